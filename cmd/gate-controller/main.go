@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// A sample controller that sets a pod readiness gate some time after the containers become ready,
+// e.g., to model a mesh sidecar that needs to be programmed before the pod can serve.
+// Run the custom kubelet with -external-gates=<condition> so that it leaves the gate to this controller.
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+)
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+type gateController struct {
+	client    client.Client
+	condition corev1.PodConditionType
+	delay     time.Duration
+}
+
+func (c *gateController) hasGate(obj client.Object) bool {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return false
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == c.condition {
+			return true
+		}
+	}
+	return false
+}
+
+func getPodCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func (c *gateController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := klog.FromContext(ctx).WithValues("pod", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	if err := c.client.Get(ctx, req.NamespacedName, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+	if gate := getPodCondition(pod, c.condition); gate != nil && gate.Status == corev1.ConditionTrue {
+		return ctrl.Result{}, nil
+	}
+	containersReady := getPodCondition(pod, corev1.ContainersReady)
+	if containersReady == nil || containersReady.Status != corev1.ConditionTrue {
+		return ctrl.Result{}, nil
+	}
+	if wait := c.delay - time.Since(containersReady.LastTransitionTime.Time); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	orig := pod.DeepCopy()
+	now := metav1.Now()
+	if gate := getPodCondition(pod, c.condition); gate != nil {
+		gate.Status = corev1.ConditionTrue
+		gate.LastTransitionTime = now
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+			Type:               c.condition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: now,
+		})
+	}
+	// optimistic lock so that a concurrent status update by the kubelet is not overwritten
+	if err := c.client.Status().Patch(ctx, pod, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	logger.V(1).Info("Readiness gate set", "condition", c.condition, "sinceContainersReady", now.Sub(containersReady.LastTransitionTime.Time))
+	return ctrl.Result{}, nil
+}
+
+func main() {
+	var condition string
+	var delayMilliseconds int
+	var workers int
+	flag.StringVar(&condition, "condition", "kubedirect.io/external-ready", "Readiness gate condition type managed by this controller")
+	flag.IntVar(&delayMilliseconds, "delay", 100, "Delay in ms after containers are ready before setting the gate")
+	flag.IntVar(&workers, "workers", 64, "Number of concurrent reconciles")
+	flag.Parse()
+
+	ctx := ctrl.SetupSignalHandler()
+	ctrl.SetLogger(klog.Background())
+	mgr := benchutil.NewManagerOrDie()
+
+	c := &gateController{
+		client:    mgr.GetClient(),
+		condition: corev1.PodConditionType(condition),
+		delay:     time.Duration(delayMilliseconds) * time.Millisecond,
+	}
+	if err := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: workers,
+		}).
+		Named("readiness_gate").
+		For(&corev1.Pod{}).
+		WithEventFilter(predicate.NewPredicateFuncs(c.hasGate)).
+		Complete(c); err != nil {
+		klog.Fatalf("Unable to create gate controller: %v", err)
+	}
+
+	klog.InfoS("Starting readiness gate controller", "condition", condition, "delay", delayMilliseconds, "workers", workers)
+	if err := mgr.Start(ctx); err != nil {
+		klog.Fatalf("Unable to run manager: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func runExport(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing export format")
+	}
+	switch args[0] {
+	case "dirigent":
+		return runExportDirigent(args[1:])
+	default:
+		return fmt.Errorf("unknown export format %q", args[0])
+	}
+}
+
+// rewrites a trace log into the CSV schema of the invitro loader, so Dirigent analysis notebooks can consume it
+func runExportDirigent(args []string) error {
+	fs := flag.NewFlagSet("export dirigent", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "o", "", "The path to the output CSV, defaults to stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect exactly one trace log, got %d", fs.NArg())
+	}
+
+	input, err := benchutil.OpenInput(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open trace log: %v", err)
+	}
+	defer input.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := csv.NewWriter(out)
+	if err := writer.Write(workload.InvitroCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %v", err)
+	}
+
+	nRecords := 0
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		record, ok := workload.ParseResponseSummary(scanner.Text())
+		if !ok {
+			continue
+		}
+		if err := writer.Write(record.InvitroRow()); err != nil {
+			return fmt.Errorf("failed to write CSV row: %v", err)
+		}
+		nRecords++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read trace log: %v", err)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records\n", nRecords)
+	return nil
+}
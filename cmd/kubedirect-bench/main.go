@@ -0,0 +1,71 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+)
+
+const usage = `Usage: kubedirect-bench <command> [args...]
+
+Commands:
+  trace stats <loader-config>    Report per-function statistics of a trace before running it
+  trace burst [flags] <dir>      Generate a fixture trace where all functions burst at the same time
+  validate-config [flags]        Check experiment configs for unknown fields and invalid combinations
+  export dirigent <trace-log>    Rewrite a trace log, plain or compressed, into the invitro CSV schema used by Dirigent analysis
+  report repeat <results-dir>    Report mean, stddev and 95% CI of each metric over the repetitions of each config
+  preflight diff [flags]         Flag asymmetries between the deployments of two baselines before comparing them
+  watch [flags]                  Follow the per-target stats of a running trace through its admin endpoint
+`
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	var err error
+	switch os.Args[1] {
+	case "trace":
+		err = runTrace(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "report":
+		err = runReport(os.Args[2:])
+	case "preflight":
+		err = runPreflight(os.Args[2:])
+	case "watch":
+		err = runWatch(os.Args[2:])
+	case "validate-config":
+		err = runValidateConfig(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s", err, usage)
+		os.Exit(1)
+	}
+}
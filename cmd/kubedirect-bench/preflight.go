@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func runPreflight(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing preflight subcommand")
+	}
+	switch args[0] {
+	case "diff":
+		return runPreflightDiff(args[1:])
+	default:
+		return fmt.Errorf("unknown preflight subcommand %q", args[0])
+	}
+}
+
+// labels that tell the baselines apart by design, stripped from the pod templates before comparing them
+const defaultIgnoredLabels = workload.RunIDLabel + ",kubedirect/managed"
+
+// asymmetries collects the differences between the two setups, a and b
+type asymmetries []string
+
+func (d *asymmetries) add(scope string, field string, a, b interface{}) {
+	*d = append(*d, fmt.Sprintf("%v: %v differs, a=%v b=%v", scope, field, a, b))
+}
+
+// compare records the field if a and b are not deeply equal
+func (d *asymmetries) compare(scope string, field string, a, b interface{}) {
+	if !reflect.DeepEqual(a, b) {
+		d.add(scope, field, a, b)
+	}
+}
+
+// compares the deployments of two baselines, e.g., -a kubedirect/run-id=r0-kd -b kubedirect/run-id=r0-k8s-plus,
+// deployments are paired by name and any asymmetry fails the command so that scripts can gate a comparison run on it
+func runPreflightDiff(args []string) error {
+	fs := flag.NewFlagSet("preflight diff", flag.ExitOnError)
+	var selectorA, selectorB, namespaceA, namespaceB, ignoredLabels string
+	fs.StringVar(&selectorA, "a", "", "The label selector of the deployments of the first setup")
+	fs.StringVar(&selectorB, "b", "", "The label selector of the deployments of the second setup")
+	fs.StringVar(&namespaceA, "namespace-a", metav1.NamespaceAll, "The namespace of the first setup, all if empty")
+	fs.StringVar(&namespaceB, "namespace-b", metav1.NamespaceAll, "The namespace of the second setup, all if empty")
+	fs.StringVar(&ignoredLabels, "ignore-labels", defaultIgnoredLabels, "Comma-separated labels allowed to differ between the setups")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if selectorA == "" || selectorB == "" {
+		return fmt.Errorf("must provide both -a and -b selectors")
+	}
+	ignored := sets.New[string]()
+	for _, label := range strings.Split(ignoredLabels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			ignored.Insert(label)
+		}
+	}
+
+	ctx := context.Background()
+	kubeClient := benchutil.NewClientsetOrDie()
+	list := func(namespace, selector string) (map[string]*appsv1.Deployment, error) {
+		if _, err := labels.Parse(selector); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		deployments, err := kubeClient.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments by %q: %v", selector, err)
+		}
+		byName := make(map[string]*appsv1.Deployment, len(deployments.Items))
+		for i := range deployments.Items {
+			byName[deployments.Items[i].Name] = &deployments.Items[i]
+		}
+		return byName, nil
+	}
+	setupA, err := list(namespaceA, selectorA)
+	if err != nil {
+		return err
+	}
+	setupB, err := list(namespaceB, selectorB)
+	if err != nil {
+		return err
+	}
+	if len(setupA) == 0 && len(setupB) == 0 {
+		return fmt.Errorf("no deployments match either selector")
+	}
+	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	var diffs asymmetries
+	names := sets.New[string]()
+	for name := range setupA {
+		names.Insert(name)
+	}
+	for name := range setupB {
+		names.Insert(name)
+	}
+	nodesA, nodesB := sets.New[string](), sets.New[string]()
+	for _, name := range sets.List(names) {
+		a, b := setupA[name], setupB[name]
+		if a == nil || b == nil {
+			diffs.add(name, "presence", a != nil, b != nil)
+			continue
+		}
+		diffs.compare(name, "replicas", replicasOf(a), replicasOf(b))
+		diffs.compare(name, "ready replicas", a.Status.ReadyReplicas, b.Status.ReadyReplicas)
+		diffTemplates(&diffs, name, &a.Spec.Template, &b.Spec.Template, ignored)
+		nodesA = nodesA.Union(eligibleNodes(nodes.Items, &a.Spec.Template.Spec))
+		nodesB = nodesB.Union(eligibleNodes(nodes.Items, &b.Spec.Template.Spec))
+	}
+	diffs.compare("cluster", "eligible nodes", sets.List(nodesA), sets.List(nodesB))
+
+	fmt.Printf("Compared %d deployments of a (%v) and %d of b (%v)\n", len(setupA), selectorA, len(setupB), selectorB)
+	for _, diff := range diffs {
+		fmt.Printf("ASYMMETRY %v\n", diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("found %d asymmetries between the setups", len(diffs))
+	}
+	fmt.Println("OK        setups are symmetric")
+	return nil
+}
+
+// an unset replica count defaults to 1
+func replicasOf(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// diffTemplates compares the containers field by field and the rest of the pod spec as a whole
+func diffTemplates(diffs *asymmetries, name string, a, b *corev1.PodTemplateSpec, ignored sets.Set[string]) {
+	strip := func(m map[string]string) map[string]string {
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			if !ignored.Has(k) {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	diffs.compare(name, "template labels", strip(a.Labels), strip(b.Labels))
+	diffs.compare(name, "template annotations", strip(a.Annotations), strip(b.Annotations))
+
+	if len(a.Spec.Containers) != len(b.Spec.Containers) {
+		diffs.add(name, "containers", len(a.Spec.Containers), len(b.Spec.Containers))
+	} else {
+		for i := range a.Spec.Containers {
+			ca, cb := &a.Spec.Containers[i], &b.Spec.Containers[i]
+			scope := fmt.Sprintf("%v/%v", name, ca.Name)
+			diffs.compare(scope, "image", ca.Image, cb.Image)
+			diffs.compare(scope, "command", ca.Command, cb.Command)
+			diffs.compare(scope, "args", ca.Args, cb.Args)
+			diffs.compare(scope, "env", formatEnv(ca.Env), formatEnv(cb.Env))
+			diffs.compare(scope, "ports", ca.Ports, cb.Ports)
+			diffs.compare(scope, "requests", formatResources(ca.Resources.Requests), formatResources(cb.Resources.Requests))
+			diffs.compare(scope, "limits", formatResources(ca.Resources.Limits), formatResources(cb.Resources.Limits))
+		}
+	}
+	diffs.compare(name, "node selector", a.Spec.NodeSelector, b.Spec.NodeSelector)
+	diffs.compare(name, "affinity", a.Spec.Affinity, b.Spec.Affinity)
+	diffs.compare(name, "tolerations", a.Spec.Tolerations, b.Spec.Tolerations)
+	restA, restB := a.Spec.DeepCopy(), b.Spec.DeepCopy()
+	for _, rest := range []*corev1.PodSpec{restA, restB} {
+		rest.Containers, rest.NodeSelector, rest.Affinity, rest.Tolerations = nil, nil, nil, nil
+	}
+	if !reflect.DeepEqual(restA, restB) {
+		*diffs = append(*diffs, fmt.Sprintf("%v: pod spec differs beyond containers and placement", name))
+	}
+}
+
+func formatEnv(env []corev1.EnvVar) string {
+	parts := make([]string, 0, len(env))
+	for _, e := range env {
+		if e.ValueFrom != nil {
+			parts = append(parts, e.Name+"=<ref>")
+			continue
+		}
+		parts = append(parts, e.Name+"="+e.Value)
+	}
+	sort.Strings(parts)
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func formatResources(resources corev1.ResourceList) string {
+	parts := make([]string, 0, len(resources))
+	for name, quantity := range resources {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, quantity.String()))
+	}
+	sort.Strings(parts)
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// eligibleNodes returns the schedulable nodes matching the node selector of the pod spec
+// whose NoSchedule and NoExecute taints the pod tolerates; node affinity is compared but not evaluated
+func eligibleNodes(nodes []corev1.Node, spec *corev1.PodSpec) sets.Set[string] {
+	eligible := sets.New[string]()
+	selector := labels.SelectorFromSet(spec.NodeSelector)
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Spec.Unschedulable || !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		tolerated := true
+		for j := range node.Spec.Taints {
+			taint := &node.Spec.Taints[j]
+			if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+				continue
+			}
+			tolerates := false
+			for k := range spec.Tolerations {
+				if spec.Tolerations[k].ToleratesTaint(taint) {
+					tolerates = true
+					break
+				}
+			}
+			if !tolerates {
+				tolerated = false
+				break
+			}
+		}
+		if tolerated {
+			eligible.Insert(node.Name)
+		}
+	}
+	return eligible
+}
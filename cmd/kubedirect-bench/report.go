@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func runReport(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing report subcommand")
+	}
+	switch args[0] {
+	case "repeat":
+		return runReportRepeat(args[1:])
+	default:
+		return fmt.Errorf("unknown report subcommand %q", args[0])
+	}
+}
+
+// repetitions are named <config>.rep<k>.log, as written by experiments/trace/repeat.sh, possibly compressed
+var repetitionPattern = regexp.MustCompile(`^(.+)\.rep(\d+)\.log(?:\.gz|\.zst)?$`)
+
+// metrics of a single repetition by name, see repeatMetrics
+type repetition map[string]float64
+
+var repeatMetrics = []string{"requests", "success %", "p50 ms", "p90 ms", "p99 ms", "overhead ms"}
+
+func summarizeRepetition(path string) (repetition, error) {
+	file, err := benchutil.OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace log: %v", err)
+	}
+	defer file.Close()
+
+	var total, succeeded int
+	var responseTimes []time.Duration
+	var overhead time.Duration
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record, ok := workload.ParseResponseSummary(scanner.Text())
+		if !ok {
+			continue
+		}
+		total++
+		if record.Status != workload.SUCCESS.String() || record.ResponseTime < 0 {
+			continue
+		}
+		succeeded++
+		responseTimes = append(responseTimes, record.ResponseTime)
+		overhead += record.ResponseTime - record.ActualRuntime
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace log %v: %v", path, err)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no responses in %v", path)
+	}
+	sort.Slice(responseTimes, func(i, j int) bool { return responseTimes[i] < responseTimes[j] })
+	percentile := func(p int) float64 {
+		if len(responseTimes) == 0 {
+			return math.NaN()
+		}
+		return float64(responseTimes[(p*(len(responseTimes)-1))/100].Microseconds()) / 1000
+	}
+	rep := repetition{
+		"requests":  float64(total),
+		"success %": 100 * float64(succeeded) / float64(total),
+		"p50 ms":    percentile(50),
+		"p90 ms":    percentile(90),
+		"p99 ms":    percentile(99),
+	}
+	rep["overhead ms"] = math.NaN()
+	if succeeded > 0 {
+		rep["overhead ms"] = float64(overhead.Microseconds()) / 1000 / float64(succeeded)
+	}
+	return rep, nil
+}
+
+// two-sided 95% quantiles of the t distribution by degrees of freedom, 1.96 beyond the table
+var tQuantile95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// meanStddevCI returns the mean, the sample stddev and the half width of the 95% confidence interval,
+// the latter two are NaN for a single sample
+func meanStddevCI(samples []float64) (mean, stddev, ci float64) {
+	n := float64(len(samples))
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= n
+	if len(samples) < 2 {
+		return mean, math.NaN(), math.NaN()
+	}
+	for _, s := range samples {
+		stddev += (s - mean) * (s - mean)
+	}
+	stddev = math.Sqrt(stddev / (n - 1))
+	t := 1.96
+	if df := len(samples) - 1; df <= len(tQuantile95) {
+		t = tQuantile95[df-1]
+	}
+	return mean, stddev, t * stddev / math.Sqrt(n)
+}
+
+// summarizes the repetitions of each config in a results dir
+func runReportRepeat(args []string) error {
+	fs := flag.NewFlagSet("report repeat", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect exactly one results dir, got %d", fs.NArg())
+	}
+
+	entries, err := os.ReadDir(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read results dir: %v", err)
+	}
+	configs := make(map[string][]repetition)
+	for _, entry := range entries {
+		m := repetitionPattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		rep, err := summarizeRepetition(filepath.Join(fs.Arg(0), entry.Name()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v: %v\n", entry.Name(), err)
+			continue
+		}
+		configs[m[1]] = append(configs[m[1]], rep)
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("no repetitions found in %v", fs.Arg(0))
+	}
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "config\tmetric\treps\tmean\tstddev\t95% CI\t")
+	format := func(v float64) string {
+		if math.IsNaN(v) {
+			return "N/A"
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	for _, name := range names {
+		reps := configs[name]
+		for _, metric := range repeatMetrics {
+			samples := make([]float64, 0, len(reps))
+			for _, rep := range reps {
+				if v := rep[metric]; !math.IsNaN(v) {
+					samples = append(samples, v)
+				}
+			}
+			if len(samples) == 0 {
+				continue
+			}
+			mean, stddev, ci := meanStddevCI(samples)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t±%s\t\n", name, metric, len(samples), format(mean), format(stddev), format(ci))
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func runTrace(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing trace subcommand")
+	}
+	switch args[0] {
+	case "stats":
+		return runTraceStats(args[1:])
+	case "burst":
+		return runTraceBurst(args[1:])
+	default:
+		return fmt.Errorf("unknown trace subcommand %q", args[0])
+	}
+}
+
+// NOTE: relative paths in the loader config are resolved against the working directory
+func runTraceStats(args []string) error {
+	fs := flag.NewFlagSet("trace stats", flag.ExitOnError)
+	var top int
+	var sortBy string
+	var runtimeFactor float64
+	var fixedRuntimeMilliSec int
+	fs.IntVar(&top, "top", 0, "Only print the top N functions, 0 means all")
+	fs.StringVar(&sortBy, "sort", "index", "Sort functions by. Options: index, invocations, rps, concurrency")
+	fs.Float64Var(&runtimeFactor, "runtime-factor", 1, "Multiply the requested runtime of every invocation by this factor, as the replay would")
+	fs.IntVar(&fixedRuntimeMilliSec, "fixed-runtime", 0, "If positive, replace the requested runtime of every invocation with this many milliseconds")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect exactly one loader config, got %d", fs.NArg())
+	}
+
+	if runtimeFactor <= 0 {
+		return fmt.Errorf("runtime factor must be positive, got %v", runtimeFactor)
+	}
+
+	specs := workload.LoadTraceFromConfig(fs.Arg(0))
+	workload.ScaleRuntimes(specs, runtimeFactor, fixedRuntimeMilliSec)
+	stats := workload.NewTraceStats(specs)
+
+	order := make([]int, len(stats.Functions))
+	for i := range order {
+		order[i] = i
+	}
+	less := map[string]func(a, b *workload.FunctionStats) bool{
+		"invocations": func(a, b *workload.FunctionStats) bool { return a.Invocations > b.Invocations },
+		"rps":         func(a, b *workload.FunctionStats) bool { return a.PeakRPS > b.PeakRPS },
+		"concurrency": func(a, b *workload.FunctionStats) bool { return a.PeakConcurrency > b.PeakConcurrency },
+	}
+	if sortBy != "index" {
+		fn, ok := less[sortBy]
+		if !ok {
+			return fmt.Errorf("unknown sort key %q", sortBy)
+		}
+		sort.SliceStable(order, func(i, j int) bool { return fn(stats.Functions[order[i]], stats.Functions[order[j]]) })
+	}
+	if top > 0 && top < len(order) {
+		order = order[:top]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "index\tinvocations\tavg rps\tpeak rps\tp50 ms\tp90 ms\tp99 ms\tmax ms\tavg conc\tpeak conc\t")
+	for _, i := range order {
+		f := stats.Functions[i]
+		fmt.Fprintf(w, "%d\t%d\t%.2f\t%d\t%d\t%d\t%d\t%d\t%.2f\t%d\t\n",
+			i, f.Invocations, f.AverageRPS, f.PeakRPS, f.RuntimeP50, f.RuntimeP90, f.RuntimeP99, f.RuntimeMax, f.AverageConcurrency, f.PeakConcurrency)
+	}
+	w.Flush()
+
+	sumPeakConcurrency := 0
+	for _, f := range stats.Functions {
+		sumPeakConcurrency += f.PeakConcurrency
+	}
+	fmt.Printf("\nFunctions: %d\n", len(stats.Functions))
+	fmt.Printf("Total invocations: %d\n", stats.TotalInvocations)
+	fmt.Printf("Peak aggregate RPS: %d\n", stats.PeakRPS)
+	fmt.Printf("Peak aggregate concurrency: %d (sum of per-function peaks: %d)\n", stats.PeakConcurrency, sumPeakConcurrency)
+	return nil
+}
+
+func runTraceBurst(args []string) error {
+	fs := flag.NewFlagSet("trace burst", flag.ExitOnError)
+	spec := &workload.BurstSpec{}
+	fs.IntVar(&spec.Functions, "functions", 200, "Number of functions, all bursting together")
+	fs.IntVar(&spec.DurationMinutes, "duration", 2, "Trace duration in minutes")
+	fs.Float64Var(&spec.AtSec, "at", 30, "When the bursts start, in seconds")
+	fs.IntVar(&spec.Size, "size", 10, "Invocations per function in its burst")
+	fs.Float64Var(&spec.SpreadSec, "spread", 1, "Seconds over which the invocations of a burst are spread")
+	fs.Float64Var(&spec.JitterSec, "jitter", 0, "Random per-function offset of the burst in seconds, 0 for synchronized bursts")
+	fs.IntVar(&spec.RuntimeMilliSec, "runtime", 1000, "Runtime of every invocation in milliseconds")
+	fs.Int64Var(&spec.Seed, "seed", 42, "Seed of the jitter")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect exactly one output dir, got %d", fs.NArg())
+	}
+	loaderPath, err := workload.WriteBurstFixture(spec, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(loaderPath)
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
+	"github.com/tomquartz/kubedirect-bench/pkg/topology"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// the flags share their names with the trace experiment, so the same arguments can be validated before a run
+func runValidateConfig(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	var autoscalerConfig, gatewayConfig, topologyConfig, loaderConfig string
+	fs.StringVar(&autoscalerConfig, "autoscaler-config", "", "The path to the autoscaler config file")
+	fs.StringVar(&gatewayConfig, "gateway-config", "", "The path to the gateway config file")
+	fs.StringVar(&topologyConfig, "topology", "", "The path to the simulated network topology config")
+	fs.StringVar(&loaderConfig, "loader-config", "", "The path to the trace loader configuration file")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	checks := []struct {
+		name     string
+		path     string
+		validate func(path string) error
+	}{
+		{"autoscaler", autoscalerConfig, func(path string) error {
+			cfg := &autoscaler.AutoscalerConfig{}
+			if err := unmarshalStrict(path, cfg); err != nil {
+				return err
+			}
+			return cfg.Validate()
+		}},
+		{"gateway", gatewayConfig, func(path string) error {
+			cfg := &gateway.GatewayConfig{}
+			if err := unmarshalStrict(path, cfg); err != nil {
+				return err
+			}
+			return cfg.Validate()
+		}},
+		{"topology", topologyConfig, func(path string) error {
+			cfg := &topology.TopologyConfig{}
+			if err := unmarshalStrict(path, cfg); err != nil {
+				return err
+			}
+			return cfg.Validate()
+		}},
+		{"loader", loaderConfig, workload.ValidateLoaderConfig},
+	}
+	nChecked, nInvalid := 0, 0
+	for _, check := range checks {
+		if check.path == "" {
+			continue
+		}
+		nChecked++
+		if err := check.validate(check.path); err != nil {
+			nInvalid++
+			fmt.Printf("INVALID %v config %v:\n  %v\n", check.name, check.path, err)
+		} else {
+			fmt.Printf("OK      %v config %v\n", check.name, check.path)
+		}
+	}
+	if nChecked == 0 {
+		return fmt.Errorf("no config to validate")
+	}
+	if nInvalid > 0 {
+		return fmt.Errorf("%d of %d configs are invalid", nInvalid, nChecked)
+	}
+	return nil
+}
+
+// unknown fields are rejected instead of being silently dropped
+func unmarshalStrict(path string, out interface{}) error {
+	configYaml, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read YAML config: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(configYaml, out); err != nil {
+		return fmt.Errorf("failed to unmarshal YAML config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
+)
+
+// follows the /watch endpoint of a running trace and prints the stats of every snapshot as it is recorded
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var addr string
+	var timeoutSeconds int
+	fs.StringVar(&addr, "addr", "localhost:8090", "The admin address of the trace, see its -admin-addr flag")
+	fs.IntVar(&timeoutSeconds, "timeout", 30, "How long each poll waits for a new snapshot")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	client := &http.Client{Timeout: time.Duration(timeoutSeconds+10) * time.Second}
+	var seq int64
+	for {
+		url := fmt.Sprintf("http://%v/watch?after=%d&timeout=%d", addr, seq, timeoutSeconds)
+		snapshots, err := pollSnapshots(client, url)
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			if seq > 0 && s.Seq > seq+1 {
+				fmt.Fprintf(os.Stderr, "Missed %d snapshots\n", s.Seq-seq-1)
+			}
+			seq = s.Seq
+			printSnapshot(s)
+		}
+	}
+}
+
+func pollSnapshots(client *http.Client, url string) ([]*gateway.Snapshot, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to poll %v: %v", url, resp.Status)
+	}
+	var snapshots []*gateway.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshots); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshots: %v", err)
+	}
+	return snapshots, nil
+}
+
+func printSnapshot(s *gateway.Snapshot) {
+	keys := make([]string, 0, len(s.Keys))
+	for key := range s.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formatInt := func(v *int) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprint(*v)
+	}
+	formatFloat := func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", *v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "#%d %v\trps\tdone/s\tlatency ms\tin-flight\tqueued\treplicas\tdesired\t\n", s.Seq, s.Time.Format(time.TimeOnly))
+	for _, key := range keys {
+		ks := s.Keys[key]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t\n", key, formatFloat(ks.RPS), formatFloat(ks.CompletedPS), formatFloat(ks.LatencyMs),
+			ks.InFlight, ks.ExternalQueue+ks.InternalQueue, formatInt(ks.Endpoints), formatInt(ks.Desired))
+	}
+	w.Flush()
+}
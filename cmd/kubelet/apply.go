@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+// field manager of the server-side applied pod status
+const kubeletFieldManager = "kubedirect-kubelet"
+
+// statusWriteStats counts the status writes that mark pods ready, to compare update, patch and apply
+type statusWriteStats struct {
+	writes    int64
+	conflicts int64
+	failures  int64
+	// total latency of successful writes in ns
+	latency int64
+}
+
+func (w *statusWriteStats) record(err error, elapsed time.Duration) {
+	switch {
+	case err == nil:
+		atomic.AddInt64(&w.writes, 1)
+		atomic.AddInt64(&w.latency, int64(elapsed))
+	case apierrors.IsConflict(err):
+		atomic.AddInt64(&w.conflicts, 1)
+	default:
+		atomic.AddInt64(&w.failures, 1)
+	}
+}
+
+// returns the successful writes and their mean latency, and the conflicting and other failed writes
+func (w *statusWriteStats) stats() (writes int64, mean time.Duration, conflicts int64, failures int64) {
+	writes = atomic.LoadInt64(&w.writes)
+	if writes > 0 {
+		mean = time.Duration(atomic.LoadInt64(&w.latency) / writes)
+	}
+	return writes, mean, atomic.LoadInt64(&w.conflicts), atomic.LoadInt64(&w.failures)
+}
+
+// the status write mode, for logging
+func (s *KubedirectServer) statusWriteMode() string {
+	switch {
+	case s.apply:
+		return "apply"
+	case s.patch:
+		return "patch"
+	default:
+		return "update"
+	}
+}
+
+// markPodReadyByApply server-side applies the status, owning its fields as the kubelet field manager.
+// Unlike update, there is no resourceVersion precondition, so it does not conflict with writers of other fields.
+func (s *KubedirectServer) markPodReadyByApply(ctx context.Context, pod *corev1.Pod, refStatus *corev1.PodStatus) (*corev1.Pod, error) {
+	logger := klog.FromContext(ctx)
+	kdLogger := kdutil.NewLogger(logger).WithHeader("Apply").WithValues("pod", klog.KObj(pod))
+	applyBytes, err := prepareApplyBytesForPodStatus(pod, *refStatus)
+	if err != nil {
+		return nil, err
+	}
+	force := true
+	start := time.Now()
+	updatedPod, err := s.GetClient(pod.Spec.NodeName).CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.ApplyPatchType, applyBytes, metav1.PatchOptions{
+		FieldManager: kubeletFieldManager,
+		Force:        &force,
+	}, "status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply status: %w", err)
+	}
+	kdLogger.Info("Pod marked ready", "elapsed", time.Since(start))
+	return updatedPod, nil
+}
+
+func prepareApplyBytesForPodStatus(pod *corev1.Pod, newPodStatus corev1.PodStatus) ([]byte, error) {
+	applyBytes, err := json.Marshal(corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID, // precondition, as in the merge patch
+		},
+		Status: newPodStatus,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to Marshal apply config for pod %q/%q: %v", pod.Namespace, pod.Name, err)
+	}
+	return applyBytes, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	kdrpc "k8s.io/kubedirect/pkg/rpc"
+	kdproto "k8s.io/kubedirect/pkg/rpc/proto"
+)
+
+// DebugState is a snapshot of the internal state of the custom kubelet
+type DebugState struct {
+	Node     string `json:"node"`
+	QueueLen int    `json:"queueLen"`
+	// in-mem pods indexed by the (possibly delegated) node they are bound to
+	InMemPods map[string][]*kdproto.PodInfo `json:"inMemPods"`
+	// namespace/name -> time until ready, negative if overdue
+	ReadyTimers map[string]string `json:"readyTimers"`
+	// namespace/name -> time since the exposure started
+	Exposing map[string]string `json:"exposing"`
+	// pods created in the api server, and those that exhausted the retry budget
+	Exposed        int64 `json:"exposed"`
+	ExposeFailures int64 `json:"exposeFailures"`
+	// template cache lookups, i.e., lister calls saved and made
+	TemplateCacheHits   int64 `json:"templateCacheHits"`
+	TemplateCacheMisses int64 `json:"templateCacheMisses"`
+	// namespaced pod List calls served by the label index and by a full scan
+	IndexedLists int64 `json:"indexedLists"`
+	ScannedLists int64 `json:"scannedLists"`
+	// status writes marking pods ready, by outcome, with the mean latency of the successful ones
+	StatusWriteMode      string `json:"statusWriteMode"`
+	StatusWrites         int64  `json:"statusWrites"`
+	StatusWriteLatency   string `json:"statusWriteLatency"`
+	StatusWriteConflicts int64  `json:"statusWriteConflicts"`
+	StatusWriteFailures  int64  `json:"statusWriteFailures"`
+}
+
+func (s *KubedirectServer) DebugState() (*DebugState, error) {
+	nodes, err := s.servedNodes()
+	if err != nil {
+		return nil, err
+	}
+	state := &DebugState{
+		Node:        s.nodeName,
+		QueueLen:    s.queue.Len(),
+		InMemPods:   make(map[string][]*kdproto.PodInfo),
+		ReadyTimers: make(map[string]string),
+		Exposing:    make(map[string]string),
+	}
+	for _, node := range nodes {
+		if pods := s.inMemCache.AsPodInfosProtoOnNode(node); len(pods) > 0 {
+			state.InMemPods[node] = pods
+		}
+	}
+	state.TemplateCacheHits, state.TemplateCacheMisses = s.templates.stats()
+	state.IndexedLists, state.ScannedLists = s.podLister.Stats()
+	state.Exposed = atomic.LoadInt64(&s.expose.exposed)
+	state.ExposeFailures = atomic.LoadInt64(&s.expose.failures)
+	var writeLatency time.Duration
+	state.StatusWriteMode = s.statusWriteMode()
+	state.StatusWrites, writeLatency, state.StatusWriteConflicts, state.StatusWriteFailures = s.statusWrites.stats()
+	state.StatusWriteLatency = writeLatency.String()
+	now := time.Now()
+	s.readyTimers.RLock()
+	for key, readyTime := range s.readyTimers.Inner() {
+		state.ReadyTimers[key] = readyTime.Sub(now).String()
+	}
+	s.readyTimers.RUnlock()
+	s.exposing.RLock()
+	for key, start := range s.exposing.Inner() {
+		state.Exposing[key] = now.Sub(start).String()
+	}
+	s.exposing.RUnlock()
+	return state, nil
+}
+
+// nodes whose kubelet service is delegated to this server, including itself
+func (s *KubedirectServer) servedNodes() ([]string, error) {
+	thisNode, err := s.nodeLister.Get(s.nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %v: %v", s.nodeName, err)
+	}
+	addr := thisNode.Annotations[kdrpc.KubeletServiceAddrAnnotation]
+	nodes, err := s.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	served := []string{s.nodeName}
+	for _, node := range nodes {
+		if node.Name != s.nodeName && addr != "" && node.Annotations[kdrpc.KubeletServiceAddrAnnotation] == addr {
+			served = append(served, node.Name)
+		}
+	}
+	return served, nil
+}
+
+func (s *KubedirectServer) debugStateHandler(w http.ResponseWriter, _ *http.Request) {
+	state, err := s.DebugState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ServeDebug exposes the internal state at /debug/state until ctx is done
+func (s *KubedirectServer) ServeDebug(ctx context.Context, addr string) error {
+	logger := klog.FromContext(ctx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/state", s.debugStateHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("Serving debug endpoint", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to serve debug endpoint: %v", err)
+	}
+	return nil
+}
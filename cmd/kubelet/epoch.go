@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// epochStore persists the epochs handshaken by each client across kubelet restarts.
+// After a restart, the in-mem state of the previous incarnation is gone, so a client still using
+// an epoch of the previous incarnation gets a well-defined stale epoch error and should re-handshake.
+// A nil store disables persistence.
+type epochStore struct {
+	path string
+	mu   sync.Mutex
+	// bumped on every restart
+	Incarnation int64 `json:"incarnation"`
+	// source -> epoch handshaken in the current incarnation
+	Epochs map[string]string `json:"epochs"`
+	// source -> epoch handshaken in the previous incarnation
+	stale map[string]string
+}
+
+func loadEpochStore(path string) (*epochStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+	e := &epochStore{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, fmt.Errorf("failed to parse epoch store %v: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read epoch store %v: %v", path, err)
+	}
+	e.stale = e.Epochs
+	e.Epochs = make(map[string]string)
+	e.Incarnation++
+	if err := e.save(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NOTE: caller must hold the lock, except during loading
+func (e *epochStore) save() error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal epoch store: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for epoch store: %v", err)
+	}
+	// write then rename so that a crash never leaves a truncated store
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write epoch store: %v", err)
+	}
+	return os.Rename(tmp, e.path)
+}
+
+func (e *epochStore) record(source, epoch string) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Epochs[source] = epoch
+	delete(e.stale, source)
+	return e.save()
+}
+
+// staleError returns a non-nil error if the epoch was handshaken with a previous incarnation of this kubelet
+func (e *epochStore) staleError(source, epoch string) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if stale, ok := e.stale[source]; ok && stale == epoch {
+		// the observed epoch and its incarnation first, then the local incarnation it is checked against
+		return fmt.Errorf("stale epoch %s of %s handshaken with incarnation %d, local incarnation is %d", epoch, source, e.Incarnation-1, e.Incarnation)
+	}
+	return nil
+}
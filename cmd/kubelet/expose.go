@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+const (
+	defaultExposeWorkers = 16
+	defaultExposeRetries = 10
+	exposeStatsPeriod    = 5 * time.Second
+)
+
+// exposePool creates in-mem pods in the api server with a bounded number of workers,
+// instead of a polling goroutine per pod
+type exposePool struct {
+	queue   workqueue.TypedRateLimitingInterface[PendingPod]
+	pods    *kdutil.SharedMap[*corev1.Pod]
+	workers int
+	// retry budget per pod, after which the pod is handed back to SyncPod
+	retries  int
+	exposed  int64
+	retried  int64
+	failures int64
+}
+
+func newExposePool(workers, retries int) *exposePool {
+	return &exposePool{
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[PendingPod](10*time.Millisecond, time.Second),
+			workqueue.TypedRateLimitingQueueConfig[PendingPod]{Name: "custom_kubelet_expose"},
+		),
+		pods:    kdutil.NewSharedMap[*corev1.Pod](),
+		workers: workers,
+		retries: retries,
+	}
+}
+
+func (s *KubedirectServer) WithExposePool(workers, retries int) *KubedirectServer {
+	if workers <= 0 {
+		workers = defaultExposeWorkers
+	}
+	s.expose.ShutDown()
+	s.expose = newExposePool(workers, retries)
+	return s
+}
+
+func (p *exposePool) ShutDown() {
+	p.queue.ShutDown()
+}
+
+func (s *KubedirectServer) enqueueExpose(pod *corev1.Pod) {
+	pending := NewPendingPodFromAPIServer(pod)
+	s.expose.pods.Set(pending.String(), pod)
+	s.exposing.Set(pending.String(), time.Now())
+	s.expose.queue.Add(pending)
+}
+
+func (s *KubedirectServer) processNextExpose(ctx context.Context) bool {
+	p := s.expose
+	pending, shutdown := p.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer p.queue.Done(pending)
+
+	key := pending.String()
+	pod, ok := p.pods.Get(key)
+	if !ok {
+		p.queue.Forget(pending)
+		return true
+	}
+	err := s.exposeManagedPod(ctx, pod)
+	if err == nil {
+		atomic.AddInt64(&p.exposed, 1)
+		p.queue.Forget(pending)
+		p.pods.Del(key)
+		s.exposing.Del(key)
+		return true
+	}
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("Expose").WithValues("pod", key)
+	if p.queue.NumRequeues(pending) < p.retries {
+		atomic.AddInt64(&p.retried, 1)
+		kdLogger.V(1).WARN("Failed to expose pod, will retry", "error", err)
+		p.queue.AddRateLimited(pending)
+		return true
+	}
+	// out of budget, let SyncPod start over with a fresh ready timer
+	atomic.AddInt64(&p.failures, 1)
+	kdLogger.Error(err, "Failed to expose pod, retry budget exhausted")
+	p.queue.Forget(pending)
+	p.pods.Del(key)
+	s.exposing.Del(key)
+	s.readyTimers.Del(key)
+	s.queue.AddRateLimited(pending)
+	return true
+}
+
+func (s *KubedirectServer) exposeWorkerLoop(ctx context.Context) {
+	for s.processNextExpose(ctx) {
+	}
+}
+
+func (s *KubedirectServer) exposeStatsLoop(ctx context.Context) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("Expose")
+	var last int64
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		exposed := atomic.LoadInt64(&s.expose.exposed)
+		if exposed == last {
+			return
+		}
+		rate := float64(exposed-last) / exposeStatsPeriod.Seconds()
+		last = exposed
+		kdLogger.Info("Expose stats", "exposed", exposed, "rate", rate, "pending", s.expose.queue.Len(),
+			"retried", atomic.LoadInt64(&s.expose.retried), "failures", atomic.LoadInt64(&s.expose.failures))
+	}, exposeStatsPeriod)
+}
+
+func (s *KubedirectServer) startExposeWorkers(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.expose.ShutDown()
+	}()
+	for i := 0; i < s.expose.workers; i++ {
+		go wait.UntilWithContext(ctx, s.exposeWorkerLoop, time.Second)
+	}
+	go s.exposeStatsLoop(ctx)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	kdrpc "k8s.io/kubedirect/pkg/rpc"
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+const (
+	kubeletLeaseNamespace = corev1.NamespaceNodeLease
+	// NOTE: the default kubelet owns the lease named after the node
+	kubeletLeasePrefix = "kd-kubelet-"
+	// take over any node whose custom kubelet lease expires
+	FailoverAllNodes = "*"
+)
+
+func kubeletLeaseName(node string) string {
+	return kubeletLeasePrefix + node
+}
+
+// takeoverState tracks the nodes being taken over, so that each transition is logged once
+type takeoverState struct {
+	// nodes whose lease was seen expired and not yet taken over,
+	// NOTE: only accessed by the failover loop
+	expired map[string]bool
+	mu      sync.Mutex
+	// node -> the takeover still waiting for its pods to get ready, removed once all are ready
+	pending map[string]*takeover
+}
+
+type takeover struct {
+	at time.Time
+	// namespace/name of the pods not ready at takeover
+	pods map[string]bool
+}
+
+func newTakeoverState() *takeoverState {
+	return &takeoverState{expired: make(map[string]bool), pending: make(map[string]*takeover)}
+}
+
+func (t *takeoverState) start(node string, at time.Time, pods map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(pods) == 0 {
+		delete(t.pending, node)
+		return
+	}
+	t.pending[node] = &takeover{at: at, pods: pods}
+}
+
+// ready removes a pod from the takeover of its node,
+// returns the time of the takeover if it was pending, and whether it completed with it
+func (t *takeoverState) ready(pod *corev1.Pod) (time.Time, bool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tk, ok := t.pending[pod.Spec.NodeName]
+	key := pod.Namespace + "/" + pod.Name
+	if !ok || !tk.pods[key] {
+		return time.Time{}, false, false
+	}
+	delete(tk.pods, key)
+	if len(tk.pods) > 0 {
+		return tk.at, true, false
+	}
+	delete(t.pending, pod.Spec.NodeName)
+	return tk.at, true, true
+}
+
+// WithFailover enables leases on the served nodes, and lets this kubelet take over the given nodes
+// once the lease of their custom kubelet expires
+func (s *KubedirectServer) WithFailover(leaseDuration time.Duration, nodes ...string) *KubedirectServer {
+	s.leaseDuration = leaseDuration
+	s.failoverNodes = make(map[string]bool)
+	for _, node := range nodes {
+		s.failoverNodes[node] = true
+	}
+	return s
+}
+
+func (s *KubedirectServer) shouldFailover(node string) bool {
+	return node != s.nodeName && (s.failoverNodes[FailoverAllNodes] || s.failoverNodes[node])
+}
+
+func (s *KubedirectServer) failoverLoop(ctx context.Context) {
+	if s.leaseDuration <= 0 {
+		return
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		s.renewLeases(ctx)
+		s.checkFailover(ctx)
+	}, s.leaseDuration/3)
+}
+
+func (s *KubedirectServer) renewLeases(ctx context.Context) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("Lease")
+	nodes, err := s.servedNodes()
+	if err != nil {
+		kdLogger.Error(err, "Failed to list served nodes")
+		return
+	}
+	for _, node := range nodes {
+		if err := s.renewLease(ctx, node); err != nil {
+			kdLogger.Error(err, "Failed to renew lease", "node", node)
+		}
+	}
+}
+
+func (s *KubedirectServer) renewLease(ctx context.Context, node string) error {
+	leases := s.initClient.CoordinationV1().Leases(kubeletLeaseNamespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(s.leaseDuration.Seconds())
+	lease, err := leases.Get(ctx, kubeletLeaseName(node), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: kubeletLeaseName(node), Namespace: kubeletLeaseNamespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.serviceAddr,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != s.serviceAddr {
+		lease.Spec.HolderIdentity = &s.serviceAddr
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *KubedirectServer) checkFailover(ctx context.Context) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("Failover")
+	nodes, err := s.nodeLister.List(labels.Everything())
+	if err != nil {
+		kdLogger.Error(err, "Failed to list nodes")
+		return
+	}
+	for _, node := range nodes {
+		addr := node.Annotations[kdrpc.KubeletServiceAddrAnnotation]
+		if !s.shouldFailover(node.Name) || addr == "" || addr == s.serviceAddr {
+			continue
+		}
+		lease, err := s.initClient.CoordinationV1().Leases(kubeletLeaseNamespace).Get(ctx, kubeletLeaseName(node.Name), metav1.GetOptions{})
+		if err != nil {
+			// the other kubelet may not have enabled leases
+			kdLogger.V(2).DEBUG("Failed to get lease", "node", node.Name, "error", err)
+			continue
+		}
+		if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		expired := s.takeoverState.expired
+		if time.Now().Before(expiry) {
+			if expired[node.Name] {
+				kdLogger.Info("Lease renewed before takeover", "node", node.Name)
+				delete(expired, node.Name)
+			}
+			continue
+		}
+		// log once per expiry, the takeover is retried on every tick until it succeeds or the lease is renewed
+		first := !expired[node.Name]
+		if first {
+			kdLogger.Info("Lease expired, taking over", "node", node.Name, "expiredFor", time.Since(expiry))
+			expired[node.Name] = true
+		}
+		done, err := s.takeOver(ctx, node, addr, lease.Spec.RenewTime.Time)
+		if err != nil && first {
+			kdLogger.Error(err, "Failed to take over node, will retry", "node", node.Name)
+		} else if err != nil {
+			kdLogger.V(2).DEBUG("Failed to take over node", "node", node.Name, "error", err)
+		}
+		if done {
+			delete(expired, node.Name)
+		}
+	}
+}
+
+// takeOver re-publishes the kubelet service address of the node to this kubelet,
+// and resyncs all custom-managed pods bound to the node.
+// Returns true once the node is published to this kubelet, or another standby kubelet won the race
+func (s *KubedirectServer) takeOver(ctx context.Context, node *corev1.Node, oldAddr string, lastRenew time.Time) (bool, error) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("Failover").WithValues("node", node.Name)
+	node = node.DeepCopy()
+	node.Annotations[kdrpc.KubeletServiceAddrAnnotation] = s.serviceAddr
+	// NOTE: the resource version guarantees a single winner among standby kubelets
+	if _, err := s.initClient.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			kdLogger.V(1).Info("Lost takeover race")
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to re-publish kubelet service address: %v", err)
+	}
+	now := time.Now()
+	s.clientPool.GetOrCreate(node.Name, func() clientset.Interface {
+		return benchutil.NewClientsetOrDie()
+	})
+	if err := s.renewLease(ctx, node.Name); err != nil {
+		kdLogger.Error(err, "Failed to acquire lease")
+	}
+
+	pods, err := s.podLister.List(labels.Everything())
+	if err != nil {
+		return true, fmt.Errorf("failed to list pods: %v", err)
+	}
+	pending := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.Spec.NodeName != node.Name || !s.enqueueFilter(pod) {
+			continue
+		}
+		if !kdutil.IsPodReady(pod) {
+			pending[pod.Namespace+"/"+pod.Name] = true
+		}
+		s.queue.Add(NewPendingPodFromAPIServer(pod))
+	}
+	s.takeoverState.start(node.Name, now, pending)
+	kdLogger.Info("Took over node", "from", oldAddr, "leaseExpiredFor", now.Sub(lastRenew)-s.leaseDuration, "sinceLastRenew", now.Sub(lastRenew), "pending", len(pending))
+	return true, nil
+}
+
+// logs the pod-ready disruption of pods pending on nodes taken over by this kubelet
+func (s *KubedirectServer) observeFailoverReady(kdLogger *kdutil.Logger, pod *corev1.Pod) {
+	at, ok, completed := s.takeoverState.ready(pod)
+	if !ok {
+		return
+	}
+	kdLogger.Info("Pod ready after failover", "node", pod.Spec.NodeName, "sinceTakeover", time.Since(at))
+	if completed {
+		kdLogger.Info("Failover completed, all pending pods are ready", "node", pod.Spec.NodeName, "sinceTakeover", time.Since(at))
+	}
+}
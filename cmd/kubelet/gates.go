@@ -0,0 +1,65 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const ReadinessGatesNotReadyReason = "ReadinessGatesNotReady"
+
+func (s *KubedirectServer) isExternalGate(conditionType corev1.PodConditionType) bool {
+	return s.externalGates[conditionType]
+}
+
+func getPodCondition(status *corev1.PodStatus, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func isConditionTrue(status *corev1.PodStatus, conditionType corev1.PodConditionType) bool {
+	cond := getPodCondition(status, conditionType)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+// externalGatesSatisfied returns true if all external readiness gates of the pod are set to true
+func (s *KubedirectServer) externalGatesSatisfied(pod *corev1.Pod) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if s.isExternalGate(gate.ConditionType) && !isConditionTrue(&pod.Status, gate.ConditionType) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyExternalGates leaves the conditions of external readiness gates as currently set on the pod,
+// and only reports the pod ready if all of them are true, like the default kubelet does.
+// NOTE: the status is sent as a whole, so the current conditions must be carried over
+func (s *KubedirectServer) applyExternalGates(pod *corev1.Pod, refStatus *corev1.PodStatus) {
+	if len(s.externalGates) == 0 || len(pod.Spec.ReadinessGates) == 0 {
+		return
+	}
+	conditions := make([]corev1.PodCondition, 0, len(refStatus.Conditions))
+	for _, cond := range refStatus.Conditions {
+		if !s.isExternalGate(cond.Type) {
+			conditions = append(conditions, cond)
+		}
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if !s.isExternalGate(gate.ConditionType) {
+			continue
+		}
+		if cond := getPodCondition(&pod.Status, gate.ConditionType); cond != nil {
+			conditions = append(conditions, *cond)
+		}
+	}
+	refStatus.Conditions = conditions
+	if !s.externalGatesSatisfied(pod) {
+		if ready := getPodCondition(refStatus, corev1.PodReady); ready != nil {
+			ready.Status = corev1.ConditionFalse
+			ready.Reason = ReadinessGatesNotReadyReason
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+// gcOrphanedPods drops in-mem pods whose template pod (and thus owner) has disappeared after BindPod
+// but before exposure. Such entries would otherwise linger forever because no informer event flushes them.
+// To tolerate informer lag, an entry is only dropped if it is found orphaned in two consecutive rounds.
+func (s *KubedirectServer) gcOrphanedPods(ctx context.Context) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader("GC")
+	nodes, err := s.servedNodes()
+	if err != nil {
+		kdLogger.Error(err, "Failed to list served nodes")
+		return
+	}
+	suspects := make(map[string]bool)
+	for _, node := range nodes {
+		for _, info := range s.inMemCache.AsPodInfosProtoOnNode(node) {
+			_, err := s.getTemplateFor(ctx, info.Owner.Namespace, info.Owner.Name, false)
+			if err == nil {
+				continue
+			} else if !apierrors.IsNotFound(err) {
+				kdLogger.V(1).WARN("Failed to get template pod", "pod", info.Name, "error", err)
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", info.Owner.Namespace, info.Name)
+			suspects[key] = true
+			if !s.gcSuspects[key] {
+				continue
+			}
+			if podInfo, _ := s.inMemCache.Del(info.Name); podInfo != nil {
+				s.readyTimers.Del(key)
+				s.nOrphaned++
+				kdLogger.Info("Dropped orphaned in-mem pod", "pod", key, "owner", info.Owner.Name, "total", s.nOrphaned)
+			}
+		}
+	}
+	s.gcSuspects = suspects
+}
+
+func (s *KubedirectServer) gcLoop(ctx context.Context) {
+	if s.gcInterval <= 0 {
+		return
+	}
+	wait.UntilWithContext(ctx, s.gcOrphanedPods, s.gcInterval)
+}
@@ -12,7 +12,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 
@@ -56,6 +55,9 @@ func (s *KubedirectServer) Handshake(ctx context.Context, req *kdproto.Handshake
 	})
 	holder := s.serverHub.Lock(req.Source, req.Epoch)
 	defer holder.Unlock()
+	if err := s.epochs.record(req.Source, req.Epoch); err != nil {
+		kdLogger.Error(err, "Failed to persist epoch")
+	}
 	msg := &kdproto.KubeletHandshakeResponse{
 		Epoch: req.Epoch,
 		Name:  req.Destination,
@@ -68,7 +70,7 @@ func (s *KubedirectServer) Handshake(ctx context.Context, req *kdproto.Handshake
 func (s *KubedirectServer) BindPod(ctx context.Context, req *kdproto.PodBindingRequest) (*emptypb.Empty, error) {
 	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader(req.Source + "->BindPod")
 	// get unnamed pod template
-	_, err := kdutil.GetUnnamedTemplateFor(ctx, s.podLister, req.PodInfo.Owner.Namespace, req.PodInfo.Owner.Name, false)
+	_, err := s.getTemplateFor(ctx, req.PodInfo.Owner.Namespace, req.PodInfo.Owner.Name, false)
 	// err is probably due to:
 	// 1. the template pod was deleted, which means the rs is also deleted
 	// 2. the template pod is not yet added to the informer cache
@@ -82,6 +84,9 @@ func (s *KubedirectServer) BindPod(ctx context.Context, req *kdproto.PodBindingR
 	// acquire shared lock on epoch
 	holder, err := s.serverHub.RLock(req.Source, req.Epoch)
 	if err != nil {
+		if staleErr := s.epochs.staleError(req.Source, req.Epoch); staleErr != nil {
+			err = staleErr
+		}
 		return nil, grpcstatus.Errorf(grpccodes.InvalidArgument, "%s: %v", kdrpc.EpochMismatchError, err)
 	}
 	defer holder.RUnlock()
@@ -100,27 +105,30 @@ func (s *KubedirectServer) BindPod(ctx context.Context, req *kdproto.PodBindingR
 	return &emptypb.Empty{}, nil
 }
 
-func (s *KubedirectServer) ExposeManagedPod(ctx context.Context, pod *corev1.Pod) {
+// exposeManagedPod makes a single attempt to create the in-mem pod in the api server
+func (s *KubedirectServer) exposeManagedPod(ctx context.Context, pod *corev1.Pod) error {
 	logger := klog.FromContext(ctx)
 	kdLogger := kdutil.NewLogger(logger).WithHeader("Expose").WithValues("pod", klog.KObj(pod))
 	if pod.ResourceVersion != "" {
 		kdLogger.WARN("Pod with resource version should not be exposed again")
-		return
+		return nil
 	}
 	start := time.Now()
-	tryCreate := func(ctx context.Context) (bool, error) {
-		_, err := s.GetClient(pod.Spec.NodeName).CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
-		if err == nil {
-			kdLogger.Info("Pod exposed", "elapsed", time.Since(start))
-			return true, nil
-		} else if apierrors.IsAlreadyExists(err) {
-			kdLogger.V(2).WARN("Pod already exposed")
-			return true, nil
-		}
-		kdLogger.Error(err, "Failed to expose pod")
-		return false, nil
+	// stamp a copy, the pod is shared with the in-mem cache
+	pod = pod.DeepCopy()
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
 	}
-	wait.PollUntilContextCancel(ctx, time.Second, true, tryCreate)
+	pod.Annotations[benchutil.ExposeStartAnnotation] = start.Format(time.RFC3339Nano)
+	_, err := s.GetClient(pod.Spec.NodeName).CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err == nil {
+		kdLogger.Info("Pod exposed", "elapsed", time.Since(start))
+		return nil
+	} else if apierrors.IsAlreadyExists(err) {
+		kdLogger.V(2).WARN("Pod already exposed")
+		return nil
+	}
+	return err
 }
 
 func (s *KubedirectServer) getRefPodStatus(pod *corev1.Pod) (*corev1.PodStatus, error) {
@@ -238,7 +246,12 @@ func tweakRefPodStatus(refStatus *corev1.PodStatus) {
 	}
 }
 
-func (s *KubedirectServer) markPodReady(ctx context.Context, pod *corev1.Pod, refStatus *corev1.PodStatus) (*corev1.Pod, error) {
+func (s *KubedirectServer) markPodReady(ctx context.Context, pod *corev1.Pod, refStatus *corev1.PodStatus) (updatedPod *corev1.Pod, err error) {
+	start := time.Now()
+	defer func() { s.statusWrites.record(err, time.Since(start)) }()
+	if s.apply {
+		return s.markPodReadyByApply(ctx, pod, refStatus)
+	}
 	if s.patch {
 		return s.markPodReadyByPatch(ctx, pod, refStatus)
 	}
@@ -252,7 +265,7 @@ func (s *KubedirectServer) markPodReadyByUpdate(ctx context.Context, pod *corev1
 	start := time.Now()
 	updatedPod, err := s.GetClient(pod.Spec.NodeName).CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update status: %v", err)
+		return nil, fmt.Errorf("failed to update status: %w", err)
 	}
 	kdLogger.Info("Pod marked ready", "elapsed", time.Since(start))
 	return updatedPod, nil
@@ -268,7 +281,7 @@ func (s *KubedirectServer) markPodReadyByPatch(ctx context.Context, pod *corev1.
 	start := time.Now()
 	updatedPod, err := s.GetClient(pod.Spec.NodeName).CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
 	if err != nil {
-		return nil, fmt.Errorf("failed to patch status %q: %v", patchBytes, err)
+		return nil, fmt.Errorf("failed to patch status %q: %w", patchBytes, err)
 	}
 	kdLogger.Info("Pod marked ready", "elapsed", time.Since(start))
 	return updatedPod, nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,6 +20,8 @@ import (
 	"k8s.io/klog/v2"
 
 	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/topology"
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
 	kdctx "k8s.io/kubedirect/pkg/context"
 	kdrpc "k8s.io/kubedirect/pkg/rpc"
 	kdproto "k8s.io/kubedirect/pkg/rpc/proto"
@@ -28,7 +31,7 @@ import (
 const (
 	CustomKubeletServicePort  = ":25010"
 	PodLifecycleManagerCustom = "custom"
-	nWorkers                  = 64
+	defaultWorkers            = 64
 	WorkloadPoolLabel         = "kubedirect/workload-pool"
 )
 
@@ -65,10 +68,12 @@ type KubedirectServer struct {
 	factory    informers.SharedInformerFactory
 	// for listing template/managed pods in rpc handlers
 	nodeLister corelisters.NodeLister
-	podLister  corelisters.PodLister
+	podLister  *benchutil.IndexedPodLister
 	// pod queue
 	// NOTE: for the queue to deduplicate, we should pass the struct by value
 	queue workqueue.TypedRateLimitingInterface[PendingPod]
+	// number of workers draining the queue
+	nWorkers int
 	// in-mem pod cache
 	// NOTE: unlike the default kubelet, the custom kubelet support kubelet service delegation
 	// so multiple nodes can map to a single custom kubelet
@@ -81,10 +86,35 @@ type KubedirectServer struct {
 	// this timer map also handle k8s-originated pods with possibly duplicate names modulo namespaces
 	// so we index with namespace/name
 	readyTimers *kdutil.SharedMap[time.Time]
+	// in-mem pods being exposed to the api server, indexed by namespace/name
+	exposing *kdutil.SharedMap[time.Time]
+	expose   *exposePool
 	// whether to bind to real containers. if false, just simulate ready delay
 	simulate bool
+	// simulated network delays, only consulted in simulate mode
+	topology *topology.Topology
 	// use patch or update to mark pod ready
 	patch bool
+	// use server-side apply to mark pod ready, takes precedence over patch
+	apply        bool
+	statusWrites statusWriteStats
+	// epochs persisted across restarts, nil if disabled
+	epochs *epochStore
+	// address of the kubelet service, published on the node annotation
+	serviceAddr string
+	// failover of other custom kubelets, disabled if leaseDuration is non-positive
+	leaseDuration time.Duration
+	failoverNodes map[string]bool
+	takeoverState *takeoverState
+	// resolved template pods, nil if disabled
+	templates *templateCache
+	// readiness gates whose conditions are set by an external controller
+	externalGates map[corev1.PodConditionType]bool
+	// period of orphaned in-mem pod GC, disabled if non-positive
+	// NOTE: the following fields are only accessed by the GC loop
+	gcInterval time.Duration
+	gcSuspects map[string]bool
+	nOrphaned  int
 }
 
 func NewKubedirectServer(c clientset.Interface, nodeName string) *KubedirectServer {
@@ -94,22 +124,31 @@ func NewKubedirectServer(c clientset.Interface, nodeName string) *KubedirectServ
 
 	factory := informers.NewSharedInformerFactory(c, 0)
 	kdServer := &KubedirectServer{
-		kdLogger:   kdLogger,
-		initClient: c,
-		clientPool: kdutil.NewSharedMap[clientset.Interface](),
-		factory:    factory,
-		nodeLister: factory.Core().V1().Nodes().Lister(),
-		podLister:  factory.Core().V1().Pods().Lister(),
-		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
-			workqueue.DefaultTypedControllerRateLimiter[PendingPod](),
-			workqueue.TypedRateLimitingQueueConfig[PendingPod]{Name: "custom_kubelet"},
-		),
-		nodeName:    nodeName,
-		inMemCache:  kdctx.NewPodInfoCache(),
-		readyTimers: kdutil.NewSharedMap[time.Time](),
+		kdLogger:      kdLogger,
+		initClient:    c,
+		clientPool:    kdutil.NewSharedMap[clientset.Interface](),
+		factory:       factory,
+		nodeLister:    factory.Core().V1().Nodes().Lister(),
+		queue:         newPendingPodQueue(workqueue.DefaultTypedControllerRateLimiter[PendingPod]()),
+		nWorkers:      defaultWorkers,
+		nodeName:      nodeName,
+		inMemCache:    kdctx.NewPodInfoCache(),
+		readyTimers:   kdutil.NewSharedMap[time.Time](),
+		exposing:      kdutil.NewSharedMap[time.Time](),
+		expose:        newExposePool(defaultExposeWorkers, defaultExposeRetries),
+		takeoverState: newTakeoverState(),
 	}
 	kdServer.serverHub = kdrpc.NewServerHub(kdServer)
 
+	// index pods by owner and workload pool, so that template and reference pod lookups
+	// do not scan the whole namespace
+	podInformer := factory.Core().V1().Pods().Informer()
+	if err := podInformer.AddIndexers(benchutil.PodLabelIndexers(kdutil.OwnerNameLabel, WorkloadPoolLabel)); err != nil {
+		kdLogger.Error(err, "Failed to add pod indexers")
+		return nil
+	}
+	kdServer.podLister = benchutil.NewIndexedPodLister(podInformer.GetIndexer(), kdutil.OwnerNameLabel, WorkloadPoolLabel)
+
 	if _, err := factory.Core().V1().Pods().Informer().AddEventHandler(cache.FilteringResourceEventHandler{
 		FilterFunc: func(obj interface{}) bool {
 			switch t := obj.(type) {
@@ -165,11 +204,84 @@ func NewKubedirectServer(c clientset.Interface, nodeName string) *KubedirectServ
 	return kdServer
 }
 
+func newPendingPodQueue(rateLimiter workqueue.TypedRateLimiter[PendingPod]) workqueue.TypedRateLimitingInterface[PendingPod] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(
+		rateLimiter,
+		workqueue.TypedRateLimitingQueueConfig[PendingPod]{Name: "custom_kubelet"},
+	)
+}
+
+// NOTE: must be called before ListenAndServe
+func (s *KubedirectServer) WithWorkers(n int) *KubedirectServer {
+	if n > 0 {
+		s.nWorkers = n
+	}
+	return s
+}
+
+// WithRateLimiter replaces the default controller rate limiter of the queue,
+// i.e., per-item exponential backoff from baseDelay to maxDelay, bounded by an overall token bucket of qps and burst.
+// NOTE: must be called before ListenAndServe
+func (s *KubedirectServer) WithRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) *KubedirectServer {
+	s.queue.ShutDown()
+	s.queue = newPendingPodQueue(workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[PendingPod](baseDelay, maxDelay),
+		&workqueue.TypedBucketRateLimiter[PendingPod]{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	))
+	return s
+}
+
 func (s *KubedirectServer) WithReadyDelay(delay time.Duration) *KubedirectServer {
 	s.readyDelay = delay
 	return s
 }
 
+func (s *KubedirectServer) WithTopology(t *topology.Topology) *KubedirectServer {
+	s.topology = t
+	return s
+}
+
+// the ready status travels from the node of the pod to the control plane
+func (s *KubedirectServer) readyDelayFor(pod *corev1.Pod) time.Duration {
+	if !s.simulate {
+		return s.readyDelay
+	}
+	return s.readyDelay + s.topology.ControlPlaneRTT(pod.Spec.NodeName)/2
+}
+
+func (s *KubedirectServer) WithGCInterval(interval time.Duration) *KubedirectServer {
+	s.gcInterval = interval
+	return s
+}
+
+func (s *KubedirectServer) WithExternalGates(conditionTypes ...string) *KubedirectServer {
+	s.externalGates = make(map[corev1.PodConditionType]bool)
+	for _, t := range conditionTypes {
+		s.externalGates[corev1.PodConditionType(t)] = true
+	}
+	return s
+}
+
+// WithEpochStore persists handshaken epochs at path, so that clients of a previous incarnation get a stale epoch error
+func (s *KubedirectServer) WithEpochStore(path string) (*KubedirectServer, error) {
+	epochs, err := loadEpochStore(path)
+	if err != nil {
+		return nil, err
+	}
+	s.epochs = epochs
+	return s, nil
+}
+
+// WithTemplateCache caches resolved template pods instead of listing them on every sync
+func (s *KubedirectServer) WithTemplateCache() *KubedirectServer {
+	s.templates = newTemplateCache()
+	if err := s.addTemplateEventHandler(); err != nil {
+		s.kdLogger.Error(err, "Failed to add template pod event handlers, template cache disabled")
+		s.templates = nil
+	}
+	return s
+}
+
 func (s *KubedirectServer) Simulate() {
 	s.simulate = true
 }
@@ -178,6 +290,10 @@ func (s *KubedirectServer) UsePatch() {
 	s.patch = true
 }
 
+func (s *KubedirectServer) UseApply() {
+	s.apply = true
+}
+
 // the managed label is not required because this server also handles k8s-originated pods
 // NOTE: we cannot directly filter on spec.NodeName because there can be kubelet service delegation
 func (s *KubedirectServer) enqueueFilter(pod *corev1.Pod) bool {
@@ -242,7 +358,7 @@ func (s *KubedirectServer) SyncPod(ctx context.Context, pending PendingPod) erro
 			return nil
 		}
 		// get unnamed pod template
-		template, err := kdutil.GetUnnamedTemplateFor(ctx, s.podLister, podInfo.Namespace, podInfo.OwnerName, true)
+		template, err := s.getTemplateFor(ctx, podInfo.Namespace, podInfo.OwnerName, true)
 		if apierrors.IsNotFound(err) {
 			kdLogger.WARN("Template pod not found for in-mem pod, will ignore")
 			return nil
@@ -295,11 +411,11 @@ func (s *KubedirectServer) SyncPod(ctx context.Context, pending PendingPod) erro
 
 	// check ready delay
 	readyTime, fresh := s.readyTimers.GetOrCreate(pending.String(), func() time.Time {
-		return time.Now().Add(s.readyDelay)
+		return time.Now().Add(s.readyDelayFor(pod))
 	})
 	// expose in-mem pod if fresh
 	if fresh && isInMem {
-		go s.ExposeManagedPod(ctx, pod)
+		s.enqueueExpose(pod)
 	}
 	if waitTime := time.Until(readyTime); waitTime > 0 {
 		kdLogger.V(1).DEBUG(fmt.Sprintf("Wait %.2fms til ready", waitTime.Seconds()*1e3))
@@ -315,6 +431,13 @@ func (s *KubedirectServer) SyncPod(ctx context.Context, pending PendingPod) erro
 		return nil
 	}
 
+	// containers are already marked ready, wait for the external controller to set the readiness gates
+	// the informer will requeue the pod once the gates are updated
+	if isConditionTrue(&pod.Status, corev1.ContainersReady) && !s.externalGatesSatisfied(pod) {
+		kdLogger.V(2).DEBUG("Waiting for external readiness gates")
+		return nil
+	}
+
 	// get reference pod status
 	var refStatus *corev1.PodStatus
 	if s.simulate {
@@ -328,11 +451,14 @@ func (s *KubedirectServer) SyncPod(ctx context.Context, pending PendingPod) erro
 		}
 	}
 
+	s.applyExternalGates(pod, refStatus)
+
 	if _, err := s.markPodReady(ctx, pod, refStatus); err != nil {
 		kdLogger.Error(err, "Failed to mark pod as ready")
 		// notfound/conflict errs would be handled after requeue
 		return err
 	}
+	s.observeFailoverReady(kdLogger, pod)
 	// readyTimers would be removed once the updated status triggers the informer event handler
 	return nil
 }
@@ -393,7 +519,8 @@ func (s *KubedirectServer) ListenAndServe(ctx context.Context) error {
 		if node.Annotations == nil {
 			node.Annotations = make(map[string]string)
 		}
-		node.Annotations[kdrpc.KubeletServiceAddrAnnotation] = hostIP + CustomKubeletServicePort
+		s.serviceAddr = hostIP + CustomKubeletServicePort
+		node.Annotations[kdrpc.KubeletServiceAddrAnnotation] = s.serviceAddr
 		if _, err := s.initClient.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
 			kdLogger.Error(err, fmt.Sprintf("Failed to update node %v", s.nodeName))
 			return false, nil
@@ -405,9 +532,19 @@ func (s *KubedirectServer) ListenAndServe(ctx context.Context) error {
 		return fmt.Errorf("failed to publish custom kubelet service address: %v", err)
 	}
 
-	for i := 0; i < nWorkers; i++ {
+	for i := 0; i < s.nWorkers; i++ {
 		go wait.UntilWithContext(ctx, s.workerLoop, time.Second)
 	}
+	s.startExposeWorkers(ctx)
+	go s.gcLoop(ctx)
+	go s.failoverLoop(ctx)
+
+	if s.templates != nil {
+		defer func() {
+			hits, misses := s.templates.stats()
+			kdLogger.Info("Template cache stats", "hits", hits, "misses", misses)
+		}()
+	}
 
 	return s.serverHub.ListenAndServe(ctx, CustomKubeletServicePort)
 }
@@ -19,12 +19,14 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/topology"
 	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
 )
 
@@ -36,12 +38,48 @@ func main() {
 	var node string
 	var simulate bool
 	var patch bool
+	var apply bool
 	var readyDelayMilliseconds int
+	var topologyConfig string
+	var debugAddr string
+	var gcIntervalSeconds int
+	var workers int
+	var baseBackoffMilliseconds int
+	var maxBackoffSeconds int
+	var qps float64
+	var burst int
+	var externalGates string
+	var leaseDurationSeconds int
+	var failoverFor string
+	var epochFile string
+	var cacheTemplates bool
+	var exposeWorkers int
+	var exposeRetries int
+	var usageIntervalSeconds int
+	var usageOutput string
 
 	flag.StringVar(&node, "node", "", "Node name this kubelet binds to. Default to hostname if not set")
 	flag.BoolVar(&simulate, "simulate", false, "If true, report pod readiness without binding to real containers")
 	flag.BoolVar(&patch, "patch", true, "If true, use patch instead of update to mark pod ready")
+	flag.BoolVar(&apply, "apply", false, "If true, use server-side apply to mark pod ready, overrides -patch")
 	flag.IntVar(&readyDelayMilliseconds, "ready-after", 100, "Delay in ms before kubelet reports pod ready")
+	flag.StringVar(&topologyConfig, "topology", "", "Path to the simulated network topology config, only applicable with -simulate")
+	flag.StringVar(&debugAddr, "debug-addr", "", "If set, serve the internal state as JSON at /debug/state on this address, e.g. :25011")
+	flag.IntVar(&gcIntervalSeconds, "gc-interval", 30, "Period in seconds to drop in-mem pods whose owner is gone, 0 to disable")
+	flag.IntVar(&workers, "workers", 64, "Number of workers syncing pods")
+	flag.IntVar(&baseBackoffMilliseconds, "base-backoff", 5, "Initial per-pod retry backoff in ms, doubled on each failure")
+	flag.IntVar(&maxBackoffSeconds, "max-backoff", 1000, "Maximum per-pod retry backoff in seconds")
+	flag.Float64Var(&qps, "qps", 10, "Overall rate limit of retries")
+	flag.IntVar(&burst, "burst", 100, "Overall burst of retries")
+	flag.StringVar(&externalGates, "external-gates", "", "Comma-separated readiness gate condition types set by an external controller, left untouched by this kubelet")
+	flag.IntVar(&leaseDurationSeconds, "lease-duration", 0, "Duration in seconds of the leases held on served nodes, 0 to disable leases and failover")
+	flag.StringVar(&failoverFor, "failover-for", "", "Comma-separated nodes to take over once their custom kubelet lease expires, or * for all")
+	flag.StringVar(&epochFile, "epoch-file", "", "If set, persist handshaken epochs to this file across restarts")
+	flag.BoolVar(&cacheTemplates, "cache-templates", true, "If true, cache template pods per owner instead of listing them on every sync")
+	flag.IntVar(&exposeWorkers, "expose-workers", 16, "Number of workers creating in-mem pods in the api server")
+	flag.IntVar(&exposeRetries, "expose-retries", 10, "Retries to create an in-mem pod before handing it back to the sync loop")
+	flag.IntVar(&usageIntervalSeconds, "usage-interval", 0, "If positive, sample the CPU, RSS and goroutines of this kubelet every this many seconds")
+	flag.StringVar(&usageOutput, "usage-output", "kubelet-usage.json", "The path to periodically write the resource usage report to, only applicable with -usage-interval")
 	flag.Parse()
 
 	if node == "" {
@@ -57,15 +95,59 @@ func main() {
 	kubeClient := benchutil.NewClientsetOrDie()
 
 	kdServer := NewKubedirectServer(kubeClient, node).
-		WithReadyDelay(time.Duration(readyDelayMilliseconds) * time.Millisecond)
+		WithReadyDelay(time.Duration(readyDelayMilliseconds)*time.Millisecond).
+		WithGCInterval(time.Duration(gcIntervalSeconds)*time.Second).
+		WithWorkers(workers).
+		WithExposePool(exposeWorkers, exposeRetries).
+		WithRateLimiter(time.Duration(baseBackoffMilliseconds)*time.Millisecond, time.Duration(maxBackoffSeconds)*time.Second, qps, burst)
+	if cacheTemplates {
+		kdServer.WithTemplateCache()
+	}
+	if epochFile != "" {
+		if _, err := kdServer.WithEpochStore(epochFile); err != nil {
+			klog.Fatalf("Failed to load epoch store: %v", err)
+		}
+	}
+	if leaseDurationSeconds > 0 {
+		var nodes []string
+		if failoverFor != "" {
+			nodes = strings.Split(failoverFor, ",")
+		}
+		kdServer.WithFailover(time.Duration(leaseDurationSeconds)*time.Second, nodes...)
+	}
+	if externalGates != "" {
+		kdServer.WithExternalGates(strings.Split(externalGates, ",")...)
+	}
 	if simulate {
 		kdServer.Simulate()
+		netTopology, err := topology.NewTopologyFrom(topologyConfig)
+		if err != nil {
+			klog.Fatalf("Failed to load network topology: %v", err)
+		}
+		kdServer.WithTopology(netTopology)
+	} else if topologyConfig != "" {
+		klog.Fatalf("Network topology can only be simulated with -simulate")
 	}
 	if patch {
 		kdServer.UsePatch()
 	}
+	if apply {
+		kdServer.UseApply()
+	}
+
+	if debugAddr != "" {
+		go func() {
+			if err := kdServer.ServeDebug(ctx, debugAddr); err != nil {
+				klog.ErrorS(err, "Debug endpoint stopped")
+			}
+		}()
+	}
+
+	if usageIntervalSeconds > 0 {
+		go reportUsage(ctx, time.Duration(usageIntervalSeconds)*time.Second, usageOutput)
+	}
 
-	klog.InfoS("Starting custom kubelet server", "node", node, "simulate", simulate, "ready-after", readyDelayMilliseconds, "patch", patch)
+	klog.InfoS("Starting custom kubelet server", "node", node, "simulate", simulate, "ready-after", readyDelayMilliseconds, "patch", patch, "apply", apply, "topology", topologyConfig, "gc-interval", gcIntervalSeconds, "workers", workers, "base-backoff", baseBackoffMilliseconds, "max-backoff", maxBackoffSeconds, "qps", qps, "burst", burst, "external-gates", externalGates, "lease-duration", leaseDurationSeconds, "failover-for", failoverFor, "epoch-file", epochFile, "cache-templates", cacheTemplates, "expose-workers", exposeWorkers, "expose-retries", exposeRetries, "usage-interval", usageIntervalSeconds, "usage-output", usageOutput)
 	if err := kdServer.ListenAndServe(ctx); err != nil {
 		klog.Fatalf("Failed to listen & serve: %v", err)
 	}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	// Kubedirect
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+// templateCache caches the resolved template pod per owner, and is invalidated by template pod events.
+// A nil cache always resolves templates via the lister.
+type templateCache struct {
+	templates *kdutil.SharedMap[*corev1.Pod]
+	hits      int64
+	misses    int64
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		templates: kdutil.NewSharedMap[*corev1.Pod](),
+	}
+}
+
+func templateCacheKey(namespace, owner string, option bool) string {
+	return fmt.Sprintf("%s/%s/%v", namespace, owner, option)
+}
+
+func (c *templateCache) invalidate(namespace, owner string) {
+	c.templates.Del(templateCacheKey(namespace, owner, true))
+	c.templates.Del(templateCacheKey(namespace, owner, false))
+}
+
+func (c *templateCache) stats() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+}
+
+// getTemplateFor is a cached kdutil.GetUnnamedTemplateFor, option is passed through as is and errors are not cached
+// NOTE: callers get their own copy, the same as a lister lookup
+func (s *KubedirectServer) getTemplateFor(ctx context.Context, namespace, owner string, option bool) (*corev1.Pod, error) {
+	c := s.templates
+	if c == nil {
+		return kdutil.GetUnnamedTemplateFor(ctx, s.podLister, namespace, owner, option)
+	}
+	key := templateCacheKey(namespace, owner, option)
+	if template, ok := c.templates.Get(key); ok {
+		atomic.AddInt64(&c.hits, 1)
+		return template.DeepCopy(), nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+	template, err := kdutil.GetUnnamedTemplateFor(ctx, s.podLister, namespace, owner, option)
+	if err != nil {
+		return nil, err
+	}
+	c.templates.Set(key, template.DeepCopy())
+	return template, nil
+}
+
+func (s *KubedirectServer) addTemplateEventHandler() error {
+	unwrap := func(obj interface{}) *corev1.Pod {
+		switch t := obj.(type) {
+		case *corev1.Pod:
+			return t
+		case cache.DeletedFinalStateUnknown:
+			pod, _ := t.Obj.(*corev1.Pod)
+			return pod
+		}
+		return nil
+	}
+	invalidate := func(obj interface{}) {
+		if pod := unwrap(obj); pod != nil {
+			s.templates.invalidate(pod.Namespace, pod.Labels[kdutil.OwnerNameLabel])
+		}
+	}
+	_, err := s.factory.Core().V1().Pods().Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			pod := unwrap(obj)
+			return pod != nil && kdutil.IsTemplatePod(pod)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: invalidate,
+			UpdateFunc: func(_, newObj interface{}) {
+				invalidate(newObj)
+			},
+			DeleteFunc: invalidate,
+		},
+	})
+	return err
+}
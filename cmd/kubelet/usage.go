@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+)
+
+// how often the usage report is rewritten, so a killed kubelet leaves a recent one
+const usageWriteInterval = 30 * time.Second
+
+// reportUsage samples the resource usage of this kubelet and writes the report until ctx is done
+func reportUsage(ctx context.Context, interval time.Duration, path string) {
+	sampler := benchutil.NewUsageSampler("kubelet", interval)
+	go sampler.Run(ctx)
+	ticker := time.NewTicker(usageWriteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := sampler.WriteReport(path); err != nil {
+				klog.ErrorS(err, "Failed to write usage report")
+			}
+			return
+		}
+		if err := sampler.WriteReport(path); err != nil {
+			klog.V(1).InfoS("[WARN] Failed to write usage report", "error", err)
+		}
+	}
+}
@@ -81,7 +81,9 @@ func newKubeletLister(_ context.Context, c client.Client, nodeName string, requi
 	}
 }
 
-func newPodInfos(ownerNamespace, ownerName string, nodeName string, nPods int) []*kdctx.PodInfo {
+// newPodInfos returns one pod per node in nodeNames
+func newPodInfos(ownerNamespace, ownerName string, nodeNames []string) []*kdctx.PodInfo {
+	nPods := len(nodeNames)
 	podInfos := make([]*kdctx.PodInfo, nPods)
 	creationTimestamp := metav1.Now()
 	for i := 0; i < nPods; i++ {
@@ -89,24 +91,26 @@ func newPodInfos(ownerNamespace, ownerName string, nodeName string, nPods int) [
 			Namespace:         ownerNamespace,
 			Name:              fmt.Sprintf("%s-%d-%d", ownerName, creationTimestamp.UnixNano(), i),
 			OwnerName:         ownerName,
-			NodeName:          nodeName,
+			NodeName:          nodeNames[i],
 			CreationTimestamp: creationTimestamp,
 		}
 	}
 	return podInfos
 }
 
-func newBindingRequests(kdClient kdrpc.ClientInterface[kdproto.KubeletClient], podInfos []*kdctx.PodInfo) []*kdproto.PodBindingRequest {
+func newBindingRequests(kdClients map[string]kdrpc.ClientInterface[kdproto.KubeletClient], podInfos []*kdctx.PodInfo) []*kdproto.PodBindingRequest {
 	reqs := make([]*kdproto.PodBindingRequest, len(podInfos))
 	for i, podInfo := range podInfos {
-		reqs[i] = podInfo.RequestForBinding(kdClient)
+		reqs[i] = podInfo.RequestForBinding(kdClients[podInfo.NodeName])
 	}
 	return reqs
 }
 
-func run(ctx context.Context, mgr manager.Manager, nodeName string, target string, nPods int, useDefaultKubelet bool) {
+// setup starts the pod monitor and the kd clients to the kubelets of the nodes
+func setup(ctx context.Context, mgr manager.Manager, nodeNames []string, target string, useDefaultKubelet bool, tracker *stageTracker) (*PodMonitor, *corev1.Pod, map[string]kdrpc.ClientInterface[kdproto.KubeletClient], func()) {
 	// setup pod monitor
 	monitor := NewPodMonitor(target)
+	monitor.tracker = tracker
 	if err := monitor.SetupWithManager(ctx, mgr); err != nil {
 		klog.Fatalf("Error creating monitor: %v", err)
 	}
@@ -142,40 +146,59 @@ func run(ctx context.Context, mgr manager.Manager, nodeName string, target strin
 		klog.Fatalf("Invalid template pod: pod-lifecycle label does not match kubelet implementation")
 	}
 
-	klog.Info("Starting KD client")
-	kubeletLister := newKubeletLister(ctx, mgrClient, nodeName, !useDefaultKubelet)
-	kdClientHub := kdrpc.NewEventedClientHub(kdClientKeyFunc(nodeName), nodeName, kdproto.NewKubeletClient).
-		WithHandshake(doKubeletHandshake).
-		WithDialOptions(dialTimeout, dialInterval).
-		WithAddrLister(kubeletLister)
-	kdClientHub.Start(ctx)
-	defer kdClientHub.Stop()
-
-	var kdClient kdrpc.ClientInterface[kdproto.KubeletClient]
-	wait.PollUntilContextCancel(ctx, 1*time.Second, true, func(ctx context.Context) (bool, error) {
-		kdClient = kdClientHub.Unwrap()
-		if kdClient == nil {
-			return false, nil
+	klog.Info("Starting KD clients")
+	kdClients := make(map[string]kdrpc.ClientInterface[kdproto.KubeletClient], len(nodeNames))
+	var stops []func()
+	for _, nodeName := range nodeNames {
+		kubeletLister := newKubeletLister(ctx, mgrClient, nodeName, !useDefaultKubelet)
+		kdClientHub := kdrpc.NewEventedClientHub(kdClientKeyFunc(nodeName), nodeName, kdproto.NewKubeletClient).
+			WithHandshake(doKubeletHandshake).
+			WithDialOptions(dialTimeout, dialInterval).
+			WithAddrLister(kubeletLister)
+		kdClientHub.Start(ctx)
+		stops = append(stops, kdClientHub.Stop)
+
+		var kdClient kdrpc.ClientInterface[kdproto.KubeletClient]
+		wait.PollUntilContextCancel(ctx, 1*time.Second, true, func(ctx context.Context) (bool, error) {
+			kdClient = kdClientHub.Unwrap()
+			if kdClient == nil {
+				return false, nil
+			}
+			return true, nil
+		})
+		kdClients[nodeName] = kdClient
+	}
+	return monitor, templatePod, kdClients, func() {
+		for _, stop := range stops {
+			stop()
 		}
-		return true, nil
-	})
+	}
+}
+
+func run(ctx context.Context, mgr manager.Manager, p *placer, target string, nPods int, useDefaultKubelet bool) {
+	monitor, templatePod, kdClients, stop := setup(ctx, mgr, p.nodes, target, useDefaultKubelet, nil)
+	defer stop()
 
-	podInfos := newPodInfos(templatePod.Namespace, target, nodeName, nPods)
-	reqs := newBindingRequests(kdClient, podInfos)
+	podInfos := newPodInfos(templatePod.Namespace, target, p.place(nPods))
+	reqs := newBindingRequests(kdClients, podInfos)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(len(reqs))
 	monitor.Watch(wg, podInfos)
 
-	klog.Infof("Binding %d pods to %s", nPods, nodeName)
+	klog.Infof("Binding %d pods to %v (%s)", nPods, p.nodes, p.strategy)
+	balance := newBindBalance()
 	nBound := int32(0)
 	start := time.Now()
 	for i := range reqs {
 		go func(i int) {
-			if _, err := kdClient.Client().BindPod(ctx, reqs[i]); err != nil {
+			nodeName := podInfos[i].NodeName
+			sent := time.Now()
+			if _, err := kdClients[nodeName].Client().BindPod(ctx, reqs[i]); err != nil {
 				klog.ErrorS(err, "Error binding pod", "pod", podInfos[i])
 			} else {
 				atomic.AddInt32(&nBound, 1)
+				balance.observe(nodeName, time.Since(sent))
 			}
 		}(i)
 	}
@@ -189,4 +212,7 @@ func run(ctx context.Context, mgr manager.Manager, nodeName string, target strin
 	latency := monitor.Since(start)
 	fmt.Printf("RPC returned %d/%d in %v\n", atomic.LoadInt32(&nBound), nPods, latency)
 	fmt.Printf("total: %v us\n", latency.Microseconds())
+	if len(p.nodes) > 1 {
+		balance.report(p.nodes)
+	}
 }
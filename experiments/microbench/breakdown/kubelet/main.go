@@ -18,6 +18,8 @@ package main
 
 import (
 	"flag"
+	"strings"
+	"time"
 
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -40,13 +42,30 @@ func main() {
 	var baseline string
 	var target string
 	var node string
+	var nodes string
+	var placement string
+	var weights string
+	var packCapacity int
 	var nPods int
+	var ramp bool
+	var startRate, rateStep, maxRate float64
+	var stepSeconds, sloMilliseconds int
 
 	// NOTE: should create the deployments ahead of time
 	flag.StringVar(&baseline, "baseline", "kubelet", "Baseline for the experiment. Options: kubelet, custom")
 	flag.StringVar(&target, "target", "", "target ReplicaSet name")
 	flag.StringVar(&node, "node", "", "target node name")
+	flag.StringVar(&nodes, "nodes", "", "Comma-separated target node names, overrides -node")
+	flag.StringVar(&placement, "placement", PlacementRoundRobin, "Placement of pods across the nodes. Options: round-robin, weighted, packed")
+	flag.StringVar(&weights, "weights", "", "Comma-separated node weights aligned with -nodes for the weighted placement")
+	flag.IntVar(&packCapacity, "pack-capacity", 0, "Number of pods to fill each node with before moving to the next for the packed placement")
 	flag.IntVar(&nPods, "n", 10, "Number of pods to scale up on the target node")
+	flag.BoolVar(&ramp, "ramp", false, "If true, ramp up the bind rate until the ready latency SLO breaks, ignoring -n")
+	flag.Float64Var(&startRate, "start-rate", 10, "Initial bind rate per second in ramp mode")
+	flag.Float64Var(&rateStep, "rate-step", 10, "Bind rate increment per step in ramp mode")
+	flag.Float64Var(&maxRate, "max-rate", 0, "Maximum bind rate per second in ramp mode, 0 means unlimited")
+	flag.IntVar(&stepSeconds, "step-duration", 10, "Duration in seconds of each step in ramp mode")
+	flag.IntVar(&sloMilliseconds, "slo", 1000, "SLO in ms on the p90 latency from bind to pod ready in ramp mode")
 	flag.Parse()
 
 	ctx := ctrl.SetupSignalHandler()
@@ -55,17 +74,46 @@ func main() {
 	if target == "" {
 		klog.Fatalf("must specify target ReplicaSet")
 	}
-	if node == "" {
-		klog.Fatalf("must specify target node")
+	nodeNames := []string{node}
+	if nodes != "" {
+		nodeNames = strings.Split(nodes, ",")
+	}
+	for _, nodeName := range nodeNames {
+		if nodeName == "" {
+			klog.Fatalf("must specify target node")
+		}
+	}
+	p, err := newPlacer(placement, nodeNames, weights, packCapacity)
+	if err != nil {
+		klog.Fatalf("Invalid placement: %v", err)
 	}
 
 	mgr := benchutil.NewManagerOrDie()
 
-	klog.InfoS("Starting experiment", "baseline", baseline, "target", target, "node", node, "nPods", nPods)
+	if baseline != "kubelet" && baseline != "custom" {
+		klog.Fatalf("unknown baseline %s", baseline)
+	}
+	if ramp {
+		if startRate <= 0 || rateStep <= 0 {
+			klog.Fatalf("start-rate and rate-step must be positive")
+		}
+		opts := RampOptions{
+			StartRate:    startRate,
+			RateStep:     rateStep,
+			MaxRate:      maxRate,
+			StepDuration: time.Duration(stepSeconds) * time.Second,
+			SLO:          time.Duration(sloMilliseconds) * time.Millisecond,
+		}
+		klog.InfoS("Starting ramp experiment", "baseline", baseline, "target", target, "nodes", nodeNames, "placement", placement, "options", opts)
+		runRamp(ctx, mgr, p, target, baseline == "kubelet", opts)
+		return
+	}
+
+	klog.InfoS("Starting experiment", "baseline", baseline, "target", target, "nodes", nodeNames, "placement", placement, "nPods", nPods)
 	if baseline == "kubelet" {
-		run(ctx, mgr, node, target, nPods, true)
+		run(ctx, mgr, p, target, nPods, true)
 	} else if baseline == "custom" {
-		run(ctx, mgr, node, target, nPods, false)
+		run(ctx, mgr, p, target, nPods, false)
 	} else {
 		klog.Fatalf("unknown baseline %s", baseline)
 	}
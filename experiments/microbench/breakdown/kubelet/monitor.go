@@ -66,6 +66,8 @@ func (s *Expectation) Done(pod *corev1.Pod) bool {
 type PodMonitor struct {
 	ownerName   string
 	expectation *Expectation
+	// optional, records per-stage timestamps
+	tracker *stageTracker
 }
 
 func NewPodMonitor(ownerName string) *PodMonitor {
@@ -75,7 +77,6 @@ func NewPodMonitor(ownerName string) *PodMonitor {
 	}
 }
 
-
 func (m *PodMonitor) Since(start time.Time) time.Duration {
 	// gather all seen times from expectations
 	seenTimes := []time.Time{}
@@ -89,7 +90,7 @@ func (m *PodMonitor) Since(start time.Time) time.Duration {
 		return 0
 	}
 	sort.Slice(seenTimes, func(i, j int) bool { return seenTimes[i].Before(seenTimes[j]) })
-	idx := (90*len(seenTimes)) / 100
+	idx := 90 * len(seenTimes) / 100
 	percentile := seenTimes[idx]
 	return percentile.Sub(start)
 }
@@ -134,6 +135,9 @@ func (m *PodMonitor) FilterEvent(object client.Object) bool {
 }
 
 func (m *PodMonitor) HandlePodEvent(kdLogger *kdutil.Logger, old, new *corev1.Pod) {
+	if m.tracker != nil {
+		m.tracker.observe(old, new)
+	}
 	// this is deletion
 	if new == nil {
 		if m.expectation.Done(old) {
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PlacementRoundRobin spreads pods evenly across the nodes in order
+	PlacementRoundRobin = "round-robin"
+	// PlacementWeighted spreads pods across the nodes in proportion to their weights
+	PlacementWeighted = "weighted"
+	// PlacementPacked fills each node up to its capacity before moving to the next
+	PlacementPacked = "packed"
+)
+
+// placer assigns pods to nodes, it is stateful so that consecutive batches (e.g., ramp steps) continue the placement
+type placer struct {
+	strategy string
+	nodes    []string
+	weights  []int
+	capacity int
+
+	n       int
+	current []int // smooth weighted round-robin state
+}
+
+// newPlacer validates the strategy and its parameters,
+// weights is a comma-separated list aligned with nodes and capacity is the per-node pod count of the packed strategy
+func newPlacer(strategy string, nodes []string, weights string, capacity int) (*placer, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes to place pods on")
+	}
+	p := &placer{strategy: strategy, nodes: nodes, capacity: capacity}
+	switch strategy {
+	case PlacementRoundRobin:
+	case PlacementWeighted:
+		parts := strings.Split(weights, ",")
+		if len(parts) != len(nodes) {
+			return nil, fmt.Errorf("expected %d weights, got %d", len(nodes), len(parts))
+		}
+		for _, part := range parts {
+			w, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight %q: %v", part, err)
+			}
+			if w < 0 {
+				return nil, fmt.Errorf("negative weight %d", w)
+			}
+			p.weights = append(p.weights, w)
+		}
+		total := 0
+		for _, w := range p.weights {
+			total += w
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("weights must not all be zero")
+		}
+		p.current = make([]int, len(nodes))
+	case PlacementPacked:
+		if capacity <= 0 {
+			return nil, fmt.Errorf("packed placement requires a positive capacity, got %d", capacity)
+		}
+	default:
+		return nil, fmt.Errorf("unknown placement %q", strategy)
+	}
+	return p, nil
+}
+
+// next returns the node of the next pod
+func (p *placer) next() string {
+	defer func() { p.n++ }()
+	switch p.strategy {
+	case PlacementWeighted:
+		// smooth weighted round-robin, interleaves the nodes instead of sending bursts to the heaviest one
+		total, best := 0, 0
+		for i, w := range p.weights {
+			p.current[i] += w
+			total += w
+			if p.current[i] > p.current[best] {
+				best = i
+			}
+		}
+		p.current[best] -= total
+		return p.nodes[best]
+	case PlacementPacked:
+		// wrap around once every node is full
+		return p.nodes[(p.n/p.capacity)%len(p.nodes)]
+	default:
+		return p.nodes[p.n%len(p.nodes)]
+	}
+}
+
+// place returns the nodes of the next nPods pods
+func (p *placer) place(nPods int) []string {
+	nodes := make([]string, nPods)
+	for i := range nodes {
+		nodes[i] = p.next()
+	}
+	return nodes
+}
+
+// bindBalance records the binds returned per node
+type bindBalance struct {
+	mu    sync.Mutex
+	bound map[string]int
+	rpc   map[string][]time.Duration
+}
+
+func newBindBalance() *bindBalance {
+	return &bindBalance{
+		bound: make(map[string]int),
+		rpc:   make(map[string][]time.Duration),
+	}
+}
+
+func (b *bindBalance) observe(node string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bound[node]++
+	b.rpc[node] = append(b.rpc[node], latency)
+}
+
+// report prints the per-node share and rpc p90 of the binds, and the imbalance as max over mean
+func (b *bindBalance) report(nodes []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	total, maxBound := 0, 0
+	for _, node := range nodes {
+		total += b.bound[node]
+		maxBound = max(maxBound, b.bound[node])
+	}
+	if total == 0 {
+		return
+	}
+	sorted := append([]string(nil), nodes...)
+	sort.Strings(sorted)
+	for _, node := range sorted {
+		fmt.Printf("node: %s bound: %d (%.1f%%) rpc p90: %v\n",
+			node, b.bound[node], 100*float64(b.bound[node])/float64(total), p90(b.rpc[node]))
+	}
+	mean := float64(total) / float64(len(nodes))
+	fmt.Printf("imbalance: %.2f (max/mean)\n", float64(maxBound)/mean)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	kdctx "k8s.io/kubedirect/pkg/context"
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+// stages of a bind, each measured from the end of the previous one;
+// queue is the wait in the kubelet before the create starts, only split from api-create with the custom kubelet
+var bindStages = []string{"rpc", "queue", "api-create", "status-patch"}
+
+type RampOptions struct {
+	StartRate    float64
+	RateStep     float64
+	MaxRate      float64
+	StepDuration time.Duration
+	SLO          time.Duration
+}
+
+// stageTracker records when each pod is sent, bound (RPC returned), dequeued by the kubelet to be created,
+// created in the API server, and ready
+type stageTracker struct {
+	mu       sync.Mutex
+	sent     map[string]time.Time
+	returned map[string]time.Time
+	dequeued map[string]time.Time
+	created  map[string]time.Time
+	ready    map[string]time.Time
+}
+
+func newStageTracker() *stageTracker {
+	return &stageTracker{
+		sent:     make(map[string]time.Time),
+		returned: make(map[string]time.Time),
+		dequeued: make(map[string]time.Time),
+		created:  make(map[string]time.Time),
+		ready:    make(map[string]time.Time),
+	}
+}
+
+func (t *stageTracker) record(m map[string]time.Time, key string, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := m[key]; !ok {
+		m[key] = ts
+	}
+}
+
+func (t *stageTracker) observe(_, new *corev1.Pod) {
+	if new == nil {
+		return
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s/%s", new.Namespace, new.Name)
+	t.record(t.created, key, now)
+	if ts, ok := benchutil.ExposeStartOf(new); ok {
+		t.record(t.dequeued, key, ts)
+	}
+	if kdutil.IsPodReady(new) {
+		t.record(t.ready, key, now)
+	}
+}
+
+// stageLatencies returns the ready latency and per-stage latencies of the given pods, unready pods are omitted.
+// The watch may see a pod before its RPC returns, and the dequeue time is stamped by the kubelet's clock,
+// so a stage may come out negative: it is clamped to 0 and counted in clamped
+func (t *stageTracker) stageLatencies(keys []string) (ready []time.Duration, stages map[string][]time.Duration, clamped map[string]int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stages = make(map[string][]time.Duration)
+	clamped = make(map[string]int)
+	add := func(stage string, from, to time.Time) {
+		d := to.Sub(from)
+		if d < 0 {
+			d = 0
+			clamped[stage]++
+		}
+		stages[stage] = append(stages[stage], d)
+	}
+	for _, key := range keys {
+		sent, returned, dequeued, created, readyAt := t.sent[key], t.returned[key], t.dequeued[key], t.created[key], t.ready[key]
+		if readyAt.IsZero() || returned.IsZero() || created.IsZero() {
+			continue
+		}
+		ready = append(ready, readyAt.Sub(sent))
+		add("rpc", sent, returned)
+		if dequeued.IsZero() {
+			add("api-create", returned, created)
+		} else {
+			add("queue", returned, dequeued)
+			add("api-create", dequeued, created)
+		}
+		add("status-patch", created, readyAt)
+	}
+	return
+}
+
+func p90(latencies []time.Duration) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[(90*len(latencies))/100]
+}
+
+type rampStep struct {
+	rate     float64
+	nPods    int
+	nReady   int
+	readyP90 time.Duration
+	stageP90 map[string]time.Duration
+}
+
+func (s *rampStep) ok(slo time.Duration) bool {
+	return s.nReady == s.nPods && s.readyP90 <= slo
+}
+
+// runRamp binds pods to the nodes at increasing rates until the p90 ready latency breaks the SLO,
+// then reports the max sustainable rate and the stage whose latency grew the most
+func runRamp(ctx context.Context, mgr manager.Manager, p *placer, target string, useDefaultKubelet bool, opts RampOptions) {
+	tracker := newStageTracker()
+	_, templatePod, kdClients, stop := setup(ctx, mgr, p.nodes, target, useDefaultKubelet, tracker)
+	defer stop()
+	balance := newBindBalance()
+
+	var steps []*rampStep
+	for rate := opts.StartRate; opts.MaxRate <= 0 || rate <= opts.MaxRate; rate += opts.RateStep {
+		nPods := int(math.Ceil(rate * opts.StepDuration.Seconds()))
+		podInfos := newPodInfos(templatePod.Namespace, target, p.place(nPods))
+		reqs := newBindingRequests(kdClients, podInfos)
+		keys := make([]string, nPods)
+		for i, podInfo := range podInfos {
+			keys[i] = fmt.Sprintf("%s/%s", podInfo.Namespace, podInfo.Name)
+		}
+
+		klog.Infof("Binding %d pods to %v (%s) at %.1f/s", nPods, p.nodes, p.strategy, rate)
+		interval := time.Duration(float64(time.Second) / rate)
+		ticker := time.NewTicker(interval)
+		for i := range reqs {
+			go func(i int, podInfo *kdctx.PodInfo) {
+				sent := time.Now()
+				tracker.record(tracker.sent, keys[i], sent)
+				if _, err := kdClients[podInfo.NodeName].Client().BindPod(ctx, reqs[i]); err != nil {
+					klog.ErrorS(err, "Error binding pod", "pod", podInfo)
+					return
+				}
+				tracker.record(tracker.returned, keys[i], time.Now())
+				balance.observe(podInfo.NodeName, time.Since(sent))
+			}(i, podInfos[i])
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+		ticker.Stop()
+
+		// give the last pods a full SLO to become ready
+		deadline := time.Now().Add(opts.SLO)
+		for time.Now().Before(deadline) {
+			if ready, _, _ := tracker.stageLatencies(keys); len(ready) == nPods {
+				break
+			}
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		ready, stages, clamped := tracker.stageLatencies(keys)
+		step := &rampStep{
+			rate:     rate,
+			nPods:    nPods,
+			nReady:   len(ready),
+			readyP90: p90(ready),
+			stageP90: make(map[string]time.Duration),
+		}
+		for _, stage := range bindStages {
+			step.stageP90[stage] = p90(stages[stage])
+		}
+		steps = append(steps, step)
+		fmt.Printf("rate: %.1f/s ready: %d/%d p90: %v rpc: %v queue: %v api-create: %v status-patch: %v\n",
+			rate, step.nReady, nPods, step.readyP90,
+			step.stageP90["rpc"], step.stageP90["queue"], step.stageP90["api-create"], step.stageP90["status-patch"])
+		for _, stage := range bindStages {
+			if clamped[stage] > 0 {
+				fmt.Printf("[WARN] %d/%d negative %s latencies clamped to 0\n", clamped[stage], step.nReady, stage)
+			}
+		}
+		if !step.ok(opts.SLO) {
+			break
+		}
+	}
+	if len(steps) == 0 {
+		return
+	}
+
+	maxRate := 0.
+	for _, step := range steps {
+		if step.ok(opts.SLO) {
+			maxRate = step.rate
+		}
+	}
+	first, last := steps[0], steps[len(steps)-1]
+	bottleneck, maxGrowth := "", time.Duration(math.MinInt64)
+	for _, stage := range bindStages {
+		if growth := last.stageP90[stage] - first.stageP90[stage]; growth > maxGrowth {
+			bottleneck, maxGrowth = stage, growth
+		}
+	}
+	if last.ok(opts.SLO) {
+		fmt.Printf("SLO not broken up to %.1f/s\n", last.rate)
+	}
+	fmt.Printf("max sustainable: %.1f binds/s\n", maxRate)
+	fmt.Printf("bottleneck: %v (+%v at p90)\n", bottleneck, maxGrowth)
+	if len(p.nodes) > 1 {
+		balance.report(p.nodes)
+	}
+}
@@ -0,0 +1,45 @@
+#! /usr/bin/env bash
+
+BASE_DIR=`realpath $(dirname $0)`
+cd $BASE_DIR
+
+set -x
+
+USAGE="ramp.sh kubelet|custom node [extra flags, e.g. -start-rate 50 -rate-step 50 -slo 1000]"
+
+export WORKLOAD=${WORKLOAD:-"test-kubelet"}
+
+baseline=$1
+case $baseline in
+    kubelet)
+        ;;
+    custom)
+        # NOTE: caller should setup custom kubelet service with --simulate flag
+        export LIFECYCLE="custom"
+        ;;
+    *)
+        echo "Usage: $USAGE"
+        exit 1
+        ;;
+esac
+shift
+
+node=$1
+if [ -z "$node" ]; then
+    echo "Usage: $USAGE"
+    exit 1
+fi
+shift
+
+echo "Running kubelet saturation experiment: baseline=$baseline, target=$WORKLOAD, node=$node"
+
+export NAME=$WORKLOAD
+cat config/template-pod.yaml | envsubst | kubectl apply -f -
+cat config/daemonset.yaml | envsubst | kubectl apply -f -
+sleep 30
+
+go run . -baseline $baseline -target $WORKLOAD -node $node -ramp "$@" >ramp.log 2>stderr.log
+
+sleep 30
+kubectl delete pods -l kubedirect/owner-name=$WORKLOAD
+cat config/daemonset.yaml | envsubst | kubectl delete -f -
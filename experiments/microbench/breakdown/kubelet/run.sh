@@ -8,6 +8,9 @@ set -x
 USAGE="run.sh kubelet|custom #pods [node]"
 
 export WORKLOAD=${WORKLOAD:-"test-kubelet"}
+# optional multi-node placement, e.g. NODES=node1,node2 PLACEMENT=weighted WEIGHTS=3,1
+NODES=${NODES:-""}
+PLACEMENT=${PLACEMENT:-"round-robin"}
 # export IMAGE=${IMAGE:-"gcr.io/google-samples/kubernetes-bootcamp:v1"}
 
 baseline=$1
@@ -66,7 +69,18 @@ cat config/daemonset.yaml | envsubst | kubectl apply -f -
 # read -p "Press enter to continue..."
 sleep 30
 
-go run . -baseline $baseline -target $WORKLOAD -node $node -n $n_pods >result.log 2>stderr.log
+placement_flags="-placement $PLACEMENT"
+if [ -n "$NODES" ]; then
+    placement_flags="$placement_flags -nodes $NODES"
+fi
+if [ -n "$WEIGHTS" ]; then
+    placement_flags="$placement_flags -weights $WEIGHTS"
+fi
+if [ -n "$PACK_CAPACITY" ]; then
+    placement_flags="$placement_flags -pack-capacity $PACK_CAPACITY"
+fi
+
+go run . -baseline $baseline -target $WORKLOAD -node $node -n $n_pods $placement_flags >result.log 2>stderr.log
 
 # cleanup
 # read -p "Press enter to continue..."
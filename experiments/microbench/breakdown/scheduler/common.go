@@ -85,7 +85,7 @@ func newSchedulerLister(ctx context.Context, uncachedClient client.Client) func(
 	}
 }
 
-func run(ctx context.Context, mgr manager.Manager, target string, nPods int, fallback bool) {
+func run(ctx context.Context, mgr manager.Manager, target string, nPods int, fallback bool, poolLabel string, pool string) {
 	uncachedClient := benchutil.NewUncachedClientOrDie(mgr)
 
 	templatePod := &corev1.Pod{}
@@ -106,6 +106,9 @@ func run(ctx context.Context, mgr manager.Manager, target string, nPods int, fal
 	if fallback != kdutil.IsFallbackBinding(templatePod) {
 		klog.Fatalf("Invalid template pod: should set fallback binding label if and only if in fallback mode")
 	}
+	if pool != "" && templatePod.Spec.NodeSelector[poolLabel] != pool {
+		klog.Fatalf("Invalid template pod: expected node selector %s=%s", poolLabel, pool)
+	}
 
 	fakeReplicaSet := &appsv1.ReplicaSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -144,5 +147,14 @@ func run(ctx context.Context, mgr manager.Manager, target string, nPods int, fal
 	}
 	fmt.Printf("RPC returned in %v\n", time.Since(start))
 
+	// with fallback binding, the rpc may return before the default scheduler binds all pods
+	pods, err := waitPlaced(ctx, uncachedClient, target, nPods, 5*time.Minute)
+	if err != nil {
+		klog.ErrorS(err, "Not all pods are placed", "target", klog.KObj(fakeReplicaSet))
+	}
 	fmt.Printf("total: %v us\n", time.Since(start).Microseconds())
+
+	if err := reportPlacement(ctx, uncachedClient, pods, poolLabel, pool); err != nil {
+		klog.ErrorS(err, "Error reporting placement", "target", klog.KObj(fakeReplicaSet))
+	}
 }
@@ -33,15 +33,20 @@ func init() {
 // NOTE: no ReplicaSet, just a template pod (no need to mark managed)
 // k8s: fallback=binding + blocking rpc, vary nPods
 // kd: blocking rpc, vary nPods
+// with -pool, nodes are labeled with pool tiers and pods are constrained to one of them, see run.sh
 func main() {
 	var baseline string
 	var target string
 	var nPods int
+	var poolLabel string
+	var pool string
 
 	// NOTE: should create the deployments ahead of time
 	flag.StringVar(&baseline, "baseline", "k8s", "Baseline for the experiment. Options: k8s, kd")
 	flag.StringVar(&target, "target", "", "target ReplicaSet name")
 	flag.IntVar(&nPods, "n", 100, "Total number of pods to scale up")
+	flag.StringVar(&poolLabel, "pool-label", defaultPoolLabel, "Node label that groups nodes into pools")
+	flag.StringVar(&pool, "pool", "", "If set, the template pod must select this pool, and placement is checked against it")
 	flag.Parse()
 
 	ctx := ctrl.SetupSignalHandler()
@@ -53,11 +58,11 @@ func main() {
 
 	mgr := benchutil.NewManagerOrDie()
 
-	klog.InfoS("Starting experiment", "baseline", baseline, "target", target, "nPods", nPods)
+	klog.InfoS("Starting experiment", "baseline", baseline, "target", target, "nPods", nPods, "pool", pool)
 	if baseline == "k8s" {
-		run(ctx, mgr, target, nPods, true)
+		run(ctx, mgr, target, nPods, true, poolLabel, pool)
 	} else if baseline == "kd" {
-		run(ctx, mgr, target, nPods, false)
+		run(ctx, mgr, target, nPods, false, poolLabel, pool)
 	} else {
 		klog.Fatalf("unknown baseline %s", baseline)
 	}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+// nodes are grouped into tiers by this label, see run.sh
+const defaultPoolLabel = "kubedirect/pool"
+
+// waitPlaced polls until all nPods pods of the target are bound to a node, and returns them
+func waitPlaced(ctx context.Context, c client.Client, target string, nPods int, timeout time.Duration) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, timeout, true, func(ctx context.Context) (bool, error) {
+		list := &corev1.PodList{}
+		if err := c.List(ctx, list,
+			client.InNamespace(metav1.NamespaceDefault),
+			client.MatchingLabels{kdutil.OwnerNameLabel: target},
+		); err != nil {
+			return false, nil
+		}
+		pods = pods[:0]
+		bound := 0
+		for i := range list.Items {
+			pod := &list.Items[i]
+			if kdutil.IsTemplatePod(pod) {
+				continue
+			}
+			pods = append(pods, *pod)
+			if pod.Spec.NodeName != "" {
+				bound++
+			}
+		}
+		return bound >= nPods, nil
+	})
+	return pods, err
+}
+
+// reportPlacement prints how the pods are spread over the nodes of each pool.
+// Placement quality: pods outside the requested pool, unbound pods, and the per-node imbalance within the pool
+func reportPlacement(ctx context.Context, c client.Client, pods []corev1.Pod, poolLabel string, pool string) error {
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return fmt.Errorf("error listing nodes: %v", err)
+	}
+	poolOf := make(map[string]string)
+	poolNodes := make(map[string]int)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		p := node.Labels[poolLabel]
+		poolOf[node.Name] = p
+		poolNodes[p]++
+	}
+
+	unbound, misplaced := 0, 0
+	perNode := make(map[string]int)
+	for i := range pods {
+		node := pods[i].Spec.NodeName
+		if node == "" {
+			unbound++
+			continue
+		}
+		if pool != "" && poolOf[node] != pool {
+			misplaced++
+			klog.V(1).InfoS("[WARN] Pod placed outside its pool", "pod", klog.KObj(&pods[i]), "node", node, "pool", poolOf[node])
+		}
+		perNode[node]++
+	}
+
+	// spread over the candidate nodes, i.e., the pool or all workers, including empty ones
+	var counts []int
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if pool != "" && poolOf[node.Name] != pool {
+			continue
+		}
+		if pool == "" && isControlPlane(node) {
+			continue
+		}
+		counts = append(counts, perNode[node.Name])
+	}
+	sort.Ints(counts)
+	mean, stddev := 0., 0.
+	for _, n := range counts {
+		mean += float64(n)
+	}
+	if len(counts) > 0 {
+		mean /= float64(len(counts))
+		for _, n := range counts {
+			stddev += (float64(n) - mean) * (float64(n) - mean)
+		}
+		stddev = math.Sqrt(stddev / float64(len(counts)))
+	}
+
+	pools := make([]string, 0, len(poolNodes))
+	for p := range poolNodes {
+		pools = append(pools, p)
+	}
+	sort.Strings(pools)
+	for _, p := range pools {
+		name := p
+		if name == "" {
+			name = "<none>"
+		}
+		fmt.Printf("pool %v: %d nodes\n", name, poolNodes[p])
+	}
+	fmt.Printf("pods: %d, unbound: %d, misplaced: %d\n", len(pods), unbound, misplaced)
+	if len(counts) > 0 {
+		fmt.Printf("candidate nodes: %d, used: %d, pods per node min/mean/max/stddev: %d/%.2f/%d/%.2f\n",
+			len(counts), len(perNode), counts[0], mean, counts[len(counts)-1], stddev)
+	}
+	return nil
+}
+
+func isControlPlane(node *corev1.Node) bool {
+	_, ok := node.Labels["node-role.kubernetes.io/control-plane"]
+	return ok
+}
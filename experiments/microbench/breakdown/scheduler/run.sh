@@ -8,6 +8,8 @@ set -x
 USAGE="run.sh k8s|kd #pods"
 # NOTE: if using kwok, then caller should setup custom kubelet service with --simulate flag + kwok node delegation
 # NOTE: must also export LIFECYCLE=custom env var
+# NOTE: to study heterogeneous pools, export POOLS="fast=2,slow=8" to label worker nodes in order with kubedirect/pool,
+# and POOL=fast to constrain the pods to one of them
 
 export WORKLOAD=${WORKLOAD:-"test-scheduler"}
 # export IMAGE=${IMAGE:-"gcr.io/google-samples/kubernetes-bootcamp:v1"}
@@ -35,16 +37,42 @@ shift
 
 echo "Running scheduler breakdown experiment: baseline=$baseline, target=$WORKLOAD, #pods=$n_pods"
 
+function label_pools {
+    local nodes=(`kubectl get nodes --selector='!node-role.kubernetes.io/control-plane' -o name`)
+    local i=0
+    for spec in ${POOLS//,/ }; do
+        local pool=${spec%%=*}
+        local count=${spec##*=}
+        for ((j = 0; j < count && i < ${#nodes[@]}; j++, i++)); do
+            kubectl label --overwrite ${nodes[$i]} kubedirect/pool=$pool
+        done
+    done
+    if [[ $i -lt ${#nodes[@]} ]]; then
+        echo "$((${#nodes[@]} - i)) nodes left without a pool"
+    fi
+}
+
+TEMPLATE=config/template-pod.yaml
+if [[ -n "$POOLS" ]]; then
+    label_pools
+fi
+if [[ -n "$POOL" ]]; then
+    TEMPLATE=config/template-pod.pool.yaml
+fi
+
 export NAME=$WORKLOAD
-cat config/template-pod.yaml | envsubst | kubectl apply -f -
+cat $TEMPLATE | envsubst | kubectl apply -f -
 
 # read -p "Press enter to continue..."
 sleep 30
 
-go run . -baseline $baseline -target $WORKLOAD -n $n_pods >result.log 2>stderr.log
+go run . -baseline $baseline -target $WORKLOAD -n $n_pods -pool "$POOL" >result.log 2>stderr.log
 
 # cleanup
 # read -p "Press enter to continue..."
 sleep 30
 # cat config/template-pod.yaml | envsubst | kubectl delete -f -
 kubectl delete pods -l kubedirect/owner-name=$WORKLOAD
+if [[ -n "$POOLS" ]]; then
+    kubectl label nodes --all kubedirect/pool-
+fi
@@ -0,0 +1,173 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+// first observations of a target after the burst
+type timeline struct {
+	scaled time.Time // spec.replicas > 0
+	ready  time.Time // status.readyReplicas > 0
+}
+
+// watches the trace deployments while synchronized bursts are replayed against them (see run.sh),
+// and reports the aggregate ready latency across targets. Per-key latencies hide cross-key contention,
+// so the spread of the scale-up instants (skew) is reported as well: with an uncontended scaler and API server
+// all targets would be scaled within the burst spread.
+func main() {
+	var runID string
+	var interval, timeout time.Duration
+	var output string
+	flag.StringVar(&runID, "run-id", "", "If set, only watch deployments labeled with this run ID")
+	flag.DurationVar(&interval, "interval", 200*time.Millisecond, "Polling interval")
+	flag.DurationVar(&timeout, "timeout", 10*time.Minute, "Stop watching after this long, or on SIGINT")
+	flag.StringVar(&output, "o", "", "If set, write the per-target timelines as CSV to this file")
+	flag.Parse()
+
+	if runID != "" {
+		if err := workload.UseRunID(runID); err != nil {
+			klog.Fatalf("Unable to scope experiment: %v", err)
+		}
+	}
+	ctx := ctrl.SetupSignalHandler()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctrl.SetLogger(klog.Background())
+	mgr := benchutil.NewManagerOrDie()
+	c := benchutil.NewUncachedClientOrDie(mgr)
+
+	timelines := make(map[string]*timeline)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	klog.InfoS("Watching trace deployments", "run-id", runID, "interval", interval)
+watch:
+	for {
+		select {
+		case <-ctx.Done():
+			break watch
+		case <-ticker.C:
+		}
+		targets := &appsv1.DeploymentList{}
+		if err := c.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
+			if ctx.Err() == nil {
+				klog.ErrorS(err, "Error listing deployments")
+			}
+			continue
+		}
+		now := time.Now()
+		for i := range targets.Items {
+			dp := &targets.Items[i]
+			key := workload.KeyFromObject(dp)
+			tl := timelines[key]
+			if tl == nil {
+				tl = &timeline{}
+				timelines[key] = tl
+			}
+			if tl.scaled.IsZero() && dp.Spec.Replicas != nil && *dp.Spec.Replicas > 0 {
+				tl.scaled = now
+			}
+			if tl.ready.IsZero() && dp.Status.ReadyReplicas > 0 {
+				tl.ready = now
+			}
+		}
+	}
+
+	report(timelines, output)
+}
+
+func report(timelines map[string]*timeline, output string) {
+	var first time.Time
+	for _, tl := range timelines {
+		if !tl.scaled.IsZero() && (first.IsZero() || tl.scaled.Before(first)) {
+			first = tl.scaled
+		}
+	}
+	if first.IsZero() {
+		fmt.Printf("targets: %d, none scaled\n", len(timelines))
+		return
+	}
+
+	var csv *os.File
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			klog.Fatalf("Error creating output: %v", err)
+		}
+		defer f.Close()
+		fmt.Fprintln(f, "target,scaled_ms,ready_ms")
+		csv = f
+	}
+	// relative to the first scale-up, which approximates the start of the bursts
+	ms := func(t time.Time) float64 {
+		return float64(t.Sub(first).Nanoseconds()) / 1e6
+	}
+	var skews, readies, lags []float64
+	nScaled, nReady := 0, 0
+	for key, tl := range timelines {
+		scaled, ready := -1., -1.
+		if !tl.scaled.IsZero() {
+			nScaled++
+			scaled = ms(tl.scaled)
+			skews = append(skews, scaled)
+		}
+		if !tl.ready.IsZero() {
+			nReady++
+			ready = ms(tl.ready)
+			readies = append(readies, ready)
+			if scaled >= 0 {
+				lags = append(lags, ready-scaled)
+			}
+		}
+		if csv != nil {
+			fmt.Fprintf(csv, "%s,%.3f,%.3f\n", key, scaled, ready)
+		}
+	}
+	fmt.Printf("targets: %d, scaled: %d, ready: %d\n", len(timelines), nScaled, nReady)
+	summarize("scale skew", skews)
+	summarize("ready", readies)
+	summarize("scaled->ready", lags)
+}
+
+func summarize(name string, values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+	pct := func(p float64) float64 {
+		return values[int(p*float64(len(values)-1))]
+	}
+	fmt.Printf("%-13s p50: %.1fms, p90: %.1fms, p99: %.1fms, max: %.1fms\n", name, pct(0.5), pct(0.9), pct(0.99), values[len(values)-1])
+}
@@ -0,0 +1,51 @@
+#! /usr/bin/env bash
+
+BASE_DIR=`realpath $(dirname $0)`
+cd $BASE_DIR
+
+set -x
+
+USAGE="run.sh k8s+|kd+ #functions [burst-size] -- args..."
+# replays synchronized bursts of all functions with the trace experiment,
+# while watching how fast the targets are scaled and become ready
+# NOTE: the autoscaler logs its queue behavior ("Scaler queue") in ../../trace/stderr.log on exit
+
+baseline=$1
+case $baseline in
+    "k8s+"|"kd+")
+        ;;
+    *)
+        echo "Usage: $USAGE"
+        exit 1
+        ;;
+esac
+shift
+
+n_functions=$1
+if ! [[ -n "$1" && "$1" =~ ^[0-9]*$ ]]; then
+    echo "Usage: $USAGE"
+    exit 1
+fi
+shift
+
+burst_size=10
+if [[ -n "$1" && "$1" =~ ^[0-9]*$ ]]; then
+    burst_size=$1
+    shift
+fi
+
+export RUN_ID=${RUN_ID:-"burst-$(date +%s)"}
+export LOADER=`go run ../../../cmd/kubedirect-bench trace burst -functions $n_functions -size $burst_size $BASE_DIR` || exit 1
+
+echo "Running burst experiment: baseline=$baseline, #functions=$n_functions, burst=$burst_size, run=$RUN_ID"
+
+go build -o burst-watch . || exit 1
+./burst-watch -run-id $RUN_ID -o timelines.csv >result.log 2>stderr.log &
+watcher=$!
+
+../../trace/run.sh $baseline $n_functions "$@"
+
+kill -INT $watcher
+wait $watcher
+rm -f burst-watch
+grep "Scaler queue" ../../trace/stderr.log >>result.log
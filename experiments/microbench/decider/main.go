@@ -0,0 +1,246 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+// a scripted load pattern: the concurrency to hold at each second, then held at the last value
+type scenario struct {
+	name string
+	load func(t time.Duration) int
+}
+
+var scenarios = []scenario{
+	{"step", func(t time.Duration) int {
+		return 20
+	}},
+	{"spike", func(t time.Duration) int {
+		if t >= 5*time.Second && t < 10*time.Second {
+			return 50
+		}
+		return 5
+	}},
+	{"decay", func(t time.Duration) int {
+		return int(40 * math.Pow(0.8, t.Seconds()))
+	}},
+}
+
+type point struct {
+	t           time.Duration
+	concurrency int
+	ready       int
+	desired     int
+}
+
+// replays scripted ReqIn/ReqOut patterns (step, spike, decay) against the KPA decider in real time,
+// with a simulated cluster where pods become ready after a fixed delay,
+// and checks the desired-scale trajectories for bounded overshoot and convergence.
+// runs entirely in memory, no cluster needed; exits non-zero if any check fails
+func main() {
+	var only string
+	var duration, loadDuration, readyDelay, stableWindow, tick time.Duration
+	var targetConcurrency, maxScaleUpRate, maxScaleDownRate, panicWindowPercentage, panicThresholdPercentage float64
+	var maxOvershoot float64
+	var convergeWithin time.Duration
+	var output string
+	flag.StringVar(&only, "scenario", "", "Comma-separated scenarios to run (step, spike, decay), all if empty")
+	flag.DurationVar(&duration, "duration", 40*time.Second, "Length of each scenario")
+	flag.DurationVar(&loadDuration, "load-duration", 20*time.Second, "The load is held at its last value after this long")
+	flag.DurationVar(&readyDelay, "ready-delay", 1*time.Second, "Delay until a new pod becomes ready")
+	flag.Float64Var(&targetConcurrency, "target-concurrency", 1, "Target concurrency per pod")
+	flag.Float64Var(&maxScaleUpRate, "max-scale-up-rate", 1000, "Max scale up rate")
+	flag.Float64Var(&maxScaleDownRate, "max-scale-down-rate", 2, "Max scale down rate")
+	flag.DurationVar(&stableWindow, "stable-window", 10*time.Second, "Stable window")
+	flag.Float64Var(&panicWindowPercentage, "panic-window-percentage", 20, "Panic window as a percentage of the stable window")
+	flag.Float64Var(&panicThresholdPercentage, "panic-threshold-percentage", 200, "Panic threshold percentage")
+	flag.DurationVar(&tick, "tick", 1*time.Second, "Decider tick interval")
+	flag.Float64Var(&maxOvershoot, "max-overshoot", 0.5, "Max desired scale above the peak demand, as a fraction of it")
+	flag.DurationVar(&convergeWithin, "converge-within", 15*time.Second, "Max time to converge after the load settles")
+	flag.StringVar(&output, "o", "", "If set, write the trajectories as CSV to this file")
+	flag.Parse()
+
+	var csv *os.File
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			klog.Fatalf("Error creating output: %v", err)
+		}
+		defer f.Close()
+		fmt.Fprintln(f, "scenario,time,concurrency,ready,desired")
+		csv = f
+	}
+
+	failed := 0
+	for _, sc := range scenarios {
+		if only != "" && !strings.Contains(","+only+",", ","+sc.name+",") {
+			continue
+		}
+		d := decider.NewKPADecider(
+			"default/"+sc.name,
+			targetConcurrency,
+			maxScaleUpRate, maxScaleDownRate,
+			stableWindow, time.Duration(float64(stableWindow)*panicWindowPercentage/100),
+			panicThresholdPercentage/100,
+			0, tick,
+		)
+		klog.InfoS("Running scenario", "scenario", sc.name, "duration", duration)
+		trajectory := run(sc, d, duration, loadDuration, readyDelay, tick)
+		if csv != nil {
+			for _, p := range trajectory {
+				fmt.Fprintf(csv, "%s,%.3f,%d,%d,%d\n", sc.name, p.t.Seconds(), p.concurrency, p.ready, p.desired)
+			}
+		}
+		if errs := check(sc, trajectory, loadDuration, targetConcurrency, maxOvershoot, convergeWithin); len(errs) > 0 {
+			failed++
+			for _, err := range errs {
+				fmt.Printf("%s: FAIL: %v\n", sc.name, err)
+			}
+		} else {
+			fmt.Printf("%s: PASS\n", sc.name)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// run holds the scripted concurrency with ReqIn/ReqOut and reconciles the decider every tick
+func run(sc scenario, d *decider.KPADecider, duration, loadDuration, readyDelay, tick time.Duration) []point {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Activate(ctx)
+
+	var trajectory []point
+	// ready times of pods that are scaling up
+	var pending []time.Time
+	concurrency, ready := 0, 0
+	start := time.Now()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		t := now.Sub(start)
+		if t > duration {
+			break
+		}
+		want := sc.load(t)
+		if t > loadDuration {
+			want = sc.load(loadDuration)
+		}
+		for ; concurrency < want; concurrency++ {
+			d.ReqIn(&workload.Request{Target: d.Key})
+		}
+		for ; concurrency > want; concurrency-- {
+			d.ReqOut(&workload.Response{})
+		}
+		for len(pending) > 0 && !pending[0].After(now) {
+			pending = pending[1:]
+			ready++
+		}
+		desired, err := d.Reconcile(ctx, now, ready)
+		if err != nil {
+			klog.ErrorS(err, "Error reconciling", "scenario", sc.name)
+			continue
+		}
+		// pods come up after the ready delay, and go away at once
+		if inflight := ready + len(pending); desired > inflight {
+			for i := inflight; i < desired; i++ {
+				pending = append(pending, now.Add(readyDelay))
+			}
+		} else if desired < inflight {
+			if drop := inflight - desired; drop <= len(pending) {
+				pending = pending[:len(pending)-drop]
+			} else {
+				ready -= drop - len(pending)
+				pending = nil
+			}
+		}
+		trajectory = append(trajectory, point{t: t, concurrency: concurrency, ready: ready, desired: desired})
+	}
+	return trajectory
+}
+
+// check asserts the desired scale never exceeds the peak demand by more than maxOvershoot,
+// and settles within one pod of the final demand no later than convergeWithin after the load settles
+func check(sc scenario, trajectory []point, loadDuration time.Duration, targetConcurrency, maxOvershoot float64, convergeWithin time.Duration) []error {
+	var errs []error
+	if len(trajectory) == 0 {
+		return []error{fmt.Errorf("empty trajectory")}
+	}
+	peak, maxDesired := 0, 0
+	for _, p := range trajectory {
+		peak = max(peak, p.concurrency)
+		maxDesired = max(maxDesired, p.desired)
+	}
+	bound := int(math.Ceil(math.Ceil(float64(peak)/targetConcurrency) * (1 + maxOvershoot)))
+	if maxDesired > bound {
+		errs = append(errs, fmt.Errorf("overshoot: desired %d exceeds bound %d (peak concurrency %d)", maxDesired, bound, peak))
+	}
+
+	final := int(math.Ceil(float64(sc.load(loadDuration)) / targetConcurrency))
+	settled := loadDuration
+	// the load of a scenario may settle before loadDuration
+	for i := len(trajectory) - 1; i > 0; i-- {
+		if trajectory[i-1].concurrency != trajectory[len(trajectory)-1].concurrency {
+			settled = trajectory[i].t
+			break
+		}
+		if i == 1 {
+			settled = 0
+		}
+	}
+	converged := time.Duration(-1)
+	for i := len(trajectory) - 1; i >= 0; i-- {
+		if abs(trajectory[i].desired-final) > 1 {
+			break
+		}
+		converged = trajectory[i].t
+	}
+	switch {
+	case converged < 0:
+		errs = append(errs, fmt.Errorf("no convergence: desired %d, want %d±1", trajectory[len(trajectory)-1].desired, final))
+	case converged-settled > convergeWithin:
+		errs = append(errs, fmt.Errorf("slow convergence: converged %v after the load settled, want within %v", converged-settled, convergeWithin))
+	default:
+		klog.InfoS("Scenario converged", "scenario", sc.name, "peak", peak, "maxDesired", maxDesired, "final", final, "after", max(0, converged-settled))
+	}
+	return errs
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
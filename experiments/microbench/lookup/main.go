@@ -0,0 +1,93 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/rand"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+// measures the latency of listing the pods of an owner from an informer cache,
+// with a full namespace scan (the default lister) and with the owner label index used by the custom kubelet.
+// runs entirely in memory, no cluster needed
+func main() {
+	var nPods int
+	var nOwners int
+	var nLookups int
+	flag.IntVar(&nPods, "pods", 10000, "Number of pods in the cache")
+	flag.IntVar(&nOwners, "owners", 100, "Number of owners the pods are spread over")
+	flag.IntVar(&nLookups, "n", 1000, "Number of lookups per lister")
+	flag.Parse()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, benchutil.PodLabelIndexers(kdutil.OwnerNameLabel))
+	for i := 0; i < nPods; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: metav1.NamespaceDefault,
+				Name:      fmt.Sprintf("pod-%d", i),
+				Labels: map[string]string{
+					kdutil.OwnerNameLabel: fmt.Sprintf("owner-%d", i%nOwners),
+				},
+			},
+		}
+		if err := indexer.Add(pod); err != nil {
+			klog.Fatalf("Error adding pod: %v", err)
+		}
+	}
+
+	owners := make([]labels.Selector, nLookups)
+	for i := range owners {
+		owners[i] = labels.Set{kdutil.OwnerNameLabel: fmt.Sprintf("owner-%d", rand.Intn(nOwners))}.AsSelectorPreValidated()
+	}
+	measure := func(lister corelisters.PodLister) time.Duration {
+		start := time.Now()
+		for _, selector := range owners {
+			pods, err := lister.Pods(metav1.NamespaceDefault).List(selector)
+			if err != nil {
+				klog.Fatalf("Error listing pods: %v", err)
+			}
+			if len(pods) == 0 {
+				klog.Fatalf("No pods found for %v", selector)
+			}
+		}
+		return time.Since(start) / time.Duration(nLookups)
+	}
+
+	klog.InfoS("Starting lookup benchmark", "pods", nPods, "owners", nOwners, "lookups", nLookups)
+	scan := measure(corelisters.NewPodLister(indexer))
+	index := measure(benchutil.NewIndexedPodLister(indexer, kdutil.OwnerNameLabel))
+	fmt.Printf("scan: %.3f us/op\n", float64(scan.Nanoseconds())/1e3)
+	fmt.Printf("index: %.3f us/op\n", float64(index.Nanoseconds())/1e3)
+	fmt.Printf("speedup: %.1fx\n", float64(scan)/float64(index))
+}
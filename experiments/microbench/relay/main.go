@@ -0,0 +1,142 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+func init() {
+	klog.InitFlags(nil)
+}
+
+// per-hop latencies of one request through the relay
+type sample struct {
+	in    time.Duration // client send -> relay stamp
+	out   time.Duration // relay stamp -> dispatcher pickup
+	back  time.Duration // dispatcher response -> client recv
+	total time.Duration
+}
+
+// pushes requests through the gateway relay with a loopback dispatcher that answers immediately,
+// and reports the relay overhead per request. runs entirely in memory, no cluster needed
+func main() {
+	var n, nTargets int
+	var interval time.Duration
+	var output string
+	flag.IntVar(&n, "n", 100000, "Number of requests per target")
+	flag.IntVar(&nTargets, "targets", 1, "Number of targets, each with its own relay")
+	flag.DurationVar(&interval, "interval", 0, "Interval between requests of a target, back to back if 0")
+	flag.StringVar(&output, "o", "", "If set, write the per-request latencies as CSV to this file")
+	flag.Parse()
+
+	keys := make([]string, nTargets)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("default/relay-%d", i)
+	}
+	g := gateway.NewLoopbackGateway(keys...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := g.Start(ctx); err != nil {
+		klog.Fatalf("Error starting gateway: %v", err)
+	}
+
+	start := time.Now()
+	for _, key := range keys {
+		go func(key string) {
+			in := g.RequestChan(key)
+			for i := 0; i < n; i++ {
+				if interval > 0 {
+					time.Sleep(interval)
+				}
+				in <- &workload.Request{
+					ID:           fmt.Sprintf("%s/%d", key, i),
+					Target:       key,
+					ClientSendTS: time.Now(),
+				}
+			}
+		}(key)
+	}
+
+	total := n * nTargets
+	samples := make([]sample, 0, total)
+	for res := range g.Responses() {
+		res.ClientRecvTS = time.Now()
+		req := res.Source
+		samples = append(samples, sample{
+			in:    req.GatewayRecvTS.Sub(req.ClientSendTS),
+			out:   req.GatewaySendTS.Sub(req.GatewayRecvTS),
+			back:  res.ClientRecvTS.Sub(res.GatewayRecvTS),
+			total: res.ClientRecvTS.Sub(req.ClientSendTS),
+		})
+		if len(samples) == total {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+	cancel()
+	g.Close()
+
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			klog.Fatalf("Error creating output: %v", err)
+		}
+		fmt.Fprintln(f, "in_us,out_us,back_us,total_us")
+		for _, s := range samples {
+			fmt.Fprintf(f, "%.3f,%.3f,%.3f,%.3f\n", us(s.in), us(s.out), us(s.back), us(s.total))
+		}
+		f.Close()
+	}
+
+	fmt.Printf("requests: %d, targets: %d, elapsed: %v, throughput: %.0f req/s\n",
+		total, nTargets, elapsed, float64(total)/elapsed.Seconds())
+	report("in", samples, func(s sample) time.Duration { return s.in })
+	report("out", samples, func(s sample) time.Duration { return s.out })
+	report("back", samples, func(s sample) time.Duration { return s.back })
+	report("total", samples, func(s sample) time.Duration { return s.total })
+}
+
+func us(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e3
+}
+
+func report(name string, samples []sample, get func(sample) time.Duration) {
+	ds := make([]time.Duration, len(samples))
+	var sum time.Duration
+	for i, s := range samples {
+		ds[i] = get(s)
+		sum += ds[i]
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	pct := func(p float64) float64 {
+		return us(ds[int(p*float64(len(ds)-1))])
+	}
+	fmt.Printf("%-5s mean: %.3fus, p50: %.3fus, p99: %.3fus, max: %.3fus\n",
+		name, us(sum)/float64(len(ds)), pct(0.5), pct(0.99), pct(1))
+}
@@ -20,9 +20,12 @@ custom_kubelet_up # watch
 # custom_kubelet_up watch
 for baseline in k8s+ kd+; do
     setup_dirs $baseline || continue
-    ./run.sh $baseline $n_traces -- -backend=grpc -v=$verbosity
+    RUN_ID=$(run_id_for $baseline) ./run.sh $baseline $n_traces -- -backend=grpc -v=$verbosity
     cp ./trace.log $RESULTS/$baseline.$n_traces.log
     cp ./stderr.log $RESULTS/stderr/$baseline.$n_traces.log
+    cp ./trace.manifest.json $RESULTS/$baseline.$n_traces.manifest.json
+    # the kubelet samples are timestamped, window them by the manifest start and end
+    $ROOT_DIR/scripts/kubelet.sh usage $RESULTS/usage
     sleep 60
 done
 custom_kubelet_down
@@ -31,9 +34,10 @@ custom_kubelet_down
 knative_up
 for baseline in kd ; do
     setup_dirs $baseline || continue
-    ./run.sh $baseline $n_traces -- -backend=grpc -v=$verbosity
+    RUN_ID=$(run_id_for $baseline) ./run.sh $baseline $n_traces -- -backend=grpc -v=$verbosity
     cp ./trace.log $RESULTS/$baseline.$n_traces.log
     cp ./stderr.log $RESULTS/stderr/$baseline.$n_traces.log
+    cp ./trace.manifest.json $RESULTS/$baseline.$n_traces.manifest.json
     sleep 60
 done
 knative_down
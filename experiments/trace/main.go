@@ -25,14 +25,20 @@ import (
 	"runtime"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
 	"github.com/tomquartz/kubedirect-bench/pkg/backend"
 	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
 	"github.com/tomquartz/kubedirect-bench/pkg/replay"
+	"github.com/tomquartz/kubedirect-bench/pkg/topology"
 	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
 var baseDir string
@@ -47,9 +53,39 @@ var backendFramework string
 var gatewayFramework string
 var autoscalerFramework string
 var autoscalerConfig string
+var gatewayConfig string
 var traceLoaderConfig string
 var outputPath string
 var dispatchTimeoutSeconds int
+var execTimeoutSeconds int
+var execTimeoutFactor float64
+var topologyConfig string
+var runID string
+var traceSample int
+var traceSampleOutput string
+var otlpEndpoint string
+var adminAddr string
+var snapshotIntervalMilliSec int
+var snapshotCapacity int
+var dirigentDataPlane string
+var remoteGatewayAddr string
+var frontDoorAddr string
+var serveOnly bool
+var knativeDispatch string
+var batchFraction float64
+var sessions int
+var highPriorityFraction float64
+var runtimeFactor float64
+var fixedRuntimeMilliSec int
+var manifestPath string
+var usageIntervalSeconds int
+var soakMinutes int
+var soakReportSeconds int
+var soakGrowth float64
+var shards int
+var shardIndex int
+var shardVirtualNodes int
+var excludeUnhealthy bool
 
 func validateFlags() {
 	if traceLoaderConfig == "" {
@@ -68,6 +104,25 @@ func validateFlags() {
 		} else if backendFramework != "grpc" {
 			klog.Fatalf("Only grpc backend is supported for knative gateway, got %v", backendFramework)
 		}
+	case "dirigent":
+		if dirigentDataPlane == "" {
+			klog.Fatalf("Must provide -dirigent-data-plane for dirigent gateway")
+		}
+		if autoscalerFramework != "" || autoscalerConfig != "" {
+			klog.Info("[WARN] Ignoring autoscaler options for dirigent gateway")
+			autoscalerFramework = ""
+			autoscalerConfig = ""
+		}
+		if gatewayConfig != "" {
+			klog.Info("[WARN] Ignoring gateway config for dirigent gateway")
+			gatewayConfig = ""
+		}
+		if backendFramework == "" {
+			klog.Info("Defaulting to grpc backend for dirigent gateway")
+			backendFramework = "grpc"
+		} else if backendFramework != "grpc" {
+			klog.Fatalf("Only grpc backend is supported for dirigent gateway, got %v", backendFramework)
+		}
 	case "k8s":
 		if autoscalerFramework != "one-time" && autoscalerConfig == "" {
 			klog.Fatalf("Must provide config for %v autoscaler", autoscalerFramework)
@@ -78,9 +133,44 @@ func validateFlags() {
 		} else if backendFramework != "grpc" && backendFramework != "fake" {
 			klog.Fatalf("Only fake/grpc backend is supported for k8s gateway")
 		}
+	case "remote":
+		if remoteGatewayAddr == "" {
+			klog.Fatalf("Must provide -gateway-addr for remote gateway")
+		}
+		if autoscalerFramework != "" || autoscalerConfig != "" || gatewayConfig != "" {
+			klog.Info("[WARN] Ignoring gateway and autoscaler options for remote gateway, they apply where it runs")
+			autoscalerFramework = ""
+			autoscalerConfig = ""
+			gatewayConfig = ""
+		}
+		if frontDoorAddr != "" || serveOnly {
+			klog.Fatalf("A remote gateway cannot serve a front door")
+		}
 	default:
 		klog.Fatalf("Unknown gateway framework %v", gatewayFramework)
 	}
+	if serveOnly && frontDoorAddr == "" {
+		klog.Fatalf("Must provide -front-door-addr with -serve-only")
+	}
+	if dispatchTimeoutSeconds <= 0 || execTimeoutSeconds <= 0 || execTimeoutFactor <= 0 {
+		klog.Fatalf("Dispatch and execution timeouts must be positive, got %v, %v and factor %v", dispatchTimeoutSeconds, execTimeoutSeconds, execTimeoutFactor)
+	}
+	if shards < 1 {
+		klog.Fatalf("Shards must be positive, got %v", shards)
+	}
+	if soakMinutes > 0 && (soakReportSeconds <= 0 || soakGrowth <= 1) {
+		klog.Fatalf("Soak reports need a positive interval and a growth factor above 1, got %v and %v", soakReportSeconds, soakGrowth)
+	}
+	if runtimeFactor <= 0 {
+		klog.Fatalf("Runtime factor must be positive, got %v", runtimeFactor)
+	}
+	if fixedRuntimeMilliSec > 0 && runtimeFactor != 1 {
+		klog.Info("[WARN] Ignoring runtime factor in favor of fixed runtime")
+		runtimeFactor = 1
+	}
+	if otlpEndpoint != "" && traceSample <= 0 {
+		klog.Fatalf("Must sample requests with -trace-sample to export their spans to -otlp-endpoint")
+	}
 }
 
 func main() {
@@ -88,23 +178,76 @@ func main() {
 	if err := os.Chdir(baseDir); err != nil {
 		klog.Fatalf("Cannot enter %v: %v", baseDir, err)
 	}
-	if dirInfo, err := os.Stat(filepath.Join(baseDir, "data")); err != nil || !dirInfo.IsDir() {
-		klog.Fatalf("%v contains no data dir, consider running download.sh first", baseDir)
-	}
 
-	flag.StringVar(&gatewayFramework, "gateway", "k8s", "The gateway to use. Options: k8s, knative")
+	flag.StringVar(&gatewayFramework, "gateway", "k8s", "The gateway to use. Options: k8s, knative, dirigent, remote (the front door of a gateway elsewhere)")
 	flag.StringVar(&backendFramework, "backend", "fake", "The backend to use. Options: fake, grpc")
-	flag.StringVar(&autoscalerFramework, "autoscaler", "one-time", "The autoscaler framework to use, only applicable to k8s gateway. Options: kpa, one-time")
+	flag.StringVar(&gatewayConfig, "gateway-config", "", "The path to the gateway config file, only the knative section applies to knative gateway")
+	flag.StringVar(&autoscalerFramework, "autoscaler", "one-time", "The autoscaler framework to use, only applicable to k8s gateway. Options: any registered, built in: kpa, one-time; the kpa decider is selected in its config")
 	flag.StringVar(&autoscalerConfig, "autoscaler-config", "", "The path to the autoscaler config file, only applicable to k8s gateway")
 	flag.StringVar(&traceLoaderConfig, "loader-config", "config/loader.json", "The path to the trace loader configuration file")
-	flag.StringVar(&outputPath, "output", "trace.log", "The path to the output file")
+	flag.StringVar(&outputPath, "output", "trace.log", "The path to the output file, compressed on the fly if it ends with .gz or .zst (needs the zstd binary)")
 	flag.IntVar(&dispatchTimeoutSeconds, "timeout", 15, "The timeout in seconds for a request to be cancelled in dispatch stage")
+	flag.IntVar(&execTimeoutSeconds, "exec-timeout", 15, "The minimum timeout in seconds for a request to be cancelled in execution stage")
+	flag.Float64Var(&execTimeoutFactor, "exec-timeout-factor", 5, "The execution timeout as a multiple of the request duration, if longer than -exec-timeout")
+	flag.StringVar(&topologyConfig, "topology", "", "The path to the simulated network topology config, only applicable to fake backend")
+	flag.StringVar(&runID, "run-id", "", "If set, only replay deployments labeled with this run ID")
+	flag.IntVar(&traceSample, "trace-sample", 0, "If positive, write the gateway-side per-hop timing of every Nth request to -trace-sample-output")
+	flag.StringVar(&traceSampleOutput, "trace-sample-output", "trace.sample.log", "The path to the per-hop timing output")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "If set, also export the hops of the sampled requests as OpenTelemetry spans to this OTLP/HTTP collector, e.g., localhost:4318")
+	flag.StringVar(&adminAddr, "admin-addr", "", "If set, serve the gateway state and snapshots at this address, e.g., :8090, and stream them to observers at /watch")
+	flag.IntVar(&snapshotIntervalMilliSec, "snapshot-interval", 1000, "The interval in milliseconds to snapshot the gateway state, 0 disables snapshots")
+	flag.IntVar(&snapshotCapacity, "snapshot-capacity", 300, "The number of latest gateway snapshots to keep")
+	flag.Float64Var(&batchFraction, "batch-fraction", 0, "Fraction of the invocations tagged with the batch class, unless the deployment is labeled with kubedirect/class")
+	flag.Float64Var(&highPriorityFraction, "high-priority-fraction", 0, "Fraction of the invocations of each target dispatched one above its kubedirect/priority label, see the dispatcher priority option")
+	flag.IntVar(&sessions, "sessions", 0, "If positive, spread the invocations of each target over this many affinity keys, see the dispatcher affinity option")
+	flag.Float64Var(&runtimeFactor, "runtime-factor", 1, "Multiply the requested runtime of every invocation by this factor")
+	flag.IntVar(&fixedRuntimeMilliSec, "fixed-runtime", 0, "If positive, replace the requested runtime of every invocation with this many milliseconds")
+	flag.StringVar(&manifestPath, "manifest", "", "If set, write the run options and the API object churn of the run to this file")
+	flag.IntVar(&usageIntervalSeconds, "usage-interval", 1, "If positive, sample the CPU, RSS and goroutines of this binary every this many seconds into the manifest, 0 disables")
+	flag.IntVar(&soakMinutes, "soak-minutes", 0, "If positive, replay the trace over and over for this many minutes, reporting the health of the harness")
+	flag.IntVar(&soakReportSeconds, "soak-report-interval", 60, "The interval in seconds between soak health reports")
+	flag.Float64Var(&soakGrowth, "soak-growth", 2, "Warn when goroutines, open FDs or heap exceed this factor of the first soak report")
+	flag.IntVar(&shards, "shards", 1, "The number of trace processes sharing the targets, each replays and serves the targets it owns by consistent hashing")
+	flag.IntVar(&shardIndex, "shard-index", 0, "The shard of this process in [0, shards)")
+	flag.IntVar(&shardVirtualNodes, "shard-virtual-nodes", 0, "The number of points of each shard on the hash ring, 0 for the default, must agree across shards")
+	flag.BoolVar(&excludeUnhealthy, "exclude-unhealthy", false, "If set, drop the targets failing their health check at start instead of replaying them, recorded in the manifest")
+	flag.StringVar(&knativeDispatch, "knative-dispatch", "ingress", "How the knative gateway reaches a service, only applicable to knative gateway. Options: ingress (via Kourier), revision (via the private service of the latest ready revision), or the name of any registered dispatcher")
+	flag.StringVar(&remoteGatewayAddr, "gateway-addr", "", "The front door address of the gateway, e.g., 10.0.1.2:9090, only applicable to remote gateway")
+	flag.StringVar(&frontDoorAddr, "front-door-addr", "", "If set, also take invocations of remote load generators over gRPC at this address, e.g., :9090")
+	flag.BoolVar(&serveOnly, "serve-only", false, "If set, do not replay the trace locally, only serve the front door until interrupted")
+	flag.StringVar(&dirigentDataPlane, "dirigent-data-plane", "", "The address of the Dirigent data plane, e.g., 10.0.1.253:8080, only applicable to dirigent gateway")
 	flag.Parse()
 
+	// the in-repo fixture trace does not need the Azure dataset
+	if !workload.IsFixtureConfig(traceLoaderConfig) {
+		if dirInfo, err := os.Stat(filepath.Join(baseDir, "data")); err != nil || !dirInfo.IsDir() {
+			klog.Fatalf("%v contains no data dir, consider running download.sh first", baseDir)
+		}
+	}
 	validateFlags()
+	if runID != "" {
+		if err := workload.UseRunID(runID); err != nil {
+			klog.Fatalf("Unable to scope experiment: %v", err)
+		}
+	}
+	if shards > 1 {
+		if err := workload.UseShard(shardIndex, shards, shardVirtualNodes); err != nil {
+			klog.Fatalf("Unable to shard targets: %v", err)
+		}
+	}
 	backend.Use(backendFramework)
-	// backend.WithSLO(requestTimeoutFactor)
-	klog.InfoS("Running trace with options", "backend", backendFramework, "gateway", gatewayFramework, "timeout", dispatchTimeoutSeconds, "autoscaler", autoscalerFramework, "autoscaler-config", autoscalerConfig, "loader-config", traceLoaderConfig, "output", outputPath, "dir", baseDir)
+	if topologyConfig != "" {
+		if backendFramework != "fake" {
+			klog.Fatalf("Network topology can only be simulated with fake backend, got %v", backendFramework)
+		}
+		netTopology, err := topology.NewTopologyFrom(topologyConfig)
+		if err != nil {
+			klog.Fatalf("Unable to load network topology: %v", err)
+		}
+		backend.WithTopology(netTopology)
+	}
+	backend.WithExecTimeout(time.Duration(execTimeoutSeconds)*time.Second, execTimeoutFactor)
+	klog.InfoS("Running trace with options", "backend", backendFramework, "gateway", gatewayFramework, "gateway-config", gatewayConfig, "timeout", dispatchTimeoutSeconds, "exec-timeout", execTimeoutSeconds, "exec-timeout-factor", execTimeoutFactor, "autoscaler", autoscalerFramework, "autoscaler-config", autoscalerConfig, "loader-config", traceLoaderConfig, "output", outputPath, "topology", topologyConfig, "run-id", runID, "dirigent-data-plane", dirigentDataPlane, "knative-dispatch", knativeDispatch, "batch-fraction", batchFraction, "sessions", sessions, "high-priority-fraction", highPriorityFraction, "runtime-factor", runtimeFactor, "fixed-runtime", fixedRuntimeMilliSec, "trace-sample", traceSample, "otlp-endpoint", otlpEndpoint, "manifest", manifestPath, "usage-interval", usageIntervalSeconds, "soak-minutes", soakMinutes, "shard", fmt.Sprintf("%d/%d", shardIndex, shards), "admin-addr", adminAddr, "gateway-addr", remoteGatewayAddr, "front-door-addr", frontDoorAddr, "serve-only", serveOnly, "dir", baseDir)
 
 	ctx := ctrl.SetupSignalHandler()
 	ctx, cancel := context.WithCancel(ctx)
@@ -117,9 +260,21 @@ func main() {
 	gatewayImpl, err := func() (gateway.Gateway, error) {
 		switch gatewayFramework {
 		case "knative":
-			return gateway.NewKnativeGateway(dispatchTimeout)
+			gwConfig, err := gateway.NewGatewayConfigFrom(gatewayConfig)
+			if err != nil {
+				return nil, err
+			}
+			return gateway.NewKnativeGateway(dispatchTimeout, knativeDispatch, gwConfig)
+		case "dirigent":
+			return gateway.NewDirigentGateway(dispatchTimeout, dirigentDataPlane)
 		case "k8s":
-			return gateway.NewK8sGateway(dispatchTimeout, autoscalerFramework, autoscalerConfig)
+			gwConfig, err := gateway.NewGatewayConfigFrom(gatewayConfig)
+			if err != nil {
+				return nil, err
+			}
+			return gateway.NewK8sGateway(dispatchTimeout, gwConfig, autoscalerFramework, autoscalerConfig)
+		case "remote":
+			return gateway.NewRemoteGateway(remoteGatewayAddr)
 		default:
 			panic(fmt.Sprintf("unknown gateway framework %v", gatewayFramework))
 		}
@@ -127,19 +282,70 @@ func main() {
 	if err != nil {
 		klog.Fatalf("Unable to create %v gateway: %v", gatewayFramework, err)
 	}
-	if err := gatewayImpl.SetUpWithManager(ctx, mgr); err != nil {
-		klog.Fatalf("Unable to setup %v gateway with manager: %v", gatewayFramework, err)
+	if err := gatewayImpl.SampleHops(traceSample, traceSampleOutput); err != nil {
+		klog.Fatalf("Unable to sample %v gateway: %v", gatewayFramework, err)
+	}
+	if err := gatewayImpl.ExportSpans(otlpEndpoint); err != nil {
+		klog.Fatalf("Unable to export spans of %v gateway: %v", gatewayFramework, err)
 	}
 
+	// the client loads the traces before the autoscaler is created, so it can adapt to them
 	klog.Info("Creating client")
+	replay.TagBatch(batchFraction)
+	replay.UseSessions(sessions)
+	replay.RaisePriority(highPriorityFraction)
+	replay.Soak(time.Duration(soakMinutes) * time.Minute)
+	replay.ScaleRuntime(runtimeFactor, fixedRuntimeMilliSec)
 	client, err := replay.NewClient(ctx, gatewayImpl, traceLoaderConfig, outputPath)
 	if err != nil {
 		klog.Fatalf("Unable to create client: %v", err)
 	}
+	traceStats, err := client.FunctionStats(ctx, mgr)
+	if err != nil {
+		klog.Fatalf("Unable to get trace statistics: %v", err)
+	}
+	autoscaler.AdaptToTrace(traceStats)
+
+	// broken targets would only add failures to the results, drop them before anything registers them
+	unhealthy, err := replay.CheckHealth(ctx, mgr)
+	if err != nil {
+		klog.Fatalf("Unable to check target health: %v", err)
+	}
+	if excludeUnhealthy && len(unhealthy) > 0 {
+		keys := make([]string, 0, len(unhealthy))
+		for key := range unhealthy {
+			keys = append(keys, key)
+		}
+		workload.ExcludeKeys(keys...)
+		klog.InfoS("Excluding unhealthy targets", "targets", workload.ExcludedKeys())
+	}
+
+	if err := gatewayImpl.SetUpWithManager(ctx, mgr); err != nil {
+		klog.Fatalf("Unable to setup %v gateway with manager: %v", gatewayFramework, err)
+	}
 	if err := client.SetupWithManager(ctx, mgr); err != nil {
 		klog.Fatalf("Unable to setup client with manager: %v", err)
 	}
 
+	// count the churn of the trace objects of this run
+	runManifest := newManifest()
+	runManifest.Unhealthy = unhealthy
+	runManifest.Excluded = workload.ExcludedKeys()
+	churnSelector, err := labels.Parse(workload.MetaV1ListOptionsForTrace.LabelSelector)
+	if err != nil {
+		klog.Fatalf("Invalid trace selector: %v", err)
+	}
+	churn := benchutil.NewChurnCounter(churnSelector)
+	if err := churn.Watch(ctx, mgr.GetCache(), &appsv1.Deployment{}, &appsv1.ReplicaSet{}, &corev1.Pod{}); err != nil {
+		klog.Fatalf("Unable to count API object churn: %v", err)
+	}
+
+	var usage *benchutil.UsageSampler
+	if usageIntervalSeconds > 0 {
+		usage = benchutil.NewUsageSampler("trace", time.Duration(usageIntervalSeconds)*time.Second)
+		go usage.Run(ctx)
+	}
+
 	klog.Info("Starting manager")
 	// mgr.Start blocks, must run it in another goroutine
 	go func() {
@@ -155,17 +361,45 @@ func main() {
 	<-time.After(5 * time.Second)
 	klog.Infof("Starting %v gateway", gatewayFramework)
 	go gatewayImpl.Start(ctx)
+	if adminAddr != "" {
+		gatewayImpl.StartSnapshots(ctx, time.Duration(snapshotIntervalMilliSec)*time.Millisecond, snapshotCapacity)
+		go func() {
+			if err := gatewayImpl.ServeAdmin(ctx, adminAddr); err != nil {
+				klog.Errorf("Gateway admin endpoint stopped: %v", err)
+			}
+		}()
+	}
+	if frontDoorAddr != "" {
+		go func() {
+			if err := gatewayImpl.ServeFrontDoor(ctx, frontDoorAddr); err != nil {
+				klog.Errorf("Gateway front door stopped: %v", err)
+			}
+		}()
+	}
 
 	<-time.After(5 * time.Second)
-	klog.Info("Starting client")
-	go client.Start(ctx)
+	if serveOnly {
+		klog.Info("Recording the invocations through the front door only")
+		client.Record(ctx)
+	} else {
+		klog.Info("Starting client")
+		go client.Start(ctx)
+	}
+	if soakMinutes > 0 {
+		go monitorSoak(ctx, mgr.GetClient(), gatewayImpl, time.Duration(soakReportSeconds)*time.Second, soakGrowth)
+	}
 
 	select {
 	case <-ctx.Done():
 		klog.Info("Received signal")
 	case <-client.FinishSend():
 		klog.Info("Client finished")
-		<-time.After(15 * time.Second)
+		// grace period for the requests in flight, cut short once every target is drained
+		select {
+		case <-client.Drained():
+			klog.Info("All targets drained")
+		case <-time.After(15 * time.Second):
+		}
 	}
 	// cancel context to stop everything
 	cancel()
@@ -174,5 +408,18 @@ func main() {
 	gatewayImpl.Close()
 	<-client.FinishRecv()
 
+	totals := churn.Totals()
+	klog.InfoS("API object churn", "churn", totals)
+	if usage != nil {
+		report := usage.Report()
+		klog.InfoS("Resource usage", "meanCores", fmt.Sprintf("%.2f", report.MeanCores), "peakCores", fmt.Sprintf("%.2f", report.PeakCores),
+			"meanRssMiB", int(report.MeanRSSMiB), "peakRssMiB", int(report.PeakRSSMiB), "peakGoroutines", report.PeakGoroutine)
+	}
+	if manifestPath != "" {
+		if err := runManifest.write(manifestPath, churn, usage); err != nil {
+			klog.Errorf("Unable to write manifest: %v", err)
+		}
+	}
+
 	klog.Info("Finished trace")
 }
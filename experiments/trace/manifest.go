@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+)
+
+// manifest records what a run was and what it cost the control plane
+type manifest struct {
+	RunID            string                     `json:"runId"`
+	Gateway          string                     `json:"gateway"`
+	Backend          string                     `json:"backend"`
+	Autoscaler       string                     `json:"autoscaler"`
+	GatewayConfig    string                     `json:"gatewayConfig"`
+	AutoscalerConfig string                     `json:"autoscalerConfig"`
+	LoaderConfig     string                     `json:"loaderConfig"`
+	Output           string                     `json:"output"`
+	Shard            int                        `json:"shard"`
+	Shards           int                        `json:"shards"`
+	Start            time.Time                  `json:"start"`
+	End              time.Time                  `json:"end"`
+	Churn            map[string]benchutil.Churn `json:"churn"`
+	// resource usage of the trace binary, the custom kubelets report theirs separately
+	Usage *benchutil.UsageReport `json:"usage,omitempty"`
+	// targets failing their health check at start by key, and those dropped with -exclude-unhealthy
+	Unhealthy map[string]string `json:"unhealthy,omitempty"`
+	Excluded  []string          `json:"excluded,omitempty"`
+}
+
+func newManifest() *manifest {
+	return &manifest{
+		RunID:            runID,
+		Gateway:          gatewayFramework,
+		Backend:          backendFramework,
+		Autoscaler:       autoscalerFramework,
+		GatewayConfig:    gatewayConfig,
+		AutoscalerConfig: autoscalerConfig,
+		LoaderConfig:     traceLoaderConfig,
+		Output:           outputPath,
+		Shard:            shardIndex,
+		Shards:           shards,
+		Start:            time.Now(),
+	}
+}
+
+func (m *manifest) write(path string, churn *benchutil.ChurnCounter, usage *benchutil.UsageSampler) error {
+	m.End = time.Now()
+	m.Churn = churn.Totals()
+	if usage != nil {
+		m.Usage = usage.Report()
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %v: %v", path, err)
+	}
+	return nil
+}
@@ -6,8 +6,11 @@ Usage: python plot.py <run_id>
   run_id: the experiment run identifier (e.g., test)
 """
 
+import gzip
+import io
 import os
 import re
+import subprocess
 import sys
 import pandas as pd
 import numpy as np
@@ -48,6 +51,20 @@ def cdf(df, column):
     return res
 
 
+def open_log(path):
+    """Open a trace log as text, falling back to its .gz or .zst copy and decompressing it."""
+    for candidate in (path, path + '.gz', path + '.zst'):
+        if os.path.exists(candidate):
+            path = candidate
+            break
+    if path.endswith('.gz'):
+        return gzip.open(path, 'rt')
+    if path.endswith('.zst'):
+        output = subprocess.run(['zstd', '-q', '-d', '-c', path], check=True, capture_output=True).stdout
+        return io.StringIO(output.decode())
+    return open(path, 'r')
+
+
 def get_slowdown_curve(path, is_csv=True, filter_timeout=False):
     """
     Calculate per-function average slowdown CDF.
@@ -98,7 +115,7 @@ def get_slowdown_curve(path, is_csv=True, filter_timeout=False):
         pattern = r"ID: default/trace-(\d+)-(\d+)/(\d+),.*TS: ([\d.]+)s,.*Delay: \+([\d.]+)ms,.*Runtime: ([\d.]+)/(\d+)ms"
         data_list = []
 
-        with open(path, 'r') as file:
+        with open_log(path) as file:
             for line in file:
                 match = re.match(pattern, line.strip())
                 if match:
@@ -189,7 +206,7 @@ def get_scheduling_latency_curve(path, is_csv=True, filter_outliers=False, filte
         pattern = r"ID: default/trace-(\d+)-(\d+)/(\d+),.*TS: ([\d.]+)s,.*Delay: \+([\d.]+)ms,.*Runtime: ([\d.]+)/(\d+)ms"
         data_list = []
 
-        with open(path, 'r') as file:
+        with open_log(path) as file:
             for line in file:
                 match = re.match(pattern, line.strip())
                 if match:
@@ -0,0 +1,45 @@
+#! /usr/bin/env bash
+
+BASE_DIR=`realpath $(dirname $0)`
+cd $BASE_DIR
+. util.sh
+lock
+
+set -x
+
+USAGE="repeat.sh #reps [#traces] [baselines...]"
+
+reps=$1
+if ! [[ -n "$reps" && "$reps" =~ ^[0-9]+$ && "$reps" -gt 0 ]]; then
+    echo "Usage: $USAGE"
+    exit 1
+fi
+shift
+n_traces=${1:-"500"}
+shift
+baselines=${@:-"k8s+ kd+"}
+verbosity=${VERBOSITY:-"1"}
+
+RUN=${RUN:-"test"}
+setup_dirs repeat || exit 1
+
+kubeadm_up
+custom_kubelet_up
+for ((rep = 0; rep < reps; rep++)); do
+    # interleave the baselines and rotate their order every repetition,
+    # so that time-of-day effects on a shared cluster do not favor a baseline
+    order=($baselines)
+    shift_by=$((rep % ${#order[@]}))
+    order=("${order[@]:$shift_by}" "${order[@]:0:$shift_by}")
+    for baseline in "${order[@]}"; do
+        RUN_ID=$(run_id_for $baseline)-rep$rep ./run.sh $baseline $n_traces -- -backend=grpc -v=$verbosity
+        cp ./trace.log $RESULTS/$baseline.$n_traces.rep$rep.log
+        cp ./stderr.log $RESULTS/stderr/$baseline.$n_traces.rep$rep.log
+        cp ./trace.manifest.json $RESULTS/$baseline.$n_traces.rep$rep.manifest.json
+        sleep 60
+    done
+done
+custom_kubelet_down
+kubeadm_down
+
+go run ../../cmd/kubedirect-bench report repeat $RESULTS | tee $RESULTS/repeat.txt
@@ -6,26 +6,35 @@ cd $BASE_DIR
 
 set -x
 
-USAGE="run.sh kd|k8s+|kd+ [#traces] -- args..."
+USAGE="run.sh kd|k8s+|kd+|dirigent [#traces] -- args..."
 # kn args: -v=1 [-backend=grpc]
 # k8s+|kd+ args: -v=1 -backend=[grpc|fake] 
+# CANARY_REPLICAS=N also creates a static canary of N pods per trace, pass a gateway config with a canary weight
+# SHARDS=N splits the targets across N trace processes, each writing trace.$i.log, do not pass a fixed -admin-addr
+# DISCOVERY=endpointslices also creates a Service per trace, pass a gateway config with "discovery: endpointslices"
+# DISCOVERY=dns also creates a headless Service per trace, pass a gateway config with "discovery: dns"
 
 tag=${TAG:-"dev"}
 export IMAGE=${IMAGE:-"shengqipku/kubedirect-bench:$tag"}
+# every object of this run is labeled with the run ID, so concurrent runs do not interfere
+export RUN_ID=${RUN_ID:-"trace-$(date +%s)"}
 
 # args inferred from baseline:
 # - arg_gateway, arg_autoscaler, arg_autoscaler_config
 # args from caller:
 # - arg_backend
-arg_loader="-loader-config=config/loader.json"
+arg_loader="-loader-config=${LOADER:-config/loader.json}"
 arg_output="-output=trace.log"
+arg_run_id="-run-id=$RUN_ID"
+arg_manifest="-manifest=trace.manifest.json"
 
 baseline=$1
 case $baseline in
     "kd")
         trace_template="config/kd.ksvc.template.yaml"
         workload_daemonset="config/kd.daemonset.yaml"
-        arg_gateway="-gateway=knative"
+        # KNATIVE_DISPATCH=revision bypasses Kourier and the activator, see -knative-dispatch
+        arg_gateway="-gateway=knative -knative-dispatch=${KNATIVE_DISPATCH:-ingress}"
         arg_timeout="-timeout=300"
         ;;
     # NOTE: for + baselines, caller should setup custom kubelet service WITHOUT --simulate flag
@@ -45,6 +54,13 @@ case $baseline in
         arg_autoscaler="-autoscaler=kpa"
         arg_autoscaler_config="-autoscaler-config=config/autoscaler.dirigent.yaml"
         ;;
+    # NOTE: functions trace-0..N must be registered in a running Dirigent cluster beforehand
+    "dirigent")
+        # the deployments stay at zero replicas and only name the targets
+        trace_template="config/k8s.deployment.template.yaml"
+        arg_gateway="-gateway=dirigent -dirigent-data-plane=${DIRIGENT_DATA_PLANE:?must set DIRIGENT_DATA_PLANE}"
+        arg_timeout="-timeout=30"
+        ;;
     *)
         echo "Usage: $USAGE"
         exit 1
@@ -74,41 +90,71 @@ case "$1" in
     ;;
 esac
 
-echo "Running trace experiment: baseline=$baseline, #traces=$n_traces"
+# fail fast on config typos instead of silently running with zero values
+go run ../../cmd/kubedirect-bench validate-config $arg_autoscaler_config $arg_loader || exit 1
+
+echo "Running trace experiment: baseline=$baseline, #traces=$n_traces, run=$RUN_ID"
 
 for ((i = 0; i < n_traces; i++)); do
     export NAME="trace-$i"
     cat $trace_template | envsubst | kubectl apply -f -
+    if [ -n "$CANARY_REPLICAS" ]; then
+        cat config/k8s.deployment.canary.template.yaml | envsubst | kubectl apply -f -
+    fi
+    if [ "$DISCOVERY" == "endpointslices" ]; then
+        cat config/k8s.service.template.yaml | envsubst | kubectl apply -f -
+    elif [ "$DISCOVERY" == "dns" ]; then
+        cat config/k8s.service.headless.template.yaml | envsubst | kubectl apply -f -
+    fi
 done
 
-# create daemonset
-export NAME="workload-daemonset"
-cat $workload_daemonset | envsubst | kubectl apply -f -
-
-# read -p "Press enter to continue..."
-sleep 120
+if [ -n "$workload_daemonset" ]; then
+    # create daemonset
+    export NAME="workload-daemonset"
+    cat $workload_daemonset | envsubst | kubectl apply -f -
 
-# wait for daemonsets
-wait_for_pods "kubedirect/workload-pool"
+    # read -p "Press enter to continue..."
+    sleep 120
 
-echo "Starting trace client with args: $@ $arg_gateway $arg_timeout $arg_autoscaler $arg_autoscaler_config $arg_loader $arg_output"
+    # wait for daemonsets
+    wait_for_pods "kubedirect/workload-pool"
+fi
 
-go run . $@ $arg_gateway $arg_timeout $arg_autoscaler $arg_autoscaler_config $arg_loader $arg_output \
-    >stderr.log 2>&1
+echo "Starting trace client with args: $@ $arg_gateway $arg_timeout $arg_autoscaler $arg_autoscaler_config $arg_loader $arg_output $arg_run_id $arg_manifest"
+
+if [ -n "$SHARDS" ] && [ "$SHARDS" -gt 1 ]; then
+    go build -o trace.bin . || exit 1
+    for ((i = 0; i < SHARDS; i++)); do
+        ./trace.bin $@ $arg_gateway $arg_timeout $arg_autoscaler $arg_autoscaler_config $arg_loader $arg_run_id \
+            -output=trace.$i.log -manifest=trace.$i.manifest.json -shards=$SHARDS -shard-index=$i \
+            >stderr.$i.log 2>&1 &
+    done
+    wait
+    rm -f trace.bin
+else
+    go run . $@ $arg_gateway $arg_timeout $arg_autoscaler $arg_autoscaler_config $arg_loader $arg_output $arg_run_id $arg_manifest \
+        >stderr.log 2>&1
+fi
 
-# cleanup
+# cleanup, only objects of this run
 sleep 30
+run_selector="kubedirect/run-id=$RUN_ID"
 case $baseline in
 "kd")
-    kubectl delete ksvc --all || true
-    kubectl delete cfg --all || true
-    kubectl delete rev --all || true
-    kubectl delete route --all || true
-    kubectl delete deployment -l workload=trace || true
-    kubectl delete replicaset -l workload=trace || true
+    kubectl delete ksvc -l $run_selector || true
+    kubectl delete cfg -l $run_selector || true
+    kubectl delete rev -l $run_selector || true
+    kubectl delete route -l $run_selector || true
+    kubectl delete deployment -l workload=trace,$run_selector || true
+    kubectl delete replicaset -l workload=trace,$run_selector || true
     ;;
-"k8s+"|"kd+")
-    kubectl delete deployment -l workload=trace || true
+"k8s+"|"kd+"|"dirigent")
+    kubectl delete deployment -l workload=trace,$run_selector || true
+    kubectl delete service -l workload=trace,$run_selector || true
+    kubectl delete deployment -l workload=trace-canary,$run_selector || true
     ;;
 esac
-cat $workload_daemonset | envsubst | kubectl delete -f -
+if [ -n "$workload_daemonset" ]; then
+    export NAME="workload-daemonset"
+    cat $workload_daemonset | envsubst | kubectl delete -f -
+fi
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// soakHealth is what a long run of the harness itself should keep flat
+type soakHealth struct {
+	Goroutines int
+	FDs        int
+	HeapMiB    float64
+	SysMiB     float64
+	// endpoints the gateway holds beyond the ready pods of their target, and ready pods it does not hold yet
+	StaleEndpoints   int
+	MissingEndpoints int
+}
+
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func checkSoakHealth(ctx context.Context, c client.Client, gw gateway.Gateway) soakHealth {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	health := soakHealth{
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        openFDs(),
+		HeapMiB:    float64(mem.HeapAlloc) / (1 << 20),
+		SysMiB:     float64(mem.Sys) / (1 << 20),
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, workload.CtrlListOptionsForTrace...); err != nil {
+		klog.V(1).InfoS("[WARN] Failed to list pods for soak health", "error", err)
+		return health
+	}
+	ready := make(map[string]int)
+	for i := range pods.Items {
+		if backend.IsPodReady(&pods.Items[i]) {
+			ready[workload.KeyFromObject(&pods.Items[i])]++
+		}
+	}
+	for key, ks := range gw.Snapshot().Keys {
+		if ks.Endpoints == nil {
+			continue
+		}
+		if diff := *ks.Endpoints - ready[key]; diff > 0 {
+			health.StaleEndpoints += diff
+		} else {
+			health.MissingEndpoints -= diff
+		}
+	}
+	return health
+}
+
+// monitorSoak reports the health of the harness every interval, warning when goroutines, FDs or heap
+// grow beyond growth times the first report; stale endpoints may show briefly while pods churn
+func monitorSoak(ctx context.Context, c client.Client, gw gateway.Gateway, interval time.Duration, growth float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var baseline *soakHealth
+	start := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		health := checkSoakHealth(ctx, c, gw)
+		klog.InfoS("Soak health", "elapsed", time.Since(start).Round(time.Second), "goroutines", health.Goroutines, "fds", health.FDs,
+			"heapMiB", int(health.HeapMiB), "sysMiB", int(health.SysMiB), "staleEndpoints", health.StaleEndpoints, "missingEndpoints", health.MissingEndpoints)
+		if baseline == nil {
+			baseline = &health
+			continue
+		}
+		if float64(health.Goroutines) > growth*float64(baseline.Goroutines) {
+			klog.InfoS("[WARN] Soak: goroutines grew", "baseline", baseline.Goroutines, "now", health.Goroutines)
+		}
+		if baseline.FDs > 0 && float64(health.FDs) > growth*float64(baseline.FDs) {
+			klog.InfoS("[WARN] Soak: open FDs grew", "baseline", baseline.FDs, "now", health.FDs)
+		}
+		if health.HeapMiB > growth*baseline.HeapMiB {
+			klog.InfoS("[WARN] Soak: heap grew", "baselineMiB", int(baseline.HeapMiB), "nowMiB", int(health.HeapMiB))
+		}
+	}
+}
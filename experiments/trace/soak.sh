@@ -0,0 +1,27 @@
+#! /usr/bin/env bash
+
+BASE_DIR=`realpath $(dirname $0)`
+cd $BASE_DIR
+
+set -x
+
+USAGE="soak.sh k8s+|kd+ [minutes] -- args..."
+# loops the in-repo fixture trace to validate the harness itself before multi-hour runs,
+# watch for "Soak health" and "[WARN] Soak" in stderr.log
+
+baseline=$1
+minutes=${2:-"240"}
+if [ -z "$baseline" ]; then
+    echo "Usage: $USAGE"
+    exit 1
+fi
+shift
+if [[ -n "$1" && "$1" =~ ^[0-9]*$ ]] ; then
+    shift
+fi
+if [ "$1" == "--" ]; then
+    shift
+fi
+
+n_traces=`python3 -c "import json; print(len(json.load(open('fixture/trace.json'))['functions']))"`
+LOADER=config/loader.fixture.json ./run.sh $baseline $n_traces -- -soak-minutes=$minutes $@
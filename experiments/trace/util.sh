@@ -23,6 +23,13 @@ function setup_dirs {
     fi
 }
 
+# usage: run_id_for <baseline>
+# label-safe run ID of a baseline in the current RUN
+function run_id_for {
+    local baseline=${1//+/-plus}
+    echo "${RUN:-test}-$baseline"
+}
+
 # usage: kubeadm_up [large] [debug] [#workers]
 function kubeadm_up {
     # loop until kubeadm is up
@@ -45,7 +52,7 @@ function custom_kubelet_up {
     if [ "$1" == "watch" ]; then
         local verbose="-v=2"
     fi
-    $ROOT_DIR/scripts/kubelet.sh run $@ -- -ready-after=200 $verbose
+    $ROOT_DIR/scripts/kubelet.sh run $@ -- -ready-after=200 -usage-interval=5 -usage-output=.kubedirect/kubelet-usage.json $verbose
     sleep 60
 }
 
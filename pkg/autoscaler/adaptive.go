@@ -0,0 +1,133 @@
+package autoscaler
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// AdaptivePanicConfig derives the windows and panic threshold of each target from its trace statistics:
+// busy targets have enough samples to react on shorter windows, while targets averaging a fraction of a pod
+// would panic on every single request, so their threshold is raised by the relative noise of their load
+type AdaptivePanicConfig struct {
+	// targets at this average RPS keep the configured windows, busier ones get shorter windows and vice versa
+	ReferenceRPS float64 `yaml:"referenceRPS"`
+	// bounds of the window factor, i.e., sqrt(referenceRPS / average RPS)
+	MinWindowFactor float64 `yaml:"minWindowFactor"`
+	MaxWindowFactor float64 `yaml:"maxWindowFactor"`
+	// the stable window is never shorter than this many p99 runtimes
+	RuntimeMultiple float64 `yaml:"runtimeMultiple"`
+	// the threshold is raised by at most this factor
+	MaxThresholdFactor float64 `yaml:"maxThresholdFactor"`
+}
+
+// the minimum stable window in Knative
+const minStableWindow = 6 * time.Second
+
+func (cfg *AdaptivePanicConfig) complete() {
+	if cfg.ReferenceRPS == 0 {
+		cfg.ReferenceRPS = 1
+	}
+	if cfg.MinWindowFactor == 0 {
+		cfg.MinWindowFactor = 0.25
+	}
+	if cfg.MaxWindowFactor == 0 {
+		cfg.MaxWindowFactor = 4
+	}
+	if cfg.RuntimeMultiple == 0 {
+		cfg.RuntimeMultiple = 10
+	}
+	if cfg.MaxThresholdFactor == 0 {
+		cfg.MaxThresholdFactor = 4
+	}
+}
+
+func (cfg *AdaptivePanicConfig) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.ReferenceRPS < 0 || cfg.MinWindowFactor < 0 || cfg.MaxWindowFactor < 0 || cfg.RuntimeMultiple < 0 || cfg.MaxThresholdFactor < 0 {
+		return fmt.Errorf("fields cannot be negative")
+	}
+	if cfg.MinWindowFactor > 0 && cfg.MaxWindowFactor > 0 && cfg.MinWindowFactor > cfg.MaxWindowFactor {
+		return fmt.Errorf("minWindowFactor %v exceeds maxWindowFactor %v", cfg.MinWindowFactor, cfg.MaxWindowFactor)
+	}
+	if cfg.MaxThresholdFactor > 0 && cfg.MaxThresholdFactor < 1 {
+		return fmt.Errorf("maxThresholdFactor must be at least 1, got %v", cfg.MaxThresholdFactor)
+	}
+	return nil
+}
+
+// per-function statistics of the loaded trace, by the key of the target replaying it
+var traceStats map[string]*workload.FunctionStats
+
+// AdaptToTrace provides the trace statistics for adaptive panic, must be called before the autoscaler is created
+func AdaptToTrace(stats map[string]*workload.FunctionStats) {
+	traceStats = stats
+}
+
+type panicParams struct {
+	stableWindow   time.Duration
+	panicWindow    time.Duration
+	panicThreshold float64
+	// never panic, scale on the stable window only
+	disabled bool
+}
+
+// derive scales the configured parameters for the given function
+func (cfg *AdaptivePanicConfig) derive(base panicParams, panicWindowFraction, targetConcurrency float64, stats *workload.FunctionStats) panicParams {
+	if stats == nil || stats.Invocations == 0 || stats.AverageRPS <= 0 {
+		return base
+	}
+	factor := math.Sqrt(cfg.ReferenceRPS / stats.AverageRPS)
+	factor = math.Min(math.Max(factor, cfg.MinWindowFactor), cfg.MaxWindowFactor)
+	stable := time.Duration(factor * float64(base.stableWindow))
+	stable = max(stable, minStableWindow, time.Duration(cfg.RuntimeMultiple*float64(stats.RuntimeP99))*time.Millisecond)
+	// Poisson arrivals fluctuate by 1/sqrt(n) relative to an average of n pods
+	thresholdFactor := cfg.MaxThresholdFactor
+	if pods := stats.AverageConcurrency / targetConcurrency; pods > 0 {
+		thresholdFactor = math.Min(1+1/math.Sqrt(pods), cfg.MaxThresholdFactor)
+	}
+	return panicParams{
+		stableWindow:   stable,
+		panicWindow:    time.Duration(panicWindowFraction * float64(stable)),
+		panicThreshold: base.panicThreshold * thresholdFactor,
+		disabled:       base.disabled,
+	}
+}
+
+// panicParamsFor returns the parameters of each key with its overrides applied, adapted to the trace if configured
+func (cfg *KnativeAutoscalerConfig) panicParamsFor(logger logr.Logger, keys []string) map[string]panicParams {
+	params := make(map[string]panicParams, len(keys))
+	for _, key := range keys {
+		windowPercentage, thresholdPercentage := cfg.panicPercentages(key)
+		params[key] = panicParams{
+			stableWindow:   time.Duration(cfg.StableWindowSeconds) * time.Second,
+			panicWindow:    time.Duration(windowPercentage/100*cfg.StableWindowSeconds) * time.Second,
+			panicThreshold: thresholdPercentage / 100,
+			disabled:       cfg.panicDisabled(key),
+		}
+	}
+	if cfg.AdaptivePanic == nil {
+		return params
+	}
+	cfg.AdaptivePanic.complete()
+	for _, key := range keys {
+		stats, ok := traceStats[key]
+		if !ok {
+			logger.Info("[WARN] No trace statistics for adaptive panic, using the configured windows", "target", key)
+			continue
+		}
+		windowPercentage, _ := cfg.panicPercentages(key)
+		derived := cfg.AdaptivePanic.derive(params[key], windowPercentage/100, cfg.TargetConcurrency, stats)
+		params[key] = derived
+		logger.Info("Adaptive panic", "target", key, "avgRPS", fmt.Sprintf("%.3f", stats.AverageRPS), "avgConcurrency", fmt.Sprintf("%.3f", stats.AverageConcurrency), "p99Runtime", stats.RuntimeP99,
+			"stable", derived.stableWindow, "panic", derived.panicWindow, "threshold", fmt.Sprintf("%.2f", derived.panicThreshold))
+	}
+	return params
+}
@@ -0,0 +1,67 @@
+package autoscaler
+
+import (
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+)
+
+func (s *autoscalerImpl) countChurn(from, to int) {
+	atomic.AddInt64(&s.nScaled, 1)
+	if to > from {
+		atomic.AddInt64(&s.replicasAdded, int64(to-from))
+	} else {
+		atomic.AddInt64(&s.replicasRemoved, int64(from-to))
+	}
+}
+
+// logChurn reports the replica churn of the scale writes, and how the fractional decisions were rounded if dithered
+func (s *autoscalerImpl) logChurn(logger logr.Logger) {
+	var up, down int64
+	for _, d := range s.deciders {
+		if reporter, ok := d.(decider.DitherReporter); ok {
+			u, dn := reporter.DitherStats()
+			up += u
+			down += dn
+		}
+	}
+	logger.Info("Scale churn", "writes", atomic.LoadInt64(&s.nScaled), "added", atomic.LoadInt64(&s.replicasAdded), "removed", atomic.LoadInt64(&s.replicasRemoved), "ditheredUp", up, "ditheredDown", down)
+}
+
+// logPredictions reports how often the forecast raised the reactive decisions, if any decider predicts
+func (s *autoscalerImpl) logPredictions(logger logr.Logger) {
+	var raised int64
+	predicting := false
+	for _, d := range s.deciders {
+		if reporter, ok := d.(decider.PredictionReporter); ok {
+			predicting = true
+			raised += reporter.PredictionStats()
+		}
+	}
+	if predicting {
+		logger.Info("Predictive scaling", "raised", raised)
+	}
+}
+
+// logComposite reports which metric dominated the decisions of the composite deciders, if any
+func (s *autoscalerImpl) logComposite(logger logr.Logger) {
+	var dominant map[string]int64
+	for _, d := range s.deciders {
+		reporter, ok := d.(decider.CompositeReporter)
+		if !ok {
+			continue
+		}
+		for metric, n := range reporter.CompositeStats() {
+			if dominant == nil {
+				dominant = make(map[string]int64)
+			}
+			dominant[metric] += n
+		}
+	}
+	if dominant != nil {
+		logger.Info("Composite scaling", "dominant", dominant)
+	}
+}
@@ -0,0 +1,69 @@
+package autoscaler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+type reconcileInput struct {
+	at       time.Time
+	nReady   int
+	snapshot metric.Snapshot
+}
+
+// coalescer collapses scaling triggers of the same key that carry no new information.
+// The workqueue already merges triggers while a key is pending, but not those arriving
+// right after a reconcile has started, e.g., the sync triggers in ReqIn during scale-from-zero.
+// We skip a reconcile if the previous one ran within half a tick on the exact same inputs.
+type coalescer struct {
+	mu     sync.Mutex
+	window time.Duration
+	last   map[string]reconcileInput
+	// triggers counts enqueued keys; reconciles counts those that reach the decider
+	triggers   int64
+	reconciles int64
+}
+
+func newCoalescer(tickInterval time.Duration) *coalescer {
+	return &coalescer{
+		window: tickInterval / 2,
+		last:   make(map[string]reconcileInput),
+	}
+}
+
+func (c *coalescer) trigger() {
+	atomic.AddInt64(&c.triggers, 1)
+}
+
+// skip returns true if the reconcile is redundant, otherwise records the inputs
+func (c *coalescer) skip(key string, now time.Time, nReady int, snapshot metric.Snapshot) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.last[key]; ok && now.Sub(last.at) < c.window && last.nReady == nReady && last.snapshot == snapshot {
+		return true
+	}
+	c.last[key] = reconcileInput{at: now, nReady: nReady, snapshot: snapshot}
+	atomic.AddInt64(&c.reconciles, 1)
+	return false
+}
+
+// stats returns #triggers, #reconciles, and the reduction ratio
+// NOTE: the reduction includes both workqueue dedup and coalesced reconciles
+func (c *coalescer) stats() (int64, int64, float64) {
+	triggers := atomic.LoadInt64(&c.triggers)
+	reconciles := atomic.LoadInt64(&c.reconciles)
+	if triggers == 0 {
+		return 0, 0, 0
+	}
+	return triggers, reconciles, 1 - float64(reconciles)/float64(triggers)
+}
+
+func (s *autoscalerImpl) enqueue(key string) {
+	s.coalescer.trigger()
+	s.queue.Add(key)
+	s.queueTracker.added(key, time.Now(), s.queue.Len())
+}
@@ -0,0 +1,81 @@
+package autoscaler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// CostReport summarizes the capacity an autoscaler kept ready during a run
+type CostReport struct {
+	// integral of ready replicas over time
+	PodSeconds float64
+	// pod-seconds weighted by the per-replica cost of each target
+	Cost float64
+}
+
+// CostReporter is implemented by autoscalers that account for the replicas they keep
+type CostReporter interface {
+	Cost() CostReport
+}
+
+type readyObservation struct {
+	at    time.Time
+	ready int
+}
+
+// costAccountant integrates the ready replicas observed at each reconcile.
+// The replica count is assumed to hold until the next observation of the same key.
+type costAccountant struct {
+	mu            sync.Mutex
+	defaultWeight float64
+	weights       map[string]float64
+	last          map[string]readyObservation
+	podSeconds    map[string]float64
+}
+
+func newCostAccountant(logger logr.Logger, defaultWeight float64, weights map[string]float64) *costAccountant {
+	if weights == nil {
+		weights = make(map[string]float64)
+	}
+	logger.V(1).Info("Cost accounting", "replicaCost", defaultWeight, "overrides", len(weights))
+	return &costAccountant{
+		defaultWeight: defaultWeight,
+		weights:       weights,
+		last:          make(map[string]readyObservation),
+		podSeconds:    make(map[string]float64),
+	}
+}
+
+func (c *costAccountant) weight(key string) float64 {
+	if weight, ok := c.weights[key]; ok {
+		return weight
+	}
+	return c.defaultWeight
+}
+
+func (c *costAccountant) observe(key string, now time.Time, ready int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.last[key]; ok && now.After(last.at) {
+		c.podSeconds[key] += float64(last.ready) * now.Sub(last.at).Seconds()
+	}
+	c.last[key] = readyObservation{at: now, ready: ready}
+}
+
+// report extends the last observation of each key up to now
+func (c *costAccountant) report(now time.Time) CostReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var report CostReport
+	for key, last := range c.last {
+		podSeconds := c.podSeconds[key]
+		if now.After(last.at) {
+			podSeconds += float64(last.ready) * now.Sub(last.at).Seconds()
+		}
+		report.PodSeconds += podSeconds
+		report.Cost += podSeconds * c.weight(key)
+	}
+	return report
+}
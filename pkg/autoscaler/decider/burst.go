@@ -0,0 +1,54 @@
+package decider
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// BurstCapacity exposes the excess burst capacity of each target at the gateway, like Knative's:
+// the tokens of its ready endpoints less the requests in flight and its target-burst-capacity
+type BurstCapacity interface {
+	// negative while the target is served through the activator, false without a target-burst-capacity
+	ExcessBurstCapacity(key string) (float64, bool)
+}
+
+// BurstCapacityReporter is implemented by deciders that may scale on the excess burst capacity
+type BurstCapacityReporter interface {
+	// the number of decisions raised to restore the target-burst-capacity
+	BurstBoosts() int64
+}
+
+type burstScaling struct {
+	capacity BurstCapacity
+	nBoosted int64
+}
+
+// WithBurstCapacity adds the pods a target lacks for its target-burst-capacity at the gateway
+func (k *KPADecider) WithBurstCapacity(capacity BurstCapacity) *KPADecider {
+	if capacity != nil {
+		k.burstScaling = &burstScaling{capacity: capacity}
+	}
+	return k
+}
+
+// burstFloor returns the pod count restoring the target-burst-capacity on top of the ready pods,
+// or 0 unless the excess burst capacity is negative
+func (k *KPADecider) burstFloor(observedReady int) (floor int, excess float64) {
+	if k.burstScaling == nil {
+		return 0, 0
+	}
+	excess, ok := k.burstScaling.capacity.ExcessBurstCapacity(k.Key)
+	if !ok || excess >= 0 {
+		return 0, excess
+	}
+	return observedReady + int(math.Ceil(-excess/k.targetValue)), excess
+}
+
+func (k *KPADecider) BurstBoosts() int64 {
+	if k.burstScaling == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&k.burstScaling.nBoosted)
+}
+
+var _ BurstCapacityReporter = &KPADecider{}
@@ -0,0 +1,144 @@
+package decider
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// provision for the most demanding metric
+	CompositeMax = "max"
+	// provision for the weighted average of the metrics
+	CompositeWeighted = "weighted"
+)
+
+// CompositeConfig configures the composite decider, which scales on concurrency and RPS at once:
+// each metric is converted to the pods it needs at its own target, and the pod counts are combined
+type CompositeConfig struct {
+	// Options: max (default), weighted
+	Policy string `yaml:"policy"`
+	// weights of the weighted policy, default to 1 for concurrency and RPS and 0 for the queue
+	ConcurrencyWeight *float64 `yaml:"concurrencyWeight"`
+	RPSWeight         *float64 `yaml:"rpsWeight"`
+	QueueWeight       *float64 `yaml:"queueWeight"`
+	// if set, the requests waiting at the gateway count as a third metric at the target concurrency;
+	// the gateway queue is only handed over with maxQueueDelayMilliSec
+	Queue bool `yaml:"queue"`
+}
+
+func (cfg *CompositeConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Policy {
+	case "", CompositeMax, CompositeWeighted:
+	default:
+		return fmt.Errorf("unknown policy %q, expect %v or %v", cfg.Policy, CompositeMax, CompositeWeighted)
+	}
+	for _, w := range []*float64{cfg.ConcurrencyWeight, cfg.RPSWeight, cfg.QueueWeight} {
+		if w != nil && *w < 0 {
+			return fmt.Errorf("weights cannot be negative")
+		}
+	}
+	if cfg.Policy == CompositeWeighted {
+		total := cfg.weight(cfg.ConcurrencyWeight, 1) + cfg.weight(cfg.RPSWeight, 1)
+		if cfg.Queue {
+			total += cfg.weight(cfg.QueueWeight, 0)
+		}
+		if total == 0 {
+			return fmt.Errorf("the weights of the weighted policy sum to zero")
+		}
+	}
+	return nil
+}
+
+func (cfg *CompositeConfig) weight(w *float64, fallback float64) float64 {
+	if w == nil {
+		return fallback
+	}
+	return *w
+}
+
+// CompositeReporter is implemented by deciders that combine several metrics
+type CompositeReporter interface {
+	// the number of decisions dominated by each metric, by name
+	CompositeStats() map[string]int64
+}
+
+type composite struct {
+	weighted  bool
+	targetRPS float64
+	queue     bool
+	// weights of concurrency, RPS, and queue
+	weights [3]float64
+	// decisions dominated by each metric
+	dominant [3]int64
+}
+
+var compositeMetrics = [3]string{MetricConcurrency, MetricRPS, "queue"}
+
+// WithComposite scales on the combined pods needed by concurrency at the target value and RPS at targetRPS
+func (k *KPADecider) WithComposite(cfg *CompositeConfig, targetRPS float64) *KPADecider {
+	if cfg == nil {
+		cfg = &CompositeConfig{}
+	}
+	k.composite = &composite{
+		weighted:  cfg.Policy == CompositeWeighted,
+		targetRPS: targetRPS,
+		queue:     cfg.Queue,
+		weights:   [3]float64{cfg.weight(cfg.ConcurrencyWeight, 1), cfg.weight(cfg.RPSWeight, 1), cfg.weight(cfg.QueueWeight, 0)},
+	}
+	return k
+}
+
+// observeComposite returns the stable and panic pods needed as concurrency at the target value,
+// so the KPA bounds, panic mode and delays apply unchanged
+func (k *KPADecider) observeComposite(now time.Time) (float64, float64, float64) {
+	c := k.composite
+	stableConcurrency, panicConcurrency, instant := k.StableAndPanicAndInstantConcurrency(now)
+	stableRPS, panicRPS := k.StableAndPanicRPS(now)
+	var queued float64
+	if c.queue && k.queueScaling != nil {
+		queued = float64(k.queueScaling.queue.QueueDepth(k.Key)) / k.targetValue
+	}
+	combine := func(concurrency, rps float64) (float64, int) {
+		pods := [3]float64{concurrency / k.targetValue, rps / c.targetRPS, queued}
+		n := 2
+		if c.queue {
+			n = 3
+		}
+		dominant := 0
+		for i := 1; i < n; i++ {
+			if pods[i] > pods[dominant] {
+				dominant = i
+			}
+		}
+		if !c.weighted {
+			return pods[dominant], dominant
+		}
+		var sum, total float64
+		for i := 0; i < n; i++ {
+			sum += c.weights[i] * pods[i]
+			total += c.weights[i]
+		}
+		return sum / total, dominant
+	}
+	stable, dominant := combine(stableConcurrency, stableRPS)
+	panicking, _ := combine(panicConcurrency, panicRPS)
+	atomic.AddInt64(&c.dominant[dominant], 1)
+	return stable * k.targetValue, panicking * k.targetValue, instant
+}
+
+func (k *KPADecider) CompositeStats() map[string]int64 {
+	if k.composite == nil {
+		return nil
+	}
+	stats := make(map[string]int64, len(compositeMetrics))
+	for i, name := range compositeMetrics {
+		stats[name] = atomic.LoadInt64(&k.composite.dominant[i])
+	}
+	return stats
+}
+
+var _ CompositeReporter = &KPADecider{}
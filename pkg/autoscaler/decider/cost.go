@@ -0,0 +1,49 @@
+package decider
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// CostAwareDecider trades SLO slack for fewer replicas:
+// each replica may run up to (1+slack) times the target concurrency of the KPA decider,
+// so requests queue on ready pods instead of asking for new ones.
+type CostAwareDecider struct {
+	*KPADecider
+	slack   float64
+	desired int32
+}
+
+func NewCostAwareDecider(kpa *KPADecider, slack float64) *CostAwareDecider {
+	return &CostAwareDecider{
+		KPADecider: kpa,
+		slack:      math.Max(0, slack),
+	}
+}
+
+var _ Decider = &CostAwareDecider{}
+
+func (c *CostAwareDecider) Reconcile(ctx context.Context, now time.Time, currentReady int) (int, error) {
+	desired, err := c.KPADecider.Reconcile(ctx, now, currentReady)
+	if err != nil {
+		return desired, err
+	}
+	reduced := int(math.Ceil(float64(desired) / (1 + c.slack)))
+	if c.inGrace(now) && reduced < currentReady {
+		// never undercut the startup grace capacity
+		reduced = int(math.Min(float64(desired), float64(currentReady)))
+	}
+	if reduced != desired {
+		klog.FromContext(ctx).V(2).Info("[decider/cost] Trading slack for replicas", "target", c.Key, "kpa", desired, "desired", reduced, "slack", c.slack)
+	}
+	atomic.StoreInt32(&c.desired, int32(reduced))
+	return reduced, nil
+}
+
+func (c *CostAwareDecider) Desired() int {
+	return int(atomic.LoadInt32(&c.desired))
+}
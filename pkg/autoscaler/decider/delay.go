@@ -0,0 +1,79 @@
+package decider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+// maxWindow is the max of the values recorded over a sliding window, as of the last record
+type maxWindow interface {
+	Record(now time.Time, value int32)
+	Current() int32
+}
+
+var maxWindowFactories = map[string]func(window, granularity time.Duration) maxWindow{
+	metric.WindowSliding: func(window, granularity time.Duration) maxWindow {
+		return newSlidingMaxWindow(window, granularity)
+	},
+}
+
+func newMaxWindow(impl string, window, granularity time.Duration) (maxWindow, error) {
+	if impl == "" {
+		impl = metric.DefaultWindow()
+	}
+	factory, ok := maxWindowFactories[impl]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric window %q, available: %v", impl, metric.Windows())
+	}
+	return factory(window, granularity), nil
+}
+
+type timedValue struct {
+	index int64
+	value int32
+}
+
+// slidingMaxWindow keeps a monotonically decreasing deque of bucketed values,
+// whose head is the max of the window
+type slidingMaxWindow struct {
+	mu          sync.Mutex
+	granularity time.Duration
+	size        int64
+	deque       []timedValue
+}
+
+func newSlidingMaxWindow(window, granularity time.Duration) *slidingMaxWindow {
+	size := int64(window / granularity)
+	if size < 1 {
+		size = 1
+	}
+	return &slidingMaxWindow{granularity: granularity, size: size}
+}
+
+func (w *slidingMaxWindow) Record(now time.Time, value int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	idx := now.UnixNano() / int64(w.granularity)
+	// drop the values out of the window
+	for len(w.deque) > 0 && w.deque[0].index <= idx-w.size {
+		w.deque = w.deque[1:]
+	}
+	// drop the values dominated by the new one
+	for len(w.deque) > 0 && w.deque[len(w.deque)-1].value <= value {
+		w.deque = w.deque[:len(w.deque)-1]
+	}
+	w.deque = append(w.deque, timedValue{index: idx, value: value})
+}
+
+func (w *slidingMaxWindow) Current() int32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.deque) == 0 {
+		return 0
+	}
+	return w.deque[0].value
+}
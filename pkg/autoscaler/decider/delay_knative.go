@@ -0,0 +1,18 @@
+//go:build !noknative
+
+package decider
+
+import (
+	"time"
+
+	knas "knative.dev/serving/pkg/autoscaler/aggregation/max"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+func init() {
+	maxWindowFactories[metric.WindowKnative] = func(window, granularity time.Duration) maxWindow {
+		return knas.NewTimeWindow(window, granularity)
+	}
+}
@@ -0,0 +1,60 @@
+package decider
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// DitherReporter is implemented by deciders that may round their demand probabilistically
+type DitherReporter interface {
+	// the number of fractional decisions rounded up and down
+	DitherStats() (up int64, down int64)
+}
+
+// ditherer rounds a fractional pod count x up with probability x - floor(x) instead of always up,
+// so a demand hovering between N and N+1 pods is met on average without holding N+1 pods throughout
+type ditherer struct {
+	// seeded per key for reproducible runs, only used under the decider state lock
+	rng  *rand.Rand
+	up   int64
+	down int64
+}
+
+func newDitherer(key string) *ditherer {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return &ditherer{rng: rand.New(rand.NewSource(int64(h.Sum64())))}
+}
+
+func (d *ditherer) round(x float64) float64 {
+	floor := math.Floor(x)
+	frac := x - floor
+	if frac == 0 {
+		return floor
+	}
+	if d.rng.Float64() < frac {
+		atomic.AddInt64(&d.up, 1)
+		return floor + 1
+	}
+	atomic.AddInt64(&d.down, 1)
+	return floor
+}
+
+// WithDither rounds the stable pod count probabilistically, the panic pod count is still rounded up
+func (k *KPADecider) WithDither(enabled bool) *KPADecider {
+	if enabled {
+		k.dither = newDitherer(k.Key)
+	}
+	return k
+}
+
+func (k *KPADecider) DitherStats() (up int64, down int64) {
+	if k.dither == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&k.dither.up), atomic.LoadInt64(&k.dither.down)
+}
+
+var _ DitherReporter = &KPADecider{}
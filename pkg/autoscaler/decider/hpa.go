@@ -0,0 +1,118 @@
+package decider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+// UtilizationSource reports the CPU usage of the ready pods of a key as a fraction of their CPU requests
+type UtilizationSource interface {
+	// returns the utilization and the number of pods it was measured on, 0 if none has metrics yet
+	Utilization(ctx context.Context, key string) (float64, int, error)
+}
+
+type hpaRecommendation struct {
+	at      time.Time
+	replica int
+}
+
+// HPADecider scales toward a target CPU utilization like the HorizontalPodAutoscaler:
+// desired = ceil(ready * utilization / target), unchanged within the tolerance,
+// and a scale-down follows the highest recommendation within the stabilization window.
+// Like the HPA, it never scales below one pod, so it has no scale-from-zero path of its own
+type HPADecider struct {
+	*metric.Collector
+	active        int32
+	source        UtilizationSource
+	target        float64
+	tolerance     float64
+	stabilization time.Duration
+	// guards the recommendations against concurrent reconciles
+	mu              sync.Mutex
+	recommendations []hpaRecommendation
+	desiredScale    int32
+}
+
+// the request metrics are only kept for the snapshot over Knative's default windows, the CPU utilization drives scaling
+func NewHPADecider(key string, source UtilizationSource, target, tolerance float64, stabilization time.Duration) *HPADecider {
+	return &HPADecider{
+		Collector:     metric.NewCollector(key, 60*time.Second, 6*time.Second, 1*time.Second),
+		source:        source,
+		target:        target,
+		tolerance:     tolerance,
+		stabilization: stabilization,
+		desiredScale:  1,
+	}
+}
+
+var _ Decider = &HPADecider{}
+
+func (h *HPADecider) Activate(ctx context.Context) bool {
+	if atomic.CompareAndSwapInt32(&h.active, 0, 1) {
+		logger := klog.FromContext(ctx)
+		logger.V(1).Info("Starting HPA decider", "target", h.Key)
+		go h.Collector.Run(ctx)
+		return true
+	}
+	return false
+}
+
+func (h *HPADecider) Reconcile(ctx context.Context, now time.Time, currentReady int) (int, error) {
+	logger := klog.FromContext(ctx).WithValues("target", h.Key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if currentReady == 0 {
+		// nothing to measure, hold the last decision while the pods start
+		desired := max(h.Desired(), 1)
+		atomic.StoreInt32(&h.desiredScale, int32(desired))
+		return desired, nil
+	}
+	utilization, measured, err := h.source.Utilization(ctx, h.Key)
+	if err != nil {
+		return h.Desired(), fmt.Errorf("failed to get CPU utilization: %v", err)
+	}
+	recommended := currentReady
+	ratio := utilization / h.target
+	if measured > 0 && math.Abs(ratio-1) > h.tolerance {
+		recommended = max(int(math.Ceil(ratio*float64(currentReady))), 1)
+	}
+
+	h.recommendations = append(h.recommendations, hpaRecommendation{at: now, replica: recommended})
+	horizon := now.Add(-h.stabilization)
+	i := 0
+	for i < len(h.recommendations) && h.recommendations[i].at.Before(horizon) {
+		i++
+	}
+	h.recommendations = h.recommendations[i:]
+
+	desired := recommended
+	if desired < currentReady {
+		// scale down no further than the highest recommendation within the window
+		for _, r := range h.recommendations {
+			desired = max(desired, r.replica)
+		}
+		desired = min(desired, currentReady)
+	}
+
+	logger.V(2).Info(fmt.Sprintf("[decider/hpa] %v"+
+		" | CPU: utilization=%0.3f target=%0.3f measured=%d"+
+		" | Scaling: current=%d desired=%d recommended=%d",
+		h.Key, utilization, h.target, measured, currentReady, desired, recommended))
+
+	atomic.StoreInt32(&h.desiredScale, int32(desired))
+	return desired, nil
+}
+
+func (h *HPADecider) Desired() int {
+	return int(atomic.LoadInt32(&h.desiredScale))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
@@ -14,4 +15,6 @@ type Decider interface {
 	Activate(ctx context.Context) bool
 	Reconcile(ctx context.Context, now time.Time, currentReady int) (int, error)
 	Desired() int
+	// the metrics the next Reconcile would act upon
+	Snapshot(now time.Time) metric.Snapshot
 }
@@ -4,31 +4,60 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"k8s.io/klog/v2"
-	knas "knative.dev/serving/pkg/autoscaler/aggregation/max"
 
 	// Kubedirect
 	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	// scale on the average number of in-flight requests per pod
+	MetricConcurrency = "concurrency"
+	// scale on the requests per second per pod, i.e., Knative's rps metric
+	MetricRPS = "rps"
 )
 
 type KPADecider struct {
 	*metric.Collector
 	active int32
-	// concurrency-based
+	// the metric targetValue applies to, concurrency or rps
+	metric           string
 	targetValue      float64
 	maxScaleUpRate   float64
 	maxScaleDownRate float64
 	stableWindow     time.Duration
 	panicWindow      time.Duration
 	panicThreshold   float64
-	delayWindow      *knas.TimeWindow
+	noPanic          bool
+	delayWindow      maxWindow
+	scaleDownDelay   time.Duration
 	tickInterval     time.Duration
+	// retain the ready pods for this long after the target went idle before scaling down
+	keepAlive time.Duration
+	// never scale below the ready count before this time, so pre-warmed capacity survives until the windows fill
+	graceUntil time.Time
+	// rounds the stable pod count probabilistically if set
+	dither *ditherer
+	// serves the requests waiting at the gateway if set
+	queueScaling *queueScaling
+	// restores the target-burst-capacity of the gateway if set
+	burstScaling *burstScaling
+	// holds the last pod until the target is idle if set
+	scaleToZero *scaleToZero
+	// combines concurrency and RPS if set, see WithComposite
+	composite *composite
 	// variables
+	idleSince int64 // unix nano, when the instant concurrency last dropped to zero
+	// guards the panic and delay state against export while reconciling
+	stateMu      sync.Mutex
 	panicTime    time.Time
 	maxPanicPods int
+	delayHistory []delaySample
 	desiredScale int32
 }
 
@@ -42,22 +71,141 @@ func NewKPADecider(
 ) *KPADecider {
 	d := &KPADecider{
 		Collector:        metric.NewCollector(key, stableWindow, panicWindow, 1*time.Second),
+		metric:           MetricConcurrency,
 		targetValue:      targetValue,
 		maxScaleUpRate:   maxScaleUpRate,
 		maxScaleDownRate: maxScaleDownRate,
 		stableWindow:     stableWindow,
 		panicWindow:      panicWindow,
 		panicThreshold:   panicThreshold,
+		scaleDownDelay:   scaleDownDelay,
 		tickInterval:     tickInterval,
 	}
 	if scaleDownDelay > 0 {
-		d.delayWindow = knas.NewTimeWindow(scaleDownDelay, tickInterval)
+		// the default implementation always exists
+		d.delayWindow, _ = newMaxWindow(metric.DefaultWindow(), scaleDownDelay, tickInterval)
 	}
 	return d
 }
 
 var _ Decider = &KPADecider{}
 
+func (k *KPADecider) WithKeepAlive(keepAlive time.Duration) *KPADecider {
+	k.keepAlive = keepAlive
+	return k
+}
+
+// WithPanicDisabled keeps the decider out of panic mode, so it scales on the stable window only
+func (k *KPADecider) WithPanicDisabled(disabled bool) *KPADecider {
+	k.noPanic = disabled
+	return k
+}
+
+// WithMetric switches the metric the target value applies to, empty keeps concurrency
+func (k *KPADecider) WithMetric(m string) (*KPADecider, error) {
+	switch m {
+	case "":
+	case MetricConcurrency, MetricRPS:
+		k.metric = m
+	default:
+		return k, fmt.Errorf("unknown metric %q, expect %v or %v", m, MetricConcurrency, MetricRPS)
+	}
+	return k, nil
+}
+
+// observe returns the stable and panic values of the scaling metric and the instant concurrency;
+// the latter tells scaling from zero in both modes, as requests wait at the gateway without a pod
+func (k *KPADecider) observe(now time.Time) (float64, float64, float64) {
+	if k.composite != nil {
+		return k.observeComposite(now)
+	}
+	if k.metric == MetricRPS {
+		stable, panicking := k.StableAndPanicRPS(now)
+		return stable, panicking, k.InstantConcurrency()
+	}
+	return k.StableAndPanicAndInstantConcurrency(now)
+}
+
+// the startup grace period counts from process start, not from decider creation or activation
+var processStart = time.Now()
+
+func (k *KPADecider) WithStartupGrace(grace time.Duration) *KPADecider {
+	if grace > 0 {
+		k.graceUntil = processStart.Add(grace)
+	}
+	return k
+}
+
+// WithMetricWindow switches the aggregation implementation of the metrics and the scale-down delay
+func (k *KPADecider) WithMetricWindow(impl string) (*KPADecider, error) {
+	if _, err := k.Collector.WithWindow(impl); err != nil {
+		return k, err
+	}
+	if k.scaleDownDelay > 0 {
+		delayWindow, err := newMaxWindow(impl, k.scaleDownDelay, k.tickInterval)
+		if err != nil {
+			return k, err
+		}
+		k.delayWindow = delayWindow
+	}
+	return k, nil
+}
+
+// WithSmoothing aggregates the stable concurrency and request count with EWMA or Holt smoothing instead of the window average
+func (k *KPADecider) WithSmoothing(mode string, alpha, beta float64) (*KPADecider, error) {
+	if _, err := k.Collector.WithSmoothing(mode, alpha, beta); err != nil {
+		return k, err
+	}
+	return k, nil
+}
+
+// WithClasses scales on the requests of the given classes only, e.g., interactive,
+// so the requests of other classes are served opportunistically by the capacity scaled for them;
+// the dispatcher admits them after the scaled-for classes only with dispatcher.batchLast
+func (k *KPADecider) WithClasses(classes ...string) *KPADecider {
+	k.Collector.WithClasses(classes...)
+	return k
+}
+
+func (k *KPADecider) ReqIn(req *workload.Request) float64 {
+	return k.Collector.ReqIn(req)
+}
+
+func (k *KPADecider) ReqOut(res *workload.Response) float64 {
+	instant := k.Collector.ReqOut(res)
+	if instant <= 0 {
+		atomic.StoreInt64(&k.idleSince, time.Now().UnixNano())
+	}
+	return instant
+}
+
+// idleFor returns how long the target has been idle, i.e., no request in flight, and false if it has never
+// finished a request
+func (k *KPADecider) idleFor(now time.Time, inFlight float64) (time.Duration, bool) {
+	since := atomic.LoadInt64(&k.idleSince)
+	if since == 0 {
+		return 0, false
+	}
+	if inFlight > 0 {
+		return 0, true
+	}
+	return now.Sub(time.Unix(0, since)), true
+}
+
+// retaining returns true if the target is idle, but went idle within the keep-alive duration
+func (k *KPADecider) retaining(now time.Time, inFlight float64) bool {
+	if k.keepAlive <= 0 || inFlight > 0 {
+		return false
+	}
+	idle, ok := k.idleFor(now, inFlight)
+	return ok && idle < k.keepAlive
+}
+
+// inGrace returns true within the startup grace period
+func (k *KPADecider) inGrace(now time.Time) bool {
+	return now.Before(k.graceUntil)
+}
+
 func (k *KPADecider) Activate(ctx context.Context) bool {
 	if atomic.CompareAndSwapInt32(&k.active, 0, 1) {
 		logger := klog.FromContext(ctx)
@@ -70,10 +218,13 @@ func (k *KPADecider) Activate(ctx context.Context) bool {
 
 func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady int) (int, error) {
 	logger := klog.FromContext(ctx).WithValues("target", k.Key)
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
 
-	observedStableValue, observedPanicValue, observedInstantValue := k.StableAndPanicAndInstantConcurrency(now)
+	observedStableValue, observedPanicValue, observedInstantValue := k.observe(now)
 
 	isScalingFromZero := currentReady == 0
+	observedReady := currentReady
 	// Use 1 if 0, otherwise the scale up/down rates won't work
 	currentReady = int(math.Max(1, float64(currentReady)))
 	upperbound, lowerbound := func() (float64, float64) {
@@ -87,12 +238,15 @@ func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady
 		return up, low
 	}()
 	dspc := math.Ceil(observedStableValue / k.targetValue)
+	if k.dither != nil {
+		dspc = k.dither.round(observedStableValue / k.targetValue)
+	}
 	dppc := math.Ceil(observedPanicValue / k.targetValue)
 
 	desiredStablePodCount := int(math.Min(math.Max(dspc, lowerbound), upperbound))
 	desiredPanicPodCount := int(math.Min(math.Max(dppc, lowerbound), upperbound))
 
-	isOverPanicThreshold := (dppc/float64(currentReady) >= k.panicThreshold)
+	isOverPanicThreshold := !k.noPanic && (dppc/float64(currentReady) >= k.panicThreshold)
 	if k.panicTime.IsZero() && isOverPanicThreshold {
 		// Begin panicking when we cross the threshold in the panic window.
 		logger.V(2).Info("PANICKING.")
@@ -131,6 +285,26 @@ func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady
 		mode = "stable"
 	}
 
+	// Serve the requests that waited too long at the gateway, or any if there is no ready pod.
+	if floor, depth, delay := k.queueFloor(now, observedReady); floor > desiredPodCount {
+		floor = int(math.Min(float64(floor), upperbound))
+		if floor > desiredPodCount {
+			logger.V(2).Info(fmt.Sprintf("Serving the gateway queue with %d pods, want %d", floor, desiredPodCount), "depth", depth, "delay", delay)
+			atomic.AddInt64(&k.queueScaling.nBoosted, 1)
+			desiredPodCount = floor
+		}
+	}
+
+	// Restore the target-burst-capacity the gateway lacks, while it serves the target through the activator.
+	if floor, excess := k.burstFloor(observedReady); floor > desiredPodCount {
+		floor = int(math.Min(float64(floor), upperbound))
+		if floor > desiredPodCount {
+			logger.V(2).Info(fmt.Sprintf("Restoring the burst capacity with %d pods, want %d", floor, desiredPodCount), "excess", excess)
+			atomic.AddInt64(&k.burstScaling.nBoosted, 1)
+			desiredPodCount = floor
+		}
+	}
+
 	// Delay scale down decisions, if a ScaleDownDelay was specified.
 	// We only do this if there's a non-nil delayWindow because although a
 	// one-element delay window is _almost_ the same as no delay at all, it is
@@ -139,7 +313,7 @@ func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady
 	// in that case).
 	var delayedPodCount int
 	if k.delayWindow != nil {
-		k.delayWindow.Record(now, int32(desiredPodCount))
+		k.recordDelay(now, int32(desiredPodCount))
 		delayedPodCount = int(k.delayWindow.Current())
 		if delayedPodCount != desiredPodCount {
 			logger.V(2).Info(fmt.Sprintf("Delaying scale down to %d, staying at %d", desiredPodCount, delayedPodCount))
@@ -147,12 +321,27 @@ func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady
 		}
 	}
 
+	// Keep the ready pods alive for a while after the target went idle.
+	if desiredPodCount < observedReady && k.retaining(now, observedInstantValue) {
+		logger.V(2).Info(fmt.Sprintf("Keeping alive %d pods, want %d", observedReady, desiredPodCount), "keepAlive", k.keepAlive)
+		desiredPodCount = observedReady
+	}
+
+	// Keep the ready capacity, e.g. pre-warmed, until the metric windows have filled.
+	if desiredPodCount < observedReady && k.inGrace(now) {
+		logger.V(2).Info(fmt.Sprintf("Startup grace, holding %d pods, want %d", observedReady, desiredPodCount))
+		desiredPodCount = observedReady
+	}
+
+	// Scale to zero only once the target has been idle for the window.
+	desiredPodCount = k.zeroFloor(logger, now, observedReady, observedInstantValue, desiredPodCount)
+
 	logger.V(2).Info(fmt.Sprintf("[decider/kpa] %v"+
 		" | Mode: %v"+
-		" | Concurrency: stable=%0.3f panic=%0.3f target=%0.3f"+
+		" | %v: stable=%0.3f panic=%0.3f target=%0.3f"+
 		" | Scaling: current=%d desired=%d stable=%d(%0.0f) panic=%d(%0.0f) delay=%d range=[%0.0f, %0.0f]",
 		k.Key, mode,
-		observedStableValue, observedPanicValue, k.targetValue,
+		k.metricLabel(), observedStableValue, observedPanicValue, k.targetValue,
 		currentReady, desiredPodCount, desiredStablePodCount, dspc, desiredPanicPodCount, dppc, delayedPodCount, lowerbound, upperbound))
 
 	atomic.StoreInt32(&k.desiredScale, int32(desiredPodCount))
@@ -160,6 +349,16 @@ func (k *KPADecider) Reconcile(ctx context.Context, now time.Time, currentReady
 	return desiredPodCount, nil
 }
 
+func (k *KPADecider) metricLabel() string {
+	if k.composite != nil {
+		return "Composite"
+	}
+	if k.metric == MetricRPS {
+		return "RPS"
+	}
+	return "Concurrency"
+}
+
 func (k *KPADecider) Desired() int {
 	return int(atomic.LoadInt32(&k.desiredScale))
 }
@@ -0,0 +1,312 @@
+package decider
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	testKey               = "default/trace-0"
+	testTarget            = 10
+	testMaxScaleUpRate    = 10
+	testMaxScaleDownRate  = 2
+	testStableWindow      = 60 * time.Second
+	testPanicWindow       = 6 * time.Second
+	testPanicThreshold    = 2
+	testTickInterval      = 2 * time.Second
+	testCollectionSeconds = 1
+)
+
+// an arbitrary epoch, the windows only look at the time between samples
+var testStart = time.Unix(1_700_000_000, 0)
+
+// fakeCluster drives a decider on a fake clock: it feeds one sample of the scripted concurrency per second,
+// reconciles every tick, and makes the desired pods ready by the next tick
+type fakeCluster struct {
+	t     *testing.T
+	d     *KPADecider
+	now   time.Time
+	ready int
+}
+
+type step struct {
+	at          time.Duration
+	concurrency float64
+	ready       int
+	desired     int
+	panicking   bool
+	// the last time over the panic threshold, zero if not panicking
+	panicTime time.Time
+}
+
+func newFakeCluster(t *testing.T, d *KPADecider, ready int) *fakeCluster {
+	return &fakeCluster{t: t, d: d, now: testStart, ready: ready}
+}
+
+func newTestDecider(scaleDownDelay time.Duration) *KPADecider {
+	return NewKPADecider(testKey, testTarget, testMaxScaleUpRate, testMaxScaleDownRate,
+		testStableWindow, testPanicWindow, testPanicThreshold, scaleDownDelay, testTickInterval)
+}
+
+// run holds the concurrency for the duration, returns the decision of every tick
+func (c *fakeCluster) run(concurrency float64, duration time.Duration) []step {
+	var steps []step
+	for end := c.now.Add(duration); c.now.Before(end); {
+		c.now = c.now.Add(testCollectionSeconds * time.Second)
+		c.d.Collector.ImportState(metric.CollectorState{Samples: []metric.Sample{{At: c.now, Concurrency: concurrency}}})
+		if c.now.Sub(testStart)%testTickInterval != 0 {
+			continue
+		}
+		desired, err := c.d.Reconcile(context.Background(), c.now, c.ready)
+		if err != nil {
+			c.t.Fatalf("reconcile at %v: %v", c.now.Sub(testStart), err)
+		}
+		steps = append(steps, step{
+			at:          c.now.Sub(testStart),
+			concurrency: concurrency,
+			ready:       c.ready,
+			desired:     desired,
+			panicking:   !c.d.panicTime.IsZero(),
+			panicTime:   c.d.panicTime,
+		})
+		c.ready = desired
+	}
+	return steps
+}
+
+// checkRates asserts every decision is within the max scale-up and scale-down rates of the ready pods
+func checkRates(t *testing.T, steps []step) {
+	t.Helper()
+	for _, s := range steps {
+		ready := math.Max(1, float64(s.ready))
+		if up := int(math.Ceil(testMaxScaleUpRate * ready)); s.desired > up {
+			t.Errorf("at %v: desired %d from %d ready exceeds the max scale-up rate, want <= %d", s.at, s.desired, s.ready, up)
+		}
+		if down := int(math.Floor(ready / testMaxScaleDownRate)); s.desired < down {
+			t.Errorf("at %v: desired %d from %d ready exceeds the max scale-down rate, want >= %d", s.at, s.desired, s.ready, down)
+		}
+	}
+}
+
+func last(steps []step) step {
+	return steps[len(steps)-1]
+}
+
+func TestKPADeciderStable(t *testing.T) {
+	c := newFakeCluster(t, newTestDecider(0), 1)
+	steps := c.run(45, 2*testStableWindow)
+	checkRates(t, steps)
+	if got := last(steps).desired; got != 5 {
+		t.Errorf("desired %d at a steady concurrency of 45, want 5", got)
+	}
+}
+
+func TestKPADeciderMaxScaleUpRate(t *testing.T) {
+	c := newFakeCluster(t, newTestDecider(0), 1)
+	steps := c.run(5000, 10*time.Second)
+	checkRates(t, steps)
+	// 1 -> 10 -> 100 -> 500, limited by the rate before the demand
+	want := []int{10, 100, 500}
+	for i, desired := range want {
+		if steps[i].desired != desired {
+			t.Errorf("tick %d: desired %d, want %d", i, steps[i].desired, desired)
+		}
+	}
+}
+
+func TestKPADeciderPanic(t *testing.T) {
+	c := newFakeCluster(t, newTestDecider(0), 1)
+	steps := c.run(10, testStableWindow)
+	if s := last(steps); s.desired != 1 || s.panicking {
+		t.Fatalf("warm-up: desired %d panicking %v, want 1 pod in stable mode", s.desired, s.panicking)
+	}
+
+	// a burst fills the panic window well before the stable one
+	burst := c.run(200, 20*time.Second)
+	checkRates(t, burst)
+	if !burst[0].panicking {
+		t.Errorf("not panicking on the first tick of a 20x burst")
+	}
+	if got := last(burst).desired; got != 20 {
+		t.Errorf("desired %d at the end of the burst, want 20", got)
+	}
+
+	// the burst is over, panic mode holds the pods until the stable window has seen no surge
+	drop := c.run(10, 2*testStableWindow)
+	checkRates(t, drop)
+	exit := -1
+	for i, s := range drop {
+		if !s.panicking {
+			exit = i
+			break
+		}
+		if s.desired < 20 {
+			t.Errorf("at %v: scaled down to %d while panicking", s.at, s.desired)
+		}
+	}
+	if exit < 0 {
+		t.Fatalf("still panicking %v after the burst", 2*testStableWindow)
+	}
+	// panic mode lasts for a stable window after the last tick over the threshold
+	if exit == 0 {
+		t.Fatalf("panic mode ended with the burst")
+	}
+	lastOver := drop[exit-1].panicTime
+	if since := testStart.Add(drop[exit].at).Sub(lastOver); since <= testStableWindow || since > testStableWindow+testTickInterval {
+		t.Errorf("panic mode ended %v after the last tick over the threshold, want within a tick after the stable window %v", since, testStableWindow)
+	}
+	if got := last(drop).desired; got != 1 {
+		t.Errorf("desired %d long after the burst, want 1", got)
+	}
+}
+
+func TestKPADeciderPanicDisabled(t *testing.T) {
+	c := newFakeCluster(t, newTestDecider(0).WithPanicDisabled(true), 1)
+	c.run(10, testStableWindow)
+	burst := c.run(200, 4*time.Second)
+	for _, s := range burst {
+		if s.panicking {
+			t.Errorf("at %v: panicking with panic disabled", s.at)
+		}
+	}
+	// the stable window averages in the burst slowly, 2 of 60 buckets at 200 move it to about 16
+	if got := last(burst).desired; got >= 20 {
+		t.Errorf("desired %d right after the burst with panic disabled, want below 20", got)
+	}
+}
+
+func TestKPADeciderScaleDownDelay(t *testing.T) {
+	const delay = 20 * time.Second
+	c := newFakeCluster(t, newTestDecider(delay).WithPanicDisabled(true), 1)
+	c.run(100, 2*testStableWindow)
+	if got := c.ready; got != 10 {
+		t.Fatalf("warm-up: desired %d, want 10", got)
+	}
+
+	// idle, without a delay the decider would halve the pods on every tick
+	steps := c.run(0, 2*testStableWindow)
+	checkRates(t, steps)
+	for _, s := range steps {
+		if s.at-steps[0].at < delay-testTickInterval && s.desired < 10 {
+			t.Errorf("at %v: scaled down to %d within the scale-down delay", s.at, s.desired)
+		}
+	}
+	if got := last(steps).desired; got != 0 {
+		t.Errorf("desired %d after idling, want 0", got)
+	}
+}
+
+func TestKPADeciderMaxScaleDownRate(t *testing.T) {
+	c := newFakeCluster(t, newTestDecider(0).WithPanicDisabled(true), 1)
+	c.run(400, 2*testStableWindow)
+	if got := c.ready; got != 40 {
+		t.Fatalf("warm-up: desired %d, want 40", got)
+	}
+	steps := c.run(0, 2*testStableWindow)
+	checkRates(t, steps)
+	// the stable window still holds the load, then the decisions halve the pods each tick
+	halved := 0
+	for _, s := range steps {
+		if s.ready > 1 && s.desired == s.ready/testMaxScaleDownRate {
+			halved++
+		}
+	}
+	if halved == 0 {
+		t.Errorf("no decision was limited by the max scale-down rate")
+	}
+}
+
+func TestKPADeciderKeepAlive(t *testing.T) {
+	const keepAlive = 3 * testStableWindow
+	d := newTestDecider(0).WithPanicDisabled(true).WithKeepAlive(keepAlive)
+	c := newFakeCluster(t, d, 1)
+	c.run(100, 2*testStableWindow)
+	if got := c.ready; got != 10 {
+		t.Fatalf("warm-up: desired %d, want 10", got)
+	}
+
+	// the last request left now, all ready pods stay within the keep-alive
+	atomic.StoreInt64(&d.idleSince, c.now.UnixNano())
+	steps := c.run(0, 2*testStableWindow)
+	for _, s := range steps {
+		if s.desired != 10 {
+			t.Errorf("at %v: scaled down to %d within the keep-alive, want 10", s.at, s.desired)
+		}
+	}
+
+	// idle for longer than the keep-alive
+	steps = c.run(0, keepAlive)
+	checkRates(t, steps)
+	if got := last(steps).desired; got != 0 {
+		t.Errorf("desired %d idle beyond the keep-alive, want 0", got)
+	}
+}
+
+func TestKPADeciderKeepAliveBusy(t *testing.T) {
+	// a busy target follows the metric down, the keep-alive only starts once it is idle
+	d := newTestDecider(0).WithPanicDisabled(true).WithKeepAlive(3 * testStableWindow)
+	c := newFakeCluster(t, d, 1)
+	c.run(100, 2*testStableWindow)
+	atomic.StoreInt64(&d.idleSince, c.now.UnixNano())
+	d.ReqIn(&workload.Request{})
+	steps := c.run(20, 2*testStableWindow)
+	checkRates(t, steps)
+	if got := last(steps).desired; got != 2 {
+		t.Errorf("desired %d at a steady concurrency of 20, want 2", got)
+	}
+}
+
+func TestKPADeciderScaleToZero(t *testing.T) {
+	// a target that never had a pod stays at zero
+	c := newFakeCluster(t, newTestDecider(0), 0)
+	if steps := c.run(0, testStableWindow); last(steps).desired != 0 {
+		t.Errorf("desired %d for a target without load, want 0", last(steps).desired)
+	}
+
+	d := newTestDecider(0).WithScaleToZero(testStableWindow)
+	c = newFakeCluster(t, d, 1)
+	c.run(10, testStableWindow)
+	atomic.StoreInt64(&d.idleSince, c.now.UnixNano())
+	steps := c.run(0, 2*testStableWindow)
+	for _, s := range steps {
+		if s.at-steps[0].at < testStableWindow-testTickInterval && s.desired == 0 {
+			t.Errorf("at %v: scaled to zero within the idle window", s.at)
+		}
+	}
+	if got := last(steps).desired; got != 0 {
+		t.Errorf("desired %d idle beyond the window, want 0", got)
+	}
+}
+
+type fakeBurstCapacity float64
+
+func (f fakeBurstCapacity) ExcessBurstCapacity(string) (float64, bool) {
+	return float64(f), true
+}
+
+func TestKPADeciderBurstCapacity(t *testing.T) {
+	// 25 requests short of the target-burst-capacity take 3 pods on top of the ready one
+	d := newTestDecider(0).WithPanicDisabled(true).WithBurstCapacity(fakeBurstCapacity(-25))
+	c := newFakeCluster(t, d, 1)
+	steps := c.run(10, testTickInterval)
+	if got := last(steps).desired; got != 4 {
+		t.Errorf("desired %d short of the burst capacity, want 4", got)
+	}
+	if got := d.BurstBoosts(); got != 1 {
+		t.Errorf("%d burst boosts, want 1", got)
+	}
+
+	// with spare burst capacity the metric decides
+	d = newTestDecider(0).WithPanicDisabled(true).WithBurstCapacity(fakeBurstCapacity(5))
+	c = newFakeCluster(t, d, 1)
+	if got := last(c.run(10, testTickInterval)).desired; got != 1 {
+		t.Errorf("desired %d with spare burst capacity, want 1", got)
+	}
+}
@@ -0,0 +1,197 @@
+package decider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// PredictiveConfig configures the predictive decider, see PredictiveDecider
+type PredictiveConfig struct {
+	// how many tick intervals ahead to forecast, defaults to 1
+	HorizonTicks int `yaml:"horizonTicks"`
+	// smoothing factors of the level, trend and season, in (0, 1]; default to 0.5, 0.3 and 0.3
+	Alpha float64 `yaml:"alpha"`
+	Beta  float64 `yaml:"beta"`
+	Gamma float64 `yaml:"gamma"`
+	// the season length in tick intervals, e.g., the period of a timer-triggered function;
+	// 0 (default) forecasts with level and trend only, i.e., double exponential smoothing
+	SeasonTicks int `yaml:"seasonTicks"`
+}
+
+func (cfg *PredictiveConfig) Complete() *PredictiveConfig {
+	if cfg == nil {
+		cfg = &PredictiveConfig{}
+	}
+	if cfg.HorizonTicks == 0 {
+		cfg.HorizonTicks = 1
+	}
+	if cfg.Alpha == 0 {
+		cfg.Alpha = 0.5
+	}
+	if cfg.Beta == 0 {
+		cfg.Beta = 0.3
+	}
+	if cfg.Gamma == 0 {
+		cfg.Gamma = 0.3
+	}
+	return cfg
+}
+
+func (cfg *PredictiveConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.HorizonTicks < 0 || cfg.SeasonTicks < 0 {
+		return fmt.Errorf("horizonTicks and seasonTicks cannot be negative")
+	}
+	for name, factor := range map[string]float64{"alpha": cfg.Alpha, "beta": cfg.Beta, "gamma": cfg.Gamma} {
+		if factor < 0 || factor > 1 {
+			return fmt.Errorf("%v must be in (0, 1], got %v", name, factor)
+		}
+	}
+	return nil
+}
+
+// holtWinters is additive triple exponential smoothing over one value per tick, double without a season
+type holtWinters struct {
+	alpha, beta, gamma float64
+	level, trend       float64
+	season             []float64
+	// the number of values seen
+	n int
+}
+
+func (h *holtWinters) update(x float64) {
+	if h.n == 0 {
+		h.level = x
+		h.n++
+		return
+	}
+	var s float64
+	i := 0
+	if len(h.season) > 0 {
+		i = h.n % len(h.season)
+		s = h.season[i]
+	}
+	last := h.level
+	h.level = h.alpha*(x-s) + (1-h.alpha)*(h.level+h.trend)
+	h.trend = h.beta*(h.level-last) + (1-h.beta)*h.trend
+	if len(h.season) > 0 {
+		h.season[i] = h.gamma*(x-h.level) + (1-h.gamma)*s
+	}
+	h.n++
+}
+
+// forecast returns the value ahead ticks after the last one seen, never negative
+func (h *holtWinters) forecast(ahead int) float64 {
+	if h.n == 0 {
+		return 0
+	}
+	f := h.level + float64(ahead)*h.trend
+	if len(h.season) > 0 {
+		f += h.season[(h.n-1+ahead)%len(h.season)]
+	}
+	return math.Max(0, f)
+}
+
+// PredictionReporter is implemented by deciders that provision ahead of the observed demand
+type PredictionReporter interface {
+	// the number of decisions raised by the forecast
+	PredictionStats() (raised int64)
+}
+
+// PredictiveDecider forecasts the scaling metric of the KPA decider HorizonTicks ahead with Holt-Winters smoothing
+// of its per-tick averages, and provisions for the forecast when it exceeds the reactive decision,
+// so capacity is starting before a recurring or ramping burst arrives. It never scales below the KPA decision
+type PredictiveDecider struct {
+	*KPADecider
+	horizon int
+	mu      sync.Mutex
+	model   *holtWinters
+	// the end of the last tick fed into the model
+	fedUntil time.Time
+	nRaised  int64
+	desired  int32
+}
+
+func NewPredictiveDecider(kpa *KPADecider, cfg *PredictiveConfig) *PredictiveDecider {
+	cfg = cfg.Complete()
+	model := &holtWinters{alpha: cfg.Alpha, beta: cfg.Beta, gamma: cfg.Gamma}
+	if cfg.SeasonTicks > 0 {
+		model.season = make([]float64, cfg.SeasonTicks)
+	}
+	return &PredictiveDecider{KPADecider: kpa, horizon: cfg.HorizonTicks, model: model}
+}
+
+var _ Decider = &PredictiveDecider{}
+var _ PredictionReporter = &PredictiveDecider{}
+
+// feed averages the collected samples of each complete tick since the last call into the model
+func (p *PredictiveDecider) feed(now time.Time) {
+	tick := p.tickInterval
+	if tick <= 0 {
+		tick = time.Second
+	}
+	if p.fedUntil.IsZero() {
+		p.fedUntil = now.Truncate(tick)
+		return
+	}
+	samples := p.Collector.ExportState().Samples
+	for !p.fedUntil.Add(tick).After(now) {
+		end := p.fedUntil.Add(tick)
+		var sum float64
+		var n int
+		for _, s := range samples {
+			if s.At.After(p.fedUntil) && !s.At.After(end) {
+				if p.metric == MetricRPS {
+					sum += s.RequestCount
+				} else {
+					sum += s.Concurrency
+				}
+				n++
+			}
+		}
+		// a tick without samples, e.g., beyond the windows after a long pause, counts as idle
+		value := 0.0
+		if n > 0 {
+			value = sum / float64(n)
+		}
+		p.model.update(value)
+		p.fedUntil = end
+	}
+}
+
+func (p *PredictiveDecider) Reconcile(ctx context.Context, now time.Time, currentReady int) (int, error) {
+	desired, err := p.KPADecider.Reconcile(ctx, now, currentReady)
+	if err != nil {
+		return desired, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.feed(now)
+	forecast := p.model.forecast(p.horizon)
+	predicted := int(math.Ceil(forecast / p.targetValue))
+	// the forecast is bounded by the scale-up rate like the reactive decision
+	predicted = min(predicted, int(math.Ceil(p.maxScaleUpRate*float64(max(currentReady, 1)))))
+	if predicted > desired {
+		klog.FromContext(ctx).V(2).Info("[decider/predictive] Provisioning ahead of the forecast", "target", p.Key, "kpa", desired, "desired", predicted, "forecast", forecast, "horizonTicks", p.horizon)
+		atomic.AddInt64(&p.nRaised, 1)
+		desired = predicted
+	}
+	atomic.StoreInt32(&p.desired, int32(desired))
+	return desired, nil
+}
+
+func (p *PredictiveDecider) Desired() int {
+	return int(atomic.LoadInt32(&p.desired))
+}
+
+func (p *PredictiveDecider) PredictionStats() int64 {
+	return atomic.LoadInt64(&p.nRaised)
+}
@@ -0,0 +1,64 @@
+package decider
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// GatewayQueue exposes the requests of a target waiting at the gateway for an endpoint,
+// which the request events alone do not tell apart from those executing
+type GatewayQueue interface {
+	// the number of waiting requests
+	QueueDepth(key string) int
+	// how long the oldest waiting request has waited, 0 if none
+	QueueDelay(key string, now time.Time) time.Duration
+}
+
+// GatewayQueueReporter is implemented by deciders that may scale on the gateway queue
+type GatewayQueueReporter interface {
+	// the number of decisions raised to serve the queue
+	QueueBoosts() int64
+}
+
+type queueScaling struct {
+	queue GatewayQueue
+	// the queue is served once its oldest request has waited this long, or right away without ready pods
+	maxDelay time.Duration
+	nBoosted int64
+}
+
+// WithGatewayQueue makes sure the requests waiting at the gateway longer than maxDelay get pods of their own
+func (k *KPADecider) WithGatewayQueue(queue GatewayQueue, maxDelay time.Duration) *KPADecider {
+	if queue != nil && maxDelay > 0 {
+		k.queueScaling = &queueScaling{queue: queue, maxDelay: maxDelay}
+	}
+	return k
+}
+
+// queueFloor returns the pod count that serves the waiting requests on top of the ready pods,
+// or 0 if the queue is empty or has not waited long enough while there are ready pods
+func (k *KPADecider) queueFloor(now time.Time, observedReady int) (floor int, depth int, delay time.Duration) {
+	if k.queueScaling == nil {
+		return 0, 0, 0
+	}
+	q := k.queueScaling
+	depth = q.queue.QueueDepth(k.Key)
+	if depth == 0 {
+		return 0, 0, 0
+	}
+	delay = q.queue.QueueDelay(k.Key, now)
+	if observedReady > 0 && delay < q.maxDelay {
+		return 0, depth, delay
+	}
+	return observedReady + int(math.Ceil(float64(depth)/k.targetValue)), depth, delay
+}
+
+func (k *KPADecider) QueueBoosts() int64 {
+	if k.queueScaling == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&k.queueScaling.nBoosted)
+}
+
+var _ GatewayQueueReporter = &KPADecider{}
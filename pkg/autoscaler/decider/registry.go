@@ -0,0 +1,160 @@
+package decider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+)
+
+// Params are the settings a decider of a target is created from; each factory reads the fields it needs
+type Params struct {
+	Key string
+	// the scaling metric, concurrency or rps, and the target value per pod
+	Metric           string
+	Target           float64
+	MaxScaleUpRate   float64
+	MaxScaleDownRate float64
+	StableWindow     time.Duration
+	PanicWindow      time.Duration
+	PanicThreshold   float64
+	DisablePanic     bool
+	ScaleDownDelay   time.Duration
+	TickInterval     time.Duration
+	KeepAlive        time.Duration
+	StartupGrace     time.Duration
+	ScaleToZeroIdle  time.Duration
+	Classes          []string
+	Dither           bool
+	MetricWindow     string
+	Smoothing        string
+	SmoothingAlpha   float64
+	SmoothingBeta    float64
+	// extra concurrency per replica of the cost-aware decider
+	CostSlack float64
+	// the forecast of the predictive decider, defaults if nil
+	Predictive *PredictiveConfig
+	// the metrics of the composite decider, defaults if nil, and its RPS target per pod
+	Composite *CompositeConfig
+	TargetRPS float64
+	// the CPU utilization of the pods and its target, for the hpa decider
+	Utilization       UtilizationSource
+	TargetUtilization float64
+	Tolerance         float64
+	Stabilization     time.Duration
+	// observes the metrics outside the gateway if set, e.g., by scraping the pods
+	MetricSource metric.Source
+	// the factories log the settings of each decider at V(1)
+	Logger logr.Logger
+}
+
+type Factory func(params *Params) (Decider, error)
+
+// names of the built-in deciders
+const (
+	KPA        = "kpa"
+	CostAware  = "cost-aware"
+	HPA        = "hpa"
+	Predictive = "predictive"
+	Composite  = "composite"
+)
+
+var registry = benchutil.NewRegistry[Factory]("decider")
+
+func init() {
+	Register(KPA, func(p *Params) (Decider, error) {
+		return asDecider(NewKPADeciderFrom(p))
+	})
+	Register(CostAware, func(p *Params) (Decider, error) {
+		kpa, err := NewKPADeciderFrom(p)
+		if err != nil {
+			return nil, err
+		}
+		p.Logger.V(1).Info("Cost-aware decider", "target", p.Key, "costSlack", p.CostSlack)
+		return NewCostAwareDecider(kpa, p.CostSlack), nil
+	})
+	Register(Predictive, func(p *Params) (Decider, error) {
+		kpa, err := NewKPADeciderFrom(p)
+		if err != nil {
+			return nil, err
+		}
+		p.Logger.V(1).Info("Predictive decider", "target", p.Key, "config", p.Predictive)
+		return NewPredictiveDecider(kpa, p.Predictive), nil
+	})
+	Register(Composite, func(p *Params) (Decider, error) {
+		kpa, err := NewKPADeciderFrom(p)
+		if err != nil {
+			return nil, err
+		}
+		p.Logger.V(1).Info("Composite decider", "target", p.Key, "config", p.Composite, "targetRPS", p.TargetRPS)
+		return kpa.WithComposite(p.Composite, p.TargetRPS), nil
+	})
+	Register(HPA, func(p *Params) (Decider, error) {
+		if p.Utilization == nil {
+			return nil, fmt.Errorf("the hpa decider needs a CPU utilization source")
+		}
+		return NewHPADecider(p.Key, p.Utilization, p.TargetUtilization, p.Tolerance, p.Stabilization), nil
+	})
+}
+
+// NewKPADeciderFrom creates a KPA decider with all the options of p applied
+func NewKPADeciderFrom(p *Params) (*KPADecider, error) {
+	kpa := NewKPADecider(p.Key, p.Target, p.MaxScaleUpRate, p.MaxScaleDownRate, p.StableWindow, p.PanicWindow, p.PanicThreshold, p.ScaleDownDelay, p.TickInterval).
+		WithKeepAlive(p.KeepAlive).
+		WithScaleToZero(p.ScaleToZeroIdle).
+		WithStartupGrace(p.StartupGrace).
+		WithClasses(p.Classes...).
+		WithDither(p.Dither).
+		WithPanicDisabled(p.DisablePanic)
+	if _, err := kpa.WithMetric(p.Metric); err != nil {
+		return nil, err
+	}
+	if _, err := kpa.WithMetricWindow(p.MetricWindow); err != nil {
+		return nil, err
+	}
+	if _, err := kpa.WithSmoothing(p.Smoothing, p.SmoothingAlpha, p.SmoothingBeta); err != nil {
+		return nil, err
+	}
+	if p.MetricSource != nil {
+		kpa.Collector.WithSource(p.MetricSource)
+	}
+	p.Logger.V(1).Info("KPA decider", "target", p.Key, "metric", p.Metric, "targetValue", p.Target, "keepAlive", p.KeepAlive, "scaleToZeroIdle", p.ScaleToZeroIdle, "startupGrace", p.StartupGrace,
+		"classes", p.Classes, "dither", p.Dither, "metricWindow", p.MetricWindow, "smoothing", p.Smoothing)
+	return kpa, nil
+}
+
+// asDecider keeps a failed constructor from returning a typed nil as a non-nil Decider
+func asDecider[D Decider](d D, err error) (Decider, error) {
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Register makes a scaling algorithm available to the autoscalers by name, e.g., from the init of its package;
+// it panics if the name is taken
+func Register(name string, factory Factory) {
+	registry.Register(name, factory)
+}
+
+// New creates a decider of the registered name
+func New(name string, params *Params) (Decider, error) {
+	factory, err := registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(params)
+}
+
+func IsRegistered(name string) bool {
+	return registry.IsRegistered(name)
+}
+
+// Registered returns the names of the registered deciders, sorted
+func Registered() []string {
+	return registry.Names()
+}
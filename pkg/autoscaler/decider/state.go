@@ -0,0 +1,86 @@
+package decider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+// StatefulDecider can carry its state across a restart or migration of the autoscaler mid-trace,
+// so that it neither forgets its windows nor scales down spuriously
+type StatefulDecider interface {
+	ExportState() ([]byte, error)
+	// must be called before the decider is activated
+	ImportState(data []byte) error
+}
+
+type delaySample struct {
+	At    time.Time `json:"at"`
+	Value int32     `json:"value"`
+}
+
+type kpaState struct {
+	Metrics      metric.CollectorState `json:"metrics"`
+	PanicTime    time.Time             `json:"panicTime"`
+	MaxPanicPods int                   `json:"maxPanicPods"`
+	DesiredScale int32                 `json:"desiredScale"`
+	IdleSince    time.Time             `json:"idleSince"`
+	// the desired scales still within the scale-down delay, replayed like the metrics
+	Delay []delaySample `json:"delay"`
+}
+
+var _ StatefulDecider = &KPADecider{}
+
+// caller must hold the state lock
+func (k *KPADecider) recordDelay(now time.Time, value int32) {
+	k.delayWindow.Record(now, value)
+	k.delayHistory = append(k.delayHistory, delaySample{At: now, Value: value})
+	horizon := now.Add(-k.scaleDownDelay)
+	i := 0
+	for i < len(k.delayHistory) && !k.delayHistory[i].At.After(horizon) {
+		i++
+	}
+	k.delayHistory = k.delayHistory[i:]
+}
+
+func (k *KPADecider) ExportState() ([]byte, error) {
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+	state := &kpaState{
+		Metrics:      k.Collector.ExportState(),
+		PanicTime:    k.panicTime,
+		MaxPanicPods: k.maxPanicPods,
+		DesiredScale: atomic.LoadInt32(&k.desiredScale),
+		Delay:        k.delayHistory,
+	}
+	if since := atomic.LoadInt64(&k.idleSince); since > 0 {
+		state.IdleSince = time.Unix(0, since)
+	}
+	return json.Marshal(state)
+}
+
+func (k *KPADecider) ImportState(data []byte) error {
+	state := &kpaState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("failed to unmarshal state of %v: %v", k.Key, err)
+	}
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+	k.Collector.ImportState(state.Metrics)
+	k.panicTime = state.PanicTime
+	k.maxPanicPods = state.MaxPanicPods
+	atomic.StoreInt32(&k.desiredScale, state.DesiredScale)
+	if !state.IdleSince.IsZero() {
+		atomic.StoreInt64(&k.idleSince, state.IdleSince.UnixNano())
+	}
+	if k.delayWindow != nil {
+		for _, s := range state.Delay {
+			k.recordDelay(s.At, s.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package decider
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// ScaleToZeroReporter is implemented by deciders that scale idle targets to zero
+type ScaleToZeroReporter interface {
+	// the number of decisions scaling a target to zero, and back up from zero, i.e., cold starts
+	ScaleToZeroStats() (zeroed int64, coldStarts int64)
+}
+
+// scaleToZero holds the last pod of a target until it has been idle for the window,
+// i.e., no request in flight and none seen since, like Knative's scale-to-zero grace period
+type scaleToZero struct {
+	idle        time.Duration
+	nZeroed     int64
+	nColdStarts int64
+}
+
+// WithScaleToZero lets the target scale to zero once idle this long, its last pod is retained before
+func (k *KPADecider) WithScaleToZero(idle time.Duration) *KPADecider {
+	if idle > 0 {
+		k.scaleToZero = &scaleToZero{idle: idle}
+	}
+	return k
+}
+
+// zeroFloor returns the desired pod count after the scale-to-zero window is applied; caller must hold the state lock
+func (k *KPADecider) zeroFloor(logger logr.Logger, now time.Time, observedReady int, inFlight float64, desired int) int {
+	z := k.scaleToZero
+	if z == nil {
+		return desired
+	}
+	idleFor, ok := k.idleFor(now, inFlight)
+	idle := inFlight == 0 && (!ok || idleFor >= z.idle)
+	previous := k.Desired()
+	if desired == 0 && observedReady > 0 && !idle {
+		logger.V(2).Info("Holding the last pod until idle", "idleWindow", z.idle)
+		return 1
+	}
+	if desired == 0 && previous > 0 {
+		atomic.AddInt64(&z.nZeroed, 1)
+		logger.V(2).Info("Scaling to zero", "idleWindow", z.idle)
+	} else if desired > 0 && previous == 0 && observedReady == 0 {
+		atomic.AddInt64(&z.nColdStarts, 1)
+	}
+	return desired
+}
+
+func (k *KPADecider) ScaleToZeroStats() (int64, int64) {
+	if k.scaleToZero == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&k.scaleToZero.nZeroed), atomic.LoadInt64(&k.scaleToZero.nColdStarts)
+}
+
+var _ ScaleToZeroReporter = &KPADecider{}
@@ -0,0 +1,104 @@
+package autoscaler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// decision is one reconcile of a key that reached its decider
+type decision struct {
+	// wall clock in unix milliseconds, to be joined with the request timestamps
+	UnixMilli         int64   `json:"unixMilli"`
+	Key               string  `json:"key"`
+	StableConcurrency float64 `json:"stableConcurrency"`
+	PanicConcurrency  float64 `json:"panicConcurrency"`
+	Ready             int     `json:"ready"`
+	Desired           int     `json:"desired"`
+	// whether the scaler wrote a new scale, and how long the decider and the whole reconcile took
+	Scaled       bool    `json:"scaled"`
+	DeciderMilli float64 `json:"deciderMilli"`
+	TotalMilli   float64 `json:"totalMilli"`
+}
+
+var decisionColumns = []string{"unixMilli", "key", "stableConcurrency", "panicConcurrency", "ready", "desired", "scaled", "deciderMilli", "totalMilli"}
+
+// decisionLog appends every scaling decision to a file, as CSV if its name ends with .csv and JSON lines otherwise
+type decisionLog struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	csv  *csv.Writer
+	n    int64
+}
+
+func newDecisionLog(logger logr.Logger, path string) (*decisionLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decision log: %v", err)
+	}
+	l := &decisionLog{file: file, w: bufio.NewWriter(file)}
+	if strings.HasSuffix(path, ".csv") {
+		l.csv = csv.NewWriter(l.w)
+		l.csv.Write(decisionColumns)
+	}
+	logger.Info("Writing decision log", "path", path)
+	return l, nil
+}
+
+func (l *decisionLog) record(d decision) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n++
+	if l.csv != nil {
+		l.csv.Write([]string{
+			strconv.FormatInt(d.UnixMilli, 10),
+			d.Key,
+			strconv.FormatFloat(d.StableConcurrency, 'f', 3, 64),
+			strconv.FormatFloat(d.PanicConcurrency, 'f', 3, 64),
+			strconv.Itoa(d.Ready),
+			strconv.Itoa(d.Desired),
+			strconv.FormatBool(d.Scaled),
+			strconv.FormatFloat(d.DeciderMilli, 'f', 3, 64),
+			strconv.FormatFloat(d.TotalMilli, 'f', 3, 64),
+		})
+		return
+	}
+	data, _ := json.Marshal(d)
+	l.w.Write(data)
+	l.w.WriteByte('\n')
+}
+
+func (l *decisionLog) close() (int64, error) {
+	if l == nil {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.csv != nil {
+		l.csv.Flush()
+	}
+	if err := l.w.Flush(); err != nil {
+		l.file.Close()
+		return l.n, err
+	}
+	return l.n, l.file.Close()
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
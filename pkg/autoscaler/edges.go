@@ -0,0 +1,85 @@
+package autoscaler
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+)
+
+// burstEdges reconciles a key as soon as its instant concurrency jumps by more than a threshold within a tick,
+// instead of waiting for the next tick, to cut the reaction latency of spiky targets.
+// The keys are fixed at creation, so the hot path takes only the lock of its own key
+type burstEdges struct {
+	// relative jump over the concurrency at the start of the tick, e.g., 1 for doubling
+	threshold float64
+	keys      map[string]*edgeState
+	nEdges    int64
+}
+
+type edgeState struct {
+	mu       sync.Mutex
+	baseline float64
+	instant  float64
+}
+
+func newBurstEdges(logger logr.Logger, percentage float64, keys []string) *burstEdges {
+	if percentage <= 0 {
+		return nil
+	}
+	logger.Info("Burst edge reconciles", "burstEdge%", percentage)
+	e := &burstEdges{threshold: percentage / 100, keys: make(map[string]*edgeState, len(keys))}
+	for _, key := range keys {
+		e.keys[key] = &edgeState{}
+	}
+	return e
+}
+
+// observe records the instant concurrency after a request arrived, returns true on a burst edge.
+// The baseline is at least one request, so a target waking up from idle needs a jump over the threshold too
+func (e *burstEdges) observe(key string, instant float64) bool {
+	if e == nil {
+		return false
+	}
+	state := e.keys[key]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.instant = instant
+	if instant <= math.Max(state.baseline, 1)*(1+e.threshold) {
+		return false
+	}
+	// a burst still ramping up within the tick fires again once it jumps over the new baseline
+	state.baseline = instant
+	atomic.AddInt64(&e.nEdges, 1)
+	return true
+}
+
+// update records the instant concurrency after a request left
+func (e *burstEdges) update(key string, instant float64) {
+	if e == nil {
+		return
+	}
+	state := e.keys[key]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.instant = instant
+}
+
+// rebase starts a new tick of key from its current concurrency
+func (e *burstEdges) rebase(key string) {
+	if e == nil {
+		return
+	}
+	state := e.keys[key]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.baseline = state.instant
+}
+
+func (s *autoscalerImpl) logBurstEdges(logger logr.Logger) {
+	if s.edges == nil {
+		return
+	}
+	logger.Info("Burst edge triggers", "edges", atomic.LoadInt64(&s.edges.nEdges), "threshold%", s.edges.threshold*100)
+}
@@ -0,0 +1,82 @@
+package autoscaler
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+)
+
+// GatewayQueueUser is implemented by autoscalers whose deciders may read the gateway queues
+type GatewayQueueUser interface {
+	UseGatewayQueue(queue decider.GatewayQueue)
+}
+
+// BurstCapacityUser is implemented by autoscalers whose deciders may read the excess burst capacity of the gateway
+type BurstCapacityUser interface {
+	UseBurstCapacity(capacity decider.BurstCapacity)
+}
+
+type queueAwareDecider interface {
+	WithGatewayQueue(queue decider.GatewayQueue, maxDelay time.Duration) *decider.KPADecider
+}
+
+type burstAwareDecider interface {
+	WithBurstCapacity(capacity decider.BurstCapacity) *decider.KPADecider
+}
+
+// UseGatewayQueue hands the gateway queues to the pod scraper if set, and to the deciders if a max queue delay
+// is configured; must be called before Run
+func (s *autoscalerImpl) UseGatewayQueue(queue decider.GatewayQueue) {
+	if s.scraper != nil {
+		s.scraper.queue = queue
+	}
+	if s.maxQueueDelay <= 0 {
+		return
+	}
+	for _, d := range s.deciders {
+		if qd, ok := d.(queueAwareDecider); ok {
+			qd.WithGatewayQueue(queue, s.maxQueueDelay)
+		}
+	}
+	s.logger.Info("Scaling on the gateway queue", "maxDelay", s.maxQueueDelay)
+}
+
+func (s *autoscalerImpl) logQueueBoosts(logger logr.Logger) {
+	if s.maxQueueDelay <= 0 {
+		return
+	}
+	var boosts int64
+	for _, d := range s.deciders {
+		if reporter, ok := d.(decider.GatewayQueueReporter); ok {
+			boosts += reporter.QueueBoosts()
+		}
+	}
+	logger.Info("Gateway queue scaling", "maxDelay", s.maxQueueDelay, "boosts", boosts)
+}
+
+// UseBurstCapacity hands the excess burst capacity of the gateway to the deciders; must be called before Run
+func (s *autoscalerImpl) UseBurstCapacity(capacity decider.BurstCapacity) {
+	s.burstCapacity = capacity
+	for _, d := range s.deciders {
+		if bd, ok := d.(burstAwareDecider); ok {
+			bd.WithBurstCapacity(capacity)
+		}
+	}
+	s.logger.Info("Scaling on the excess burst capacity of the gateway")
+}
+
+func (s *autoscalerImpl) logBurstBoosts(logger logr.Logger) {
+	if s.burstCapacity == nil {
+		return
+	}
+	var boosts int64
+	for _, d := range s.deciders {
+		if reporter, ok := d.(decider.BurstCapacityReporter); ok {
+			boosts += reporter.BurstBoosts()
+		}
+	}
+	logger.Info("Burst capacity scaling", "boosts", boosts)
+}
@@ -0,0 +1,244 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	// where pod CPU usage is scraped from
+	CPUSourceMetricsServer = "metrics-server"
+	CPUSourceKubelet       = "kubelet"
+
+	// the defaults of the HorizontalPodAutoscaler, except the target which it has none of
+	defaultHPATargetUtilizationPercentage = 80
+	defaultHPATolerance                   = 0.1
+	defaultHPAStabilizationSeconds        = 300
+)
+
+// HPAConfig configures the hpa decider, a CPU-utilization baseline that mirrors the HorizontalPodAutoscaler.
+// Pods must declare CPU requests
+type HPAConfig struct {
+	// mean CPU usage of the ready pods in percent of their requests, defaults to 80
+	TargetUtilizationPercentage float64 `yaml:"targetUtilizationPercentage"`
+	// the relative deviation from the target that is ignored, defaults to 0.1
+	Tolerance float64 `yaml:"tolerance"`
+	// a scale-down follows the highest recommendation within this window, defaults to 300
+	ScaleDownStabilizationSeconds *float64 `yaml:"scaleDownStabilizationSeconds"`
+	// Options: metrics-server (default), the metrics.k8s.io API as the HPA does,
+	// or kubelet, the summary API of each node, which skips the metrics-server scrape interval
+	Source string `yaml:"source"`
+}
+
+func (cfg *HPAConfig) complete() {
+	if cfg.TargetUtilizationPercentage == 0 {
+		cfg.TargetUtilizationPercentage = defaultHPATargetUtilizationPercentage
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = defaultHPATolerance
+	}
+	if cfg.ScaleDownStabilizationSeconds == nil {
+		seconds := float64(defaultHPAStabilizationSeconds)
+		cfg.ScaleDownStabilizationSeconds = &seconds
+	}
+	if cfg.Source == "" {
+		cfg.Source = CPUSourceMetricsServer
+	}
+}
+
+func (cfg *HPAConfig) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.TargetUtilizationPercentage < 0 || cfg.Tolerance < 0 {
+		return fmt.Errorf("targetUtilizationPercentage and tolerance cannot be negative")
+	}
+	if cfg.ScaleDownStabilizationSeconds != nil && *cfg.ScaleDownStabilizationSeconds < 0 {
+		return fmt.Errorf("scaleDownStabilizationSeconds cannot be negative, got %v", *cfg.ScaleDownStabilizationSeconds)
+	}
+	switch cfg.Source {
+	case "", CPUSourceMetricsServer, CPUSourceKubelet:
+	default:
+		return fmt.Errorf("unknown source %q", cfg.Source)
+	}
+	return nil
+}
+
+// cpuUtilization measures the ready pods of a deployment against their CPU requests
+type cpuUtilization struct {
+	client client.Client
+	rest   rest.Interface
+	source string
+}
+
+func newCPUUtilization(logger logr.Logger, c client.Client, restConfig *rest.Config, cfg *HPAConfig) (*cpuUtilization, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	logger.Info("HPA CPU utilization", "source", cfg.Source, "target%", cfg.TargetUtilizationPercentage, "tolerance", cfg.Tolerance, "stabilization", *cfg.ScaleDownStabilizationSeconds)
+	return &cpuUtilization{client: c, rest: clientset.CoreV1().RESTClient(), source: cfg.Source}, nil
+}
+
+func (u *cpuUtilization) Utilization(ctx context.Context, key string) (float64, int, error) {
+	target := &appsv1.Deployment{}
+	if err := u.client.Get(ctx, workload.NamespacedNameFromKey(key), target); err != nil {
+		return 0, 0, fmt.Errorf("failed to get deployment %v: %v", key, err)
+	}
+	pods := corev1.PodList{}
+	if err := u.client.List(ctx, &pods,
+		client.InNamespace(target.Namespace),
+		client.MatchingLabels(target.Spec.Template.Labels),
+	); err != nil {
+		return 0, 0, fmt.Errorf("failed to list pods for key %v: %v", key, err)
+	}
+	var ready []*corev1.Pod
+	for i := range pods.Items {
+		if backend.IsPodReady(&pods.Items[i]) {
+			ready = append(ready, &pods.Items[i])
+		}
+	}
+	if len(ready) == 0 {
+		return 0, 0, nil
+	}
+	var usage map[string]int64
+	var err error
+	if u.source == CPUSourceKubelet {
+		usage, err = u.kubeletUsage(ctx, ready)
+	} else {
+		usage, err = u.metricsServerUsage(ctx, target.Namespace, target.Spec.Template.Labels)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var used, requested int64
+	measured := 0
+	for _, pod := range ready {
+		milli, ok := usage[pod.Name]
+		if !ok {
+			// not scraped yet, e.g., just started
+			continue
+		}
+		request := cpuRequest(pod)
+		if request == 0 {
+			return 0, 0, fmt.Errorf("missing CPU request of pod %v", pod.Name)
+		}
+		used += milli
+		requested += request
+		measured++
+	}
+	if measured == 0 {
+		return 0, 0, nil
+	}
+	return float64(used) / float64(requested), measured, nil
+}
+
+// cpuRequest sums the CPU requests of the containers of pod in millicores
+func cpuRequest(pod *corev1.Pod) int64 {
+	var milli int64
+	for _, c := range pod.Spec.Containers {
+		if request, ok := c.Resources.Requests[corev1.ResourceCPU]; ok {
+			milli += request.MilliValue()
+		}
+	}
+	return milli
+}
+
+// the subset of the metrics.k8s.io PodMetricsList we read, to avoid the k8s.io/metrics module
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Usage map[string]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// metricsServerUsage returns the CPU usage in millicores by pod name
+func (u *cpuUtilization) metricsServerUsage(ctx context.Context, namespace string, selector map[string]string) (map[string]int64, error) {
+	data, err := u.rest.Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").
+		Param("labelSelector", labels.SelectorFromSet(selector).String()).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics: %v", err)
+	}
+	list := podMetricsList{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pod metrics: %v", err)
+	}
+	usage := make(map[string]int64, len(list.Items))
+	for _, item := range list.Items {
+		var milli int64
+		for _, c := range item.Containers {
+			if cpu, ok := c.Usage[string(corev1.ResourceCPU)]; ok {
+				milli += cpu.MilliValue()
+			}
+		}
+		usage[item.Metadata.Name] = milli
+	}
+	return usage, nil
+}
+
+// the subset of the kubelet summary API we read
+type kubeletSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU *struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+	} `json:"pods"`
+}
+
+// kubeletUsage returns the CPU usage in millicores by pod name, querying the summary API of each node once
+func (u *cpuUtilization) kubeletUsage(ctx context.Context, pods []*corev1.Pod) (map[string]int64, error) {
+	wanted := make(map[string]map[string]bool)
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		if wanted[pod.Spec.NodeName] == nil {
+			wanted[pod.Spec.NodeName] = make(map[string]bool)
+		}
+		wanted[pod.Spec.NodeName][pod.Namespace+"/"+pod.Name] = true
+	}
+	usage := make(map[string]int64, len(pods))
+	for node, names := range wanted {
+		data, err := u.rest.Get().
+			AbsPath("/api/v1/nodes", node, "proxy/stats/summary").
+			DoRaw(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get summary of node %v: %v", node, err)
+		}
+		summary := kubeletSummary{}
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal summary of node %v: %v", node, err)
+		}
+		for _, pod := range summary.Pods {
+			if !names[pod.PodRef.Namespace+"/"+pod.PodRef.Name] || pod.CPU == nil || pod.CPU.UsageNanoCores == nil {
+				continue
+			}
+			usage[pod.PodRef.Name] = int64(*pod.CPU.UsageNanoCores / 1e6)
+		}
+	}
+	return usage, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -23,10 +25,6 @@ import (
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
-const (
-	maxConcurrentScalers = 16
-)
-
 type AutoscalerConfig struct {
 	Knative *KnativeAutoscalerConfig `yaml:"kpa"`
 	OneTime *OneTimeAutoscalerConfig `yaml:"oneTime"`
@@ -54,6 +52,28 @@ type Autoscaler interface {
 	Run(ctx context.Context)
 }
 
+// DesiredReporter is implemented by autoscalers that expose the latest decision per key
+type DesiredReporter interface {
+	Desired(key string) (int, bool)
+}
+
+// Poker is implemented by autoscalers that can reconcile a key on demand, e.g., when its requests wait for a first pod
+type Poker interface {
+	Poke(key string)
+}
+
+// ZeroScaler is implemented by autoscalers that may scale targets to zero,
+// whose requests the gateway must then hold until a pod is ready
+type ZeroScaler interface {
+	ScalesToZero() bool
+}
+
+// EndpointObserver is implemented by autoscalers that follow the dispatchable endpoints of each key,
+// e.g., to time their scale-ups up to the first endpoint
+type EndpointObserver interface {
+	EndpointsChanged(key string, before, after int)
+}
+
 type autoscalerImpl struct {
 	framework    string
 	async        bool
@@ -61,17 +81,53 @@ type autoscalerImpl struct {
 	client       client.Client
 	deciders     map[string]decider.Decider
 	scaler       scaler.Scaler
+	pool         *scalerPool
+	coalescer    *coalescer
+	limiter      *scaleRateLimiter
+	bucket       *scaleTokenBucket
+	cost         *costAccountant
 	// We need a queue because ticking is periodic yet scaling is blocking
 	// the queue would merge multiple requests for the same key
-	queue  workqueue.TypedRateLimitingInterface[string]
-	runCtx context.Context
-	logger logr.Logger
+	queue        workqueue.TypedRateLimitingInterface[string]
+	queueTracker *queueTracker
+	// scale writes, and the replicas they added and removed
+	nScaled         int64
+	replicasAdded   int64
+	replicasRemoved int64
+	// deciders serve the gateway queue once it waited this long, see UseGatewayQueue
+	maxQueueDelay time.Duration
+	// deciders restore the target-burst-capacity of the gateway if set, see UseBurstCapacity
+	burstCapacity decider.BurstCapacity
+	// deciders scale idle targets to zero after this long if positive
+	scaleToZeroIdle time.Duration
+	// scrapes the decider metrics from the pods if set
+	scraper *podScraper
+	// reconciles keys on concurrency jumps between ticks if set
+	edges *burstEdges
+	// decider state is saved here on stop if set, and every stateSaveInterval if positive
+	stateFile         string
+	stateSaveInterval time.Duration
+	stateMu           sync.Mutex
+	// every decision is appended here, and exported to Prometheus, if set
+	decisions *decisionLog
+	metrics   *promMetrics
+	runCtx    context.Context
+	logger    logr.Logger
+	// the time of the decisions, time.Now if nil
+	clock func() time.Time
 }
 
 func (s *autoscalerImpl) Framework() string {
 	return s.framework
 }
 
+func (s *autoscalerImpl) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
 func (s *autoscalerImpl) scale(ctx context.Context, key string) error {
 	// logger := klog.FromContext(ctx).WithValues("target", key)
 	logger := s.logger
@@ -79,6 +135,12 @@ func (s *autoscalerImpl) scale(ctx context.Context, key string) error {
 		panic(fmt.Sprintf("Scaling error: no decider for key %v", key))
 	}
 	start := time.Now()
+	// defer the whole reconcile so that the decision uses the latest metrics once allowed
+	if wait := max(s.limiter.when(key, start), s.bucket.when(key, start)); wait > 0 {
+		logger.V(2).Info("Rate limited scaling", "target", key, "wait", wait)
+		s.queue.AddAfter(key, wait)
+		return nil
+	}
 	target := &appsv1.Deployment{}
 	if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), target); err != nil {
 		return fmt.Errorf("failed to get deployment %v: %v", key, err)
@@ -98,22 +160,63 @@ func (s *autoscalerImpl) scale(ctx context.Context, key string) error {
 			nReady++
 		}
 	}
-	desired, err := s.deciders[key].Reconcile(ctx, time.Now(), nReady)
+	now := s.now()
+	s.cost.observe(key, now, nReady)
+	snapshot := s.deciders[key].Snapshot(now)
+	if s.coalescer.skip(key, now, nReady, snapshot) {
+		logger.V(2).Info("Coalesced scaling trigger", "target", key, "ready", nReady)
+		return nil
+	}
+	desired, err := s.deciders[key].Reconcile(ctx, now, nReady)
 	if err != nil {
 		return fmt.Errorf("failed to get desired scale for key %v: %v", key, err)
 	}
 	deciderTime := time.Since(start)
 	scaled, err := s.scaler.Scale(ctx, key, desired)
+	totalTime := time.Since(start)
+	s.decisions.record(decision{
+		UnixMilli:         now.UnixMilli(),
+		Key:               key,
+		StableConcurrency: snapshot.StableConcurrency,
+		PanicConcurrency:  snapshot.PanicConcurrency,
+		Ready:             nReady,
+		Desired:           desired,
+		Scaled:            scaled,
+		DeciderMilli:      milliseconds(deciderTime),
+		TotalMilli:        milliseconds(totalTime),
+	})
+	s.metrics.observe(key, snapshot, nReady, desired, scaled, deciderTime, totalTime-deciderTime)
 	if err != nil {
 		return fmt.Errorf("failed to scale %v: %v", key, err)
 	}
-	totalTime := time.Since(start)
 	if scaled {
+		s.limiter.scaled(key, time.Now())
+		s.bucket.scaled(key, time.Now())
+		s.countChurn(int(*target.Spec.Replicas), desired)
 		logger.V(1).Info(fmt.Sprintf("Finished scaling %v: %v(%v) -> %v", key, *target.Spec.Replicas, nReady, desired), "elapsed", totalTime, "decider", deciderTime, "scaler", totalTime-deciderTime)
 	}
 	return nil
 }
 
+func (s *autoscalerImpl) Desired(key string) (int, bool) {
+	d, ok := s.deciders[key]
+	if !ok {
+		return 0, false
+	}
+	return d.Desired(), true
+}
+
+// EndpointsChanged forwards to the scaler if it follows the endpoints
+func (s *autoscalerImpl) EndpointsChanged(key string, before, after int) {
+	if observer, ok := s.scaler.(scaler.EndpointObserver); ok {
+		observer.EndpointsChanged(key, before, after)
+	}
+}
+
+func (s *autoscalerImpl) Cost() CostReport {
+	return s.cost.report(time.Now())
+}
+
 func (s *autoscalerImpl) Run(ctx context.Context) {
 	logger := klog.FromContext(ctx)
 	logger.Info("Starting autoscaler", "framework", s.framework)
@@ -122,10 +225,55 @@ func (s *autoscalerImpl) Run(ctx context.Context) {
 
 	s.runCtx = ctx
 	s.logger = logger
-	for i := 0; i < maxConcurrentScalers; i++ {
-		go s.workerLoop(ctx)
+	s.spawnScalers(ctx, s.pool.min)
+	go s.resizeLoop(ctx)
+	go s.metrics.serve(ctx, logger)
+	if s.stateFile != "" && s.stateSaveInterval > 0 {
+		go s.saveStateLoop(ctx)
 	}
 	<-ctx.Done()
+	triggers, reconciles, reduction := s.coalescer.stats()
+	cost := s.Cost()
+	logger.Info("Stopping autoscaler", "triggers", triggers, "reconciles", reconciles, "reduction", fmt.Sprintf("%.2f%%", reduction*100), "podSeconds", fmt.Sprintf("%.1f", cost.PodSeconds), "cost", fmt.Sprintf("%.1f", cost.Cost))
+	queue := s.QueueStats()
+	logger.Info("Scaler queue", "dequeued", queue.Dequeued, "maxDepth", queue.MaxDepth, "avgWait", queue.AvgWait, "maxWait", queue.MaxWait)
+	s.logChurn(logger)
+	s.logQueueBoosts(logger)
+	s.logBurstBoosts(logger)
+	s.logScaleToZero(logger)
+	s.logPredictions(logger)
+	s.logComposite(logger)
+	s.logScrapes(logger)
+	s.logBurstEdges(logger)
+	if s.bucket != nil {
+		logger.Info("Scale token bucket", "throttled", s.bucket.throttled(), "scaled", atomic.LoadInt64(&s.nScaled))
+	}
+	if reporter, ok := s.scaler.(scaler.ErrorReporter); ok {
+		logger.Info("Scaler errors", "scaler", fmt.Sprintf("%T", s.scaler), "errors", reporter.ErrorCounts())
+	}
+	if reporter, ok := s.scaler.(scaler.DelayReporter); ok {
+		delay := reporter.DelayStats()
+		logger.Info("Injected control-plane delay", "delayed", delay.Delayed, "total", delay.Total)
+	}
+	if reporter, ok := s.scaler.(scaler.TimelineReporter); ok {
+		if stats := reporter.TimelineStats(); stats.Completed > 0 {
+			n := time.Duration(stats.Completed)
+			logger.Info("Kd scale stages", "completed", stats.Completed, "incomplete", stats.Incomplete,
+				"avgBuild", stats.Build/n, "avgRPC", stats.RPC/n, "avgFirstPod", stats.FirstPod/n, "avgFirstEndpoint", stats.FirstEndpoint/n)
+		}
+	}
+	if n, err := s.decisions.close(); err != nil {
+		logger.Error(err, "Failed to write decision log")
+	} else if s.decisions != nil {
+		logger.Info("Wrote decision log", "decisions", n)
+	}
+	if s.stateFile != "" {
+		if err := s.saveState(s.stateFile); err != nil {
+			logger.Error(err, "Failed to save decider state")
+		} else {
+			logger.Info("Saved decider state", "path", s.stateFile)
+		}
+	}
 }
 
 func (s *autoscalerImpl) processNextItem(ctx context.Context) bool {
@@ -134,10 +282,16 @@ func (s *autoscalerImpl) processNextItem(ctx context.Context) bool {
 		return false
 	}
 	defer s.queue.Done(key)
+	s.queueTracker.picked(key, time.Now())
 	// we do not requeue in any cases
 	defer s.queue.Forget(key)
 
-	if err := s.scale(ctx, key); err != nil {
+	atomic.AddInt32(&s.pool.busy, 1)
+	defer atomic.AddInt32(&s.pool.busy, -1)
+	start := time.Now()
+	err := s.scale(ctx, key)
+	s.pool.observe(time.Since(start))
+	if err != nil {
 		s.logger.Error(err, fmt.Sprintf("Failed to scale %v", key))
 		// etcd error
 		if strings.Contains(err.Error(), "mvcc") {
@@ -148,8 +302,11 @@ func (s *autoscalerImpl) processNextItem(ctx context.Context) bool {
 }
 
 func (s *autoscalerImpl) workerLoop(ctx context.Context) {
-	// Exit when s.queue is shut down
+	// Exit when s.queue is shut down, or when the pool shrinks
 	for s.processNextItem(ctx) {
+		if s.pool.retire() {
+			return
+		}
 	}
 }
 
@@ -159,7 +316,8 @@ func (s *autoscalerImpl) tickAutoScaler(key string) {
 	for {
 		select {
 		case <-ticker.C:
-			s.queue.Add(key)
+			s.edges.rebase(key)
+			s.enqueue(key)
 		case <-s.runCtx.Done():
 			return
 		}
@@ -175,13 +333,24 @@ func (s *autoscalerImpl) ReqIn(req *workload.Request) {
 		panic(fmt.Sprintf("Req in id %v: no decider for key %v", req.ID, key))
 	}
 	// s.logger.V(1).Info("request in", "id", req.ID, "target", req.Target)
-	s.deciders[key].ReqIn(req)
+	instant := s.deciders[key].ReqIn(req)
 	if s.deciders[key].Activate(s.runCtx) {
 		go s.tickAutoScaler(key)
 	}
 	if !s.async && s.deciders[key].Desired() == 0 {
-		s.queue.Add(key)
+		s.enqueue(key)
+	} else if s.edges.observe(key, instant) {
+		s.logger.V(2).Info("Burst edge", "target", key, "concurrency", instant)
+		s.enqueue(key)
+	}
+}
+
+// Poke reconciles the key right away instead of on the next tick
+func (s *autoscalerImpl) Poke(key string) {
+	if s.runCtx == nil || s.deciders[key] == nil {
+		return
 	}
+	s.enqueue(key)
 }
 
 func (s *autoscalerImpl) ReqOut(res *workload.Response) {
@@ -193,5 +362,5 @@ func (s *autoscalerImpl) ReqOut(res *workload.Response) {
 	if s.deciders[key] == nil {
 		panic(fmt.Sprintf("Req out id %v: no decider for key %v", res.Source.ID, key))
 	}
-	s.deciders[key].ReqOut(res)
+	s.edges.update(key, s.deciders[key].ReqOut(res))
 }
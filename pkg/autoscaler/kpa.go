@@ -3,10 +3,13 @@ package autoscaler
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
@@ -15,12 +18,17 @@ import (
 	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/scaler"
 )
 
+// the default target of Knative's rps metric
+const defaultTargetRPS = 200
+
 type KnativeAutoscaler struct {
 	*autoscalerImpl
 }
 
 type KnativeAutoscalerConfig struct {
 	client                   client.Client
+	informers                cache.Informers
+	restConfig               *rest.Config
 	Async                    bool    `yaml:"async"`
 	TargetConcurrency        float64 `yaml:"targetConcurrency"`
 	MaxScaleUpRate           float64 `yaml:"maxScaleUpRate"`
@@ -30,15 +38,225 @@ type KnativeAutoscalerConfig struct {
 	PanicThresholdPercentage float64 `yaml:"panicThresholdPercentage"`
 	ScaleDownDelaySeconds    int64   `yaml:"scaleDownDelaySeconds"`
 	TickIntervalSeconds      int64   `yaml:"tickIntervalSeconds"`
+	// if set, targets never panic and scale on the stable window only, for ablations of the panic path
+	DisablePanic bool `yaml:"disablePanic"`
+	// if positive, a key is reconciled right away when its instant concurrency jumps by more than this percentage
+	// within a tick, instead of on the next tick; see "Burst edge triggers" in the log
+	BurstEdgePercentage float64 `yaml:"burstEdgePercentage"`
+	// bounds of the adaptive scaling worker pool
+	MinScalers int `yaml:"minScalers"`
+	MaxScalers int `yaml:"maxScalers"`
+	// minimum interval between successive scale writes of a key, 0 means unlimited
+	MinScaleIntervalSeconds float64 `yaml:"minScaleIntervalSeconds"`
+	// if positive, the scale writes of each key are limited by a token bucket of this rate and burst (default 1);
+	// a throttled key is reconciled once it has a token, so the decisions in between coalesce into one write
+	ScaleWritesPerSecond float64 `yaml:"scaleWritesPerSecond"`
+	ScaleWriteBurst      int     `yaml:"scaleWriteBurst"`
+	// the scaler to actuate decisions. Options: deployment (default), kd,
+	// knative-pa (the PodAutoscaler of Knative revision deployments, actuated by Knative)
+	Scaler string                 `yaml:"scaler"`
+	Kd     *scaler.KdScalerConfig `yaml:"kd"`
+	// if set, every scale call of the scaler is delayed by a synthetic control-plane latency
+	ControlPlaneDelay *scaler.DelayConfig `yaml:"controlPlaneDelay"`
+	// how the deployment scaler writes scale intents. Options: update (default) the scale subresource, apply (server-side apply)
+	ScaleWriteMode string `yaml:"scaleWriteMode"`
+	// aggregation of the decider metrics. Options: knative (default if built in), sliding (in-repo, required with the noknative build tag)
+	MetricWindow string `yaml:"metricWindow"`
+	// where the decider metrics come from. Options: gateway (default) counts the requests it dispatches,
+	// pods scrapes the stats endpoint of the workload handler in each ready pod, see handler.PodStats,
+	// so the metrics hold when several gateways or external clients drive the same target; the requests queued at
+	// this gateway for a token are added, as the pods cannot see them
+	MetricSource string `yaml:"metricSource"`
+	// the port of the pod stats endpoint, defaults to that of the workload handler
+	PodStatsPort int `yaml:"podStatsPort"`
+	// smoothing of the stable concurrency and request count. Options: none (default), ewma, holt
+	Smoothing string `yaml:"smoothing"`
+	// level and trend factors of the smoothing, beta only applies to holt
+	SmoothingAlpha float64 `yaml:"smoothingAlpha"`
+	SmoothingBeta  float64 `yaml:"smoothingBeta"`
+	// if set, a fractional stable pod count N+p is rounded up with probability p instead of always up
+	Dither bool `yaml:"dither"`
+	// if set, only requests of these classes drive scaling, e.g., [interactive], others use the spare capacity,
+	// after the scaled-for requests only with the gateway's dispatcher.batchLast
+	ScaleOnClasses []string `yaml:"scaleOnClasses"`
+	// the metric the KPA decider scales on. Options: concurrency (default), rps
+	Metric string `yaml:"metric"`
+	// requests per second per pod in rps mode and for the composite decider, defaults to 200 as in Knative
+	TargetRPS float64 `yaml:"targetRPS"`
+	// the decider to compute desired scales, any registered in the decider package.
+	// Built in: kpa (default), cost-aware, hpa; targets may select their own
+	Decider string `yaml:"decider"`
+	// extra concurrency per replica the cost-aware decider tolerates, e.g. 0.5 runs up to 1.5x the target
+	CostSlack float64 `yaml:"costSlack"`
+	// the CPU-utilization settings of the hpa decider
+	HPA *HPAConfig `yaml:"hpa"`
+	// the forecast of the predictive decider
+	Predictive *decider.PredictiveConfig `yaml:"predictive"`
+	// the metrics of the composite decider, which scales on targetConcurrency and targetRPS at once
+	Composite *decider.CompositeConfig `yaml:"composite"`
+	// if positive, deciders add pods for the requests waiting at the gateway once the oldest waited this long,
+	// and right away when scaling from zero
+	MaxQueueDelayMilliSec int `yaml:"maxQueueDelayMilliSec"`
+	// once a target is idle, i.e., its instant concurrency dropped to zero, retain its ready pods this long
+	// before scaling down
+	KeepAliveSeconds float64 `yaml:"keepAliveSeconds"`
+	// if positive, a target keeps its last pod until idle this long, then scales to zero;
+	// the gateway activator (dispatcher.activatorHoldMilliSec) holds the requests arriving at zero
+	ScaleToZeroIdleSeconds float64 `yaml:"scaleToZeroIdleSeconds"`
+	// for this long after process start, deciders never scale below the current ready count,
+	// so pre-warmed capacity is not collapsed before the metric windows fill
+	StartupGraceSeconds float64 `yaml:"startupGraceSeconds"`
+	// cost of keeping one replica ready for one second, defaults to 1
+	ReplicaCost float64 `yaml:"replicaCost"`
+	// if set, the decider state is restored from this file on start if it exists, and saved to it on stop,
+	// so that the autoscaler can be restarted or migrated mid-trace
+	StateFile string `yaml:"stateFile"`
+	// if positive, the decider state is also saved every this many ticks,
+	// so that a crash loses at most that much instead of the whole run
+	StateSaveTicks int `yaml:"stateSaveTicks"`
+	// if set, every decision is appended to this file with the observed concurrency, ready and desired scale,
+	// and the actuation latency; as CSV if it ends with .csv, JSON lines otherwise
+	DecisionLog string `yaml:"decisionLog"`
+	// if set, the decider inputs and outputs, actuation latency, and scaling workqueue depth are served
+	// as Prometheus metrics on /metrics at this address, e.g., ":9090"
+	MetricsAddress string `yaml:"metricsAddress"`
+	// if set, the windows and panic threshold of each target are derived from its trace statistics, see AdaptToTrace
+	AdaptivePanic *AdaptivePanicConfig `yaml:"adaptivePanic"`
+	// per-target overrides, indexed by workload key (namespace/name)
+	Targets map[string]*KnativeTargetConfig `yaml:"targets"`
+}
+
+type KnativeTargetConfig struct {
+	MinScaleIntervalSeconds  *float64 `yaml:"minScaleIntervalSeconds"`
+	ReplicaCost              *float64 `yaml:"replicaCost"`
+	KeepAliveSeconds         *float64 `yaml:"keepAliveSeconds"`
+	Decider                  *string  `yaml:"decider"`
+	PanicWindowPercentage    *float64 `yaml:"panicWindowPercentage"`
+	PanicThresholdPercentage *float64 `yaml:"panicThresholdPercentage"`
+	DisablePanic             *bool    `yaml:"disablePanic"`
+}
+
+func (cfg *KnativeAutoscalerConfig) deciderFor(key string) string {
+	name := cfg.Decider
+	if target := cfg.Targets[key]; target != nil && target.Decider != nil {
+		name = *target.Decider
+	}
+	if name == "" {
+		return decider.KPA
+	}
+	return name
+}
+
+// deciders returns the decider names configured globally and per target
+func (cfg *KnativeAutoscalerConfig) deciders() []string {
+	names := []string{cfg.deciderFor("")}
+	for _, target := range cfg.Targets {
+		if target != nil && target.Decider != nil && *target.Decider != "" {
+			names = append(names, *target.Decider)
+		}
+	}
+	return names
+}
+
+// uses returns true if any of keys selects the decider, or any configured target if keys is nil
+func (cfg *KnativeAutoscalerConfig) uses(name string, keys []string) bool {
+	if keys == nil {
+		return slices.Contains(cfg.deciders(), name)
+	}
+	for _, key := range keys {
+		if cfg.deciderFor(key) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// panicPercentages returns the panic window and threshold percentages of key
+func (cfg *KnativeAutoscalerConfig) panicPercentages(key string) (float64, float64) {
+	window, threshold := cfg.PanicWindowPercentage, cfg.PanicThresholdPercentage
+	if target := cfg.Targets[key]; target != nil {
+		if target.PanicWindowPercentage != nil {
+			window = *target.PanicWindowPercentage
+		}
+		if target.PanicThresholdPercentage != nil {
+			threshold = *target.PanicThresholdPercentage
+		}
+	}
+	return window, threshold
+}
+
+func (cfg *KnativeAutoscalerConfig) panicDisabled(key string) bool {
+	if target := cfg.Targets[key]; target != nil && target.DisablePanic != nil {
+		return *target.DisablePanic
+	}
+	return cfg.DisablePanic
+}
+
+func (cfg *KnativeAutoscalerConfig) keepAlive(key string) time.Duration {
+	seconds := cfg.KeepAliveSeconds
+	if target := cfg.Targets[key]; target != nil && target.KeepAliveSeconds != nil {
+		seconds = *target.KeepAliveSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (cfg *KnativeAutoscalerConfig) minScaleIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	for key, target := range cfg.Targets {
+		if target != nil && target.MinScaleIntervalSeconds != nil {
+			intervals[key] = time.Duration(*target.MinScaleIntervalSeconds * float64(time.Second))
+		}
+	}
+	return intervals
+}
+
+func (cfg *KnativeAutoscalerConfig) replicaCosts() map[string]float64 {
+	costs := make(map[string]float64)
+	for key, target := range cfg.Targets {
+		if target != nil && target.ReplicaCost != nil {
+			costs[key] = *target.ReplicaCost
+		}
+	}
+	return costs
 }
 
 func (cfg *KnativeAutoscalerConfig) Complete(ctx context.Context, mgr manager.Manager) (*KnativeAutoscalerConfig, error) {
 	cfg.client = mgr.GetClient()
+	cfg.informers = mgr.GetCache()
+	cfg.restConfig = mgr.GetConfig()
 	if cfg.TargetConcurrency == 0 {
 		// use the default value in Dirigent
 		// https://github.com/vhive-serverless/invitro/blob/40546b63cade9113a8c27e5632f39b03aa38333c/pkg/driver/deployment.go#L110
 		cfg.TargetConcurrency = 100
 	}
+	if cfg.MinScalers == 0 {
+		cfg.MinScalers = defaultMinScalers
+	}
+	if cfg.MaxScalers == 0 {
+		cfg.MaxScalers = defaultMaxScalers
+	}
+	if cfg.ReplicaCost == 0 {
+		cfg.ReplicaCost = 1
+	}
+	switch cfg.Metric {
+	case "", decider.MetricConcurrency, decider.MetricRPS:
+	default:
+		return nil, fmt.Errorf("unknown metric %v", cfg.Metric)
+	}
+	if cfg.TargetRPS == 0 && (cfg.Metric == decider.MetricRPS || cfg.uses(decider.Composite, nil)) {
+		cfg.TargetRPS = defaultTargetRPS
+	}
+	for _, name := range cfg.deciders() {
+		if !decider.IsRegistered(name) {
+			return nil, fmt.Errorf("unknown decider %v, registered: %v", name, decider.Registered())
+		}
+	}
+	if cfg.uses(decider.HPA, nil) {
+		if cfg.HPA == nil {
+			cfg.HPA = &HPAConfig{}
+		}
+		cfg.HPA.complete()
+	}
 	return cfg, nil
 }
 
@@ -51,10 +269,17 @@ func NewKnativeAutoscaler(
 	s := &KnativeAutoscaler{
 		autoscalerImpl: &autoscalerImpl{
 			framework:    "kpa",
+			logger:       logger,
 			async:        cfg.Async,
 			tickInterval: time.Duration(cfg.TickIntervalSeconds) * time.Second,
 			client:       cfg.client,
 			deciders:     make(map[string]decider.Decider),
+			pool:         newScalerPool(cfg.MinScalers, cfg.MaxScalers),
+			coalescer:    newCoalescer(time.Duration(cfg.TickIntervalSeconds) * time.Second),
+			limiter:      newScaleRateLimiter(logger, time.Duration(cfg.MinScaleIntervalSeconds*float64(time.Second)), cfg.minScaleIntervals()),
+			bucket:       newScaleTokenBucket(logger, cfg.ScaleWritesPerSecond, cfg.ScaleWriteBurst),
+			cost:         newCostAccountant(logger, cfg.ReplicaCost, cfg.replicaCosts()),
+			queueTracker: newQueueTracker(),
 			queue: workqueue.NewTypedRateLimitingQueueWithConfig(
 				workqueue.DefaultTypedControllerRateLimiter[string](),
 				workqueue.TypedRateLimitingQueueConfig[string]{Name: "kpa"},
@@ -62,25 +287,132 @@ func NewKnativeAutoscaler(
 		},
 	}
 
-	// deployment-based scaler
-	scaler, err := scaler.NewDeploymentScaler(ctx, cfg.client, keys...)
+	sc, err := newScaler(ctx, cfg, keys...)
 	if err != nil {
 		// logger.Error(err, "failed to create deployment scaler")
-		return nil, fmt.Errorf("failed to create deployment scaler in aquatope autoscaler: %v", err)
+		return nil, fmt.Errorf("failed to create %v scaler in knative autoscaler: %v", cfg.Scaler, err)
 	}
-	s.scaler = scaler
+	s.scaler = scaler.WithDelay(ctx, sc, cfg.ControlPlaneDelay)
+	s.maxQueueDelay = time.Duration(cfg.MaxQueueDelayMilliSec) * time.Millisecond
+	s.scaleToZeroIdle = time.Duration(cfg.ScaleToZeroIdleSeconds * float64(time.Second))
+	s.edges = newBurstEdges(logger, cfg.BurstEdgePercentage, keys)
 
-	stableWindow := time.Duration(cfg.StableWindowSeconds) * time.Second
-	panicWindow := time.Duration(cfg.PanicWindowPercentage/100*cfg.StableWindowSeconds) * time.Second
 	scaleDownDelay := time.Duration(cfg.ScaleDownDelaySeconds) * time.Second
 	tickInterval := time.Duration(cfg.TickIntervalSeconds) * time.Second
 
+	params := cfg.panicParamsFor(logger, keys)
+
+	target := cfg.TargetConcurrency
+	if cfg.Metric == decider.MetricRPS {
+		target = cfg.TargetRPS
+	}
+
+	var scraper *podScraper
+	if cfg.MetricSource == MetricSourcePods {
+		scraper = newPodScraper(logger, cfg.client, cfg.PodStatsPort, podScrapeTimeout)
+		s.scraper = scraper
+	}
+
+	var cpu *cpuUtilization
+	if cfg.uses(decider.HPA, keys) {
+		if cpu, err = newCPUUtilization(logger, cfg.client, cfg.restConfig, cfg.HPA); err != nil {
+			return nil, fmt.Errorf("failed to create hpa decider: %v", err)
+		}
+	}
+
 	for _, key := range keys {
-		s.deciders[key] = decider.NewKPADecider(key, cfg.TargetConcurrency, cfg.MaxScaleUpRate, cfg.MaxScaleDownRate, stableWindow, panicWindow, cfg.PanicThresholdPercentage/100, scaleDownDelay, tickInterval)
+		p := params[key]
+		dp := &decider.Params{
+			Key:              key,
+			Metric:           cfg.Metric,
+			Target:           target,
+			MaxScaleUpRate:   cfg.MaxScaleUpRate,
+			MaxScaleDownRate: cfg.MaxScaleDownRate,
+			StableWindow:     p.stableWindow,
+			PanicWindow:      p.panicWindow,
+			PanicThreshold:   p.panicThreshold,
+			DisablePanic:     p.disabled,
+			ScaleDownDelay:   scaleDownDelay,
+			TickInterval:     tickInterval,
+			KeepAlive:        cfg.keepAlive(key),
+			StartupGrace:     time.Duration(cfg.StartupGraceSeconds * float64(time.Second)),
+			ScaleToZeroIdle:  s.scaleToZeroIdle,
+			Classes:          cfg.ScaleOnClasses,
+			Dither:           cfg.Dither,
+			MetricWindow:     cfg.MetricWindow,
+			Smoothing:        cfg.Smoothing,
+			SmoothingAlpha:   cfg.SmoothingAlpha,
+			SmoothingBeta:    cfg.SmoothingBeta,
+			CostSlack:        cfg.CostSlack,
+			Predictive:       cfg.Predictive,
+			Composite:        cfg.Composite,
+			TargetRPS:        cfg.TargetRPS,
+			Logger:           logger,
+		}
+		if scraper != nil {
+			dp.MetricSource = scraper
+		}
+		if cpu != nil {
+			dp.Utilization = cpu
+			dp.TargetUtilization = cfg.HPA.TargetUtilizationPercentage / 100
+			dp.Tolerance = cfg.HPA.Tolerance
+			dp.Stabilization = time.Duration(*cfg.HPA.ScaleDownStabilizationSeconds * float64(time.Second))
+		}
+		d, err := decider.New(cfg.deciderFor(key), dp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create decider for %v: %v", key, err)
+		}
+		s.deciders[key] = d
+	}
+
+	if s.decisions, err = newDecisionLog(logger, cfg.DecisionLog); err != nil {
+		return nil, err
+	}
+	s.metrics = newPromMetrics(logger, cfg.MetricsAddress, s.queue.Len)
+
+	if cfg.StateFile != "" {
+		if err := s.loadState(logger, cfg.StateFile); err != nil {
+			return nil, err
+		}
+		s.stateFile = cfg.StateFile
+		s.stateSaveInterval = time.Duration(cfg.StateSaveTicks) * s.tickInterval
 	}
 
-	logger.Info("Knative autoscaler initialized", "concurrency", cfg.TargetConcurrency, "maxUp", cfg.MaxScaleUpRate, "maxDown", cfg.MaxScaleDownRate, "stable", cfg.StableWindowSeconds, "panicWin%", cfg.PanicWindowPercentage, "panicThresh%", cfg.PanicThresholdPercentage, "delay", cfg.ScaleDownDelaySeconds, "tick", cfg.TickIntervalSeconds)
+	logger.Info("Knative autoscaler initialized", "concurrency", cfg.TargetConcurrency, "metric", cfg.Metric, "targetRPS", cfg.TargetRPS, "maxUp", cfg.MaxScaleUpRate, "maxDown", cfg.MaxScaleDownRate, "stable", cfg.StableWindowSeconds, "panicWin%", cfg.PanicWindowPercentage, "panicThresh%", cfg.PanicThresholdPercentage, "disablePanic", cfg.DisablePanic, "delay", cfg.ScaleDownDelaySeconds, "tick", cfg.TickIntervalSeconds, "scalers", fmt.Sprintf("[%d, %d]", cfg.MinScalers, cfg.MaxScalers), "scaler", cfg.Scaler, "decider", cfg.Decider, "overrides", len(cfg.Targets))
 	return s, nil
 }
 
 var _ Autoscaler = &KnativeAutoscaler{}
+
+func newScaler(ctx context.Context, cfg *KnativeAutoscalerConfig, keys ...string) (scaler.Scaler, error) {
+	switch cfg.Scaler {
+	case "", "deployment":
+		// deployment-based scaler
+		s, err := scaler.NewDeploymentScaler(ctx, cfg.client, keys...)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.ScaleWriteMode == "apply" {
+			klog.FromContext(ctx).Info("Writing scales with server-side apply")
+			s.WithApply()
+		}
+		return s, nil
+	case "knative-pa":
+		// knative-actuated scaler through the revision's PodAutoscaler bounds
+		return scaler.NewKnPAScaler(ctx, cfg.client, keys...)
+	case "kd":
+		// replicaset-based scaler through kd rpc
+		s, err := scaler.NewKdScaler(ctx, cfg.client, cfg.Kd, keys...)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Kd != nil && cfg.Kd.Timing {
+			if err := s.TimeStages(ctx, cfg.informers); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown scaler %v", cfg.Scaler)
+	}
+}
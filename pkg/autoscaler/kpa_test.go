@@ -0,0 +1,191 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const testKey = "default/trace-0"
+
+var testLabels = map[string]string{"app": "trace-0"}
+
+// fakeScaler actuates decisions at once: the deployment is scaled and exactly the desired pods are ready
+type fakeScaler struct {
+	client  client.Client
+	history []int
+}
+
+func (f *fakeScaler) Scale(ctx context.Context, key string, desired int) (bool, error) {
+	f.history = append(f.history, desired)
+	target := &appsv1.Deployment{}
+	if err := f.client.Get(ctx, workload.NamespacedNameFromKey(key), target); err != nil {
+		return false, err
+	}
+	if int(*target.Spec.Replicas) == desired {
+		return false, nil
+	}
+	replicas := int32(desired)
+	target.Spec.Replicas = &replicas
+	if err := f.client.Update(ctx, target); err != nil {
+		return false, err
+	}
+	return true, setReadyPods(ctx, f.client, desired)
+}
+
+func setReadyPods(ctx context.Context, c client.Client, n int) error {
+	if err := c.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace("default"), client.MatchingLabels(testLabels)); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("trace-0-%d", i), Labels: testLabels},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		if err := c.Create(ctx, pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTestAutoscaler creates a Knative autoscaler of one target with ready pods, on a fake client and clock
+func newTestAutoscaler(t *testing.T, cfg *KnativeAutoscalerConfig, ready int) (*KnativeAutoscaler, *fakeScaler, *time.Time) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	replicas := int32(ready)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "trace-0"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: testLabels}},
+		},
+	}).Build()
+	if err := setReadyPods(ctx, c, ready); err != nil {
+		t.Fatal(err)
+	}
+	cfg.client = c
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewKnativeAutoscaler(ctx, cfg, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeScaler{client: c}
+	s.scaler = f
+	now := time.Unix(1_700_000_000, 0)
+	s.clock = func() time.Time { return now }
+	return s, f, &now
+}
+
+func newTestConfig() *KnativeAutoscalerConfig {
+	return &KnativeAutoscalerConfig{
+		TargetConcurrency:        10,
+		MaxScaleUpRate:           10,
+		MaxScaleDownRate:         2,
+		StableWindowSeconds:      60,
+		PanicWindowPercentage:    10,
+		PanicThresholdPercentage: 200,
+		TickIntervalSeconds:      2,
+		MinScalers:               1,
+		MaxScalers:               1,
+		ReplicaCost:              1,
+	}
+}
+
+// drive feeds one sample of the concurrency per second and scales the target every tick,
+// returns the desired scale of every tick
+func drive(t *testing.T, s *KnativeAutoscaler, now *time.Time, concurrency float64, duration time.Duration) []int {
+	t.Helper()
+	d := s.deciders[testKey].(*decider.KPADecider)
+	var desired []int
+	for end := now.Add(duration); now.Before(end); {
+		*now = now.Add(time.Second)
+		d.Collector.ImportState(metric.CollectorState{Samples: []metric.Sample{{At: *now, Concurrency: concurrency}}})
+		if now.Unix()%int64(s.tickInterval/time.Second) != 0 {
+			continue
+		}
+		if err := s.scale(context.Background(), testKey); err != nil {
+			t.Fatalf("scale: %v", err)
+		}
+		desired = append(desired, d.Desired())
+	}
+	return desired
+}
+
+func TestKnativeAutoscalerTrajectory(t *testing.T) {
+	s, f, now := newTestAutoscaler(t, newTestConfig(), 1)
+
+	// a 20x burst over a steady load panics, and the pods follow the 6s panic window as it fills
+	drive(t, s, now, 10, time.Minute)
+	burst := drive(t, s, now, 200, 20*time.Second)
+	if want := []int{8, 14, 20}; !slices.Equal(burst[:3], want) {
+		t.Errorf("desired %v on the first ticks of the burst, want %v", burst[:3], want)
+	}
+
+	// panic mode holds the 20 pods for a stable window after the last tick over the threshold,
+	// then the pods are halved at most per tick
+	drop := drive(t, s, now, 10, 2*time.Minute)
+	held := 0
+	for held < len(drop) && drop[held] == 20 {
+		held++
+	}
+	if held < 20 {
+		t.Errorf("scaled down %d ticks into the drop while panicking: %v", held, drop)
+	}
+	for i := held; i < len(drop); i++ {
+		if prev := max(1, drop[i-1]); drop[i] < prev/2 {
+			t.Errorf("scaled down from %d to %d, over the max scale-down rate", prev, drop[i])
+		}
+	}
+	if got := drop[len(drop)-1]; got != 1 {
+		t.Errorf("desired %d after the drop, want 1", got)
+	}
+
+	// every decision reached the scaler
+	if got, want := f.history[len(f.history)-len(burst)-len(drop):], append(burst, drop...); !slices.Equal(got, want) {
+		t.Errorf("scaler saw %v, want the decisions %v", got, want)
+	}
+}
+
+func TestKnativeAutoscalerScaleDownDelay(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ScaleDownDelaySeconds = 20
+	cfg.DisablePanic = true
+	s, _, now := newTestAutoscaler(t, cfg, 10)
+
+	drive(t, s, now, 100, 2*time.Minute)
+	idle := drive(t, s, now, 0, 2*time.Minute)
+	// the delay window is 20s, i.e., 10 ticks
+	for i, desired := range idle[:9] {
+		if desired != 10 {
+			t.Errorf("tick %d: scaled down to %d within the scale-down delay", i, desired)
+		}
+	}
+	if got := idle[len(idle)-1]; got != 0 {
+		t.Errorf("desired %d after idling, want 0", got)
+	}
+}
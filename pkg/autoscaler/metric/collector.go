@@ -2,42 +2,185 @@ package metric
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/klog/v2"
-	knas "knative.dev/serving/pkg/autoscaler/aggregation"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
 type Collector struct {
 	*RequestStats
-	concurrencyBuckets       *knas.TimedFloat64Buckets
-	concurrencyPanicBuckets  *knas.TimedFloat64Buckets
-	requestCountBuckets      *knas.TimedFloat64Buckets
-	requestCountPanicBuckets *knas.TimedFloat64Buckets
+	concurrencyBuckets       Window
+	concurrencyPanicBuckets  Window
+	requestCountBuckets      Window
+	requestCountPanicBuckets Window
+	stableWindow             time.Duration
+	panicWindow              time.Duration
 	collectInterval          time.Duration
+	// how the stable series are aggregated, empty if windowed
+	smoothing string
+	// if set, only requests of these classes drive scaling
+	scaleOn map[string]bool
+	// instant concurrency per request class, including those not driving scaling
+	classMu          sync.Mutex
+	classConcurrency map[string]float64
+	// recent samples for state export
+	historyMu sync.Mutex
+	history   []Sample
+	// if set, the samples are observed from here instead of the requests seen by the gateway
+	source Source
+	// consecutive samples the source failed
+	sourceFailures int
+}
+
+// Source observes the load of a target outside the gateway, e.g., by scraping its pods,
+// so the metrics hold when other gateways or clients also drive it
+type Source interface {
+	// Observe returns the average concurrency of key since its previous call and the requests received meanwhile
+	Observe(ctx context.Context, key string, now time.Time) (concurrency float64, requestCount float64, err error)
 }
 
 // granularity is bucket bin size, also the stats report interval
 // the number of buckets if window/granularity
 func NewCollector(key string, stableWindow, panicWindow, granularity time.Duration) *Collector {
-	return &Collector{
-		RequestStats:             NewRequestStats(key),
-		concurrencyBuckets:       knas.NewTimedFloat64Buckets(stableWindow, granularity),
-		concurrencyPanicBuckets:  knas.NewTimedFloat64Buckets(panicWindow, granularity),
-		requestCountBuckets:      knas.NewTimedFloat64Buckets(stableWindow, granularity),
-		requestCountPanicBuckets: knas.NewTimedFloat64Buckets(panicWindow, granularity),
-		collectInterval:          granularity,
+	c := &Collector{
+		RequestStats:    NewRequestStats(key),
+		stableWindow:    stableWindow,
+		panicWindow:     panicWindow,
+		collectInterval: granularity,
+	}
+	// the default implementation always exists
+	c.WithWindow(DefaultWindow())
+	return c
+}
+
+// WithWindow switches the aggregation implementation, must be called before the collector runs
+func (c *Collector) WithWindow(impl string) (*Collector, error) {
+	newWindow := func(window time.Duration) Window {
+		w, _ := NewWindow(impl, window, c.collectInterval)
+		return w
+	}
+	if _, err := NewWindow(impl, c.stableWindow, c.collectInterval); err != nil {
+		return c, err
+	}
+	c.concurrencyBuckets = newWindow(c.stableWindow)
+	c.concurrencyPanicBuckets = newWindow(c.panicWindow)
+	c.requestCountBuckets = newWindow(c.stableWindow)
+	c.requestCountPanicBuckets = newWindow(c.panicWindow)
+	return c, nil
+}
+
+// WithSmoothing replaces the stable window averages of concurrency and request count with a smoothed series,
+// the panic windows are kept; must be called before the collector runs
+func (c *Collector) WithSmoothing(mode string, alpha, beta float64) (*Collector, error) {
+	if mode == "" || mode == SmoothingNone {
+		return c, nil
+	}
+	concurrency, err := newSmoothedSeries(mode, alpha, beta, c.collectInterval)
+	if err != nil {
+		return c, err
+	}
+	requestCount, _ := newSmoothedSeries(mode, alpha, beta, c.collectInterval)
+	c.concurrencyBuckets = concurrency
+	c.requestCountBuckets = requestCount
+	c.smoothing = mode
+	return c, nil
+}
+
+// WithSource observes the samples from source, the requests seen by the gateway then only drive the instant
+// concurrency and the class breakdown; must be called before the collector runs
+func (c *Collector) WithSource(source Source) *Collector {
+	c.source = source
+	return c
+}
+
+// WithClasses restricts the requests driving scaling to the given classes, others are only counted per class
+func (c *Collector) WithClasses(classes ...string) *Collector {
+	if len(classes) == 0 {
+		return c
+	}
+	c.scaleOn = make(map[string]bool)
+	for _, class := range classes {
+		c.scaleOn[class] = true
+	}
+	return c
+}
+
+func (c *Collector) countClass(class string, delta float64) {
+	c.classMu.Lock()
+	defer c.classMu.Unlock()
+	if c.classConcurrency == nil {
+		c.classConcurrency = make(map[string]float64)
+	}
+	c.classConcurrency[class] += delta
+}
+
+// ReqIn returns the instant concurrency of the classes driving scaling
+func (c *Collector) ReqIn(req *workload.Request) float64 {
+	class := workload.ClassOf(req)
+	c.countClass(class, 1)
+	if c.scaleOn != nil && !c.scaleOn[class] {
+		return c.RequestStats.InstantConcurrency()
+	}
+	return c.RequestStats.ReqIn(req)
+}
+
+func (c *Collector) ReqOut(res *workload.Response) float64 {
+	var source *workload.Request
+	if res != nil {
+		source = res.Source
+	}
+	class := workload.ClassOf(source)
+	c.countClass(class, -1)
+	if c.scaleOn != nil && !c.scaleOn[class] {
+		return c.RequestStats.InstantConcurrency()
 	}
+	return c.RequestStats.ReqOut(res)
 }
 
-func (c *Collector) collect(_ logr.Logger, now time.Time) {
+// ClassConcurrency returns the instant concurrency per request class
+func (c *Collector) ClassConcurrency() map[string]float64 {
+	c.classMu.Lock()
+	defer c.classMu.Unlock()
+	concurrency := make(map[string]float64, len(c.classConcurrency))
+	for class, n := range c.classConcurrency {
+		concurrency[class] = n
+	}
+	return concurrency
+}
+
+func (c *Collector) collect(ctx context.Context, logger logr.Logger, now time.Time) {
 	report := c.RequestStats.Report(now)
 	// logger.V(1).Info("collecting metrics", "time", now, "report", report.String())
-	c.concurrencyBuckets.Record(now, report.AverageConcurrency)
-	c.concurrencyPanicBuckets.Record(now, report.AverageConcurrency)
-	c.requestCountBuckets.Record(now, report.RequestCount)
-	c.requestCountPanicBuckets.Record(now, report.RequestCount)
+	sample := Sample{At: now, Concurrency: report.AverageConcurrency, RequestCount: report.RequestCount}
+	if c.source != nil {
+		concurrency, requestCount, err := c.source.Observe(ctx, c.Key, now)
+		if err != nil {
+			// skip the sample rather than fall back to the gateway view, which misses the load of other clients
+			c.sourceFailures++
+			if c.sourceFailures == 1 || c.sourceFailures%60 == 0 {
+				logger.V(1).Info("[WARN] Failed to observe metrics", "target", c.Key, "failures", c.sourceFailures, "error", err)
+			}
+			return
+		}
+		c.sourceFailures = 0
+		sample.Concurrency, sample.RequestCount = concurrency, requestCount
+	}
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	c.record(sample)
+	c.remember(sample)
+}
+
+func (c *Collector) record(s Sample) {
+	c.concurrencyBuckets.Record(s.At, s.Concurrency)
+	c.concurrencyPanicBuckets.Record(s.At, s.Concurrency)
+	c.requestCountBuckets.Record(s.At, s.RequestCount)
+	c.requestCountPanicBuckets.Record(s.At, s.RequestCount)
 }
 
 func (c *Collector) StableAndPanicConcurrency(now time.Time) (float64, float64) {
@@ -48,10 +191,41 @@ func (c *Collector) StableAndPanicAndInstantConcurrency(now time.Time) (float64,
 	return c.concurrencyBuckets.WindowAverage(now), c.concurrencyPanicBuckets.WindowAverage(now), c.InstantConcurrency()
 }
 
+// Snapshot is the metrics view a decider acts upon at a given time
+type Snapshot struct {
+	StableConcurrency  float64
+	PanicConcurrency   float64
+	InstantConcurrency float64
+	StableRPS          float64
+	PanicRPS           float64
+	// the smoothing of the stable series, empty if windowed
+	Smoothing string
+}
+
+func (c *Collector) Snapshot(now time.Time) Snapshot {
+	stable, panicking, instant := c.StableAndPanicAndInstantConcurrency(now)
+	stableRPS, panicRPS := c.StableAndPanicRPS(now)
+	return Snapshot{
+		StableConcurrency:  stable,
+		PanicConcurrency:   panicking,
+		InstantConcurrency: instant,
+		StableRPS:          stableRPS,
+		PanicRPS:           panicRPS,
+		Smoothing:          c.smoothing,
+	}
+}
+
 func (c *Collector) StableAndPanicRequestCount(now time.Time) (float64, float64) {
 	return c.requestCountBuckets.WindowAverage(now), c.requestCountPanicBuckets.WindowAverage(now)
 }
 
+// StableAndPanicRPS converts the average request count per bucket into requests per second
+func (c *Collector) StableAndPanicRPS(now time.Time) (float64, float64) {
+	stable, panicking := c.StableAndPanicRequestCount(now)
+	seconds := c.collectInterval.Seconds()
+	return stable / seconds, panicking / seconds
+}
+
 func (c *Collector) Run(ctx context.Context) {
 	logger := klog.FromContext(ctx)
 	logger.V(1).Info("Starting collector", "target", c.Key)
@@ -62,7 +236,7 @@ func (c *Collector) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case now := <-ticker.C:
-			c.collect(logger, now)
+			c.collect(ctx, logger, now)
 		}
 	}
 }
@@ -0,0 +1,119 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	SmoothingNone = "none"
+	// exponentially weighted moving average of the per-bucket values
+	SmoothingEWMA = "ewma"
+	// double exponential smoothing (Holt), forecasting one bucket ahead with the trend
+	SmoothingHolt = "holt"
+	// at most this many skipped buckets are replayed as zeros
+	maxSkippedBuckets = 1024
+)
+
+// smoothedSeries replaces the window average with an exponentially smoothed series of the bucket totals.
+// A bucket enters the series once it is complete, i.e., when a later bucket is recorded or read.
+type smoothedSeries struct {
+	mu          sync.Mutex
+	granularity time.Duration
+	holt        bool
+	alpha       float64
+	beta        float64
+	// the bucket being recorded, -1 if none
+	bucket      int64
+	sum         float64
+	level       float64
+	trend       float64
+	initialized bool
+}
+
+func newSmoothedSeries(mode string, alpha, beta float64, granularity time.Duration) (*smoothedSeries, error) {
+	if err := ValidateSmoothing(mode, alpha, beta); err != nil {
+		return nil, err
+	}
+	return &smoothedSeries{
+		granularity: granularity,
+		holt:        mode == SmoothingHolt,
+		alpha:       alpha,
+		beta:        beta,
+		bucket:      -1,
+	}, nil
+}
+
+func ValidateSmoothing(mode string, alpha, beta float64) error {
+	switch mode {
+	case "", SmoothingNone:
+		return nil
+	case SmoothingEWMA, SmoothingHolt:
+	default:
+		return fmt.Errorf("unknown smoothing %q, expected %v, %v or %v", mode, SmoothingNone, SmoothingEWMA, SmoothingHolt)
+	}
+	if alpha <= 0 || alpha > 1 {
+		return fmt.Errorf("smoothing alpha must be in (0, 1], got %v", alpha)
+	}
+	if mode == SmoothingHolt && (beta <= 0 || beta > 1) {
+		return fmt.Errorf("smoothing beta must be in (0, 1], got %v", beta)
+	}
+	return nil
+}
+
+var _ Window = &smoothedSeries{}
+
+// caller must hold the lock
+func (s *smoothedSeries) update(x float64) {
+	if !s.initialized {
+		s.level, s.trend, s.initialized = x, 0, true
+		return
+	}
+	if !s.holt {
+		s.level = s.alpha*x + (1-s.alpha)*s.level
+		return
+	}
+	last := s.level
+	s.level = s.alpha*x + (1-s.alpha)*(s.level+s.trend)
+	s.trend = s.beta*(s.level-last) + (1-s.beta)*s.trend
+}
+
+// caller must hold the lock; completes the buckets before idx
+func (s *smoothedSeries) advance(idx int64) {
+	if s.bucket < 0 || idx <= s.bucket {
+		return
+	}
+	s.update(s.sum)
+	for i := int64(1); i < idx-s.bucket && i <= maxSkippedBuckets; i++ {
+		s.update(0)
+	}
+	s.bucket, s.sum = idx, 0
+}
+
+func (s *smoothedSeries) Record(now time.Time, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := now.UnixNano() / int64(s.granularity)
+	if s.bucket < 0 {
+		s.bucket = idx
+	}
+	s.advance(idx)
+	if idx == s.bucket {
+		s.sum += value
+	}
+}
+
+func (s *smoothedSeries) WindowAverage(now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(now.UnixNano() / int64(s.granularity))
+	if !s.initialized {
+		return 0
+	}
+	if s.holt {
+		return math.Max(0, s.level+s.trend)
+	}
+	return s.level
+}
@@ -0,0 +1,46 @@
+package metric
+
+import (
+	"time"
+)
+
+// Sample is one collected report, as recorded into the windows
+type Sample struct {
+	At           time.Time `json:"at"`
+	Concurrency  float64   `json:"concurrency"`
+	RequestCount float64   `json:"requestCount"`
+}
+
+// CollectorState holds the samples still within the stable or panic window.
+// The windows are rebuilt by replaying them, so the state is independent of the window implementation;
+// smoothed series only remember the replayed span.
+type CollectorState struct {
+	Samples []Sample `json:"samples"`
+}
+
+// caller must hold the history lock
+func (c *Collector) remember(sample Sample) {
+	c.history = append(c.history, sample)
+	horizon := sample.At.Add(-max(c.stableWindow, c.panicWindow))
+	i := 0
+	for i < len(c.history) && !c.history[i].At.After(horizon) {
+		i++
+	}
+	c.history = c.history[i:]
+}
+
+func (c *Collector) ExportState() CollectorState {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	return CollectorState{Samples: append([]Sample(nil), c.history...)}
+}
+
+// ImportState replays the samples into the windows, must be called before the collector runs
+func (c *Collector) ImportState(state CollectorState) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	for _, s := range state.Samples {
+		c.record(s)
+		c.remember(s)
+	}
+}
@@ -0,0 +1,151 @@
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Window aggregates timed values over a sliding window
+type Window interface {
+	Record(now time.Time, value float64)
+	WindowAverage(now time.Time) float64
+}
+
+const (
+	// Knative's aggregation buckets, only available without the noknative build tag
+	WindowKnative = "knative"
+	// the in-repo implementation
+	WindowSliding = "sliding"
+)
+
+var windowFactories = map[string]func(window, granularity time.Duration) Window{
+	WindowSliding: func(window, granularity time.Duration) Window {
+		return NewSlidingWindow(window, granularity)
+	},
+}
+
+// DefaultWindow is knative if built in, sliding otherwise
+func DefaultWindow() string {
+	if _, ok := windowFactories[WindowKnative]; ok {
+		return WindowKnative
+	}
+	return WindowSliding
+}
+
+// Windows lists the available implementations
+func Windows() []string {
+	var names []string
+	for name := range windowFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewWindow creates a window of the given implementation, the default if empty
+func NewWindow(impl string, window, granularity time.Duration) (Window, error) {
+	if impl == "" {
+		impl = DefaultWindow()
+	}
+	factory, ok := windowFactories[impl]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric window %q, available: %v", impl, Windows())
+	}
+	return factory(window, granularity), nil
+}
+
+// SlidingWindow sums the values recorded within each granularity-sized bucket,
+// and averages the buckets of the window, counting only those since the first record,
+// i.e., the same semantics as Knative's TimedFloat64Buckets.
+type SlidingWindow struct {
+	mu          sync.Mutex
+	granularity time.Duration
+	buckets     []float64
+	// index of the bucket last written, -1 if none
+	last  int64
+	first int64
+}
+
+func NewSlidingWindow(window, granularity time.Duration) *SlidingWindow {
+	n := int(window / granularity)
+	if n < 1 {
+		n = 1
+	}
+	return &SlidingWindow{
+		granularity: granularity,
+		buckets:     make([]float64, n),
+		last:        -1,
+		first:       -1,
+	}
+}
+
+var _ Window = &SlidingWindow{}
+
+func (w *SlidingWindow) index(now time.Time) int64 {
+	return now.UnixNano() / int64(w.granularity)
+}
+
+// caller must hold the lock; zeroes the buckets skipped since the last write
+func (w *SlidingWindow) advance(idx int64) {
+	if w.last < 0 || idx <= w.last {
+		return
+	}
+	n := int64(len(w.buckets))
+	if idx-w.last >= n {
+		// idle for a whole window, start over as if idx were the first record
+		for i := range w.buckets {
+			w.buckets[i] = 0
+		}
+		w.first = idx
+	} else {
+		for i := w.last + 1; i <= idx; i++ {
+			w.buckets[i%n] = 0
+		}
+	}
+	w.last = idx
+}
+
+func (w *SlidingWindow) Record(now time.Time, value float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	idx := w.index(now)
+	if w.last < 0 {
+		w.first, w.last = idx, idx
+	} else if idx < w.last-int64(len(w.buckets))+1 {
+		// older than the window
+		return
+	}
+	w.advance(idx)
+	w.buckets[idx%int64(len(w.buckets))] += value
+}
+
+func (w *SlidingWindow) WindowAverage(now time.Time) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last < 0 {
+		return 0
+	}
+	n := int64(len(w.buckets))
+	idx := w.index(now)
+	if idx < w.last {
+		idx = w.last
+	}
+	if idx-w.last >= n {
+		// nothing recorded for a whole window
+		return 0
+	}
+	var total float64
+	for i := idx - n + 1; i <= w.last; i++ {
+		if i >= 0 && i >= w.first {
+			total += w.buckets[i%n]
+		}
+	}
+	// buckets since the first record, excluding those not written since the last record
+	span := w.last - w.first + 1
+	if gap := n - (idx - w.last); span > gap {
+		span = gap
+	}
+	return total / float64(span)
+}
@@ -0,0 +1,15 @@
+//go:build !noknative
+
+package metric
+
+import (
+	"time"
+
+	knas "knative.dev/serving/pkg/autoscaler/aggregation"
+)
+
+func init() {
+	windowFactories[WindowKnative] = func(window, granularity time.Duration) Window {
+		return knas.NewTimedFloat64Buckets(window, granularity)
+	}
+}
@@ -0,0 +1,120 @@
+package autoscaler
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMinScalers = 16
+	defaultMaxScalers = 256
+	// how often the pool re-evaluates its size
+	scalerPoolResizeInterval = 1 * time.Second
+	// smoothing factor of the observed Scale() latency
+	scalerLatencyAlpha = 0.2
+)
+
+// scalerPool sizes the scaling workers based on the queue backlog and the observed scaling latency.
+// Workers are only spawned by the resize loop, and retire themselves after finishing an item
+// if the pool is over its target size, so an in-flight scaling operation is never interrupted.
+type scalerPool struct {
+	min     int32
+	max     int32
+	workers int32
+	target  int32
+	busy    int32
+	mu      sync.Mutex
+	latency float64 // EWMA of Scale() latency in seconds
+}
+
+func newScalerPool(minScalers, maxScalers int) *scalerPool {
+	if minScalers <= 0 {
+		minScalers = defaultMinScalers
+	}
+	if maxScalers < minScalers {
+		maxScalers = minScalers
+	}
+	return &scalerPool{
+		min:    int32(minScalers),
+		max:    int32(maxScalers),
+		target: int32(minScalers),
+	}
+}
+
+func (p *scalerPool) observe(elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latency == 0 {
+		p.latency = elapsed.Seconds()
+		return
+	}
+	p.latency = scalerLatencyAlpha*elapsed.Seconds() + (1-scalerLatencyAlpha)*p.latency
+}
+
+func (p *scalerPool) averageLatency() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Duration(p.latency * float64(time.Second))
+}
+
+// desired returns the number of workers needed to drain the backlog within one resize interval,
+// in addition to the workers that are currently busy.
+func (p *scalerPool) desired(backlog int) int32 {
+	busy := atomic.LoadInt32(&p.busy)
+	latency := p.averageLatency()
+	need := busy
+	if backlog > 0 {
+		if latency <= 0 {
+			// no observation yet, be optimistic
+			need += int32(backlog)
+		} else {
+			perWorker := math.Max(1, float64(scalerPoolResizeInterval)/float64(latency))
+			need += int32(math.Ceil(float64(backlog) / perWorker))
+		}
+	}
+	return int32(math.Min(math.Max(float64(need), float64(p.min)), float64(p.max)))
+}
+
+// retire returns true if the calling worker should exit
+func (p *scalerPool) retire() bool {
+	for {
+		n := atomic.LoadInt32(&p.workers)
+		if n <= atomic.LoadInt32(&p.target) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.workers, n, n-1) {
+			return true
+		}
+	}
+}
+
+func (s *autoscalerImpl) spawnScalers(ctx context.Context, n int32) {
+	for i := int32(0); i < n; i++ {
+		atomic.AddInt32(&s.pool.workers, 1)
+		go s.workerLoop(ctx)
+	}
+}
+
+func (s *autoscalerImpl) resizeLoop(ctx context.Context) {
+	ticker := time.NewTicker(scalerPoolResizeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backlog := s.queue.Len()
+			target := s.pool.desired(backlog)
+			old := atomic.SwapInt32(&s.pool.target, target)
+			if n := atomic.LoadInt32(&s.pool.workers); target > n {
+				s.spawnScalers(ctx, target-n)
+			}
+			if old != target {
+				s.logger.V(1).Info("Resizing scaler pool", "from", old, "to", target, "backlog", backlog, "latency", s.pool.averageLatency())
+			}
+		}
+	}
+}
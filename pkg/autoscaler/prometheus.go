@@ -0,0 +1,104 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+const promNamespace = "kubedirect_autoscaler"
+
+// promMetrics exports the inputs and outputs of every decision on its own registry,
+// since the metrics endpoint of the controller manager is disabled
+type promMetrics struct {
+	addr              string
+	registry          *prometheus.Registry
+	stableConcurrency *prometheus.GaugeVec
+	panicConcurrency  *prometheus.GaugeVec
+	desired           *prometheus.GaugeVec
+	ready             *prometheus.GaugeVec
+	decisions         *prometheus.CounterVec
+	// across all keys, per-key histograms would not scale to thousands of targets
+	deciderLatency   prometheus.Histogram
+	actuationLatency prometheus.Histogram
+}
+
+func newPromMetrics(logger logr.Logger, addr string, queueDepth func() int) *promMetrics {
+	if addr == "" {
+		return nil
+	}
+	logger.Info("Prometheus metrics", "address", addr)
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: promNamespace, Name: name, Help: help}, []string{"target"})
+	}
+	latency := func(name, help string) prometheus.Histogram {
+		return prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: promNamespace,
+			Name:      name,
+			Help:      help,
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		})
+	}
+	m := &promMetrics{
+		addr:              addr,
+		registry:          prometheus.NewRegistry(),
+		stableConcurrency: gauge("stable_concurrency", "Stable-window concurrency observed by the decider."),
+		panicConcurrency:  gauge("panic_concurrency", "Panic-window concurrency observed by the decider."),
+		desired:           gauge("desired_pods", "Latest desired scale of the decider."),
+		ready:             gauge("ready_pods", "Ready pods when the decider last ran."),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: promNamespace,
+			Name:      "decisions_total",
+			Help:      "Decisions reaching the decider, by whether the scaler wrote a new scale.",
+		}, []string{"scaled"}),
+		deciderLatency:   latency("decider_seconds", "Time from dequeue to the decision, including the pod listing."),
+		actuationLatency: latency("actuation_seconds", "Time the scaler took to actuate a decision."),
+	}
+	m.registry.MustRegister(m.stableConcurrency, m.panicConcurrency, m.desired, m.ready, m.decisions, m.deciderLatency, m.actuationLatency,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: promNamespace,
+			Name:      "workqueue_depth",
+			Help:      "Keys waiting in the scaling workqueue.",
+		}, func() float64 { return float64(queueDepth()) }),
+	)
+	return m
+}
+
+func (m *promMetrics) observe(key string, snapshot metric.Snapshot, ready, desired int, scaled bool, deciderTime, actuationTime time.Duration) {
+	if m == nil {
+		return
+	}
+	m.stableConcurrency.WithLabelValues(key).Set(snapshot.StableConcurrency)
+	m.panicConcurrency.WithLabelValues(key).Set(snapshot.PanicConcurrency)
+	m.ready.WithLabelValues(key).Set(float64(ready))
+	m.desired.WithLabelValues(key).Set(float64(desired))
+	m.decisions.WithLabelValues(fmt.Sprint(scaled)).Inc()
+	m.deciderLatency.Observe(deciderTime.Seconds())
+	m.actuationLatency.Observe(actuationTime.Seconds())
+}
+
+// serve exposes the metrics on /metrics until ctx is done
+func (m *promMetrics) serve(ctx context.Context, logger logr.Logger) {
+	if m == nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: m.addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("Serving autoscaler metrics", "addr", m.addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error(err, "Failed to serve autoscaler metrics")
+	}
+}
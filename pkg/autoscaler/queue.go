@@ -0,0 +1,77 @@
+package autoscaler
+
+import (
+	"sync"
+	"time"
+)
+
+// QueueStats describes how long scaling triggers wait for a scaler, which exposes cross-key contention
+// when many targets burst at once; per-key decisions alone hide it
+type QueueStats struct {
+	// keys dequeued by a scaler, after waiting since their first trigger
+	Dequeued int64
+	MaxDepth int
+	AvgWait  time.Duration
+	MaxWait  time.Duration
+}
+
+// QueueReporter is implemented by autoscalers that expose their scaling queue
+type QueueReporter interface {
+	QueueStats() QueueStats
+}
+
+// queueTracker measures the wait of a key in the workqueue, from the first trigger merged into it until a scaler picks it up.
+// Delayed retries of the rate limiter are not triggers and are not tracked.
+type queueTracker struct {
+	mu        sync.Mutex
+	pending   map[string]time.Time
+	maxDepth  int
+	dequeued  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+func newQueueTracker() *queueTracker {
+	return &queueTracker{pending: make(map[string]time.Time)}
+}
+
+func (q *queueTracker) added(key string, now time.Time, depth int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[key]; !ok {
+		q.pending[key] = now
+	}
+	q.maxDepth = max(q.maxDepth, depth)
+}
+
+func (q *queueTracker) picked(key string, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	since, ok := q.pending[key]
+	if !ok {
+		return
+	}
+	delete(q.pending, key)
+	wait := now.Sub(since)
+	q.dequeued++
+	q.totalWait += wait
+	q.maxWait = max(q.maxWait, wait)
+}
+
+func (q *queueTracker) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := QueueStats{
+		Dequeued: q.dequeued,
+		MaxDepth: q.maxDepth,
+		MaxWait:  q.maxWait,
+	}
+	if q.dequeued > 0 {
+		stats.AvgWait = q.totalWait / time.Duration(q.dequeued)
+	}
+	return stats
+}
+
+func (s *autoscalerImpl) QueueStats() QueueStats {
+	return s.queueTracker.stats()
+}
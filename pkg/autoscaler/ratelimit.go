@@ -0,0 +1,126 @@
+package autoscaler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+)
+
+// scaleRateLimiter enforces a minimum interval between successive scale writes of the same key.
+// Only calls that actually changed the scale count, so no-op reconciles are never throttled.
+type scaleRateLimiter struct {
+	mu              sync.Mutex
+	defaultInterval time.Duration
+	intervals       map[string]time.Duration
+	lastScaled      map[string]time.Time
+}
+
+func newScaleRateLimiter(logger logr.Logger, defaultInterval time.Duration, intervals map[string]time.Duration) *scaleRateLimiter {
+	if intervals == nil {
+		intervals = make(map[string]time.Duration)
+	}
+	if defaultInterval > 0 || len(intervals) > 0 {
+		logger.Info("Scale rate limiter", "minScaleInterval", defaultInterval, "overrides", len(intervals))
+	}
+	return &scaleRateLimiter{
+		defaultInterval: defaultInterval,
+		intervals:       intervals,
+		lastScaled:      make(map[string]time.Time),
+	}
+}
+
+func (r *scaleRateLimiter) interval(key string) time.Duration {
+	if interval, ok := r.intervals[key]; ok {
+		return interval
+	}
+	return r.defaultInterval
+}
+
+// when returns how long the key must wait before it can be scaled again
+func (r *scaleRateLimiter) when(key string, now time.Time) time.Duration {
+	interval := r.interval(key)
+	if interval <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last, ok := r.lastScaled[key]
+	if !ok {
+		return 0
+	}
+	if wait := last.Add(interval).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (r *scaleRateLimiter) scaled(key string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastScaled[key] = now
+}
+
+// scaleTokenBucket limits the scale writes of each key to a rate with bursts, e.g., to spare the API server
+// when deciders oscillate across thousands of keys. Like scaleRateLimiter, only writes take a token,
+// and a throttled key is reconciled once a token is available, so the intermediate decisions coalesce into one write
+type scaleTokenBucket struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	buckets map[string]*rate.Limiter
+	// reconciles deferred for a token
+	nThrottled int64
+}
+
+func newScaleTokenBucket(logger logr.Logger, writesPerSecond float64, burst int) *scaleTokenBucket {
+	if writesPerSecond <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	logger.Info("Scale token bucket", "writesPerSecond", writesPerSecond, "burst", burst)
+	return &scaleTokenBucket{limit: rate.Limit(writesPerSecond), burst: burst, buckets: make(map[string]*rate.Limiter)}
+}
+
+func (b *scaleTokenBucket) bucket(key string) *rate.Limiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = rate.NewLimiter(b.limit, b.burst)
+		b.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// when returns how long the key must wait for a token
+func (b *scaleTokenBucket) when(key string, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	tokens := b.bucket(key).TokensAt(now)
+	if tokens >= 1 {
+		return 0
+	}
+	atomic.AddInt64(&b.nThrottled, 1)
+	return time.Duration((1 - tokens) / float64(b.limit) * float64(time.Second))
+}
+
+// scaled takes the token of a write
+func (b *scaleTokenBucket) scaled(key string, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.bucket(key).AllowN(now, 1)
+}
+
+func (b *scaleTokenBucket) throttled() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.nThrottled)
+}
@@ -0,0 +1,69 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+)
+
+// Factory creates an autoscaler of the keys from its section of cfg, which may be nil without a config file
+type Factory func(ctx context.Context, mgr manager.Manager, cfg *AutoscalerConfig, keys ...string) (Autoscaler, error)
+
+// names of the built-in autoscaler frameworks; the scaling algorithm of kpa is selected by its decider
+const (
+	FrameworkKPA     = "kpa"
+	FrameworkOneTime = "one-time"
+)
+
+var registry = benchutil.NewRegistry[Factory]("autoscaler")
+
+func init() {
+	Register(FrameworkKPA, func(ctx context.Context, mgr manager.Manager, cfg *AutoscalerConfig, keys ...string) (Autoscaler, error) {
+		if cfg == nil || cfg.Knative == nil {
+			return nil, fmt.Errorf("kpa is not configured")
+		}
+		kpaConfig, err := cfg.Knative.Complete(ctx, mgr)
+		if err != nil {
+			return nil, err
+		}
+		return NewKnativeAutoscaler(ctx, kpaConfig, keys...)
+	})
+	Register(FrameworkOneTime, func(ctx context.Context, mgr manager.Manager, cfg *AutoscalerConfig, keys ...string) (Autoscaler, error) {
+		var oneTime *OneTimeAutoscalerConfig
+		if cfg != nil {
+			oneTime = cfg.OneTime
+		}
+		oneTimeConfig, err := oneTime.Complete(ctx, mgr)
+		if err != nil {
+			return nil, err
+		}
+		return NewOneTimeAutoscaler(ctx, mgr, oneTimeConfig, keys...)
+	})
+}
+
+// Register makes an autoscaler framework available to the k8s gateway by name; it panics if the name is taken
+func Register(name string, factory Factory) {
+	registry.Register(name, factory)
+}
+
+// New creates an autoscaler of the registered framework
+func New(ctx context.Context, name string, mgr manager.Manager, cfg *AutoscalerConfig, keys ...string) (Autoscaler, error) {
+	factory, err := registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(ctx, mgr, cfg, keys...)
+}
+
+func IsRegistered(name string) bool {
+	return registry.IsRegistered(name)
+}
+
+// Registered returns the names of the registered autoscaler frameworks, sorted
+func Registered() []string {
+	return registry.Names()
+}
@@ -0,0 +1,122 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DelayConfig injects a synthetic control-plane latency before every scale call,
+// to study how end-to-end latency degrades as the API server or kd RPCs get slower
+type DelayConfig struct {
+	MilliSec int `yaml:"milliSec"`
+	// if positive, a uniform jitter in [0, jitterMilliSec) is added to every delay
+	JitterMilliSec int `yaml:"jitterMilliSec"`
+}
+
+func (cfg *DelayConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MilliSec < 0 {
+		return fmt.Errorf("milliSec cannot be negative, got %v", cfg.MilliSec)
+	}
+	if cfg.JitterMilliSec < 0 {
+		return fmt.Errorf("jitterMilliSec cannot be negative, got %v", cfg.JitterMilliSec)
+	}
+	return nil
+}
+
+// DelayReporter is implemented by scalers with an injected delay
+type DelayReporter interface {
+	DelayStats() DelayStats
+}
+
+type DelayStats struct {
+	Delayed int64
+	Total   time.Duration
+}
+
+type delayedScaler struct {
+	inner  Scaler
+	delay  time.Duration
+	jitter time.Duration
+	mu     sync.Mutex
+	rng    *rand.Rand
+	stats  DelayStats
+}
+
+// WithDelay wraps s so that every scale call is delayed as configured, s is returned as is if cfg is nil or zero
+func WithDelay(ctx context.Context, s Scaler, cfg *DelayConfig) Scaler {
+	if cfg == nil || (cfg.MilliSec == 0 && cfg.JitterMilliSec == 0) {
+		return s
+	}
+	klog.FromContext(ctx).Info("Injecting control-plane delay", "milliSec", cfg.MilliSec, "jitterMilliSec", cfg.JitterMilliSec)
+	return &delayedScaler{
+		inner:  s,
+		delay:  time.Duration(cfg.MilliSec) * time.Millisecond,
+		jitter: time.Duration(cfg.JitterMilliSec) * time.Millisecond,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+var _ Scaler = &delayedScaler{}
+var _ ErrorReporter = &delayedScaler{}
+var _ DelayReporter = &delayedScaler{}
+var _ EndpointObserver = &delayedScaler{}
+var _ TimelineReporter = &delayedScaler{}
+
+func (s *delayedScaler) next() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.delay
+	if s.jitter > 0 {
+		d += time.Duration(s.rng.Int63n(int64(s.jitter)))
+	}
+	s.stats.Delayed++
+	s.stats.Total += d
+	return d
+}
+
+func (s *delayedScaler) Scale(ctx context.Context, key string, desired int) (bool, error) {
+	timer := time.NewTimer(s.next())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	return s.inner.Scale(ctx, key, desired)
+}
+
+// ErrorCounts forwards to the wrapped scaler, empty if it does not classify its errors
+func (s *delayedScaler) ErrorCounts() map[string]int64 {
+	if reporter, ok := s.inner.(ErrorReporter); ok {
+		return reporter.ErrorCounts()
+	}
+	return map[string]int64{}
+}
+
+func (s *delayedScaler) DelayStats() DelayStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *delayedScaler) EndpointsChanged(key string, before, after int) {
+	if observer, ok := s.inner.(EndpointObserver); ok {
+		observer.EndpointsChanged(key, before, after)
+	}
+}
+
+// TimelineStats forwards to the wrapped scaler, the stages include the injected delay in build
+func (s *delayedScaler) TimelineStats() TimelineStats {
+	if reporter, ok := s.inner.(TimelineReporter); ok {
+		return reporter.TimelineStats()
+	}
+	return TimelineStats{}
+}
@@ -6,14 +6,21 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	// Kubedirect
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
+// field manager of the server-side applied scale intents
+const autoscalerFieldManager = "kubedirect-autoscaler"
+
 type DeploymentScaler struct {
 	client client.Client
+	// server-side apply spec.replicas instead of updating the scale subresource
+	apply bool
+	errs  errorCounter
 }
 
 func NewDeploymentScaler(ctx context.Context, client client.Client, keys ...string) (*DeploymentScaler, error) {
@@ -23,29 +30,67 @@ func NewDeploymentScaler(ctx context.Context, client client.Client, keys ...stri
 	return s, nil
 }
 
+// WithApply writes scale intents with server-side apply, owning only spec.replicas
+func (s *DeploymentScaler) WithApply() *DeploymentScaler {
+	s.apply = true
+	return s
+}
+
 var _ Scaler = &DeploymentScaler{}
+var _ ErrorReporter = &DeploymentScaler{}
 
 func (s *DeploymentScaler) Scale(ctx context.Context, key string, desired int) (bool, error) {
 	// logger := klog.FromContext(ctx).WithValues("target", key)
-	deployment := &appsv1.Deployment{}
-	if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), deployment); err != nil {
-		return false, fmt.Errorf("failed to get deployment %v: %v", key, err)
-	}
-	if deployment.DeletionTimestamp != nil {
-		return false, fmt.Errorf("deployment %v is being deleted", key)
-	}
-	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == int32(desired) {
-		return false, nil
+	scaled := false
+	err := s.errs.retryScale(func() error {
+		// get-modify-write on every attempt, so a conflict is retried against the latest version
+		deployment := &appsv1.Deployment{}
+		if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), deployment); err != nil {
+			return err
+		}
+		if deployment.DeletionTimestamp != nil {
+			return fmt.Errorf("deployment %v is being deleted", key)
+		}
+		if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == int32(desired) {
+			return nil
+		}
+		if s.apply {
+			if err := s.applyReplicas(ctx, deployment, desired); err != nil {
+				return err
+			}
+			scaled = true
+			return nil
+		}
+		scale := &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: int32(desired)}}
+		if err := s.client.SubResource("scale").Update(ctx, deployment, client.WithSubResourceBody(scale)); err != nil {
+			return err
+		}
+		scaled = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to scale deployment %v (%v): %v", key, classify(err), err)
 	}
-	scale := &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: int32(desired)}}
-	if err := s.client.SubResource("scale").Update(ctx, deployment, client.WithSubResourceBody(scale)); err != nil {
-		return false, err
-	}
-	return true, nil
-	// return wait.PollUntilContextTimeout(ctx, time.Millisecond*50, time.Second*1, true, func(retryContext context.Context) (bool, error) {
-	// 	if err := s.client.SubResource("scale").Update(ctx, deployment, client.WithSubResourceBody(scale)); err != nil {
-	// 		return false, err
-	// 	}
-	// 	return true, nil
-	// })
+	return scaled, nil
+}
+
+func (s *DeploymentScaler) ErrorCounts() map[string]int64 {
+	return s.errs.ErrorCounts()
+}
+
+// applyReplicas server-side applies a Deployment with nothing but spec.replicas.
+// There is no resourceVersion precondition, so concurrent writers of other fields do not conflict with it.
+func (s *DeploymentScaler) applyReplicas(ctx context.Context, deployment *appsv1.Deployment, desired int) error {
+	intent := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": appsv1.SchemeGroupVersion.String(),
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"namespace": deployment.Namespace,
+			"name":      deployment.Name,
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(desired),
+		},
+	}}
+	return s.client.Patch(ctx, intent, client.Apply, client.FieldOwner(autoscalerFieldManager), client.ForceOwnership)
 }
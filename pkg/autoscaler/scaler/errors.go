@@ -0,0 +1,89 @@
+package scaler
+
+import (
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// error classes of scale writes
+const (
+	ErrConflict  = "conflict"
+	ErrNotFound  = "notFound"
+	ErrForbidden = "forbidden"
+	ErrThrottled = "throttled"
+	ErrOther     = "other"
+)
+
+// ErrorReporter is implemented by scalers that classify their API errors
+type ErrorReporter interface {
+	// number of errors by class, including the retried ones
+	ErrorCounts() map[string]int64
+}
+
+func classify(err error) string {
+	switch {
+	case apierrors.IsConflict(err):
+		return ErrConflict
+	case apierrors.IsNotFound(err):
+		return ErrNotFound
+	case apierrors.IsForbidden(err):
+		return ErrForbidden
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err):
+		return ErrThrottled
+	default:
+		return ErrOther
+	}
+}
+
+// conflicts are retried with a fresh get, throttled requests after a backoff
+func retriable(err error) bool {
+	switch classify(err) {
+	case ErrConflict, ErrThrottled:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff of retried scale writes, the client-go default for conflicts
+var scaleRetryBackoff wait.Backoff = retry.DefaultRetry
+
+type errorCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *errorCounter) observe(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[classify(err)]++
+}
+
+func (c *errorCounter) ErrorCounts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for class, n := range c.counts {
+		counts[class] = n
+	}
+	return counts
+}
+
+// retryScale runs a get-modify-write attempt until it succeeds or fails with a non-retriable error,
+// counting every error by class
+func (c *errorCounter) retryScale(attempt func() error) error {
+	return retry.OnError(scaleRetryBackoff, retriable, func() error {
+		err := attempt()
+		c.observe(err)
+		return err
+	})
+}
@@ -0,0 +1,188 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+	kdctx "k8s.io/kubedirect/pkg/context"
+	kdrpc "k8s.io/kubedirect/pkg/rpc"
+	kdproto "k8s.io/kubedirect/pkg/rpc/proto"
+	kdutil "k8s.io/kubedirect/pkg/util"
+)
+
+const (
+	kdScalerClient = "autoscaler"
+	kdRSService    = "rs"
+	kdDialTimeout  = 5 * time.Second
+	kdDialInterval = 1 * time.Second
+)
+
+type KdScalerConfig struct {
+	// wait for the pods to be created before the RPC returns
+	Blocking bool `yaml:"blocking"`
+	// log the per-stage timing of every scale-up, from request build to the first dispatchable endpoint
+	Timing bool `yaml:"timing"`
+}
+
+// KdScaler scales the active ReplicaSet of a Deployment through the kd ReplicaSet service,
+// bypassing the Deployment scale subresource.
+// The service only exposes a unary Scale RPC of one ReplicaSet, so every key is scaled by its own request
+type KdScaler struct {
+	client   client.Client
+	blocking bool
+	unwrap   func() kdrpc.ClientInterface[kdproto.ReplicaSetClient]
+	errs     errorCounter
+	// nil unless timing, see TimeStages
+	timelines *kdTimelines
+}
+
+func NewKdScaler(ctx context.Context, c client.Client, cfg *KdScalerConfig, keys ...string) (*KdScaler, error) {
+	if cfg == nil {
+		cfg = &KdScalerConfig{}
+	}
+	hub := kdrpc.NewEventedClientHub(kdScalerClient, kdRSService, kdproto.NewReplicaSetClient).
+		WithHandshake(doReplicaSetHandshake).
+		WithDialOptions(kdDialTimeout, kdDialInterval).
+		WithAddrLister(newReplicaSetServiceLister(ctx, c))
+	hub.Start(ctx)
+	s := &KdScaler{
+		client:   c,
+		blocking: cfg.Blocking,
+		unwrap: func() kdrpc.ClientInterface[kdproto.ReplicaSetClient] {
+			return hub.Unwrap()
+		},
+	}
+	return s, nil
+}
+
+var _ Scaler = &KdScaler{}
+var _ ErrorReporter = &KdScaler{}
+
+func (s *KdScaler) Scale(ctx context.Context, key string, desired int) (bool, error) {
+	scaled := false
+	err := s.errs.retryScale(func() error {
+		rs, err := s.getActiveReplicaSet(ctx, key)
+		if err != nil {
+			return err
+		}
+		if rs.Spec.Replicas != nil && *rs.Spec.Replicas == int32(desired) {
+			return nil
+		}
+		var from int32 = 1
+		if rs.Spec.Replicas != nil {
+			from = *rs.Spec.Replicas
+		}
+		t := s.timelines.built(key, from, int32(desired))
+		rs = rs.DeepCopy()
+		replicas := int32(desired)
+		rs.Spec.Replicas = &replicas
+		scaled = true
+		return s.scaleOne(ctx, rs, t)
+	})
+	return scaled, err
+}
+
+func (s *KdScaler) ErrorCounts() map[string]int64 {
+	return s.errs.ErrorCounts()
+}
+
+func (s *KdScaler) scaleOne(ctx context.Context, rs *appsv1.ReplicaSet, t *scaleTimeline) error {
+	kdClient := s.unwrap()
+	if kdClient == nil {
+		return fmt.Errorf("kd client for %v service is not connected", kdRSService)
+	}
+	req := kdctx.NewReplicaSetScalingRequest(kdClient, rs)
+	req.Blocking = s.blocking
+	start := time.Now()
+	s.timelines.sent(t)
+	_, err := kdClient.Client().Scale(ctx, req)
+	s.timelines.returned(t, err)
+	if err != nil {
+		return fmt.Errorf("failed to scale replicaset %v: %v", klog.KObj(rs), err)
+	}
+	klog.FromContext(ctx).V(2).Info("Scaled replicaset via kd", "target", klog.KObj(rs), "replicas", *rs.Spec.Replicas, "blocking", s.blocking, "elapsed", time.Since(start))
+	return nil
+}
+
+// the newest kd-managed ReplicaSet controlled by the Deployment of key
+func (s *KdScaler) getActiveReplicaSet(ctx context.Context, key string) (*appsv1.ReplicaSet, error) {
+	deployment := &appsv1.Deployment{}
+	if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), deployment); err != nil {
+		return nil, fmt.Errorf("failed to get deployment %v: %w", key, err)
+	}
+	if deployment.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("deployment %v is being deleted", key)
+	}
+	rsList := &appsv1.ReplicaSetList{}
+	if err := s.client.List(ctx, rsList,
+		client.InNamespace(deployment.Namespace),
+		client.MatchingLabels(deployment.Spec.Template.Labels),
+	); err != nil {
+		return nil, fmt.Errorf("failed to list replicasets for %v: %w", key, err)
+	}
+	var active *appsv1.ReplicaSet
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if !metav1.IsControlledBy(rs, deployment) || !kdutil.IsManaged(rs) {
+			continue
+		}
+		if active == nil || active.CreationTimestamp.Before(&rs.CreationTimestamp) {
+			active = rs
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("no kd-managed replicaset found for deployment %v", key)
+	}
+	return active, nil
+}
+
+func doReplicaSetHandshake(ctx context.Context, src string, dest string, client kdproto.ReplicaSetClient) (string, error) {
+	msg := kdrpc.NewHandshakeRequest(src, dest)
+	epoch := msg.Epoch
+	resp, err := client.Handshake(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	if epoch != resp.Epoch {
+		return "", fmt.Errorf("epoch mismatch: expected %s, got %s", epoch, resp.Epoch)
+	}
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader(fmt.Sprintf("Handshake->%v", dest))
+	kdLogger.Info("Handshake done", "epoch", epoch)
+	return epoch, nil
+}
+
+func newReplicaSetServiceLister(ctx context.Context, c client.Client) func(ctx context.Context) (addrs []string, err error) {
+	kdLogger := kdutil.NewLogger(klog.FromContext(ctx)).WithHeader(fmt.Sprintf("Lister/%s", kdRSService))
+
+	return func(ctx context.Context) (addrs []string, err error) {
+		ctrlMgrs := &corev1.PodList{}
+		err = c.List(ctx, ctrlMgrs,
+			client.InNamespace(metav1.NamespaceSystem),
+			client.MatchingLabels{"component": "kube-controller-manager"},
+		)
+		if err != nil {
+			kdLogger.Error(err, "Failed to list controller managers")
+			return
+		}
+		for i := range ctrlMgrs.Items {
+			ctrlMgr := &ctrlMgrs.Items[i]
+			if !kdutil.IsPodReady(ctrlMgr) {
+				continue
+			}
+			addrs = append(addrs, ctrlMgr.Status.PodIP+kdrpc.ReplicaSetServicePort)
+		}
+		if len(addrs) == 0 {
+			kdLogger.WARN("No ready controller manager found, will retry later")
+		}
+		return
+	}
+}
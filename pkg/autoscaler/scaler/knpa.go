@@ -0,0 +1,99 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	knMinScaleAnnotation = "autoscaling.knative.dev/min-scale"
+	knMaxScaleAnnotation = "autoscaling.knative.dev/max-scale"
+	knRevisionLabel      = "serving.knative.dev/revision"
+)
+
+var knRevisionGVK = schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Revision"}
+
+// KnPAScaler hands the desired scale to Knative instead of writing the Deployment: it pins the min and max scale
+// of the PodAutoscaler of the revision, so the Knative autoscaler clamps its own decision to ours and actuates it,
+// including the activator and serverless-service mode switches.
+// The bounds are written to the Revision, which the revision reconciler propagates to its PodAutoscaler;
+// written to the PodAutoscaler directly, they would be reverted on the next revision reconcile.
+// Knative has no max scale of zero, so a desired scale of zero only lifts the floor
+// and leaves the last pod to the scale-to-zero of Knative once it sees the revision idle
+type KnPAScaler struct {
+	client client.Client
+	errs   errorCounter
+}
+
+func NewKnPAScaler(ctx context.Context, c client.Client, keys ...string) (*KnPAScaler, error) {
+	return &KnPAScaler{client: c}, nil
+}
+
+var _ Scaler = &KnPAScaler{}
+var _ ErrorReporter = &KnPAScaler{}
+
+// revisionOf returns the Revision of the deployment of key, which carries its name as a label
+func (s *KnPAScaler) revisionOf(ctx context.Context, key string) (*unstructured.Unstructured, error) {
+	deployment := &appsv1.Deployment{}
+	if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), deployment); err != nil {
+		return nil, err
+	}
+	name, ok := deployment.Labels[knRevisionLabel]
+	if !ok {
+		return nil, fmt.Errorf("deployment %v is not a Knative revision, no %v label", key, knRevisionLabel)
+	}
+	revision := &unstructured.Unstructured{}
+	revision.SetGroupVersionKind(knRevisionGVK)
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: deployment.Namespace, Name: name}, revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+func (s *KnPAScaler) Scale(ctx context.Context, key string, desired int) (bool, error) {
+	scaled := false
+	err := s.errs.retryScale(func() error {
+		revision, err := s.revisionOf(ctx, key)
+		if err != nil {
+			return err
+		}
+		floor, ceiling := strconv.Itoa(desired), strconv.Itoa(desired)
+		if desired == 0 {
+			floor, ceiling = "0", "1"
+		}
+		annotations := revision.GetAnnotations()
+		if annotations[knMinScaleAnnotation] == floor && annotations[knMaxScaleAnnotation] == ceiling {
+			return nil
+		}
+		patch := client.MergeFrom(revision.DeepCopy())
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[knMinScaleAnnotation] = floor
+		annotations[knMaxScaleAnnotation] = ceiling
+		revision.SetAnnotations(annotations)
+		if err := s.client.Patch(ctx, revision, patch); err != nil {
+			return err
+		}
+		scaled = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to scale PodAutoscaler of %v (%v): %v", key, classify(err), err)
+	}
+	return scaled, nil
+}
+
+func (s *KnPAScaler) ErrorCounts() map[string]int64 {
+	return s.errs.ErrorCounts()
+}
@@ -0,0 +1,200 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// EndpointObserver is implemented by scalers that follow the dispatchable endpoints of each key
+type EndpointObserver interface {
+	EndpointsChanged(key string, before, after int)
+}
+
+// TimelineReporter is implemented by scalers that time the stages of their scale-ups
+type TimelineReporter interface {
+	TimelineStats() TimelineStats
+}
+
+// scaleTimeline stamps the stages of a single kd scale operation, from building the request
+// to the first new endpoint the gateway can dispatch to; the pod stages only apply to followed scale-ups
+type scaleTimeline struct {
+	key           string
+	from, to      int32
+	followed      bool
+	build         time.Time
+	send          time.Time
+	rpcReturn     time.Time
+	firstPod      time.Time
+	firstEndpoint time.Time
+}
+
+// durations of the stages, the pods are timed from the send since a blocking RPC returns after they are created
+func (t *scaleTimeline) stages() []interface{} {
+	since := func(from, to time.Time) interface{} {
+		if from.IsZero() || to.IsZero() {
+			return "N/A"
+		}
+		return to.Sub(from)
+	}
+	return []interface{}{
+		"target", t.key, "replicas", fmt.Sprintf("%v -> %v", t.from, t.to), "followed", t.followed,
+		"build", since(t.build, t.send), "rpc", since(t.send, t.rpcReturn),
+		"firstPod", since(t.send, t.firstPod), "firstEndpoint", since(t.firstPod, t.firstEndpoint),
+		"total", since(t.build, t.firstEndpoint),
+	}
+}
+
+// TimelineStats sums up the stages of the completed scale-ups, and counts the incomplete ones
+type TimelineStats struct {
+	Completed  int64
+	Incomplete int64
+	// totals of build -> send, send -> return, send -> first pod, first pod -> first endpoint
+	Build         time.Duration
+	RPC           time.Duration
+	FirstPod      time.Duration
+	FirstEndpoint time.Duration
+}
+
+// kdTimelines follows at most one scale-up per key until its first endpoint is dispatchable;
+// other scale operations are logged at return, the pods of overlapping scale-ups cannot be told apart
+type kdTimelines struct {
+	mu      sync.Mutex
+	pending map[string]*scaleTimeline
+	stats   TimelineStats
+	logger  logr.Logger
+}
+
+func newKdTimelines(logger logr.Logger) *kdTimelines {
+	return &kdTimelines{pending: make(map[string]*scaleTimeline), logger: logger}
+}
+
+// built starts the timeline of a scale operation, nil if timing is disabled
+func (tl *kdTimelines) built(key string, from, to int32) *scaleTimeline {
+	if tl == nil {
+		return nil
+	}
+	return &scaleTimeline{key: key, from: from, to: to, build: time.Now()}
+}
+
+// sent follows t if it scales up a key without a pending scale-up
+func (tl *kdTimelines) sent(t *scaleTimeline) {
+	if t == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	t.send = time.Now()
+	if t.to > t.from && tl.pending[t.key] == nil {
+		t.followed = true
+		tl.pending[t.key] = t
+	}
+}
+
+func (tl *kdTimelines) returned(t *scaleTimeline, err error) {
+	if t == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	t.rpcReturn = time.Now()
+	if t.followed && err == nil {
+		return
+	}
+	if t.followed {
+		delete(tl.pending, t.key)
+		tl.stats.Incomplete++
+	}
+	tl.logger.V(1).Info("Kd scale timeline", append(t.stages(), "error", err)...)
+}
+
+func (tl *kdTimelines) podAdded(key string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if t := tl.pending[key]; t != nil && t.firstPod.IsZero() {
+		t.firstPod = time.Now()
+	}
+}
+
+func (tl *kdTimelines) endpointsChanged(key string, before, after int) {
+	if after <= before {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	t := tl.pending[key]
+	if t == nil || t.rpcReturn.IsZero() {
+		return
+	}
+	delete(tl.pending, key)
+	t.firstEndpoint = time.Now()
+	if t.firstPod.IsZero() {
+		// an existing pod turned ready first, the new pods are not the ones timed
+		tl.stats.Incomplete++
+		tl.logger.V(1).Info("Kd scale timeline", t.stages()...)
+		return
+	}
+	tl.stats.Completed++
+	tl.stats.Build += t.send.Sub(t.build)
+	tl.stats.RPC += t.rpcReturn.Sub(t.send)
+	tl.stats.FirstPod += t.firstPod.Sub(t.send)
+	tl.stats.FirstEndpoint += t.firstEndpoint.Sub(t.firstPod)
+	tl.logger.Info("Kd scale timeline", t.stages()...)
+}
+
+func (tl *kdTimelines) report() TimelineStats {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	stats := tl.stats
+	stats.Incomplete += int64(len(tl.pending))
+	return stats
+}
+
+// TimeStages logs the stages of every kd scale operation: request build, RPC send, RPC return,
+// and for scale-ups, the first new pod in the informer cache and the first new endpoint reported by the gateway.
+// Must be called before the cache starts
+func (s *KdScaler) TimeStages(ctx context.Context, informers cache.Informers) error {
+	informer, err := informers.GetInformer(ctx, &corev1.Pod{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod informer: %v", err)
+	}
+	timelines := newKdTimelines(klog.FromContext(ctx).WithValues("scaler", "kd"))
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok && workload.IsTraceWorkload(pod) {
+				timelines.podAdded(workload.KeyFromObject(pod))
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch pods: %v", err)
+	}
+	s.timelines = timelines
+	return nil
+}
+
+var _ EndpointObserver = &KdScaler{}
+var _ TimelineReporter = &KdScaler{}
+
+func (s *KdScaler) EndpointsChanged(key string, before, after int) {
+	if s.timelines != nil {
+		s.timelines.endpointsChanged(key, before, after)
+	}
+}
+
+func (s *KdScaler) TimelineStats() TimelineStats {
+	if s.timelines == nil {
+		return TimelineStats{}
+	}
+	return s.timelines.report()
+}
@@ -0,0 +1,197 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload/handler"
+)
+
+const (
+	// observe the requests seen by this gateway
+	MetricSourceGateway = "gateway"
+	// scrape the stats endpoint of the workload pods, like Knative scrapes its queue-proxies
+	MetricSourcePods = "pods"
+)
+
+// below the collect interval, so a hanging pod does not delay the next sample
+const podScrapeTimeout = 500 * time.Millisecond
+
+var defaultStatsPort = strings.TrimPrefix(handler.StatsServicePort, ":")
+
+// podScraper observes the load of a target from the cumulative stats of its ready pods, see handler.PodStats.
+// A pod contributes from its second scrape on, its first one only sets the baseline.
+// The pods only see the requests holding a token, at most the container concurrency each, so the requests waiting
+// at the gateway are added on top, like Knative adds the activator's concurrency to that of the queue-proxies
+type podScraper struct {
+	client client.Client
+	http   *http.Client
+	port   string
+	mu     sync.Mutex
+	// the last stats of each pod, by target and pod uid
+	last     map[string]map[types.UID]handler.PodStats
+	nScraped int64
+	nFailed  int64
+	// the requests of each target waiting at the gateway, nil until UseGatewayQueue
+	queue decider.GatewayQueue
+}
+
+func newPodScraper(logger logr.Logger, c client.Client, port int, timeout time.Duration) *podScraper {
+	s := &podScraper{
+		client: c,
+		http:   &http.Client{Timeout: timeout},
+		port:   defaultStatsPort,
+		last:   make(map[string]map[types.UID]handler.PodStats),
+	}
+	if port > 0 {
+		s.port = strconv.Itoa(port)
+	}
+	logger.Info("Scraping decider metrics from the pods", "port", s.port, "timeout", timeout)
+	return s
+}
+
+var _ metric.Source = &podScraper{}
+
+func (s *podScraper) Observe(ctx context.Context, key string, now time.Time) (float64, float64, error) {
+	target := &appsv1.Deployment{}
+	if err := s.client.Get(ctx, workload.NamespacedNameFromKey(key), target); err != nil {
+		return 0, 0, fmt.Errorf("failed to get deployment %v: %v", key, err)
+	}
+	pods := corev1.PodList{}
+	if err := s.client.List(ctx, &pods,
+		client.InNamespace(target.Namespace),
+		client.MatchingLabels(target.Spec.Template.Labels),
+	); err != nil {
+		return 0, 0, fmt.Errorf("failed to list pods for key %v: %v", key, err)
+	}
+	var ready []*corev1.Pod
+	for i := range pods.Items {
+		if pod := &pods.Items[i]; backend.IsPodReady(pod) && pod.Status.PodIP != "" {
+			ready = append(ready, pod)
+		}
+	}
+
+	stats := make([]*handler.PodStats, len(ready))
+	errs := make([]error, len(ready))
+	var wg sync.WaitGroup
+	for i, pod := range ready {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = s.scrape(ctx, pod.Status.PodIP)
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.last[key]
+	current := make(map[types.UID]handler.PodStats, len(ready))
+	var concurrency, requestCount float64
+	var firstErr error
+	for i, pod := range ready {
+		if errs[i] != nil {
+			atomic.AddInt64(&s.nFailed, 1)
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		atomic.AddInt64(&s.nScraped, 1)
+		current[pod.UID] = *stats[i]
+		prev, ok := last[pod.UID]
+		if !ok || stats[i].Requests < prev.Requests {
+			// a new pod, or a restarted container whose counters started over
+			continue
+		}
+		if elapsed := float64(stats[i].UnixNano-prev.UnixNano) / 1e9; elapsed > 0 {
+			concurrency += (stats[i].ConcurrencySeconds - prev.ConcurrencySeconds) / elapsed
+		}
+		requestCount += float64(stats[i].Requests - prev.Requests)
+	}
+	// forget the pods that are gone, and keep the baseline of those that failed this time
+	for uid, prev := range last {
+		if _, ok := current[uid]; !ok && podIn(ready, uid) {
+			current[uid] = prev
+		}
+	}
+	s.last[key] = current
+	if len(ready) > 0 && len(ready) == countErrors(errs) {
+		return 0, 0, fmt.Errorf("failed to scrape any of %d pods of %v: %v", len(ready), key, firstErr)
+	}
+	if s.queue != nil {
+		concurrency += float64(s.queue.QueueDepth(key))
+	}
+	return concurrency, requestCount, nil
+}
+
+func (s *podScraper) scrape(ctx context.Context, ip string) (*handler.PodStats, error) {
+	url := "http://" + net.JoinHostPort(ip, s.port) + handler.StatsPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", url, res.Status)
+	}
+	stats := &handler.PodStats{}
+	if err := json.NewDecoder(res.Body).Decode(stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats of %v: %v", url, err)
+	}
+	return stats, nil
+}
+
+func podIn(pods []*corev1.Pod, uid types.UID) bool {
+	for _, pod := range pods {
+		if pod.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func countErrors(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *podScraper) stats() (scraped int64, failed int64) {
+	return atomic.LoadInt64(&s.nScraped), atomic.LoadInt64(&s.nFailed)
+}
+
+func (s *autoscalerImpl) logScrapes(logger logr.Logger) {
+	if s.scraper == nil {
+		return
+	}
+	scraped, failed := s.scraper.stats()
+	logger.Info("Pod metric scrapes", "scraped", scraped, "failed", failed)
+}
@@ -0,0 +1,110 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+)
+
+// ExportState returns the state of the stateful deciders, by key
+func (s *autoscalerImpl) ExportState() (map[string]json.RawMessage, error) {
+	states := make(map[string]json.RawMessage)
+	for key, d := range s.deciders {
+		stateful, ok := d.(decider.StatefulDecider)
+		if !ok {
+			continue
+		}
+		data, err := stateful.ExportState()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export state of %v: %v", key, err)
+		}
+		states[key] = data
+	}
+	return states, nil
+}
+
+// ImportState restores the deciders of known keys, must be called before Run
+func (s *autoscalerImpl) ImportState(states map[string]json.RawMessage) (int, error) {
+	n := 0
+	for key, data := range states {
+		stateful, ok := s.deciders[key].(decider.StatefulDecider)
+		if !ok {
+			continue
+		}
+		if err := stateful.ImportState(data); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// loadState restores the deciders from path, if it exists
+func (s *autoscalerImpl) loadState(logger logr.Logger, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("No decider state to restore", "path", path)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read decider state %v: %v", path, err)
+	}
+	states := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &states); err != nil {
+		return fmt.Errorf("failed to unmarshal decider state %v: %v", path, err)
+	}
+	n, err := s.ImportState(states)
+	if err != nil {
+		return err
+	}
+	logger.Info("Restored decider state", "path", path, "restored", n, "saved", len(states))
+	return nil
+}
+
+// saveState writes the deciders to path, replacing it atomically
+func (s *autoscalerImpl) saveState(path string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	states, err := s.ExportState()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decider state: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write decider state %v: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save decider state %v: %v", path, err)
+	}
+	return nil
+}
+
+// saveStateLoop saves the deciders every stateSaveInterval until ctx is done, Run saves them once more on stop
+func (s *autoscalerImpl) saveStateLoop(ctx context.Context) {
+	s.logger.Info("Saving decider state periodically", "path", s.stateFile, "interval", s.stateSaveInterval)
+	ticker := time.NewTicker(s.stateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.saveState(s.stateFile); err != nil {
+				s.logger.Error(err, "Failed to save decider state")
+			} else {
+				s.logger.V(2).Info("Saved decider state", "path", s.stateFile)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/metric"
+)
+
+// Validate catches settings that would otherwise silently fall back to zero values or misbehave at runtime
+func (cfg *AutoscalerConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	var errs []error
+	if cfg.Knative != nil {
+		if err := cfg.Knative.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("kpa: %v", err))
+		}
+	}
+	if cfg.OneTime != nil {
+		if err := cfg.OneTime.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("oneTime: %v", err))
+		}
+	}
+	if cfg.Knative == nil && cfg.OneTime == nil {
+		errs = append(errs, fmt.Errorf("neither kpa nor oneTime is configured"))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (cfg *KnativeAutoscalerConfig) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(cfg.TickIntervalSeconds > 0, "tickIntervalSeconds must be positive, got %v", cfg.TickIntervalSeconds)
+	check(cfg.StableWindowSeconds > 0, "stableWindowSeconds must be positive, got %v", cfg.StableWindowSeconds)
+	check(cfg.StableWindowSeconds >= float64(cfg.TickIntervalSeconds), "stableWindowSeconds %v is shorter than tickIntervalSeconds %v", cfg.StableWindowSeconds, cfg.TickIntervalSeconds)
+	if err := validatePanicPercentages(cfg.PanicWindowPercentage, cfg.PanicThresholdPercentage); err != nil {
+		check(false, "%v", err)
+	}
+	check(cfg.MaxScaleUpRate > 1, "maxScaleUpRate must be greater than 1, got %v", cfg.MaxScaleUpRate)
+	check(cfg.MaxScaleDownRate > 1, "maxScaleDownRate must be greater than 1, got %v", cfg.MaxScaleDownRate)
+	check(cfg.TargetConcurrency >= 0, "targetConcurrency cannot be negative, got %v", cfg.TargetConcurrency)
+	switch cfg.Metric {
+	case "", decider.MetricConcurrency:
+		check(cfg.TargetRPS == 0 || cfg.uses(decider.Composite, nil), "targetRPS is set but metric is %q", cfg.Metric)
+	case decider.MetricRPS:
+		check(cfg.TargetRPS >= 0, "targetRPS cannot be negative, got %v", cfg.TargetRPS)
+	default:
+		check(false, "unknown metric %q", cfg.Metric)
+	}
+	check(cfg.ScaleDownDelaySeconds >= 0, "scaleDownDelaySeconds cannot be negative, got %v", cfg.ScaleDownDelaySeconds)
+	check(cfg.MinScalers >= 0 && cfg.MaxScalers >= 0, "minScalers and maxScalers cannot be negative")
+	check(cfg.MaxScalers == 0 || cfg.MinScalers <= cfg.MaxScalers, "minScalers %v exceeds maxScalers %v", cfg.MinScalers, cfg.MaxScalers)
+	check(cfg.MinScaleIntervalSeconds >= 0, "minScaleIntervalSeconds cannot be negative, got %v", cfg.MinScaleIntervalSeconds)
+	switch cfg.Scaler {
+	case "", "deployment", "knative-pa":
+		check(cfg.Kd == nil, "kd is set but scaler is %q", cfg.Scaler)
+	case "kd":
+	default:
+		check(false, "unknown scaler %q", cfg.Scaler)
+	}
+	if err := cfg.ControlPlaneDelay.Validate(); err != nil {
+		check(false, "controlPlaneDelay: %v", err)
+	}
+	if cfg.MetricWindow != "" {
+		_, err := metric.NewWindow(cfg.MetricWindow, time.Second, time.Second)
+		check(err == nil, "metricWindow: %v", err)
+	}
+	if err := metric.ValidateSmoothing(cfg.Smoothing, cfg.SmoothingAlpha, cfg.SmoothingBeta); err != nil {
+		check(false, "%v", err)
+	}
+	for _, class := range cfg.ScaleOnClasses {
+		check(class != "", "scaleOnClasses cannot contain an empty class")
+	}
+	switch cfg.ScaleWriteMode {
+	case "", "update":
+	case "apply":
+		check(cfg.Scaler == "" || cfg.Scaler == "deployment", "scaleWriteMode apply only applies to the deployment scaler, got scaler %q", cfg.Scaler)
+	default:
+		check(false, "unknown scaleWriteMode %q", cfg.ScaleWriteMode)
+	}
+	for _, name := range cfg.deciders() {
+		check(decider.IsRegistered(name), "unknown decider %q, registered: %v", name, decider.Registered())
+	}
+	if cfg.uses(decider.CostAware, nil) {
+		check(cfg.CostSlack > 0, "costSlack must be positive for the cost-aware decider, got %v", cfg.CostSlack)
+	} else {
+		check(cfg.CostSlack == 0, "costSlack is set but no target uses the cost-aware decider")
+	}
+	switch cfg.MetricSource {
+	case "", MetricSourceGateway, MetricSourcePods:
+	default:
+		check(false, "unknown metricSource %q, expect %v or %v", cfg.MetricSource, MetricSourceGateway, MetricSourcePods)
+	}
+	check(cfg.StateSaveTicks >= 0, "stateSaveTicks cannot be negative, got %v", cfg.StateSaveTicks)
+	check(cfg.StateSaveTicks == 0 || cfg.StateFile != "", "stateSaveTicks is set but stateFile is not")
+	check(cfg.PodStatsPort >= 0, "podStatsPort cannot be negative, got %v", cfg.PodStatsPort)
+	check(cfg.PodStatsPort == 0 || cfg.MetricSource == MetricSourcePods, "podStatsPort is set but metricSource is not %q", MetricSourcePods)
+	check(cfg.ScaleWritesPerSecond >= 0 && cfg.ScaleWriteBurst >= 0, "scaleWritesPerSecond and scaleWriteBurst cannot be negative")
+	check(cfg.ScaleWriteBurst == 0 || cfg.ScaleWritesPerSecond > 0, "scaleWriteBurst is set but scaleWritesPerSecond is not")
+	check(cfg.BurstEdgePercentage >= 0, "burstEdgePercentage cannot be negative, got %v", cfg.BurstEdgePercentage)
+	check(cfg.KeepAliveSeconds >= 0, "keepAliveSeconds cannot be negative, got %v", cfg.KeepAliveSeconds)
+	check(cfg.ScaleToZeroIdleSeconds >= 0, "scaleToZeroIdleSeconds cannot be negative, got %v", cfg.ScaleToZeroIdleSeconds)
+	check(cfg.MaxQueueDelayMilliSec >= 0, "maxQueueDelayMilliSec cannot be negative, got %v", cfg.MaxQueueDelayMilliSec)
+	check(cfg.StartupGraceSeconds >= 0, "startupGraceSeconds cannot be negative, got %v", cfg.StartupGraceSeconds)
+	check(cfg.HPA == nil || cfg.uses(decider.HPA, nil), "hpa is set but no target uses the hpa decider")
+	if err := cfg.HPA.validate(); err != nil {
+		check(false, "hpa: %v", err)
+	}
+	check(cfg.Predictive == nil || cfg.uses(decider.Predictive, nil), "predictive is set but no target uses the predictive decider")
+	if err := cfg.Predictive.Validate(); err != nil {
+		check(false, "predictive: %v", err)
+	}
+	check(cfg.Composite == nil || cfg.uses(decider.Composite, nil), "composite is set but no target uses the composite decider")
+	if err := cfg.Composite.Validate(); err != nil {
+		check(false, "composite: %v", err)
+	}
+	check(cfg.Metric != decider.MetricRPS || !cfg.uses(decider.Composite, nil), "the composite decider scales on both metrics, unset metric")
+	check(cfg.Composite == nil || !cfg.Composite.Queue || cfg.MaxQueueDelayMilliSec > 0, "composite.queue needs maxQueueDelayMilliSec to read the gateway queue")
+	if err := cfg.AdaptivePanic.validate(); err != nil {
+		check(false, "adaptivePanic: %v", err)
+	}
+	check(cfg.ReplicaCost >= 0, "replicaCost cannot be negative, got %v", cfg.ReplicaCost)
+	for key, target := range cfg.Targets {
+		if parts := strings.Split(key, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			check(false, "target %q is not a namespace/name key", key)
+		}
+		if target == nil {
+			continue
+		}
+		if target.MinScaleIntervalSeconds != nil {
+			check(*target.MinScaleIntervalSeconds >= 0, "targets[%v].minScaleIntervalSeconds cannot be negative", key)
+		}
+		if target.ReplicaCost != nil {
+			check(*target.ReplicaCost >= 0, "targets[%v].replicaCost cannot be negative", key)
+		}
+		if target.KeepAliveSeconds != nil {
+			check(*target.KeepAliveSeconds >= 0, "targets[%v].keepAliveSeconds cannot be negative", key)
+		}
+		if target.PanicWindowPercentage != nil || target.PanicThresholdPercentage != nil {
+			// the same check as the globals, on the percentages in effect for the target
+			if err := validatePanicPercentages(cfg.panicPercentages(key)); err != nil {
+				check(false, "targets[%v]: %v", key, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// the panic window is a percentage of the stable window
+func validatePanicPercentages(window, threshold float64) error {
+	var errs []error
+	if window <= 0 || window > 100 {
+		errs = append(errs, fmt.Errorf("panicWindowPercentage must be in (0, 100], got %v, i.e., the panic window cannot exceed the stable window", window))
+	}
+	if threshold <= 0 {
+		errs = append(errs, fmt.Errorf("panicThresholdPercentage must be positive, got %v", threshold))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (cfg *OneTimeAutoscalerConfig) Validate() error {
+	if cfg.InitialScale < 0 {
+		return fmt.Errorf("initialScale cannot be negative, got %v", cfg.InitialScale)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package autoscaler
+
+import (
+	"github.com/go-logr/logr"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler/decider"
+)
+
+func (s *autoscalerImpl) ScalesToZero() bool {
+	return s.scaleToZeroIdle > 0
+}
+
+// logScaleToZero reports how often targets went to zero and came back, i.e., the cold starts under the trace
+func (s *autoscalerImpl) logScaleToZero(logger logr.Logger) {
+	if s.scaleToZeroIdle <= 0 {
+		return
+	}
+	var zeroed, coldStarts int64
+	for _, d := range s.deciders {
+		if reporter, ok := d.(decider.ScaleToZeroReporter); ok {
+			z, c := reporter.ScaleToZeroStats()
+			zeroed += z
+			coldStarts += c
+		}
+	}
+	logger.Info("Scale to zero", "idleWindow", s.scaleToZeroIdle, "zeroed", zeroed, "coldStarts", coldStarts)
+}
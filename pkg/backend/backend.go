@@ -8,6 +8,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/topology"
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 	kdutil "k8s.io/kubedirect/pkg/util"
 )
@@ -20,6 +21,7 @@ type Executor interface {
 var framework string
 var baseTimeout = 15 * time.Second
 var timeoutFactor = 5.0
+var networkTopology *topology.Topology
 
 func Use(f string) {
 	framework = f
@@ -29,6 +31,18 @@ func WithSLO(factor float64) {
 	timeoutFactor = factor
 }
 
+// WithExecTimeout sets the minimum execution timeout, requests longer than base/factor get factor × their duration;
+// the execution timeout starts once the gateway acquired an endpoint and is independent of the dispatch timeout
+func WithExecTimeout(base time.Duration, factor float64) {
+	baseTimeout = base
+	timeoutFactor = factor
+}
+
+// only the fake backend simulates the network delays
+func WithTopology(t *topology.Topology) {
+	networkTopology = t
+}
+
 func Timeout(req *workload.Request) time.Duration {
 	if slo := time.Duration(float64(req.DurationMilliSec)*timeoutFactor) * time.Millisecond; slo > baseTimeout {
 		return slo
@@ -36,16 +50,28 @@ func Timeout(req *workload.Request) time.Duration {
 	return baseTimeout
 }
 
-func NewBackend(endpoint string) (Executor, error) {
+// node is where the endpoint runs, used to look up the simulated network delay
+func NewBackend(endpoint string, node string) (Executor, error) {
+	return NewScaledBackend(endpoint, node, 1)
+}
+
+// speedUp divides the simulated runtime of the fake backend, real backends run at the speed of their pods
+func NewScaledBackend(endpoint string, node string, speedUp float64) (Executor, error) {
 	switch framework {
 	case "fake":
-		return newFakeBackend(), nil
+		return newFakeBackend(networkTopology.GatewayRTT(node), speedUp), nil
 	case "grpc":
 		return newGrpcBackend(endpoint)
 	}
 	panic(fmt.Sprintf("invalid framework: %s", framework))
 }
 
+// NewRoutedBackend always uses grpc, sending requests to a proxy that routes them by authority,
+// e.g., the Dirigent data plane routes by function name
+func NewRoutedBackend(proxy string, authority string) (Executor, error) {
+	return newGrpcBackendWithAuthority(proxy, authority)
+}
+
 func IsPodReady(pod *corev1.Pod) bool {
 	return kdutil.IsPodReady(pod)
 }
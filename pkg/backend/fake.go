@@ -7,26 +7,62 @@ import (
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
-type fakeBackend struct{}
+type fakeBackend struct {
+	// simulated round trip time between the gateway and the endpoint
+	rtt time.Duration
+	// runtime of a request is divided by the speed-up
+	speedUp float64
+}
 
 var _ Executor = &fakeBackend{}
 
-func newFakeBackend() *fakeBackend {
-	return &fakeBackend{}
+func newFakeBackend(rtt time.Duration, speedUp float64) *fakeBackend {
+	if speedUp <= 0 {
+		speedUp = 1
+	}
+	return &fakeBackend{rtt: rtt, speedUp: speedUp}
 }
 
 func (f *fakeBackend) Start() error { return nil }
 
 func (f *fakeBackend) Close() {}
 
-func (f *fakeBackend) Execute(_ context.Context, req *workload.Request) *workload.Response {
+// Execute fails with FAIL_TIMEOUT if ctx expires before the simulated response arrives, like the grpc backend
+func (f *fakeBackend) Execute(ctx context.Context, req *workload.Request) *workload.Response {
+	req.Hops.Connected(false)
+	req.GatewaySendTS = time.Now()
+	res := &workload.Response{Source: req}
+	if !sleep(ctx, f.rtt/2) {
+		res.Status = workload.FAIL_TIMEOUT
+		return res
+	}
 	start := time.Now()
-	req.GatewaySendTS = start
-	<-time.After(time.Duration(req.DurationMilliSec) * time.Millisecond)
-	return &workload.Response{
-		Source:          req,
-		Status:          workload.SUCCESS,
-		GatewayRecvTS:   time.Now(),
-		RuntimeMicroSec: int(time.Since(start).Microseconds()),
+	if !sleep(ctx, time.Duration(float64(req.DurationMilliSec)/f.speedUp)*time.Millisecond) {
+		res.Status = workload.FAIL_TIMEOUT
+		return res
+	}
+	runtime := time.Since(start)
+	if !sleep(ctx, f.rtt/2) {
+		res.Status = workload.FAIL_TIMEOUT
+		return res
+	}
+	res.Status = workload.SUCCESS
+	res.GatewayRecvTS = time.Now()
+	res.RuntimeMicroSec = int(runtime.Microseconds())
+	return res
+}
+
+// sleep returns false if ctx expires first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
@@ -21,15 +21,22 @@ const (
 )
 
 type grpcBackend struct {
-	endpoint       string
+	endpoint string
+	// if set, overrides the :authority of the requests, used by proxies routing on it
+	authority      string
 	connectionPool *chann.Chann[*grpc.ClientConn]
 }
 
 var _ Executor = &grpcBackend{}
 
 func newGrpcBackend(endpoint string) (*grpcBackend, error) {
+	return newGrpcBackendWithAuthority(endpoint, "")
+}
+
+func newGrpcBackendWithAuthority(endpoint string, authority string) (*grpcBackend, error) {
 	g := &grpcBackend{
 		endpoint:       endpoint,
+		authority:      authority,
 		connectionPool: chann.New[*grpc.ClientConn](),
 	}
 	if err := g.newClient(); err != nil {
@@ -49,12 +56,13 @@ func (g *grpcBackend) Execute(ctx context.Context, req *workload.Request) *workl
 	logger := klog.FromContext(ctx).WithValues("backend", "grpc", "endpoint", g.endpoint, "req", req.ID)
 	res := &workload.Response{Source: req}
 
-	conn, err := g.getOrCreateClient()
+	conn, newConn, err := g.getOrCreateClient()
 	if err != nil {
 		logger.Error(err, "Error creating gRPC connection")
 		res.Status = workload.FAIL_CONNECT
 		return res
 	}
+	req.Hops.Connected(newConn)
 	defer func() { g.connectionPool.In() <- conn }()
 	grpcExecutor := proto.NewExecutorClient(conn)
 
@@ -81,6 +89,9 @@ func (g *grpcBackend) Execute(ctx context.Context, req *workload.Request) *workl
 
 func (g *grpcBackend) newClient(opts ...grpc.DialOption) error {
 	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if g.authority != "" {
+		opts = append(opts, grpc.WithAuthority(g.authority))
+	}
 	conn, err := grpc.NewClient(g.endpoint, opts...)
 	if err != nil {
 		return err
@@ -91,15 +102,16 @@ func (g *grpcBackend) newClient(opts ...grpc.DialOption) error {
 	return nil
 }
 
-func (g *grpcBackend) getOrCreateClient() (*grpc.ClientConn, error) {
+// newConn is true if the pool was exhausted and a new connection was created
+func (g *grpcBackend) getOrCreateClient() (conn *grpc.ClientConn, newConn bool, err error) {
 	select {
 	case conn := <-g.connectionPool.Out():
-		return conn, nil
+		return conn, false, nil
 	default:
 		if err := g.newClient(); err != nil {
-			return nil, err
+			return nil, true, err
 		}
 		conn := <-g.connectionPool.Out()
-		return conn, nil
+		return conn, true, nil
 	}
 }
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// The gateway buffers are unbounded, which hides overload as ever-growing latency.
+// With admission control, the relay sheds requests with FAIL_OVERFLOW instead, so that goodput under saturation can be measured.
+type AdmissionConfig struct {
+	// if positive, shed while this many requests of the target are in flight at the gateway, queued or executing
+	MaxQueueDepth int `yaml:"maxQueueDepth"`
+	// if positive, shed while the queueing delay of the target exceeds this, i.e., from the gateway receiving
+	// the latest completed request to sending it to an endpoint
+	MaxQueueDelayMilliSec int `yaml:"maxQueueDelayMilliSec"`
+	// per-target overrides, indexed by workload key (namespace/name)
+	Targets map[string]*AdmissionTargetConfig `yaml:"targets"`
+}
+
+// nil fields inherit the gateway-wide value
+type AdmissionTargetConfig struct {
+	MaxQueueDepth         *int `yaml:"maxQueueDepth"`
+	MaxQueueDelayMilliSec *int `yaml:"maxQueueDelayMilliSec"`
+}
+
+// For returns the config of the given target with its overrides applied
+func (cfg *AdmissionConfig) For(key string) *AdmissionConfig {
+	if cfg == nil {
+		return nil
+	}
+	target := cfg.Targets[key]
+	if target == nil {
+		return cfg
+	}
+	merged := *cfg
+	if target.MaxQueueDepth != nil {
+		merged.MaxQueueDepth = *target.MaxQueueDepth
+	}
+	if target.MaxQueueDelayMilliSec != nil {
+		merged.MaxQueueDelayMilliSec = *target.MaxQueueDelayMilliSec
+	}
+	return &merged
+}
+
+func (cfg *AdmissionConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxQueueDepth < 0 || cfg.MaxQueueDelayMilliSec < 0 {
+		return fmt.Errorf("maxQueueDepth and maxQueueDelayMilliSec cannot be negative")
+	}
+	for key, target := range cfg.Targets {
+		if target == nil {
+			continue
+		}
+		if (target.MaxQueueDepth != nil && *target.MaxQueueDepth < 0) || (target.MaxQueueDelayMilliSec != nil && *target.MaxQueueDelayMilliSec < 0) {
+			return fmt.Errorf("targets[%v]: maxQueueDepth and maxQueueDelayMilliSec cannot be negative", key)
+		}
+	}
+	return nil
+}
+
+// admission is only accessed by the relay of its key, except for the counter
+type admission struct {
+	maxDepth int64
+	maxDelay time.Duration
+	// queueing delay of the latest completed request, reset when the target is idle
+	delay time.Duration
+	nShed int64
+}
+
+// nil if admission control is disabled for the target
+func newAdmission(cfg *AdmissionConfig) *admission {
+	if cfg == nil || (cfg.MaxQueueDepth <= 0 && cfg.MaxQueueDelayMilliSec <= 0) {
+		return nil
+	}
+	return &admission{
+		maxDepth: int64(cfg.MaxQueueDepth),
+		maxDelay: time.Duration(cfg.MaxQueueDelayMilliSec) * time.Millisecond,
+	}
+}
+
+func (a *admission) admit(inFlight int64) bool {
+	if a == nil {
+		return true
+	}
+	if (a.maxDepth > 0 && inFlight >= a.maxDepth) || (a.maxDelay > 0 && inFlight > 0 && a.delay > a.maxDelay) {
+		atomic.AddInt64(&a.nShed, 1)
+		return false
+	}
+	return true
+}
+
+// observe tracks the queueing delay of a completed request, given the in-flight requests left
+func (a *admission) observe(res *workload.Response, inFlight int64) {
+	if a == nil {
+		return
+	}
+	if inFlight == 0 {
+		a.delay = 0
+		return
+	}
+	req := res.Source
+	if !req.GatewaySendTS.IsZero() {
+		a.delay = req.GatewaySendTS.Sub(req.GatewayRecvTS)
+	}
+}
+
+func (a *admission) shed() int64 {
+	if a == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&a.nShed)
+}
+
+// UseAdmission enables admission control, must be called before the targets are registered
+func (g *gatewayImpl) UseAdmission(cfg *AdmissionConfig) {
+	g.admissionConfig = cfg
+}
+
+// number of requests shed by admission control
+func (g *gatewayImpl) Shed() int64 {
+	var n int64
+	for _, a := range g.admissions {
+		n += a.shed()
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.design/x/chann"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// newRelayBuffer is unbounded unless size is positive, in which case a full buffer blocks its writer.
+// A request buffer only fills if its dispatcher bounds the requests it takes, see dispatcher maxDispatching,
+// otherwise the dispatcher drains it into goroutines or its worker queue.
+// Only the request buffers are bounded: the relay does not read responses while blocked on a full request buffer,
+// and a dispatcher frees its slots only once it has written the response back, so a bounded response buffer
+// could deadlock the two. The responses pending then are bounded by the requests taken in anyway
+func newRelayBuffer[T any](size int) *chann.Chann[T] {
+	if size > 0 {
+		return chann.New[T](chann.Cap(size))
+	}
+	return chann.New[T]()
+}
+
+// UseRelayBuffers bounds the request buffers between the relays and the dispatchers, 0 keeps them unbounded;
+// must be called before the targets are registered
+func (g *gatewayImpl) UseRelayBuffers(size int) {
+	g.relayBufferSize = size
+}
+
+// relayPressure records how long the relay of a key was blocked by a full dispatcher buffer,
+// and how deep its buffers grew, bounded or not
+type relayPressure struct {
+	nBlocked     int64
+	blockedNanos int64
+	maxReqDepth  int64
+	maxResDepth  int64
+}
+
+func storeMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
+
+// send hands req to the dispatcher, timing the wait if the buffer is full
+func (p *relayPressure) send(ch chan<- *Request, req *Request) {
+	select {
+	case ch <- req:
+		return
+	default:
+	}
+	start := time.Now()
+	ch <- req
+	atomic.AddInt64(&p.nBlocked, 1)
+	atomic.AddInt64(&p.blockedNanos, int64(time.Since(start)))
+}
+
+func (p *relayPressure) observe(reqDepth, resDepth int) {
+	storeMax(&p.maxReqDepth, int64(reqDepth))
+	storeMax(&p.maxResDepth, int64(resDepth))
+}
+
+type BackpressureStats struct {
+	// requests whose hand-off to the dispatcher blocked, and the total time blocked
+	Blocked     int64
+	BlockedTime time.Duration
+	// max depth of the request and response buffers of any key
+	MaxReqDepth int64
+	MaxResDepth int64
+	// the key blocked the longest, empty if none blocked
+	Worst string
+}
+
+func (g *gatewayImpl) BackpressureStats() BackpressureStats {
+	var stats BackpressureStats
+	var worst int64
+	for key, p := range g.pressure {
+		blocked := atomic.LoadInt64(&p.blockedNanos)
+		stats.Blocked += atomic.LoadInt64(&p.nBlocked)
+		stats.BlockedTime += time.Duration(blocked)
+		stats.MaxReqDepth = max(stats.MaxReqDepth, atomic.LoadInt64(&p.maxReqDepth))
+		stats.MaxResDepth = max(stats.MaxResDepth, atomic.LoadInt64(&p.maxResDepth))
+		if blocked > worst {
+			stats.Worst, worst = key, blocked
+		}
+	}
+	return stats
+}
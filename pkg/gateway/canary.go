@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+
+	"golang.design/x/chann"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway/dispatcher"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// CanaryConfig splits the requests of a target between its deployment and its canary,
+// i.e., a deployment labeled kubedirect/canary-of=<target name> in the same namespace, see k8s.deployment.canary.template.yaml.
+// The canary has a dispatcher of its own, its responses are merged into those of the target,
+// and it is not autoscaled.
+type CanaryConfig struct {
+	// fraction of the requests sent to the canary
+	Weight float64 `yaml:"weight"`
+	// per-target overrides, indexed by workload key (namespace/name) of the target
+	Targets map[string]*CanaryTargetConfig `yaml:"targets"`
+}
+
+// nil fields inherit the gateway-wide value
+type CanaryTargetConfig struct {
+	Weight *float64 `yaml:"weight"`
+}
+
+// For returns the config of the given target with its overrides applied
+func (cfg *CanaryConfig) For(key string) *CanaryConfig {
+	if cfg == nil {
+		return nil
+	}
+	target := cfg.Targets[key]
+	if target == nil {
+		return cfg
+	}
+	merged := *cfg
+	if target.Weight != nil {
+		merged.Weight = *target.Weight
+	}
+	return &merged
+}
+
+func (cfg *CanaryConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Weight < 0 || cfg.Weight > 1 {
+		return fmt.Errorf("weight must be in [0, 1], got %v", cfg.Weight)
+	}
+	for key, target := range cfg.Targets {
+		if target != nil && target.Weight != nil && (*target.Weight < 0 || *target.Weight > 1) {
+			return fmt.Errorf("targets[%v]: weight must be in [0, 1], got %v", key, *target.Weight)
+		}
+	}
+	return nil
+}
+
+// canarySplit sits between the relay of a target and the dispatchers of its deployment and canary
+type canarySplit struct {
+	key       string
+	canaryKey string
+	weight    float64
+	canary    *dispatcher.PodDispatcher
+	// inputs and outputs of the two dispatchers
+	stableReqs *chann.Chann[*workload.Request]
+	canaryReqs *chann.Chann[*workload.Request]
+	stableRes  *chann.Chann[*workload.Response]
+	canaryRes  *chann.Chann[*workload.Response]
+	// served and failed requests of each side
+	nStable     int64
+	nCanary     int64
+	nStableFail int64
+	nCanaryFail int64
+}
+
+func newCanarySplit(key, canaryKey string, weight float64) *canarySplit {
+	return &canarySplit{
+		key:        key,
+		canaryKey:  canaryKey,
+		weight:     weight,
+		stableReqs: chann.New[*workload.Request](),
+		canaryReqs: chann.New[*workload.Request](),
+		stableRes:  chann.New[*workload.Response](),
+		canaryRes:  chann.New[*workload.Response](),
+	}
+}
+
+// toCanary deterministically picks the requests of the canary by hashing their IDs,
+// salted with the key so the split is independent of the class sampling
+func (s *canarySplit) toCanary(req *workload.Request) bool {
+	if s.weight <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s.key + "#" + req.ID))
+	return float64(h.Sum32())/float64(^uint32(0)) < s.weight
+}
+
+// run splits the requests of the relay and merges the responses back
+func (s *canarySplit) run(ctx context.Context, reqChan <-chan *workload.Request, resChan chan<- *workload.Response) {
+	merge := func(res <-chan *workload.Response, served, failed *int64) {
+		for {
+			select {
+			case r := <-res:
+				atomic.AddInt64(served, 1)
+				if r.Status != workload.SUCCESS {
+					atomic.AddInt64(failed, 1)
+				}
+				resChan <- r
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	go merge(s.stableRes.Out(), &s.nStable, &s.nStableFail)
+	go merge(s.canaryRes.Out(), &s.nCanary, &s.nCanaryFail)
+	for {
+		select {
+		case req := <-reqChan:
+			if s.toCanary(req) {
+				s.canaryReqs.In() <- req
+			} else {
+				s.stableReqs.In() <- req
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type CanaryStats struct {
+	Stable, StableFail int64
+	Canary, CanaryFail int64
+}
+
+func (s *canarySplit) stats() CanaryStats {
+	return CanaryStats{
+		Stable:     atomic.LoadInt64(&s.nStable),
+		StableFail: atomic.LoadInt64(&s.nStableFail),
+		Canary:     atomic.LoadInt64(&s.nCanary),
+		CanaryFail: atomic.LoadInt64(&s.nCanaryFail),
+	}
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"golang.design/x/chann"
+)
+
+// Completion signals that a finished target is drained: every request relayed for it has been answered
+type Completion struct {
+	Target string
+	// responses of the target delivered on Responses, so that a reader of the fan-in
+	// can tell when it has seen them all, the completion may overtake the last of them
+	Responses int64
+}
+
+// onceBuffer is closed by whichever comes first of FinishTarget, the drain of the target and Close;
+// an unbounded chann must not be closed twice, nor sent to once closed
+type onceBuffer[T any] struct {
+	*chann.Chann[T]
+	// guards closed, so that send never races Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newOnceBuffer[T any](buf *chann.Chann[T]) *onceBuffer[T] {
+	return &onceBuffer[T]{Chann: buf}
+}
+
+func (b *onceBuffer[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.Chann.Close()
+	}
+}
+
+// send puts v into the buffer, returns false if the buffer is already closed
+func (b *onceBuffer[T]) send(v T) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false
+	}
+	b.In() <- v
+	return true
+}
+
+// targetDrain follows a key from FinishTarget until its last response is delivered
+type targetDrain struct {
+	// set once the relay has seen the end of the requests
+	finished  bool
+	delivered int64
+}
+
+// FinishTarget closes the requests of target, which must not be sent to any more;
+// once the requests in flight are answered, the per-target responses are closed and the completion is sent
+func (g *gatewayImpl) FinishTarget(target string) {
+	if input, ok := g.externalInputs[target]; ok {
+		input.Close()
+	}
+}
+
+func (g *gatewayImpl) Completions() <-chan *Completion {
+	return g.completions.Out()
+}
+
+// complete closes the per-target responses and sends the completion once the finished key is drained
+func (g *gatewayImpl) complete(key string, drain *targetDrain, inFlight *int64) bool {
+	if !drain.finished || atomic.LoadInt64(inFlight) > 0 {
+		return false
+	}
+	if output, ok := g.externalOutputs[key]; ok {
+		output.Close()
+	}
+	g.completions.In() <- &Completion{Target: key, Responses: drain.delivered}
+	return true
+}
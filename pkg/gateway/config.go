@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway/dispatcher"
+)
+
+type GatewayConfig struct {
+	// only applicable to k8s gateway
+	Dispatcher *dispatcher.PodDispatcherConfig `yaml:"dispatcher"`
+	// only applicable to knative gateway, the autoscaling annotations of the knative services, see KnativeConfig
+	Knative *KnativeConfig `yaml:"knative"`
+	// if set, the relay sheds requests under overload, see AdmissionConfig
+	Admission *AdmissionConfig `yaml:"admission"`
+	// if set, targets with a canary deployment split their requests with it, see CanaryConfig
+	Canary *CanaryConfig `yaml:"canary"`
+	// if positive, bound the request buffers between the relays and the dispatchers to this many items,
+	// so that overload shows up as relay backpressure instead of unbounded memory growth; needs dispatcher.maxDispatching
+	RelayBufferSize int `yaml:"relayBufferSize"`
+	// how the k8s gateway discovers endpoints, DiscoveryPods (default), DiscoveryEndpointSlices or DiscoveryDNS
+	Discovery string `yaml:"discovery"`
+	// the cluster domain and the polling interval of DiscoveryDNS, default to cluster.local and 1000
+	DNSDomain           string `yaml:"dnsDomain"`
+	DNSIntervalMilliSec int    `yaml:"dnsIntervalMilliSec"`
+	// if set, the autoscaler reconciles a target as soon as its ready endpoints change instead of on its next tick
+	PokeOnEndpointChange bool `yaml:"pokeOnEndpointChange"`
+}
+
+// an empty path gives the default config
+func NewGatewayConfigFrom(configPath string) (*GatewayConfig, error) {
+	config := &GatewayConfig{}
+	if configPath != "" {
+		configYaml, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gateway YAML config: %v", err)
+		}
+		if err := yaml.Unmarshal(configYaml, config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal YAML config: %v", err)
+		}
+	}
+	if config.Dispatcher == nil {
+		config.Dispatcher = &dispatcher.PodDispatcherConfig{}
+	}
+	return config, nil
+}
+
+func (cfg *GatewayConfig) Validate() error {
+	if err := cfg.Dispatcher.Validate(); err != nil {
+		return fmt.Errorf("dispatcher: %v", err)
+	}
+	if err := cfg.Admission.Validate(); err != nil {
+		return fmt.Errorf("admission: %v", err)
+	}
+	if err := cfg.Canary.Validate(); err != nil {
+		return fmt.Errorf("canary: %v", err)
+	}
+	if err := cfg.Knative.Validate(); err != nil {
+		return fmt.Errorf("knative: %v", err)
+	}
+	if cfg.RelayBufferSize < 0 {
+		return fmt.Errorf("relayBufferSize cannot be negative, got %v", cfg.RelayBufferSize)
+	}
+	if cfg.RelayBufferSize > 0 && cfg.Dispatcher.MaxDispatching <= 0 {
+		return fmt.Errorf("relayBufferSize needs dispatcher.maxDispatching, the dispatchers drain the buffers otherwise")
+	}
+	if err := validDiscovery(cfg.Discovery); err != nil {
+		return err
+	}
+	if cfg.DNSIntervalMilliSec < 0 {
+		return fmt.Errorf("dnsIntervalMilliSec cannot be negative, got %v", cfg.DNSIntervalMilliSec)
+	}
+	if cfg.Discovery == DiscoveryDNS && !cfg.Dispatcher.NumericPorts() {
+		return fmt.Errorf("discovery %q cannot resolve port names, configure a port number", DiscoveryDNS)
+	}
+	return nil
+}
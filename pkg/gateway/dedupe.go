@@ -0,0 +1,39 @@
+package gateway
+
+import "time"
+
+// a resent request is only caught within this long of the first send
+const dedupeWindow = 5 * time.Minute
+
+// seenRequests remembers the request IDs of a key in two generations, rotated every dedupeWindow,
+// so that an ID is remembered for one to two windows and memory is bounded by the request rate
+// instead of growing with every request ever relayed; only accessed by the relay of the key
+type seenRequests struct {
+	current  map[string]struct{}
+	previous map[string]struct{}
+	rotated  time.Time
+}
+
+func newSeenRequests() *seenRequests {
+	return &seenRequests{
+		current:  make(map[string]struct{}),
+		previous: make(map[string]struct{}),
+		rotated:  time.Now(),
+	}
+}
+
+// see records id, returns true if it was already seen within the window
+func (s *seenRequests) see(id string, now time.Time) bool {
+	if now.Sub(s.rotated) >= dedupeWindow {
+		s.previous, s.current = s.current, make(map[string]struct{})
+		s.rotated = now
+	}
+	if _, ok := s.current[id]; ok {
+		return true
+	}
+	if _, ok := s.previous[id]; ok {
+		return true
+	}
+	s.current[id] = struct{}{}
+	return false
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway/dispatcher"
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// dirigentGateway replays the trace against a running Dirigent cluster, as an end-to-end baseline.
+// The trace deployments only name the targets, as for the other gateways, and may stay at zero replicas;
+// each must be registered in Dirigent as a function of the same name beforehand.
+type dirigentGateway struct {
+	*gatewayImpl
+	dispatchTimeout time.Duration
+	dataPlane       string
+	dispatchers     map[string]dispatcher.Dispatcher
+}
+
+func NewDirigentGateway(dispatchTimeout time.Duration, dataPlane string) (*dirigentGateway, error) {
+	if dataPlane == "" {
+		return nil, fmt.Errorf("dirigent gateway requires the data plane address")
+	}
+	g := &dirigentGateway{
+		dispatchTimeout: dispatchTimeout,
+		dataPlane:       dataPlane,
+		dispatchers:     make(map[string]dispatcher.Dispatcher),
+	}
+	g.gatewayImpl = newGatewayImpl(g.onReqIn, g.onReqOut)
+	return g, nil
+}
+
+var _ Gateway = &dirigentGateway{}
+
+func (g *dirigentGateway) onReqIn(req *workload.Request) {}
+
+func (g *dirigentGateway) onReqOut(req *workload.Response) {}
+
+func (g *dirigentGateway) Start(ctx context.Context) error {
+	for key, dispatcher := range g.dispatchers {
+		go g.relay(ctx, key)
+		go dispatcher.Run(ctx)
+	}
+	return nil
+}
+
+// Dirigent autoscales on its own
+func (g *dirigentGateway) Autoscaler() autoscaler.Autoscaler {
+	return nil
+}
+
+func (g *dirigentGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager) error {
+	logger := klog.FromContext(ctx).WithValues("gateway", "dirigent")
+
+	// setup a temporary client to list deployments because manager hasn't started yet
+	uncachedClient := benchutil.NewUncachedClientOrDie(mgr)
+
+	targets := &appsv1.DeploymentList{}
+	if err := uncachedClient.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
+		return fmt.Errorf("error listing deployments in dirigent gateway: %v", err)
+	}
+	for i := range targets.Items {
+		target := &targets.Items[i]
+		key := workload.KeyFromObject(target)
+		if !workload.OwnsKey(key) {
+			continue
+		}
+		logger.V(1).Info(fmt.Sprintf("Registering function %v", target.Name), "key", key)
+		// register channel
+		g.register(key)
+		reqBuffer, resBuffer := g.internalBuffers(key)
+		dd, err := dispatcher.New(ctx, dispatcher.Dirigent, &dispatcher.Spec{
+			Target:   key,
+			Timeout:  g.dispatchTimeout,
+			ReqChan:  reqBuffer,
+			ResChan:  resBuffer,
+			Address:  g.dataPlane,
+			Function: target.Name,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create dirigent dispatcher for %v: %v", key, err)
+		}
+		g.dispatchers[key] = dd
+	}
+	logger.Info("All dirigent functions registered", "total", len(g.dispatchers), "dataPlane", g.dataPlane)
+	return nil
+}
@@ -0,0 +1,131 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// activator parks the requests of a target without endpoints until the first one is ready, like Knative's activator:
+// the autoscaler is poked on the first parked request, and all parked requests are released at once
+// with a fresh dispatch timeout
+type activator struct {
+	hold time.Duration
+	poke func()
+	mu   sync.Mutex
+	// closed while the target has endpoints
+	ready chan struct{}
+	poked bool
+	// parked requests, those released by an endpoint, and their hold time
+	nParked   int64
+	nReleased int64
+	holdNanos int64
+	maxHold   int64
+}
+
+func newActivator(hold time.Duration) *activator {
+	if hold <= 0 {
+		return nil
+	}
+	return &activator{hold: hold, ready: make(chan struct{})}
+}
+
+// WithActivatorPoke sets how the activator asks for a first endpoint, or more with a target-burst-capacity,
+// e.g., by poking the autoscaler
+func (pd *PodDispatcher) WithActivatorPoke(poke func()) *PodDispatcher {
+	if pd.activator != nil {
+		pd.activator.poke = poke
+	}
+	if pd.burst != nil {
+		pd.burst.poke = poke
+	}
+	return pd
+}
+
+// activate returns false if the request was parked but no endpoint became ready within the hold time
+func (pd *PodDispatcher) activate(ctx context.Context) bool {
+	a := pd.activator
+	if a == nil {
+		return true
+	}
+	a.mu.Lock()
+	ready := a.ready
+	select {
+	case <-ready:
+		a.mu.Unlock()
+		return true
+	default:
+	}
+	poke := !a.poked && a.poke != nil
+	a.poked = true
+	a.mu.Unlock()
+
+	atomic.AddInt64(&a.nParked, 1)
+	if poke {
+		go a.poke()
+	}
+	start := time.Now()
+	timer := time.NewTimer(a.hold)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		held := int64(time.Since(start))
+		atomic.AddInt64(&a.nReleased, 1)
+		atomic.AddInt64(&a.holdNanos, held)
+		for {
+			old := atomic.LoadInt64(&a.maxHold)
+			if held <= old || atomic.CompareAndSwapInt64(&a.maxHold, old, held) {
+				break
+			}
+		}
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// update releases the parked requests once the target has endpoints, and parks again when it has none
+func (a *activator) update(endpoints int) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.ready:
+		if endpoints == 0 {
+			a.ready = make(chan struct{})
+			a.poked = false
+		}
+	default:
+		if endpoints > 0 {
+			close(a.ready)
+		}
+	}
+}
+
+type ActivatorStats struct {
+	Parked   int64
+	Released int64
+	MeanHold time.Duration
+	MaxHold  time.Duration
+}
+
+func (pd *PodDispatcher) ActivatorStats() ActivatorStats {
+	a := pd.activator
+	if a == nil {
+		return ActivatorStats{}
+	}
+	stats := ActivatorStats{
+		Parked:   atomic.LoadInt64(&a.nParked),
+		Released: atomic.LoadInt64(&a.nReleased),
+		MaxHold:  time.Duration(atomic.LoadInt64(&a.maxHold)),
+	}
+	if stats.Released > 0 {
+		stats.MeanHold = time.Duration(atomic.LoadInt64(&a.holdNanos) / stats.Released)
+	}
+	return stats
+}
@@ -0,0 +1,66 @@
+package dispatcher
+
+import (
+	"sync"
+	"sync/atomic"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// affinityTable binds affinity keys to the endpoint that served their first request
+type affinityTable struct {
+	mu    sync.Mutex
+	bound map[string]string
+}
+
+func newAffinityTable(enabled bool) *affinityTable {
+	if !enabled {
+		return nil
+	}
+	return &affinityTable{bound: make(map[string]string)}
+}
+
+// preferred returns the endpoint bound to the affinity key of req, empty if none or removed
+func (pd *PodDispatcher) preferred(req *workload.Request) string {
+	if pd.affinity == nil || req.AffinityKey == "" {
+		return ""
+	}
+	pd.affinity.mu.Lock()
+	defer pd.affinity.mu.Unlock()
+	key, ok := pd.affinity.bound[req.AffinityKey]
+	if !ok {
+		return ""
+	}
+	if _, ok := pd.endpoints.Get(key); !ok {
+		// rebind on the next dispatch
+		delete(pd.affinity.bound, req.AffinityKey)
+		return ""
+	}
+	return key
+}
+
+// bind records the endpoint of req if its affinity key is unbound, and counts whether the binding was honored
+func (pd *PodDispatcher) bind(req *workload.Request, preferred, key string) {
+	if pd.affinity == nil || req.AffinityKey == "" {
+		return
+	}
+	if preferred == "" {
+		pd.affinity.mu.Lock()
+		if _, ok := pd.affinity.bound[req.AffinityKey]; !ok {
+			pd.affinity.bound[req.AffinityKey] = key
+		}
+		pd.affinity.mu.Unlock()
+		return
+	}
+	if key == preferred {
+		atomic.AddInt64(&pd.nAffinityHit, 1)
+	} else {
+		atomic.AddInt64(&pd.nAffinityMiss, 1)
+	}
+}
+
+// returns the number of requests served by their bound endpoint, and those sent elsewhere because it was busy
+func (pd *PodDispatcher) AffinityStats() (hit int64, miss int64) {
+	return atomic.LoadInt64(&pd.nAffinityHit), atomic.LoadInt64(&pd.nAffinityMiss)
+}
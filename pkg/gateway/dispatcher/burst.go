@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// burstCapacity switches a target between Knative's serve and proxy modes by its target-burst-capacity:
+// while the spare capacity of its ready endpoints is below the TBC, requests go through the activator, i.e.,
+// they are parked until an endpoint has a free token, and switching to proxy mode pokes the autoscaler
+// so it scales right away instead of on its next tick. The deciders see the excess burst capacity,
+// see ExcessBurstCapacity
+type burstCapacity struct {
+	tbc float64
+	// tokens per endpoint, the container concurrency if set
+	perEndpoint int
+	endpoints   func() int
+	poke        func()
+	// parked requests are released within this long, the activator hold time
+	hold time.Duration
+	mu   sync.Mutex
+	// requests entered, and those of them released to the endpoints
+	inFlight int
+	released int
+	// closed and replaced whenever a parked request may be released
+	changed chan struct{}
+	// 1 while in proxy mode
+	proxying int32
+	nProxied int64
+	nServed  int64
+	nToProxy int64
+}
+
+func newBurstCapacity(cfg *PodDispatcherConfig, concurrency int, endpoints func() int) *burstCapacity {
+	if cfg.TargetBurstCapacity == 0 {
+		return nil
+	}
+	perEndpoint := cfg.ContainerConcurrency
+	if perEndpoint <= 0 {
+		perEndpoint = concurrency
+	}
+	return &burstCapacity{
+		tbc:         cfg.TargetBurstCapacity,
+		perEndpoint: perEndpoint,
+		endpoints:   endpoints,
+		hold:        time.Duration(cfg.ActivatorHoldMilliSec) * time.Millisecond,
+		changed:     make(chan struct{}),
+	}
+}
+
+// enter counts a request in flight and routes it by the spare capacity left with it: served directly,
+// or parked in proxy mode until an endpoint has a free token; returns false if not released within the hold time
+func (b *burstCapacity) enter(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	b.inFlight++
+	if spare := float64(b.perEndpoint*b.endpoints() - b.inFlight); b.tbc > 0 && spare >= b.tbc {
+		b.released++
+		b.mu.Unlock()
+		atomic.AddInt64(&b.nServed, 1)
+		atomic.StoreInt32(&b.proxying, 0)
+		return true
+	}
+	b.mu.Unlock()
+	atomic.AddInt64(&b.nProxied, 1)
+	if atomic.CompareAndSwapInt32(&b.proxying, 0, 1) {
+		atomic.AddInt64(&b.nToProxy, 1)
+		if b.poke != nil {
+			go b.poke()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.hold)
+	defer cancel()
+	for {
+		b.mu.Lock()
+		if b.released < b.perEndpoint*b.endpoints() {
+			b.released++
+			b.mu.Unlock()
+			return true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.inFlight--
+			b.mu.Unlock()
+			return false
+		}
+	}
+}
+
+// leave frees the token of a request released by enter
+func (b *burstCapacity) leave() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight--
+	b.released--
+	b.notify()
+}
+
+// update releases the parked requests the endpoints may take after they change
+func (b *burstCapacity) update() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notify()
+}
+
+// caller must hold the lock
+func (b *burstCapacity) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// ExcessBurstCapacity returns Knative's excess burst capacity of the target, i.e., the tokens of its ready endpoints
+// less the requests in flight and the target-burst-capacity, negative in proxy mode;
+// false without a positive target-burst-capacity
+func (pd *PodDispatcher) ExcessBurstCapacity() (float64, bool) {
+	b := pd.burst
+	if b == nil || b.tbc <= 0 {
+		return 0, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return float64(b.perEndpoint*b.endpoints()-b.inFlight) - b.tbc, true
+}
+
+type BurstStats struct {
+	// requests served through the activator and directly, and the switches to proxy mode
+	Proxied int64
+	Served  int64
+	ToProxy int64
+}
+
+func (pd *PodDispatcher) BurstStats() BurstStats {
+	b := pd.burst
+	if b == nil {
+		return BurstStats{}
+	}
+	return BurstStats{
+		Proxied: atomic.LoadInt64(&b.nProxied),
+		Served:  atomic.LoadInt64(&b.nServed),
+		ToProxy: atomic.LoadInt64(&b.nToProxy),
+	}
+}
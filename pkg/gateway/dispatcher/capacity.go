@@ -0,0 +1,148 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	OverflowQueue = "queue"
+	OverflowShed  = "shed"
+)
+
+// capacityGate caps the in-flight requests of a target, across all of its endpoints.
+// With containerConcurrency the cap follows the ready endpoints, mirroring Knative's revision-level
+// containerConcurrency×replicas capacity. Excess requests wait for a slot, or fail immediately if shedding
+// and the queue is full; at zero endpoints every request is excess, so the queue holds a cold start.
+type capacityGate struct {
+	maxInFlight          int
+	containerConcurrency int
+	endpoints            func() int
+	shed                 bool
+	maxQueued            int
+	mu                   sync.Mutex
+	inFlight             int
+	// requests waiting for a slot now
+	waiting int
+	// closed and replaced whenever a slot may have become available
+	changed chan struct{}
+	nQueued int64
+	nShed   int64
+}
+
+func newCapacityGate(cfg *PodDispatcherConfig, endpoints func() int) *capacityGate {
+	if cfg.MaxInFlight <= 0 && cfg.ContainerConcurrency <= 0 {
+		return nil
+	}
+	maxQueued := cfg.MaxQueued
+	if maxQueued == 0 {
+		maxQueued = cfg.ContainerConcurrency
+	}
+	return &capacityGate{
+		maxInFlight:          cfg.MaxInFlight,
+		containerConcurrency: cfg.ContainerConcurrency,
+		endpoints:            endpoints,
+		shed:                 cfg.OverflowPolicy == OverflowShed,
+		maxQueued:            maxQueued,
+		changed:              make(chan struct{}),
+	}
+}
+
+func validOverflowPolicy(policy string) error {
+	switch policy {
+	case "", OverflowQueue, OverflowShed:
+		return nil
+	default:
+		return fmt.Errorf("unknown overflow policy %q, expected %q or %q", policy, OverflowQueue, OverflowShed)
+	}
+}
+
+// caller must hold the lock
+func (c *capacityGate) limit() int {
+	limit := -1
+	if c.containerConcurrency > 0 {
+		limit = c.containerConcurrency * c.endpoints()
+	}
+	if c.maxInFlight > 0 && (limit < 0 || c.maxInFlight < limit) {
+		limit = c.maxInFlight
+	}
+	return limit
+}
+
+// admit takes a slot, returns false if the request is shed or ctx expires first
+func (c *capacityGate) admit(ctx context.Context) bool {
+	if c == nil {
+		return true
+	}
+	queued := false
+	defer func() {
+		if queued {
+			c.mu.Lock()
+			c.waiting--
+			c.mu.Unlock()
+		}
+	}()
+	for {
+		c.mu.Lock()
+		if c.inFlight < c.limit() {
+			c.inFlight++
+			c.mu.Unlock()
+			return true
+		}
+		if !queued {
+			if c.shed && c.waiting >= c.maxQueued {
+				c.nShed++
+				c.mu.Unlock()
+				return false
+			}
+			queued = true
+			c.waiting++
+			c.nQueued++
+		}
+		changed := c.changed
+		c.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// done frees the slot taken by admit
+func (c *capacityGate) done() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.notify()
+}
+
+// poke wakes up the queued requests after the endpoints change
+func (c *capacityGate) poke() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notify()
+}
+
+// caller must hold the lock
+func (c *capacityGate) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// returns the number of requests that waited for, or were shed by, the in-flight cap
+func (pd *PodDispatcher) CapacityStats() (queued int64, shed int64) {
+	if pd.capacity == nil {
+		return 0, 0
+	}
+	pd.capacity.mu.Lock()
+	defer pd.capacity.mu.Unlock()
+	return pd.capacity.nQueued, pd.capacity.nShed
+}
@@ -0,0 +1,56 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// requests an endpoint completes before it is warm, unless configured
+const defaultWarmUpRequests = 1
+
+// cold returns true if the endpoint has not completed enough requests to be warm
+func (pd *PodDispatcher) cold(ep *podEndpoint) bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.served < pd.warmUpRequests
+}
+
+// avoidCold returns true if the cold-aware policy should route around the endpoint,
+// i.e., it is cold and already busy, likely with its cold start
+func (pd *PodDispatcher) avoidCold(ep *podEndpoint) bool {
+	return pd.policy == PolicyColdAware && pd.cold(ep) && ep.outstanding() > 0
+}
+
+// served counts a completed request of the endpoint, and records its warm-up time once it becomes warm
+func (pd *PodDispatcher) served(ep *podEndpoint) {
+	ep.mu.Lock()
+	ep.served++
+	warmed := ep.served == pd.warmUpRequests
+	ep.mu.Unlock()
+	if warmed {
+		atomic.AddInt64(&pd.nWarmed, 1)
+		atomic.AddInt64(&pd.warmUpNanos, int64(time.Since(ep.added)))
+	}
+}
+
+type ColdStartStats struct {
+	// requests sent to cold endpoints
+	ToCold int64
+	// requests diverted from busy cold endpoints to warm ones
+	Diverted int64
+	// endpoints that became warm, and their mean time from being added
+	Warmed     int64
+	MeanWarmUp time.Duration
+}
+
+func (pd *PodDispatcher) ColdStartStats() ColdStartStats {
+	stats := ColdStartStats{
+		ToCold:   atomic.LoadInt64(&pd.nToCold),
+		Diverted: atomic.LoadInt64(&pd.nDiverted),
+		Warmed:   atomic.LoadInt64(&pd.nWarmed),
+	}
+	if stats.Warmed > 0 {
+		stats.MeanWarmUp = time.Duration(atomic.LoadInt64(&pd.warmUpNanos) / stats.Warmed)
+	}
+	return stats
+}
@@ -0,0 +1,24 @@
+package dispatcher
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// overrides the concurrency of a single pod, i.e., the number of tokens issued for its endpoint
+const ConcurrencyAnnotation = "kubedirect/concurrency"
+
+// concurrencyOf returns the annotated concurrency of a pod, 0 if unset or invalid
+func (pd *PodDispatcher) concurrencyOf(pod *corev1.Pod) int {
+	value, ok := pod.Annotations[ConcurrencyAnnotation]
+	if !ok {
+		return 0
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency <= 0 {
+		pd.logger.V(1).Info("[WARN] Ignoring invalid concurrency annotation", "pod", pod.Name, "value", value)
+		return 0
+	}
+	return concurrency
+}
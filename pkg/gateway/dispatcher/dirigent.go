@@ -0,0 +1,68 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// Dispatch requests of a function to the Dirigent data plane, which does its own load balancing and autoscaling
+type DirigentDispatcher struct {
+	target    string
+	function  string
+	dataPlane string
+	timeout   time.Duration
+	reqChan   <-chan *workload.Request
+	resChan   chan<- *workload.Response
+	executor  backend.Executor
+}
+
+// function is the name the function is registered with in Dirigent
+func NewDirigentDispatcher(ctx context.Context, target string, timeout time.Duration, reqChan <-chan *workload.Request, resChan chan<- *workload.Response, dataPlane string, function string) (*DirigentDispatcher, error) {
+	dd := &DirigentDispatcher{
+		target:    target,
+		function:  function,
+		dataPlane: dataPlane,
+		timeout:   timeout,
+		reqChan:   reqChan,
+		resChan:   resChan,
+	}
+	executor, err := backend.NewRoutedBackend(dataPlane, function)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start backend: %v", err)
+	}
+	dd.executor = executor
+	return dd, nil
+}
+
+func (dd *DirigentDispatcher) Dispatch(ctx context.Context, _ logr.Logger, req *workload.Request) {
+	req.Hops.Dispatching()
+	// no endpoint slots, the request goes straight to the data plane
+	req.Hops.Acquired(dd.dataPlane)
+	// cold starts happen behind the data plane, so add the dispatch timeout as for knative
+	ctx, cancel := context.WithTimeout(ctx, dd.timeout+backend.Timeout(req))
+	defer cancel()
+	res := dd.executor.Execute(ctx, req)
+	dd.resChan <- res
+}
+
+func (dd *DirigentDispatcher) Run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	logger.V(1).Info("starting dirigent dispatcher", "target", dd.target, "function", dd.function)
+	for {
+		select {
+		case req := <-dd.reqChan:
+			go dd.Dispatch(ctx, logger, req)
+		case <-ctx.Done():
+			dd.executor.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// a draining pod receives no new requests, but its in-flight ones complete over the kept connection
+const DrainingLabel = "kubedirect/draining"
+
+func isDraining(pod *corev1.Pod) bool {
+	return pod.Labels[DrainingLabel] == "true"
+}
+
+// lookup returns the endpoint of a token, false if it is removed or draining
+func (pd *PodDispatcher) lookup(key string) (*podEndpoint, bool) {
+	ep, ok := pd.endpoints.Get(key)
+	if !ok || ep.isDraining() {
+		return nil, false
+	}
+	return ep, true
+}
+
+func (ep *podEndpoint) isDraining() bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.draining
+}
+
+// drain returns true if the endpoint was not draining before; draining cannot be undone
+func (ep *podEndpoint) drain() bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.draining {
+		return false
+	}
+	ep.draining = true
+	return true
+}
+
+func (ep *podEndpoint) acquire() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.inFlight++
+}
+
+// done returns true if the request completed on an endpoint that was already removed,
+// i.e., the request was likely lost
+func (ep *podEndpoint) done() bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.inFlight--
+	if ep.removed && ep.inFlight == 0 && !ep.closed {
+		ep.closed = true
+		go ep.executor.Close()
+	}
+	return ep.removed
+}
+
+// retire closes the executor, after the in-flight requests if the endpoint is draining
+func (ep *podEndpoint) retire() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.removed = true
+	if ep.closed || (ep.draining && ep.inFlight > 0) {
+		return
+	}
+	ep.closed = true
+	go ep.executor.Close()
+}
+
+// returns the number of drained endpoints and failed requests on removed endpoints
+func (pd *PodDispatcher) DrainStats() (drained int64, lost int64) {
+	return atomic.LoadInt64(&pd.nDrained), atomic.LoadInt64(&pd.nLost)
+}
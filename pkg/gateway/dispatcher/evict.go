@@ -0,0 +1,197 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	defaultEvictionWindow           = 20
+	defaultEvictionCooldownMilliSec = 30000
+)
+
+// EvictionConfig removes endpoints that keep failing, e.g., a wedged pod that still passes its readiness probe,
+// so that they stop absorbing tokens
+type EvictionConfig struct {
+	// evict an endpoint once this fraction of its recent responses failed, disabled if not positive
+	FailureRate float64 `yaml:"failureRate"`
+	// the number of recent responses per endpoint the rate is computed over, defaults to 20
+	Window int `yaml:"window"`
+	// an evicted endpoint is readmitted by a reconcile once its pod turned ready again after the eviction,
+	// or once this long has passed, defaults to 30000
+	CooldownMilliSec int `yaml:"cooldownMilliSec"`
+}
+
+func (cfg *EvictionConfig) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.FailureRate < 0 || cfg.FailureRate > 1 {
+		return fmt.Errorf("eviction: failureRate must be in [0, 1], got %v", cfg.FailureRate)
+	}
+	if cfg.Window < 0 || cfg.CooldownMilliSec < 0 {
+		return fmt.Errorf("eviction: window and cooldownMilliSec cannot be negative")
+	}
+	return nil
+}
+
+// the outcomes of the recent responses of an endpoint, as a ring
+type endpointHealth struct {
+	failed   []bool
+	next     int
+	n        int
+	failures int
+}
+
+func (h *endpointHealth) record(failed bool) {
+	if h.n == len(h.failed) {
+		if h.failed[h.next] {
+			h.failures--
+		}
+	} else {
+		h.n++
+	}
+	h.failed[h.next] = failed
+	if failed {
+		h.failures++
+	}
+	h.next = (h.next + 1) % len(h.failed)
+}
+
+type evictor struct {
+	failureRate float64
+	window      int
+	cooldown    time.Duration
+	mu          sync.Mutex
+	health      map[string]*endpointHealth
+	// eviction time by endpoint key, until readmitted
+	evicted     map[string]time.Time
+	nEvicted    int64
+	nReadmitted int64
+}
+
+// nil if eviction is disabled
+func newEvictor(cfg *EvictionConfig) *evictor {
+	if cfg == nil || cfg.FailureRate <= 0 {
+		return nil
+	}
+	e := &evictor{
+		failureRate: cfg.FailureRate,
+		window:      cfg.Window,
+		cooldown:    time.Duration(cfg.CooldownMilliSec) * time.Millisecond,
+		health:      make(map[string]*endpointHealth),
+		evicted:     make(map[string]time.Time),
+	}
+	if e.window <= 0 {
+		e.window = defaultEvictionWindow
+	}
+	if e.cooldown <= 0 {
+		e.cooldown = defaultEvictionCooldownMilliSec * time.Millisecond
+	}
+	return e
+}
+
+// observe records a response of the endpoint, returns true if the endpoint must be evicted now;
+// the rate is only judged over a full window
+func (e *evictor) observe(key string, status workload.ResponseStatus) bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.evicted[key]; ok {
+		return false
+	}
+	h, ok := e.health[key]
+	if !ok {
+		h = &endpointHealth{failed: make([]bool, e.window)}
+		e.health[key] = h
+	}
+	h.record(status != workload.SUCCESS)
+	if h.n < e.window || float64(h.failures) < e.failureRate*float64(h.n) {
+		return false
+	}
+	delete(e.health, key)
+	e.evicted[key] = time.Now()
+	e.nEvicted++
+	return true
+}
+
+// admit returns false while the endpoint of pod is evicted, i.e., until its pod turned ready again
+// after the eviction or the cooldown has passed
+func (e *evictor) admit(key string, pod *corev1.Pod, now time.Time) bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	evictedAt, ok := e.evicted[key]
+	if !ok {
+		return true
+	}
+	if now.Sub(evictedAt) < e.cooldown && !readySince(pod, evictedAt) {
+		return false
+	}
+	delete(e.evicted, key)
+	e.nReadmitted++
+	return true
+}
+
+// prune forgets the endpoints whose pods are gone
+func (e *evictor) prune(present map[string]string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.evicted {
+		if _, ok := present[key]; !ok {
+			delete(e.evicted, key)
+		}
+	}
+	for key := range e.health {
+		if _, ok := present[key]; !ok {
+			delete(e.health, key)
+		}
+	}
+}
+
+// readySince is true if the ready condition of pod last turned true after t;
+// pods synthesized from EndpointSlices or DNS carry no conditions and wait for the cooldown
+func readySince(pod *corev1.Pod, t time.Time) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue && cond.LastTransitionTime.After(t)
+		}
+	}
+	return false
+}
+
+// evict stops issuing tokens of the endpoint and removes it once its in-flight requests complete;
+// its tokens are discarded like those of a removed pod
+func (pd *PodDispatcher) evict(key string) {
+	endpoint, _ := pd.endpoints.Del(key)
+	if endpoint == nil {
+		return
+	}
+	endpoint.drain()
+	endpoint.retire()
+	pd.retain(endpoint)
+	pd.logger.Info("[WARN] Evicted failing endpoint", "endpoint", key, "failureRate", pd.evictor.failureRate, "window", pd.evictor.window)
+}
+
+// returns the number of evicted endpoints and of those readmitted since
+func (pd *PodDispatcher) EvictionStats() (evicted int64, readmitted int64) {
+	if pd.evictor == nil {
+		return 0, 0
+	}
+	pd.evictor.mu.Lock()
+	defer pd.evictor.mu.Unlock()
+	return pd.evictor.nEvicted, pd.evictor.nReadmitted
+}
@@ -0,0 +1,175 @@
+package dispatcher
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.design/x/chann"
+	corev1 "k8s.io/api/core/v1"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	// pods of the same target may come in different flavors, e.g. small and large variants
+	FlavorLabel = "kubedirect/flavor"
+	// flavor of pods without the flavor label, or with an unknown one
+	defaultFlavor = "default"
+)
+
+type FlavorConfig struct {
+	Name string `yaml:"name"`
+	// number of requests a pod of this flavor serves at the same time
+	Concurrency int `yaml:"concurrency"`
+	// relative cost of serving a request on this flavor
+	Cost float64 `yaml:"cost"`
+	// runtime of a request on this flavor is divided by the speed-up, only simulated by the fake backend
+	SpeedUp float64 `yaml:"speedUp"`
+}
+
+type flavor struct {
+	*FlavorConfig
+	tokens      *chann.Chann[string]
+	nDispatched int64
+}
+
+func newFlavor(cfg *FlavorConfig) *flavor {
+	cfg = &FlavorConfig{
+		Name:        cfg.Name,
+		Concurrency: cfg.Concurrency,
+		Cost:        cfg.Cost,
+		SpeedUp:     cfg.SpeedUp,
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = podServiceConcurrency
+	}
+	if cfg.Cost <= 0 {
+		cfg.Cost = 1
+	}
+	if cfg.SpeedUp <= 0 {
+		cfg.SpeedUp = 1
+	}
+	return &flavor{
+		FlavorConfig: cfg,
+		tokens:       chann.New[string](),
+	}
+}
+
+// expected runtime of req on this flavor
+func (f *flavor) runtime(req *workload.Request) time.Duration {
+	return time.Duration(float64(req.DurationMilliSec)/f.SpeedUp) * time.Millisecond
+}
+
+func (pd *PodDispatcher) initFlavors(configs []*FlavorConfig) {
+	if len(configs) == 0 {
+		return
+	}
+	pd.flavors = make(map[string]*flavor)
+	for _, cfg := range configs {
+		f := newFlavor(cfg)
+		pd.flavors[f.Name] = f
+		pd.byCost = append(pd.byCost, f)
+	}
+	if _, ok := pd.flavors[defaultFlavor]; !ok {
+		f := newFlavor(&FlavorConfig{Name: defaultFlavor})
+		pd.flavors[defaultFlavor] = f
+		pd.byCost = append(pd.byCost, f)
+	}
+	sort.SliceStable(pd.byCost, func(i, j int) bool {
+		return pd.byCost[i].Cost < pd.byCost[j].Cost
+	})
+}
+
+func (pd *PodDispatcher) flavored() bool {
+	return len(pd.flavors) > 0
+}
+
+func (pd *PodDispatcher) flavorOf(pod *corev1.Pod) *flavor {
+	if f, ok := pd.flavors[pod.Labels[FlavorLabel]]; ok {
+		return f
+	}
+	return pd.flavors[defaultFlavor]
+}
+
+// returns the number of dispatched requests per flavor
+func (pd *PodDispatcher) FlavorStats() map[string]int64 {
+	stats := make(map[string]int64, len(pd.flavors))
+	for name, f := range pd.flavors {
+		stats[name] = atomic.LoadInt64(&f.nDispatched)
+	}
+	return stats
+}
+
+func (pd *PodDispatcher) deadlineFor(req *workload.Request) time.Duration {
+	if pd.deadlineFactor > 0 {
+		return time.Duration(float64(req.DurationMilliSec)*pd.deadlineFactor) * time.Millisecond
+	}
+	return pd.execTimeoutFor(req)
+}
+
+// flavors able to finish req within the remaining time, cheapest first;
+// if none is, all flavors are returned fastest first so that req misses its deadline by as little as possible
+func (pd *PodDispatcher) candidateFlavors(req *workload.Request, remaining time.Duration) []*flavor {
+	var feasible []*flavor
+	for _, f := range pd.byCost {
+		if f.runtime(req) <= remaining {
+			feasible = append(feasible, f)
+		}
+	}
+	if len(feasible) > 0 {
+		return feasible
+	}
+	fastest := append([]*flavor(nil), pd.byCost...)
+	sort.SliceStable(fastest, func(i, j int) bool {
+		return fastest[i].SpeedUp > fastest[j].SpeedUp
+	})
+	return fastest
+}
+
+// dispatchFlavored picks the cheapest flavor with a free slot that still meets the deadline of req,
+// and otherwise waits for a slot on any of the candidate flavors within the dispatch deadline of ctx
+func (pd *PodDispatcher) dispatchFlavored(ctx context.Context, req *workload.Request) (string, *podEndpoint) {
+	deadline := time.Now().Add(pd.deadlineFor(req))
+	for {
+		candidates := pd.candidateFlavors(req, time.Until(deadline))
+		for _, f := range candidates {
+			if key, ep := pd.tryFlavor(f); ep != nil {
+				return key, ep
+			}
+		}
+		// wait on all candidates at once
+		cases := make([]reflect.SelectCase, 0, len(candidates)+1)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+		for _, f := range candidates {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(f.tokens.Out())})
+		}
+		chosen, value, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return "", nil
+		}
+		key := value.String()
+		// Discard tokens of removed or draining pods
+		if ep, ok := pd.lookup(key); ok {
+			return key, ep
+		}
+	}
+}
+
+// non-blocking
+func (pd *PodDispatcher) tryFlavor(f *flavor) (string, *podEndpoint) {
+	for {
+		select {
+		case key := <-f.tokens.Out():
+			// Discard tokens of removed or draining pods
+			if ep, ok := pd.lookup(key); ok {
+				return key, ep
+			}
+		default:
+			return "", nil
+		}
+	}
+}
@@ -16,6 +16,8 @@ import (
 
 const (
 	kourierGatewayServicePort = ":80"
+	// the private service of a revision fronts the queue-proxies of its pods on the same port
+	revisionPrivateServicePort = ":80"
 )
 
 type KnServiceDispatcher struct {
@@ -27,15 +29,26 @@ type KnServiceDispatcher struct {
 	executor backend.Executor
 }
 
+// NewKnServiceDispatcher sends requests to the Kourier ingress at the URL of the knative service
 func NewKnServiceDispatcher(ctx context.Context, target string, timeout time.Duration, reqChan <-chan *workload.Request, resChan chan<- *workload.Response, url string) (*KnServiceDispatcher, error) {
+	return newKnDispatcher(ctx, target, timeout, reqChan, resChan, strings.TrimPrefix(url, "http://")+kourierGatewayServicePort)
+}
+
+// NewKnRevisionDispatcher sends requests straight to the private service of a revision at the given IP,
+// bypassing the ingress and the activator; requests fail to connect while the revision is at zero
+func NewKnRevisionDispatcher(ctx context.Context, target string, timeout time.Duration, reqChan <-chan *workload.Request, resChan chan<- *workload.Response, ip string) (*KnServiceDispatcher, error) {
+	return newKnDispatcher(ctx, target, timeout, reqChan, resChan, ip+revisionPrivateServicePort)
+}
+
+func newKnDispatcher(ctx context.Context, target string, timeout time.Duration, reqChan <-chan *workload.Request, resChan chan<- *workload.Response, endpoint string) (*KnServiceDispatcher, error) {
 	kd := &KnServiceDispatcher{
 		target:   target,
 		timeout:  timeout,
 		reqChan:  reqChan,
 		resChan:  resChan,
-		endpoint: strings.TrimPrefix(url, "http://") + kourierGatewayServicePort,
+		endpoint: endpoint,
 	}
-	executor, err := backend.NewBackend(kd.endpoint)
+	executor, err := backend.NewBackend(kd.endpoint, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to start backend: %v", err)
 	}
@@ -44,6 +57,9 @@ func NewKnServiceDispatcher(ctx context.Context, target string, timeout time.Dur
 }
 
 func (kd *KnServiceDispatcher) Dispatch(ctx context.Context, _ logr.Logger, req *workload.Request) {
+	req.Hops.Dispatching()
+	// no endpoint slots, the request goes straight to the knative ingress or revision
+	req.Hops.Acquired(kd.endpoint)
 	// kn dispatcher is integrated with gateway service, so add the timeout
 	ctx, cancel := context.WithTimeout(ctx, kd.timeout+backend.Timeout(req))
 	defer cancel()
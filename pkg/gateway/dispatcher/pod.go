@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -15,7 +16,6 @@ import (
 	// Kubedirect
 	"github.com/tomquartz/kubedirect-bench/pkg/backend"
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
-	"github.com/tomquartz/kubedirect-bench/pkg/workload/handler"
 	kdutil "k8s.io/kubedirect/pkg/util"
 )
 
@@ -24,83 +24,518 @@ const (
 	// podServiceDispatchTimeout = 15 * time.Second
 )
 
-// NOTE: we index by both pod name and ip:port to handle pod restarts and/or ip reuse for different pods
-var podEndpointKeyFunc = func(pod *corev1.Pod) (key string, ep string) {
-	ep = pod.Status.PodIP + handler.WorkloadServicePort
-	key = fmt.Sprintf("%s@%s", pod.Name, ep)
-	return
+type PodDispatcherConfig struct {
+	// tokens issued per endpoint, i.e., the container concurrency, defaults to 1;
+	// flavors and the kubedirect/concurrency pod annotation take precedence
+	Concurrency int `yaml:"concurrency"`
+	// zone of the gateway; if set, endpoints in the same zone are preferred
+	Zone string `yaml:"zone"`
+	// how long a request waits for a same-zone endpoint before spilling over to other zones,
+	// 0 disables spilling over
+	SpillOverMilliSec int `yaml:"spillOverMilliSec"`
+	// if set, pods are grouped by their flavor label and requests go to the cheapest flavor meeting the deadline;
+	// zone preference does not apply to flavored dispatching
+	Flavors []*FlavorConfig `yaml:"flavors"`
+	// deadline of a request as a multiple of its duration, defaults to the backend timeout
+	DeadlineFactor float64 `yaml:"deadlineFactor"`
+	// if positive, requests of a target are admitted at most at this rate
+	MaxRPS float64 `yaml:"maxRPS"`
+	// bucket size of the rate smoothing, defaults to 1, i.e., a leaky bucket
+	Burst int `yaml:"burst"`
+	// if positive, endpoints added within this window are avoided while warm ones have free tokens;
+	// does not apply to flavored dispatching
+	SlowStartMilliSec int `yaml:"slowStartMilliSec"`
+	// if positive, the concurrency tokens of a new endpoint are added one by one over this window
+	RampMilliSec int `yaml:"rampMilliSec"`
+	// how an endpoint is picked among those with free tokens. Options: fifo (default), least-outstanding;
+	// does not apply to flavored dispatching
+	Policy string `yaml:"policy"`
+	// requests an endpoint completes before it is warm under the cold-aware policy, defaults to 1
+	WarmUpRequests int `yaml:"warmUpRequests"`
+	// if set, requests with the same affinity key go to the same endpoint while it has a free token;
+	// does not apply to flavored dispatching
+	Affinity bool `yaml:"affinity"`
+	// if positive, requests of a target without endpoints are parked up to this long until the first one is ready,
+	// and the autoscaler is poked right away instead of on its next tick; released requests get a fresh dispatch timeout
+	ActivatorHoldMilliSec int `yaml:"activatorHoldMilliSec"`
+	// Knative's target-burst-capacity: while the spare capacity of the ready endpoints, i.e., their tokens less the in-flight requests,
+	// is below this many requests, the target is served through the activator, which parks requests until an endpoint has a free token,
+	// and the autoscaler is poked on the switch and adds the pods missing for the spare capacity;
+	// -1 keeps the activator always in the path, 0 (default) only at zero endpoints. Needs activatorHoldMilliSec
+	TargetBurstCapacity float64 `yaml:"targetBurstCapacity"`
+	// if positive, caps the in-flight requests of a target across all of its endpoints
+	MaxInFlight int `yaml:"maxInFlight"`
+	// if positive, caps the in-flight requests of a target at containerConcurrency × ready endpoints, like a Knative revision
+	ContainerConcurrency int `yaml:"containerConcurrency"`
+	// what happens to requests over the in-flight cap: "queue" (default) waits within the dispatch timeout,
+	// "shed" waits likewise while fewer than maxQueued requests wait, and fails the others immediately
+	OverflowPolicy string `yaml:"overflowPolicy"`
+	// the requests waiting over the in-flight cap before shedding, defaults to containerConcurrency, i.e., the load of one endpoint,
+	// so a target without endpoints queues for its first one instead of shedding everything
+	MaxQueued int `yaml:"maxQueued"`
+	// if set, requests with a higher priority (see workload.PriorityLabel) take free endpoints first;
+	// does not apply to flavored dispatching
+	Priority bool `yaml:"priority"`
+	// if set, batch requests (see workload.ClassLabel) take free endpoints only after the interactive requests
+	// of the same priority, as the autoscaler may not scale for them, see scaleOnClasses;
+	// does not apply to flavored dispatching
+	BatchLast bool `yaml:"batchLast"`
+	// if set, requests failing on an endpoint are re-dispatched, see RetryConfig
+	Retry *RetryConfig `yaml:"retry"`
+	// if set, endpoints failing too many of their requests are evicted, see EvictionConfig
+	Eviction *EvictionConfig `yaml:"eviction"`
+	// if positive, overrides the gateway dispatch timeout, i.e., how long a request waits for smoothing, the in-flight cap and an endpoint
+	// altogether before failing with FAIL_DISPATCH
+	DispatchTimeoutMilliSec int `yaml:"dispatchTimeoutMilliSec"`
+	// if positive, caps the execution of a request on its endpoint before failing with FAIL_TIMEOUT, defaults to the backend timeout
+	ExecTimeoutMilliSec int `yaml:"execTimeoutMilliSec"`
+	// the container port requests are sent to, by name or number; defaults to the first TCP container port of a pod,
+	// or 80 if it declares none
+	Port string `yaml:"port"`
+	// if positive, requests of a target are dispatched by this many workers instead of a goroutine each,
+	// and wait for a free one before their dispatch timeout starts; a worker is held until its request completes
+	Workers int `yaml:"workers"`
+	// if positive, at most this many requests of a target are taken from the relay at once, being dispatched or waiting
+	// for a worker; the others stay in the relay buffer, which then pushes back on the relay if bounded, see relayBufferSize
+	MaxDispatching int `yaml:"maxDispatching"`
+	// per-target overrides, indexed by workload key (namespace/name)
+	Targets map[string]*PodDispatcherTargetConfig `yaml:"targets"`
+}
+
+// nil fields inherit the gateway-wide value
+type PodDispatcherTargetConfig struct {
+	Concurrency             *int     `yaml:"concurrency"`
+	MaxRPS                  *float64 `yaml:"maxRPS"`
+	Burst                   *int     `yaml:"burst"`
+	RampMilliSec            *int     `yaml:"rampMilliSec"`
+	MaxInFlight             *int     `yaml:"maxInFlight"`
+	ContainerConcurrency    *int     `yaml:"containerConcurrency"`
+	DispatchTimeoutMilliSec *int     `yaml:"dispatchTimeoutMilliSec"`
+	ExecTimeoutMilliSec     *int     `yaml:"execTimeoutMilliSec"`
+	Workers                 *int     `yaml:"workers"`
+	Port                    *string  `yaml:"port"`
+	TargetBurstCapacity     *float64 `yaml:"targetBurstCapacity"`
+}
+
+// For returns the config of the given target with its overrides applied
+func (cfg *PodDispatcherConfig) For(key string) *PodDispatcherConfig {
+	if cfg == nil {
+		return nil
+	}
+	target := cfg.Targets[key]
+	if target == nil {
+		return cfg
+	}
+	merged := *cfg
+	if target.Concurrency != nil {
+		merged.Concurrency = *target.Concurrency
+	}
+	if target.MaxRPS != nil {
+		merged.MaxRPS = *target.MaxRPS
+	}
+	if target.Burst != nil {
+		merged.Burst = *target.Burst
+	}
+	if target.RampMilliSec != nil {
+		merged.RampMilliSec = *target.RampMilliSec
+	}
+	if target.MaxInFlight != nil {
+		merged.MaxInFlight = *target.MaxInFlight
+	}
+	if target.ContainerConcurrency != nil {
+		merged.ContainerConcurrency = *target.ContainerConcurrency
+	}
+	if target.DispatchTimeoutMilliSec != nil {
+		merged.DispatchTimeoutMilliSec = *target.DispatchTimeoutMilliSec
+	}
+	if target.ExecTimeoutMilliSec != nil {
+		merged.ExecTimeoutMilliSec = *target.ExecTimeoutMilliSec
+	}
+	if target.Workers != nil {
+		merged.Workers = *target.Workers
+	}
+	if target.Port != nil {
+		merged.Port = *target.Port
+	}
+	if target.TargetBurstCapacity != nil {
+		merged.TargetBurstCapacity = *target.TargetBurstCapacity
+	}
+	return &merged
+}
+
+type podEndpoint struct {
+	executor backend.Executor
+	zone     string
+	// in a different zone than the gateway
+	remote bool
+	// nil if not flavored
+	flavor *flavor
+	added  time.Time
+	// lifecycle, see drain.go
+	mu       sync.Mutex
+	inFlight int
+	// completed requests, see cold.go
+	served   int
+	draining bool
+	removed  bool
+	closed   bool
 }
 
 // Directly dispatch request to a pod
 type PodDispatcher struct {
 	target    string
 	timeout   time.Duration
-	endpoints *kdutil.SharedMap[backend.Executor]
-	tokens    *chann.Chann[string]
-	reqChan   <-chan *workload.Request
-	resChan   chan<- *workload.Response
-	logger    logr.Logger
+	zone      string
+	spillOver time.Duration
+	slowStart time.Duration
+	ramp      time.Duration
+	policy    string
+	// configured port name or number, see port.go
+	port string
+	// completed requests for an endpoint to be warm
+	warmUpRequests int
+	// default tokens per endpoint
+	concurrency int
+	endpoints   *kdutil.SharedMap[*podEndpoint]
+	// tokens of same-zone endpoints, or all endpoints if not zone-aware
+	tokens       *chann.Chann[string]
+	remoteTokens *chann.Chann[string]
+	// resolves the zone of a node
+	zoneOf func(ctx context.Context, node string) string
+	// pod flavors by name, and sorted by cost
+	flavors        map[string]*flavor
+	byCost         []*flavor
+	deadlineFactor float64
+	execTimeout    time.Duration // zero defers to the backend timeout, see timeout.go
+	smoother       *smoother
+	capacity       *capacityGate
+	retry          *retryPolicy
+	evictor        *evictor
+	affinity       *affinityTable
+	priority       *priorityGate
+	activator      *activator
+	burst          *burstCapacity
+	nDispatched    int64
+	nCrossZone     int64
+	nDrained       int64
+	nLost          int64
+	nToWarming     int64
+	nSwapped       int64
+	nRebalanced    int64
+	nToCold        int64
+	nDiverted      int64
+	nWarmed        int64
+	warmUpNanos    int64
+	nAffinityHit   int64
+	nAffinityMiss  int64
+	nDispatchFail  int64
+	nExecTimeout   int64
+	reqChan        <-chan *workload.Request
+	resChan        chan<- *workload.Response
+	logger         logr.Logger
+
+	// removed endpoints, see served.go
+	retiredMu sync.Mutex
+	retired   []*podEndpoint
+	// requests waiting for an endpoint, see queue.go
+	queue *waitQueue
+	// starts the dispatch of each request, see pool.go
+	scheduler *dispatchScheduler
 }
 
-func NewPodDispatcher(ctx context.Context, target string, timeout time.Duration, reqChan <-chan *workload.Request, resChan chan<- *workload.Response) (*PodDispatcher, error) {
+func NewPodDispatcher(ctx context.Context, target string, timeout time.Duration, cfg *PodDispatcherConfig, reqChan <-chan *workload.Request, resChan chan<- *workload.Response) (*PodDispatcher, error) {
+	if cfg == nil {
+		cfg = &PodDispatcherConfig{}
+	}
 	pd := &PodDispatcher{
-		target:    target,
-		timeout:   timeout,
-		endpoints: kdutil.NewSharedMap[backend.Executor](),
-		tokens:    chann.New[string](),
-		reqChan:   reqChan,
-		resChan:   resChan,
+		target:       target,
+		timeout:      timeout,
+		zone:         cfg.Zone,
+		spillOver:    time.Duration(cfg.SpillOverMilliSec) * time.Millisecond,
+		slowStart:    time.Duration(cfg.SlowStartMilliSec) * time.Millisecond,
+		ramp:         time.Duration(cfg.RampMilliSec) * time.Millisecond,
+		policy:       cfg.Policy,
+		port:         cfg.Port,
+		concurrency:  cfg.Concurrency,
+		endpoints:    kdutil.NewSharedMap[*podEndpoint](),
+		tokens:       chann.New[string](),
+		remoteTokens: chann.New[string](),
+		reqChan:      reqChan,
+		resChan:      resChan,
 	}
+	if pd.concurrency <= 0 {
+		pd.concurrency = podServiceConcurrency
+	}
+	pd.warmUpRequests = cfg.WarmUpRequests
+	if pd.warmUpRequests <= 0 {
+		pd.warmUpRequests = defaultWarmUpRequests
+	}
+	pd.deadlineFactor = cfg.DeadlineFactor
+	pd.smoother = newSmoother(cfg.MaxRPS, cfg.Burst)
+	pd.capacity = newCapacityGate(cfg, pd.Endpoints)
+	pd.retry = newRetryPolicy(cfg.Retry)
+	pd.evictor = newEvictor(cfg.Eviction)
+	pd.affinity = newAffinityTable(cfg.Affinity)
+	pd.priority = newPriorityGate(cfg.Priority, cfg.BatchLast)
+	pd.activator = newActivator(time.Duration(cfg.ActivatorHoldMilliSec) * time.Millisecond)
+	pd.burst = newBurstCapacity(cfg, pd.concurrency, pd.Endpoints)
+	pd.queue = newWaitQueue()
+	pd.scheduler = newDispatchScheduler(cfg.Workers, cfg.MaxDispatching)
+	if cfg.DispatchTimeoutMilliSec > 0 {
+		pd.timeout = time.Duration(cfg.DispatchTimeoutMilliSec) * time.Millisecond
+	}
+	pd.execTimeout = time.Duration(cfg.ExecTimeoutMilliSec) * time.Millisecond
+	pd.initFlavors(cfg.Flavors)
 	return pd, nil
 }
 
-func (pd *PodDispatcher) dispatch(ctx context.Context) (string, backend.Executor) {
-	dispatchCtx, cancel := context.WithTimeout(ctx, pd.timeout)
-	defer cancel()
+func (pd *PodDispatcher) WithZoneResolver(zoneOf func(ctx context.Context, node string) string) *PodDispatcher {
+	pd.zoneOf = zoneOf
+	return pd
+}
+
+func (pd *PodDispatcher) zoneAware() bool {
+	return pd.zone != "" && pd.zoneOf != nil
+}
+
+// returns the number of dispatched requests and those sent to a different zone
+func (pd *PodDispatcher) CrossZoneStats() (dispatched int64, crossZone int64) {
+	return atomic.LoadInt64(&pd.nDispatched), atomic.LoadInt64(&pd.nCrossZone)
+}
+
+// smooth waits for the rate smoother within the dispatch deadline of ctx
+func (pd *PodDispatcher) smooth(ctx context.Context) bool {
+	if pd.smoother == nil {
+		return true
+	}
+	return pd.smoother.wait(ctx)
+}
+
+// admit waits for an in-flight slot of the target within the dispatch deadline of ctx
+func (pd *PodDispatcher) admit(ctx context.Context) bool {
+	if pd.capacity == nil {
+		return true
+	}
+	return pd.capacity.admit(ctx)
+}
+
+func (pd *PodDispatcher) SmoothingStats() SmoothingStats {
+	return pd.smoother.stats()
+}
+
+// number of ready endpoints
+func (pd *PodDispatcher) Endpoints() int {
+	pd.endpoints.RLock()
+	defer pd.endpoints.RUnlock()
+	return len(pd.endpoints.Inner())
+}
+
+func (pd *PodDispatcher) release(key string, ep *podEndpoint) {
+	if ep.isDraining() {
+		// the token retires with the request
+		return
+	}
+	if ep.flavor != nil {
+		ep.flavor.tokens.In() <- key
+	} else if ep.remote {
+		pd.remoteTokens.In() <- key
+	} else {
+		pd.tokens.In() <- key
+	}
+}
+
+// dispatch waits for an endpoint within the dispatch deadline of ctx
+func (pd *PodDispatcher) dispatch(ctx context.Context, req *workload.Request) (string, *podEndpoint) {
+	preferred := pd.preferred(req)
+	rank := pd.priority.rank(req)
+	pd.priority.enter(rank)
+	defer pd.priority.leave(rank)
 	for {
-		select {
-		case <-dispatchCtx.Done():
+		if !pd.priority.wait(ctx, rank) {
 			return "", nil
-		case key := <-pd.tokens.Out():
-			// Discard tokens of removed pods
-			executor, ok := pd.endpoints.Get(key)
-			if !ok {
-				continue
+		}
+		key, ep := pd.acquire(ctx, preferred)
+		if ep == nil {
+			return "", nil
+		}
+		if pd.priority.yield(rank) {
+			// a higher-ranked request started waiting meanwhile, hand it the token
+			pd.release(key, ep)
+			continue
+		}
+		pd.bind(req, preferred, key)
+		return key, ep
+	}
+}
+
+// acquire waits for a token within ctx, returns a nil endpoint if ctx expires first
+func (pd *PodDispatcher) acquire(ctx context.Context, preferred string) (string, *podEndpoint) {
+	if pd.zoneAware() {
+		// prefer same-zone endpoints, waiting up to the spill-over window;
+		// without one, spill stays nil and requests wait for same-zone endpoints only
+		var spill <-chan time.Time
+		if pd.spillOver > 0 {
+			timer := time.NewTimer(pd.spillOver)
+			defer timer.Stop()
+			spill = timer.C
+		}
+	local:
+		for {
+			select {
+			case <-ctx.Done():
+				return "", nil
+			case key := <-pd.tokens.Out():
+				// Discard tokens of removed pods
+				if ep, ok := pd.lookup(key); ok {
+					return pd.pick(pd.tokens, key, ep, preferred)
+				}
+			case <-spill:
+				break local
 			}
-			// pd.logger.V(1).Info("Dispatching to pod", "req", req.ID, "endpoint", key)
-			return key, executor
 		}
 	}
+	for {
+		var key string
+		var tokens *chann.Chann[string]
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case key = <-pd.tokens.Out():
+			tokens = pd.tokens
+		case key = <-pd.remoteTokens.Out():
+			tokens = pd.remoteTokens
+		}
+		// Discard tokens of removed or draining pods
+		ep, ok := pd.lookup(key)
+		if !ok {
+			continue
+		}
+		return pd.pick(tokens, key, ep, preferred)
+	}
 }
 
 func (pd *PodDispatcher) Dispatch(ctx context.Context, logger logr.Logger, req *workload.Request) {
-	key, executor := pd.dispatch(ctx)
-	if executor == nil {
-		logger.V(1).Info("[WARN] Timeout dispatching request", "req", req.ID)
-		res := &workload.Response{
-			Source: req,
-			Status: workload.FAIL_DISPATCH,
+	pd.queue.enter(req)
+	defer pd.queue.leave(req)
+	if !pd.activate(ctx) {
+		logger.V(1).Info("[WARN] Timeout activating request", "req", req.ID)
+		pd.resChan <- pd.dispatchFailed(req)
+		return
+	}
+	if !pd.burst.enter(ctx) {
+		logger.V(1).Info("[WARN] Timeout parking request in proxy mode", "req", req.ID)
+		pd.resChan <- pd.dispatchFailed(req)
+		return
+	}
+	defer pd.burst.leave()
+	req.Hops.Dispatching()
+	// one deadline for smoothing, the in-flight cap and an endpoint together
+	deadline := time.Now().Add(pd.timeout)
+	dispatchCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if !pd.smooth(dispatchCtx) {
+		logger.V(1).Info("[WARN] Timeout smoothing request", "req", req.ID)
+		pd.resChan <- pd.dispatchFailed(req)
+		return
+	}
+	if !pd.admit(dispatchCtx) {
+		logger.V(1).Info("[WARN] Request over in-flight cap", "req", req.ID)
+		pd.resChan <- pd.dispatchFailed(req)
+		return
+	}
+	defer pd.capacity.done()
+	attempt := 1
+	for {
+		res := pd.attempt(ctx, deadline, logger, req)
+		if pd.retry.retry(ctx, attempt, res) {
+			attempt++
+			logger.V(2).Info("Retrying request", "req", req.ID, "status", res.Status, "attempt", attempt)
+			// a retry waits for another endpoint within a fresh dispatch timeout
+			deadline = time.Now().Add(pd.timeout)
+			continue
 		}
+		pd.retry.done(attempt, res)
 		pd.resChan <- res
 		return
 	}
-	// pd.logger.V(1).Info("Dispatching to pod", "req", req.ID, "endpoint", key)
-	ctx, cancel := context.WithTimeout(ctx, backend.Timeout(req))
+}
+
+// attempt sends req to one endpoint acquired before the dispatch deadline
+func (pd *PodDispatcher) attempt(ctx context.Context, deadline time.Time, logger logr.Logger, req *workload.Request) *workload.Response {
+	var key string
+	var ep *podEndpoint
+	dispatchCtx, cancel := context.WithDeadline(ctx, deadline)
+	if pd.flavored() {
+		key, ep = pd.dispatchFlavored(dispatchCtx, req)
+	} else {
+		key, ep = pd.dispatch(dispatchCtx, req)
+	}
+	cancel()
+	if ep == nil {
+		logger.V(1).Info("[WARN] Timeout dispatching request", "req", req.ID)
+		return pd.dispatchFailed(req)
+	}
+	req.Hops.Acquired(key)
+	pd.queue.leave(req)
+	atomic.AddInt64(&pd.nDispatched, 1)
+	if ep.remote {
+		atomic.AddInt64(&pd.nCrossZone, 1)
+	}
+	if ep.flavor != nil {
+		atomic.AddInt64(&ep.flavor.nDispatched, 1)
+	}
+	ctx, cancel = context.WithTimeout(ctx, pd.execTimeoutFor(req))
 	defer cancel()
-	res := executor.Execute(ctx, req)
-	pd.tokens.In() <- key
-	pd.resChan <- res
+	ep.acquire()
+	res := ep.executor.Execute(ctx, req)
+	res.Endpoint = key
+	if res.Status == workload.FAIL_TIMEOUT {
+		atomic.AddInt64(&pd.nExecTimeout, 1)
+	}
+	if removed := ep.done(); removed && res.Status != workload.SUCCESS {
+		atomic.AddInt64(&pd.nLost, 1)
+	}
+	pd.served(ep)
+	pd.release(key, ep)
+	if pd.evictor.observe(key, res.Status) {
+		pd.evict(key)
+	}
+	return res
 }
 
 func (pd *PodDispatcher) Reconcile(ctx context.Context, readyPods []*corev1.Pod) error {
 	logger := pd.logger
 
 	endpoints := make(map[string]string)
+	nodes := make(map[string]string)
+	flavors := make(map[string]*flavor)
+	draining := make(map[string]bool)
+	podConcurrency := make(map[string]int)
+	// ready endpoints including evicted ones, see evict.go
+	present := make(map[string]string)
+	now := time.Now()
 	for _, pod := range readyPods {
-		key, ep := podEndpointKeyFunc(pod)
+		port, err := pd.portOf(pod)
+		if err != nil {
+			logger.V(1).Info("[WARN] Skipping pod without the configured port", "pod", pod.Name, "error", err)
+			continue
+		}
+		key, ep := podEndpointKey(pod, port)
+		present[key] = ep
+		if !pd.evictor.admit(key, pod, now) {
+			continue
+		}
 		endpoints[key] = ep
+		nodes[key] = pod.Spec.NodeName
+		draining[key] = isDraining(pod)
+		podConcurrency[key] = pd.concurrencyOf(pod)
+		if pd.flavored() {
+			flavors[key] = pd.flavorOf(pod)
+		}
 	}
 
+	pd.evictor.prune(present)
+
 	// reconcile with existing endpoins
 	// NOTE: there is actually no need to acquire read lock, because we are the only writer to endpoins
 	add, del := func() (add, del []string) {
@@ -131,27 +566,55 @@ func (pd *PodDispatcher) Reconcile(ctx context.Context, readyPods []*corev1.Pod)
 		go func(key string) {
 			defer wg.Done()
 			ep := endpoints[key]
-			executor, err := backend.NewBackend(ep)
+			concurrency, speedUp := pd.concurrency, 1.
+			if f := flavors[key]; f != nil {
+				concurrency, speedUp = f.Concurrency, f.SpeedUp
+			}
+			if c := podConcurrency[key]; c > 0 {
+				concurrency = c
+			}
+			executor, err := backend.NewScaledBackend(ep, nodes[key], speedUp)
 			if err != nil {
 				errs <- fmt.Errorf("failed to start backend: %v", err)
 				return
 			}
-			pd.endpoints.Set(key, executor)
-			for i := 0; i < podServiceConcurrency; i++ {
-				pd.tokens.In() <- key
+			endpoint := &podEndpoint{executor: executor, flavor: flavors[key], added: time.Now()}
+			if pd.zoneAware() && endpoint.flavor == nil {
+				endpoint.zone = pd.zoneOf(ctx, nodes[key])
+				endpoint.remote = endpoint.zone != pd.zone
 			}
+			endpoint.draining = draining[key]
+			pd.endpoints.Set(key, endpoint)
+			pd.rampUp(ctx, key, endpoint, concurrency)
 		}(key)
 	}
 
+	// stop issuing requests to draining endpoints
+	for key, isDraining := range draining {
+		if !isDraining {
+			continue
+		}
+		if endpoint, ok := pd.endpoints.Get(key); ok && endpoint.drain() {
+			atomic.AddInt64(&pd.nDrained, 1)
+			logger.V(1).Info("Draining endpoint", "endpoint", key)
+		}
+	}
+
 	// remove stale endpoints
 	for _, key := range del {
-		if executor, _ := pd.endpoints.Del(key); executor != nil {
-			go executor.Close()
+		if endpoint, _ := pd.endpoints.Del(key); endpoint != nil {
+			endpoint.retire()
+			pd.retain(endpoint)
 		}
 	}
 
 	// wait for all adds to finish
 	wg.Wait()
+	pd.activator.update(pd.Endpoints())
+	if len(add) > 0 || len(del) > 0 {
+		pd.capacity.poke()
+		pd.burst.update()
+	}
 	close(errs)
 	errList := []error{}
 	for err := range errs {
@@ -162,13 +625,63 @@ func (pd *PodDispatcher) Reconcile(ctx context.Context, readyPods []*corev1.Pod)
 
 func (pd *PodDispatcher) Run(ctx context.Context) {
 	logger := klog.FromContext(ctx).WithValues("target", pd.target)
-	logger.V(1).Info("Starting pod dispatcher")
+	logger.V(1).Info("Starting pod dispatcher", "zone", pd.zone, "spillOver", pd.spillOver, "slowStart", pd.slowStart, "ramp", pd.ramp, "policy", pd.policy, "concurrency", pd.concurrency, "flavors", len(pd.flavors))
 	pd.logger = logger
+	pd.scheduler.start(ctx, func(req *workload.Request) {
+		pd.Dispatch(ctx, logger, req)
+	}, func(req *workload.Request) {
+		logger.V(1).Info("[WARN] Dispatcher stopped before dispatching request", "req", req.ID)
+		pd.resChan <- pd.dispatchFailed(req)
+	})
 	for {
 		select {
 		case req := <-pd.reqChan:
-			go pd.Dispatch(ctx, logger, req)
+			pd.scheduler.schedule(ctx, req)
 		case <-ctx.Done():
+			pd.scheduler.stop()
+			if pd.zoneAware() {
+				dispatched, crossZone := pd.CrossZoneStats()
+				logger.V(1).Info("Stopping pod dispatcher", "dispatched", dispatched, "crossZone", crossZone)
+			}
+			if pd.flavored() {
+				logger.V(1).Info("Stopping pod dispatcher", "flavors", pd.FlavorStats())
+			}
+			if pd.slowStart > 0 {
+				toWarming, swapped := pd.SlowStartStats()
+				logger.V(1).Info("Stopping pod dispatcher", "toWarming", toWarming, "swapped", swapped)
+			}
+			if pd.policy == PolicyLeastOutstanding {
+				logger.V(1).Info("Stopping pod dispatcher", "rebalanced", pd.RebalanceStats())
+			}
+			if pd.policy == PolicyColdAware {
+				stats := pd.ColdStartStats()
+				logger.V(1).Info("Stopping pod dispatcher", "toCold", stats.ToCold, "diverted", stats.Diverted, "warmed", stats.Warmed, "meanWarmUp", stats.MeanWarmUp)
+			}
+			if pd.affinity != nil {
+				hit, miss := pd.AffinityStats()
+				logger.V(1).Info("Stopping pod dispatcher", "affinityHit", hit, "affinityMiss", miss)
+			}
+			if pd.activator != nil {
+				stats := pd.ActivatorStats()
+				logger.V(1).Info("Stopping pod dispatcher", "parked", stats.Parked, "released", stats.Released, "meanHold", stats.MeanHold, "maxHold", stats.MaxHold)
+			}
+			if pd.burst != nil {
+				stats := pd.BurstStats()
+				logger.V(1).Info("Stopping pod dispatcher", "proxied", stats.Proxied, "served", stats.Served, "toProxy", stats.ToProxy)
+			}
+			if pd.capacity != nil {
+				queued, shed := pd.CapacityStats()
+				logger.V(1).Info("Stopping pod dispatcher", "queued", queued, "shed", shed)
+			}
+			if drained, lost := pd.DrainStats(); drained > 0 || lost > 0 {
+				logger.V(1).Info("Stopping pod dispatcher", "drained", drained, "lost", lost)
+			}
+			if pd.smoother != nil {
+				stats := pd.SmoothingStats()
+				logger.V(1).Info("Stopping pod dispatcher", "smoothed", stats.Admitted, "meanWait", stats.MeanWait, "maxWait", stats.MaxWait)
+			}
+			stats := pd.SchedulingStats()
+			logger.V(1).Info("Stopping pod dispatcher", "workers", stats.Workers, "scheduled", stats.Scheduled, "meanPickUp", stats.MeanWait, "maxPickUp", stats.MaxWait, "maxQueue", stats.MaxQueue, "maxBusy", stats.MaxBusy, "blocked", stats.Blocked, "failed", stats.Failed)
 			return
 		}
 	}
@@ -0,0 +1,116 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"golang.design/x/chann"
+)
+
+const (
+	// endpoints are used in the order their tokens are released
+	PolicyFIFO = "fifo"
+	// the endpoint with the fewest in-flight requests among those with a free token
+	PolicyLeastOutstanding = "least-outstanding"
+	// fifo, but cold endpoints, i.e., those yet to complete warmUpRequests requests, are avoided while busy
+	PolicyColdAware = "cold-aware"
+)
+
+func validPolicy(policy string) error {
+	switch policy {
+	case "", PolicyFIFO, PolicyLeastOutstanding, PolicyColdAware:
+		return nil
+	default:
+		return fmt.Errorf("unknown dispatch policy %q, expected %q, %q or %q", policy, PolicyFIFO, PolicyLeastOutstanding, PolicyColdAware)
+	}
+}
+
+func (ep *podEndpoint) outstanding() int {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.inFlight
+}
+
+// better returns true if a should serve the next request rather than b:
+// warm endpoints come first during slow start, then idle or warm ones under the cold-aware policy,
+// then the least outstanding if the policy asks for it
+func (pd *PodDispatcher) better(a, b *podEndpoint) bool {
+	if wa, wb := pd.warming(a), pd.warming(b); wa != wb {
+		return !wa
+	}
+	if ca, cb := pd.avoidCold(a), pd.avoidCold(b); ca != cb {
+		return !ca
+	}
+	return pd.policy == PolicyLeastOutstanding && a.outstanding() < b.outstanding()
+}
+
+// ideal returns true if no other endpoint can be better than ep
+func (pd *PodDispatcher) ideal(ep *podEndpoint) bool {
+	if pd.warming(ep) || pd.avoidCold(ep) {
+		return false
+	}
+	return pd.policy != PolicyLeastOutstanding || ep.outstanding() == 0
+}
+
+// pick swaps the drawn token for the best token already queued in the same channel, per affinity, slow start and the dispatch policy.
+// Only the queued tokens are considered, so the request never waits for a better endpoint.
+func (pd *PodDispatcher) pick(tokens *chann.Chann[string], key string, ep *podEndpoint, preferred string) (string, *podEndpoint) {
+	bestKey, best := key, ep
+	var skipped []string
+	defer func() {
+		for _, k := range skipped {
+			if e, ok := pd.lookup(k); ok {
+				pd.release(k, e)
+			}
+		}
+	}()
+	ideal := func() bool {
+		if preferred != "" {
+			return bestKey == preferred
+		}
+		return pd.ideal(best)
+	}
+scan:
+	for n := tokens.Len(); n > 0 && !ideal(); n-- {
+		var next string
+		select {
+		case next = <-tokens.Out():
+		default:
+			break scan
+		}
+		nextEp, ok := pd.lookup(next)
+		if !ok {
+			continue
+		}
+		if next == preferred || pd.better(nextEp, best) {
+			skipped = append(skipped, bestKey)
+			bestKey, best = next, nextEp
+		} else {
+			skipped = append(skipped, next)
+		}
+	}
+	if bestKey != key {
+		switch {
+		case bestKey == preferred:
+			// counted by bind
+		case pd.warming(ep) && !pd.warming(best):
+			atomic.AddInt64(&pd.nSwapped, 1)
+		case pd.avoidCold(ep) && !pd.avoidCold(best):
+			atomic.AddInt64(&pd.nDiverted, 1)
+		default:
+			atomic.AddInt64(&pd.nRebalanced, 1)
+		}
+	}
+	if pd.warming(best) {
+		atomic.AddInt64(&pd.nToWarming, 1)
+	}
+	if pd.cold(best) {
+		atomic.AddInt64(&pd.nToCold, 1)
+	}
+	return bestKey, best
+}
+
+// returns the number of requests diverted to a less loaded endpoint by the least-outstanding policy
+func (pd *PodDispatcher) RebalanceStats() int64 {
+	return atomic.LoadInt64(&pd.nRebalanced)
+}
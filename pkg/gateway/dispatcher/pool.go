@@ -0,0 +1,174 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.design/x/chann"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// dispatchScheduler starts the dispatch of each request of a target, on a goroutine of its own
+// or on one of a bounded pool of workers, and records how long requests wait to be picked up
+// so that both modes can be compared.
+// A pooled request holds its worker while it waits for an endpoint and while it executes,
+// so a pool smaller than the tokens of the target caps its throughput.
+// With a bound, scheduling blocks while that many requests are taken, so the requests back up in the relay buffer.
+// Requests that cannot be dispatched before the dispatcher stops fail, so each still gets a response
+type dispatchScheduler struct {
+	workers int
+	// one per request being dispatched or waiting for a worker, nil without a bound
+	slots chan struct{}
+	// requests waiting for a free worker, nil without a pool
+	queue    *chann.Chann[scheduledRequest]
+	dispatch func(req *workload.Request)
+	fail     func(req *workload.Request)
+
+	mu         sync.Mutex
+	nScheduled int64
+	total      time.Duration
+	max        time.Duration
+	maxQueue   int
+	// requests being dispatched, i.e., the goroutines held, and the peak
+	busy    int
+	maxBusy int
+	// requests that waited for a slot under the bound
+	nBlocked int64
+	// requests failed as the dispatcher stopped before they were dispatched
+	nFailed int64
+}
+
+type scheduledRequest struct {
+	req *workload.Request
+	at  time.Time
+}
+
+func newDispatchScheduler(workers, bound int) *dispatchScheduler {
+	s := &dispatchScheduler{workers: workers}
+	if workers > 0 {
+		s.queue = chann.New[scheduledRequest]()
+	}
+	if bound > 0 {
+		s.slots = make(chan struct{}, bound)
+	}
+	return s
+}
+
+// start spawns the workers of the pool if any, once ctx expires they fail the requests left in the queue
+// and exit when it is closed by stop
+func (s *dispatchScheduler) start(ctx context.Context, dispatch func(req *workload.Request), fail func(req *workload.Request)) {
+	s.dispatch = dispatch
+	s.fail = fail
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for sr := range s.queue.Out() {
+				if ctx.Err() != nil {
+					s.drop(sr)
+					continue
+				}
+				s.run(sr)
+			}
+		}()
+	}
+}
+
+// stop closes the queue, nothing must be scheduled after
+func (s *dispatchScheduler) stop() {
+	if s.queue != nil {
+		s.queue.Close()
+	}
+}
+
+// schedule waits for a slot under the bound, and fails req if ctx expires first
+func (s *dispatchScheduler) schedule(ctx context.Context, req *workload.Request) {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			s.mu.Lock()
+			s.nBlocked++
+			s.mu.Unlock()
+			select {
+			case s.slots <- struct{}{}:
+			case <-ctx.Done():
+				s.drop(scheduledRequest{req: req})
+				return
+			}
+		}
+	}
+	sr := scheduledRequest{req: req, at: time.Now()}
+	if s.queue == nil {
+		go s.run(sr)
+		return
+	}
+	s.queue.In() <- sr
+	if depth := s.queue.Len(); depth > 0 {
+		s.mu.Lock()
+		s.maxQueue = max(s.maxQueue, depth)
+		s.mu.Unlock()
+	}
+}
+
+// drop fails a request that will not be dispatched, releasing its slot if it took one
+func (s *dispatchScheduler) drop(sr scheduledRequest) {
+	s.mu.Lock()
+	s.nFailed++
+	s.mu.Unlock()
+	s.fail(sr.req)
+	if s.slots != nil && !sr.at.IsZero() {
+		<-s.slots
+	}
+}
+
+func (s *dispatchScheduler) run(sr scheduledRequest) {
+	waited := time.Since(sr.at)
+	s.mu.Lock()
+	s.nScheduled++
+	s.total += waited
+	s.max = max(s.max, waited)
+	s.busy++
+	s.maxBusy = max(s.maxBusy, s.busy)
+	s.mu.Unlock()
+	s.dispatch(sr.req)
+	s.mu.Lock()
+	s.busy--
+	s.mu.Unlock()
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// SchedulingStats is the delay between reading a request and starting its dispatch,
+// i.e., goroutine start-up without a pool, and the wait for a free worker with one
+type SchedulingStats struct {
+	// 0 without a pool
+	Workers   int
+	Scheduled int64
+	MeanWait  time.Duration
+	MaxWait   time.Duration
+	// peak requests waiting for a worker
+	MaxQueue int
+	// peak requests dispatched at once, i.e., goroutines held by the dispatcher
+	MaxBusy int
+	// requests that waited under maxDispatching, i.e., were left in the relay buffer
+	Blocked int64
+	// requests failed as the dispatcher stopped before they were dispatched
+	Failed int64
+}
+
+func (s *dispatchScheduler) stats() SchedulingStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SchedulingStats{Workers: s.workers, Scheduled: s.nScheduled, MaxWait: s.max, MaxQueue: s.maxQueue, MaxBusy: s.maxBusy, Blocked: s.nBlocked, Failed: s.nFailed}
+	if s.nScheduled > 0 {
+		stats.MeanWait = s.total / time.Duration(s.nScheduled)
+	}
+	return stats
+}
+
+func (pd *PodDispatcher) SchedulingStats() SchedulingStats {
+	return pd.scheduler.stats()
+}
@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload/handler"
+)
+
+// the port of pods without a declared container port, i.e., that of the workload handler
+var defaultWorkloadPort = strings.TrimPrefix(handler.WorkloadServicePort, ":")
+
+// portOf resolves the port requests are sent to on pod. A configured port number is used as is,
+// a configured name must match a TCP container port of the pod; otherwise the first TCP container port is used,
+// or the workload handler port if the pod declares none
+func (pd *PodDispatcher) portOf(pod *corev1.Pod) (string, error) {
+	if pd.port != "" {
+		if _, err := strconv.Atoi(pd.port); err == nil {
+			return pd.port, nil
+		}
+	}
+	for i := range pod.Spec.Containers {
+		for _, port := range pod.Spec.Containers[i].Ports {
+			if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+				continue
+			}
+			if pd.port == "" || port.Name == pd.port {
+				return strconv.Itoa(int(port.ContainerPort)), nil
+			}
+		}
+	}
+	if pd.port != "" {
+		return "", fmt.Errorf("no container port named %q", pd.port)
+	}
+	return defaultWorkloadPort, nil
+}
+
+// validPort accepts an empty port, a port number, or a port name as validated by Kubernetes
+func validPort(port string) error {
+	if port == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(port); err == nil {
+		if n <= 0 || n > 65535 {
+			return fmt.Errorf("port must be in [1, 65535], got %v", n)
+		}
+		return nil
+	}
+	if len(port) > 15 || strings.Trim(port, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		return fmt.Errorf("invalid port name %q, expect at most 15 lowercase alphanumerics or '-'", port)
+	}
+	return nil
+}
+
+// NumericPorts is false if any target is configured with a port name, which only the pod spec can resolve
+func (cfg *PodDispatcherConfig) NumericPorts() bool {
+	if cfg == nil {
+		return true
+	}
+	numeric := func(port string) bool {
+		_, err := strconv.Atoi(port)
+		return port == "" || err == nil
+	}
+	if !numeric(cfg.Port) {
+		return false
+	}
+	for _, target := range cfg.Targets {
+		if target != nil && target.Port != nil && !numeric(*target.Port) {
+			return false
+		}
+	}
+	return true
+}
+
+// NOTE: we index by both pod name and ip:port to handle pod restarts and/or ip reuse for different pods
+func podEndpointKey(pod *corev1.Pod, port string) (key string, ep string) {
+	ep = net.JoinHostPort(pod.Status.PodIP, port)
+	key = fmt.Sprintf("%s@%s", pod.Name, ep)
+	return
+}
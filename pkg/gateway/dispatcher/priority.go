@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// priorityGate holds requests back from the tokens while requests of a higher rank wait for one,
+// so that free endpoints go to the highest rank first and to the oldest request within a rank.
+// The relay hands requests over as they arrive, so the wait for a token is where a queue forms.
+type priorityGate struct {
+	// rank requests by their priority, and batch requests below interactive ones of the same priority
+	prioritized bool
+	batchLast   bool
+	mu          sync.Mutex
+	// requests waiting for a token by priority
+	waiting map[int]int
+	// closed and replaced whenever a request stops waiting
+	changed chan struct{}
+	// requests held back at least once, and tokens handed back to a higher priority
+	nHeld    int64
+	nYielded int64
+}
+
+func newPriorityGate(prioritized, batchLast bool) *priorityGate {
+	if !prioritized && !batchLast {
+		return nil
+	}
+	return &priorityGate{prioritized: prioritized, batchLast: batchLast, waiting: make(map[int]int), changed: make(chan struct{})}
+}
+
+// rank orders req at the gate, higher goes first
+func (g *priorityGate) rank(req *workload.Request) int {
+	if g == nil {
+		return 0
+	}
+	rank := 0
+	if g.prioritized {
+		rank = 2 * req.Priority
+	}
+	if !g.batchLast || workload.ClassOf(req) != workload.ClassBatch {
+		rank++
+	}
+	return rank
+}
+
+func (g *priorityGate) enter(priority int) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.waiting[priority]++
+}
+
+func (g *priorityGate) leave(priority int) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.waiting[priority]--; g.waiting[priority] == 0 {
+		delete(g.waiting, priority)
+	}
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// outranked returns true if a request of a higher priority is waiting, must hold mu
+func (g *priorityGate) outranked(priority int) bool {
+	for p := range g.waiting {
+		if p > priority {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks while requests of a higher priority wait for a token, returns false if ctx expires first
+func (g *priorityGate) wait(ctx context.Context, priority int) bool {
+	if g == nil {
+		return true
+	}
+	held := false
+	for {
+		g.mu.Lock()
+		if !g.outranked(priority) {
+			g.mu.Unlock()
+			return true
+		}
+		changed := g.changed
+		g.mu.Unlock()
+		if !held {
+			held = true
+			atomic.AddInt64(&g.nHeld, 1)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// yield returns true if the token just taken should go to a higher-priority request,
+// which started waiting after the gate let this one through
+func (g *priorityGate) yield(priority int) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.outranked(priority) {
+		return false
+	}
+	atomic.AddInt64(&g.nYielded, 1)
+	return true
+}
+
+// returns the requests held back for a higher rank, and the tokens they handed over after taking them
+func (pd *PodDispatcher) PriorityStats() (held int64, yielded int64) {
+	if pd.priority == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&pd.priority.nHeld), atomic.LoadInt64(&pd.priority.nYielded)
+}
@@ -0,0 +1,48 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// waitQueue tracks the requests waiting for an endpoint, from the gateway receiving them to acquiring a token
+type waitQueue struct {
+	mu      sync.Mutex
+	waiting map[*workload.Request]time.Time
+}
+
+func newWaitQueue() *waitQueue {
+	return &waitQueue{waiting: make(map[*workload.Request]time.Time)}
+}
+
+func (q *waitQueue) enter(req *workload.Request) {
+	since := req.GatewayRecvTS
+	if since.IsZero() {
+		since = time.Now()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waiting[req] = since
+}
+
+// leave is idempotent, so both acquiring an endpoint and giving up can call it
+func (q *waitQueue) leave(req *workload.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.waiting, req)
+}
+
+// Queued returns the number of requests waiting for an endpoint and how long the oldest of them has waited
+func (pd *PodDispatcher) Queued(now time.Time) (int, time.Duration) {
+	q := pd.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest time.Duration
+	for _, since := range q.waiting {
+		oldest = max(oldest, now.Sub(since))
+	}
+	return len(q.waiting), oldest
+}
@@ -0,0 +1,36 @@
+package dispatcher
+
+import (
+	"context"
+	"time"
+)
+
+// rampUp releases the concurrency tokens of a new endpoint one at a time, evenly over the ramp window,
+// so a cold pod is not hit by its full concurrency at once.
+// Stops early if the endpoint is removed or draining.
+func (pd *PodDispatcher) rampUp(ctx context.Context, key string, ep *podEndpoint, concurrency int) {
+	if pd.ramp <= 0 || concurrency <= 1 {
+		for i := 0; i < concurrency; i++ {
+			pd.release(key, ep)
+		}
+		return
+	}
+	pd.release(key, ep)
+	interval := pd.ramp / time.Duration(concurrency-1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 1; i < concurrency; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, ok := pd.lookup(key); !ok {
+				return
+			}
+			pd.release(key, ep)
+		}
+		pd.logger.V(2).Info("Ramped up endpoint", "endpoint", key, "concurrency", concurrency)
+	}()
+}
@@ -0,0 +1,88 @@
+package dispatcher
+
+import (
+	"context"
+	"time"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// Dispatcher takes the requests of a target from its relay and writes back their responses until ctx is done
+type Dispatcher interface {
+	Run(ctx context.Context)
+}
+
+// Spec is what a gateway knows about a target when creating its dispatcher; each factory reads the fields it needs
+type Spec struct {
+	Target  string
+	Timeout time.Duration
+	ReqChan <-chan *workload.Request
+	ResChan chan<- *workload.Response
+	// where to send the requests: the URL of a knative service, the IP of a revision, or the Dirigent data plane
+	Address string
+	// the function name in Dirigent
+	Function string
+	// the config of a pod dispatcher, whose endpoints are fed by the k8s gateway
+	Config *PodDispatcherConfig
+}
+
+type Factory func(ctx context.Context, spec *Spec) (Dispatcher, error)
+
+// names of the built-in dispatchers; pod dispatchers are only of use to the k8s gateway, which feeds them endpoints
+const (
+	Pod        = "pod"
+	KnService  = "ksvc"
+	KnRevision = "revision"
+	Dirigent   = "dirigent"
+)
+
+var registry = benchutil.NewRegistry[Factory]("dispatcher")
+
+func init() {
+	Register(Pod, func(ctx context.Context, spec *Spec) (Dispatcher, error) {
+		return asDispatcher(NewPodDispatcher(ctx, spec.Target, spec.Timeout, spec.Config, spec.ReqChan, spec.ResChan))
+	})
+	Register(KnService, func(ctx context.Context, spec *Spec) (Dispatcher, error) {
+		return asDispatcher(NewKnServiceDispatcher(ctx, spec.Target, spec.Timeout, spec.ReqChan, spec.ResChan, spec.Address))
+	})
+	Register(KnRevision, func(ctx context.Context, spec *Spec) (Dispatcher, error) {
+		return asDispatcher(NewKnRevisionDispatcher(ctx, spec.Target, spec.Timeout, spec.ReqChan, spec.ResChan, spec.Address))
+	})
+	Register(Dirigent, func(ctx context.Context, spec *Spec) (Dispatcher, error) {
+		return asDispatcher(NewDirigentDispatcher(ctx, spec.Target, spec.Timeout, spec.ReqChan, spec.ResChan, spec.Address, spec.Function))
+	})
+}
+
+// asDispatcher keeps a failed constructor from returning a typed nil as a non-nil Dispatcher
+func asDispatcher[D Dispatcher](d D, err error) (Dispatcher, error) {
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Register makes a dispatch strategy available to the gateways by name, e.g., from the init of its package;
+// it panics if the name is taken
+func Register(name string, factory Factory) {
+	registry.Register(name, factory)
+}
+
+// New creates a dispatcher of the registered name
+func New(ctx context.Context, name string, spec *Spec) (Dispatcher, error) {
+	factory, err := registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(ctx, spec)
+}
+
+func IsRegistered(name string) bool {
+	return registry.IsRegistered(name)
+}
+
+// Registered returns the names of the registered dispatchers, sorted
+func Registered() []string {
+	return registry.Names()
+}
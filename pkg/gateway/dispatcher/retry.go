@@ -0,0 +1,117 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// statuses retried if RetryOn is empty: the endpoint was unreachable, so the request never ran
+var defaultRetryOn = []workload.ResponseStatus{workload.FAIL_CONNECT, workload.FAIL_SEND}
+
+type RetryConfig struct {
+	// total attempts including the first one, retries are disabled if at most 1
+	MaxAttempts int `yaml:"maxAttempts"`
+	// backoff before the first retry, doubled for every further retry
+	BackoffMilliSec int `yaml:"backoffMilliSec"`
+	// caps the backoff if positive
+	MaxBackoffMilliSec int `yaml:"maxBackoffMilliSec"`
+	// response statuses to retry on, e.g., FAIL_CONNECT, defaults to FAIL_CONNECT and FAIL_SEND
+	RetryOn []string `yaml:"retryOn"`
+}
+
+func (cfg *RetryConfig) validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxAttempts < 0 || cfg.BackoffMilliSec < 0 || cfg.MaxBackoffMilliSec < 0 {
+		return fmt.Errorf("retry: maxAttempts, backoffMilliSec and maxBackoffMilliSec cannot be negative")
+	}
+	for _, s := range cfg.RetryOn {
+		status, ok := workload.ParseResponseStatus(s)
+		if !ok {
+			return fmt.Errorf("retry: unknown status %q", s)
+		}
+		if status == workload.SUCCESS {
+			return fmt.Errorf("retry: cannot retry on %v", s)
+		}
+	}
+	return nil
+}
+
+// retryPolicy re-dispatches requests that failed on an endpoint, possibly to another one.
+// The request keeps its in-flight slot across attempts, and the dispatch timeout applies to each of them.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retryOn     map[workload.ResponseStatus]bool
+	nRetried    int64
+	nRecovered  int64
+}
+
+// nil if retries are disabled
+func newRetryPolicy(cfg *RetryConfig) *retryPolicy {
+	if cfg == nil || cfg.MaxAttempts <= 1 {
+		return nil
+	}
+	p := &retryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     time.Duration(cfg.BackoffMilliSec) * time.Millisecond,
+		maxBackoff:  time.Duration(cfg.MaxBackoffMilliSec) * time.Millisecond,
+		retryOn:     make(map[workload.ResponseStatus]bool),
+	}
+	for _, s := range cfg.RetryOn {
+		// validated
+		status, _ := workload.ParseResponseStatus(s)
+		p.retryOn[status] = true
+	}
+	if len(p.retryOn) == 0 {
+		for _, status := range defaultRetryOn {
+			p.retryOn[status] = true
+		}
+	}
+	return p
+}
+
+// retry returns true if the response of the given attempt (from 1) should be retried,
+// after waiting for the backoff; false if ctx is done meanwhile
+func (p *retryPolicy) retry(ctx context.Context, attempt int, res *workload.Response) bool {
+	if p == nil || attempt >= p.maxAttempts || !p.retryOn[res.Status] {
+		return false
+	}
+	backoff := p.backoff << (attempt - 1)
+	if p.maxBackoff > 0 && (backoff > p.maxBackoff || backoff < 0) {
+		backoff = p.maxBackoff
+	}
+	if backoff > 0 {
+		timer := time.NewTimer(backoff)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+	}
+	atomic.AddInt64(&p.nRetried, 1)
+	return true
+}
+
+// records the final response of a request that was retried at least once
+func (p *retryPolicy) done(attempts int, res *workload.Response) {
+	if p != nil && attempts > 1 && res.Status == workload.SUCCESS {
+		atomic.AddInt64(&p.nRecovered, 1)
+	}
+}
+
+// returns the number of retries and the requests that succeeded after a retry
+func (pd *PodDispatcher) RetryStats() (retried int64, recovered int64) {
+	if pd.retry == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&pd.retry.nRetried), atomic.LoadInt64(&pd.retry.nRecovered)
+}
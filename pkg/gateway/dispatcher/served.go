@@ -0,0 +1,59 @@
+package dispatcher
+
+import (
+	"math"
+)
+
+// ServedStats is the distribution of the requests served per endpoint, including removed endpoints
+type ServedStats struct {
+	Endpoints int
+	Min       int64
+	Max       int64
+	Mean      float64
+	StdDev    float64
+}
+
+// keep removed endpoints for their served counts
+func (pd *PodDispatcher) retain(ep *podEndpoint) {
+	pd.retiredMu.Lock()
+	defer pd.retiredMu.Unlock()
+	pd.retired = append(pd.retired, ep)
+}
+
+func (pd *PodDispatcher) ServedStats() ServedStats {
+	var counts []int64
+	count := func(ep *podEndpoint) {
+		ep.mu.Lock()
+		defer ep.mu.Unlock()
+		counts = append(counts, int64(ep.served))
+	}
+	pd.endpoints.RLock()
+	for _, ep := range pd.endpoints.Inner() {
+		count(ep)
+	}
+	pd.endpoints.RUnlock()
+	pd.retiredMu.Lock()
+	for _, ep := range pd.retired {
+		count(ep)
+	}
+	pd.retiredMu.Unlock()
+
+	stats := ServedStats{Endpoints: len(counts)}
+	if len(counts) == 0 {
+		return stats
+	}
+	stats.Min, stats.Max = counts[0], counts[0]
+	var sum float64
+	for _, n := range counts {
+		stats.Min = min(stats.Min, n)
+		stats.Max = max(stats.Max, n)
+		sum += float64(n)
+	}
+	stats.Mean = sum / float64(len(counts))
+	var variance float64
+	for _, n := range counts {
+		variance += (float64(n) - stats.Mean) * (float64(n) - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(counts)))
+	return stats
+}
@@ -0,0 +1,69 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// smoother admits requests of a target at a bounded rate, as a leaky bucket when the burst is 1.
+// Requests wait in arrival order; the induced queueing is recorded so raw and smoothed runs can be compared.
+type smoother struct {
+	limiter *rate.Limiter
+	mu      sync.Mutex
+	nWaited int64
+	total   time.Duration
+	max     time.Duration
+}
+
+func newSmoother(maxRPS float64, burst int) *smoother {
+	if maxRPS <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &smoother{limiter: rate.NewLimiter(rate.Limit(maxRPS), burst)}
+}
+
+// wait blocks until the request is admitted, returns false if ctx expires first
+func (s *smoother) wait(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+	start := time.Now()
+	if err := s.limiter.Wait(ctx); err != nil {
+		return false
+	}
+	waited := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nWaited++
+	s.total += waited
+	if waited > s.max {
+		s.max = waited
+	}
+	return true
+}
+
+// SmoothingStats is the queueing induced by rate smoothing
+type SmoothingStats struct {
+	Admitted int64
+	MeanWait time.Duration
+	MaxWait  time.Duration
+}
+
+func (s *smoother) stats() SmoothingStats {
+	if s == nil {
+		return SmoothingStats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SmoothingStats{Admitted: s.nWaited, MaxWait: s.max}
+	if s.nWaited > 0 {
+		stats.MeanWait = s.total / time.Duration(s.nWaited)
+	}
+	return stats
+}
@@ -0,0 +1,37 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// A request fails in one of two stages: FAIL_DISPATCH if no endpoint is acquired within the dispatch timeout,
+// i.e., the target lacks capacity, and FAIL_TIMEOUT if the endpoint does not respond within the execution timeout,
+// i.e., the backend is slow. The two timeouts are independent, the execution one starts when an endpoint is acquired.
+
+// execTimeoutFor returns the execution timeout of req, the configured one if any, otherwise the backend timeout
+func (pd *PodDispatcher) execTimeoutFor(req *workload.Request) time.Duration {
+	if pd.execTimeout > 0 {
+		return pd.execTimeout
+	}
+	return backend.Timeout(req)
+}
+
+// dispatchFailed is the response of a request that did not get an endpoint in time
+func (pd *PodDispatcher) dispatchFailed(req *workload.Request) *workload.Response {
+	atomic.AddInt64(&pd.nDispatchFail, 1)
+	return &workload.Response{
+		Source: req,
+		Status: workload.FAIL_DISPATCH,
+	}
+}
+
+// returns the number of attempts failed in the dispatch stage, including those shed by the in-flight cap,
+// and in the execution stage, retried attempts included
+func (pd *PodDispatcher) TimeoutStats() (dispatch int64, exec int64) {
+	return atomic.LoadInt64(&pd.nDispatchFail), atomic.LoadInt64(&pd.nExecTimeout)
+}
@@ -0,0 +1,137 @@
+package dispatcher
+
+import (
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func (cfg *PodDispatcherConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	var errs []error
+	if cfg.SpillOverMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("spillOverMilliSec cannot be negative, got %v", cfg.SpillOverMilliSec))
+	}
+	if cfg.SpillOverMilliSec > 0 && cfg.Zone == "" {
+		errs = append(errs, fmt.Errorf("spillOverMilliSec is set but zone is empty"))
+	}
+	if cfg.Zone != "" && len(cfg.Flavors) > 0 {
+		errs = append(errs, fmt.Errorf("zone preference does not apply to flavored dispatching"))
+	}
+	if cfg.Affinity && len(cfg.Flavors) > 0 {
+		errs = append(errs, fmt.Errorf("affinity does not apply to flavored dispatching"))
+	}
+	if cfg.Priority && len(cfg.Flavors) > 0 {
+		errs = append(errs, fmt.Errorf("priority does not apply to flavored dispatching"))
+	}
+	if cfg.BatchLast && len(cfg.Flavors) > 0 {
+		errs = append(errs, fmt.Errorf("batchLast does not apply to flavored dispatching"))
+	}
+	if cfg.DeadlineFactor < 0 {
+		errs = append(errs, fmt.Errorf("deadlineFactor cannot be negative, got %v", cfg.DeadlineFactor))
+	}
+	if cfg.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("concurrency cannot be negative, got %v", cfg.Concurrency))
+	}
+	if cfg.SlowStartMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("slowStartMilliSec cannot be negative, got %v", cfg.SlowStartMilliSec))
+	}
+	if cfg.RampMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("rampMilliSec cannot be negative, got %v", cfg.RampMilliSec))
+	}
+	if cfg.ActivatorHoldMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("activatorHoldMilliSec cannot be negative, got %v", cfg.ActivatorHoldMilliSec))
+	}
+	if cfg.TargetBurstCapacity < 0 && cfg.TargetBurstCapacity != -1 {
+		errs = append(errs, fmt.Errorf("targetBurstCapacity must be non-negative or -1, got %v", cfg.TargetBurstCapacity))
+	}
+	if cfg.TargetBurstCapacity != 0 && cfg.ActivatorHoldMilliSec <= 0 {
+		errs = append(errs, fmt.Errorf("targetBurstCapacity is set but activatorHoldMilliSec is not"))
+	}
+	if cfg.WarmUpRequests < 0 {
+		errs = append(errs, fmt.Errorf("warmUpRequests cannot be negative, got %v", cfg.WarmUpRequests))
+	}
+	if cfg.WarmUpRequests > 0 && cfg.Policy != PolicyColdAware {
+		errs = append(errs, fmt.Errorf("warmUpRequests is set but policy is not %q", PolicyColdAware))
+	}
+	if cfg.MaxInFlight < 0 || cfg.ContainerConcurrency < 0 || cfg.MaxQueued < 0 {
+		errs = append(errs, fmt.Errorf("maxInFlight, containerConcurrency and maxQueued cannot be negative"))
+	}
+	if err := validPolicy(cfg.Policy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validOverflowPolicy(cfg.OverflowPolicy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Eviction.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DispatchTimeoutMilliSec < 0 || cfg.ExecTimeoutMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("dispatchTimeoutMilliSec and execTimeoutMilliSec cannot be negative"))
+	}
+	if err := validPort(cfg.Port); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Workers < 0 || cfg.MaxDispatching < 0 {
+		errs = append(errs, fmt.Errorf("workers and maxDispatching cannot be negative"))
+	}
+	if cfg.MaxRPS < 0 || cfg.Burst < 0 {
+		errs = append(errs, fmt.Errorf("maxRPS and burst cannot be negative"))
+	}
+	for key, target := range cfg.Targets {
+		if target == nil {
+			continue
+		}
+		if (target.MaxRPS != nil && *target.MaxRPS < 0) || (target.Burst != nil && *target.Burst < 0) {
+			errs = append(errs, fmt.Errorf("targets[%v]: maxRPS and burst cannot be negative", key))
+		}
+		if target.Concurrency != nil && *target.Concurrency < 0 {
+			errs = append(errs, fmt.Errorf("targets[%v]: concurrency cannot be negative", key))
+		}
+		if target.RampMilliSec != nil && *target.RampMilliSec < 0 {
+			errs = append(errs, fmt.Errorf("targets[%v]: rampMilliSec cannot be negative", key))
+		}
+		if (target.MaxInFlight != nil && *target.MaxInFlight < 0) || (target.ContainerConcurrency != nil && *target.ContainerConcurrency < 0) {
+			errs = append(errs, fmt.Errorf("targets[%v]: maxInFlight and containerConcurrency cannot be negative", key))
+		}
+		if (target.DispatchTimeoutMilliSec != nil && *target.DispatchTimeoutMilliSec < 0) || (target.ExecTimeoutMilliSec != nil && *target.ExecTimeoutMilliSec < 0) {
+			errs = append(errs, fmt.Errorf("targets[%v]: dispatchTimeoutMilliSec and execTimeoutMilliSec cannot be negative", key))
+		}
+		if tbc := target.TargetBurstCapacity; tbc != nil {
+			if *tbc < 0 && *tbc != -1 {
+				errs = append(errs, fmt.Errorf("targets[%v]: targetBurstCapacity must be non-negative or -1, got %v", key, *tbc))
+			}
+			if *tbc != 0 && cfg.ActivatorHoldMilliSec <= 0 {
+				errs = append(errs, fmt.Errorf("targets[%v]: targetBurstCapacity is set but activatorHoldMilliSec is not", key))
+			}
+		}
+		if target.Workers != nil && *target.Workers < 0 {
+			errs = append(errs, fmt.Errorf("targets[%v]: workers cannot be negative", key))
+		}
+		if target.Port != nil {
+			if err := validPort(*target.Port); err != nil {
+				errs = append(errs, fmt.Errorf("targets[%v]: %v", key, err))
+			}
+		}
+	}
+	names := make(map[string]bool)
+	for i, f := range cfg.Flavors {
+		if f == nil || f.Name == "" {
+			errs = append(errs, fmt.Errorf("flavors[%d] has no name", i))
+			continue
+		}
+		if names[f.Name] {
+			errs = append(errs, fmt.Errorf("duplicate flavor %q", f.Name))
+		}
+		names[f.Name] = true
+		if f.Concurrency < 0 || f.Cost < 0 || f.SpeedUp < 0 {
+			errs = append(errs, fmt.Errorf("flavor %q has negative concurrency, cost, or speedUp", f.Name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
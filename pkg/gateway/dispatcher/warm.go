@@ -0,0 +1,16 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// warming returns true if the endpoint was added within the slow-start window
+func (pd *PodDispatcher) warming(ep *podEndpoint) bool {
+	return pd.slowStart > 0 && time.Since(ep.added) < pd.slowStart
+}
+
+// returns the number of requests sent to warming endpoints, and those diverted to warm ones
+func (pd *PodDispatcher) SlowStartStats() (toWarming int64, swapped int64) {
+	return atomic.LoadInt64(&pd.nToWarming), atomic.LoadInt64(&pd.nSwapped)
+}
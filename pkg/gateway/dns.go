@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/gateway/dispatcher"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	defaultDNSDomain           = "cluster.local"
+	defaultDNSIntervalMilliSec = 1000
+)
+
+// dnsHost is the name of the headless Service named after the target deployment
+func (g *k8sGateway) dnsHost(key string) string {
+	domain := g.config.DNSDomain
+	if domain == "" {
+		domain = defaultDNSDomain
+	}
+	name := workload.NamespacedNameFromKey(key)
+	return fmt.Sprintf("%s.%s.svc.%s", name.Name, name.Namespace, domain)
+}
+
+// resolveEndpoints returns the ready endpoints of the headless Service of key as pods carrying only their IP,
+// which also names them: a client that does not watch the API server knows nothing else about them.
+// Configured port names cannot be resolved, see dispatcher.PodDispatcherConfig.Port
+func (g *k8sGateway) resolveEndpoints(ctx context.Context, key string) ([]*corev1.Pod, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, g.dnsHost(key))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			// a headless Service without ready endpoints has no records
+			return nil, nil
+		}
+		return nil, err
+	}
+	slices.Sort(addrs)
+	name := workload.NamespacedNameFromKey(key)
+	pods := make([]*corev1.Pod, 0, len(addrs))
+	for _, addr := range addrs {
+		pod := &corev1.Pod{}
+		pod.Namespace = name.Namespace
+		pod.Name = addr
+		pod.Status.PodIP = addr
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// pollDNS resolves the endpoints of key every interval until ctx is done, reconciling pd when they change;
+// how soon a new pod shows up depends on the TTL and the negative caching of the cluster DNS
+func (g *k8sGateway) pollDNS(ctx context.Context, key string, pd *dispatcher.PodDispatcher) {
+	interval := time.Duration(g.config.DNSIntervalMilliSec) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultDNSIntervalMilliSec * time.Millisecond
+	}
+	logger := g.logger.WithValues("target", key)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last []string
+	for {
+		pods, err := g.resolveEndpoints(ctx, key)
+		if err != nil {
+			logger.V(1).Info("[WARN] Failed to resolve endpoints", "host", g.dnsHost(key), "error", err)
+		} else {
+			ips := make([]string, 0, len(pods))
+			for _, pod := range pods {
+				ips = append(ips, pod.Status.PodIP)
+			}
+			g.propagation.observe(key, pods, time.Now())
+			if !slices.Equal(ips, last) {
+				if err := g.reconcileDispatcher(ctx, key, pd, pods); err != nil {
+					logger.Error(err, "Failed to reconcile pod dispatcher")
+				} else {
+					last = ips
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
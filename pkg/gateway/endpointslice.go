@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/backend"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	// list the pods of the target deployment and filter by readiness
+	DiscoveryPods = "pods"
+	// watch the EndpointSlices of the Service named after the target deployment, like real ingress layers;
+	// the Service must carry the labels of the deployment, which the EndpointSlice controller copies to its slices
+	DiscoveryEndpointSlices = "endpointslices"
+	// resolve the headless Service named after the target deployment, like clients that do not watch the API server;
+	// see dns.go
+	DiscoveryDNS = "dns"
+)
+
+func validDiscovery(mode string) error {
+	switch mode {
+	case "", DiscoveryPods, DiscoveryEndpointSlices, DiscoveryDNS:
+		return nil
+	default:
+		return fmt.Errorf("unknown discovery %q, expected %q, %q or %q", mode, DiscoveryPods, DiscoveryEndpointSlices, DiscoveryDNS)
+	}
+}
+
+// endpointPropagation measures how long a ready pod takes to show up as a ready endpoint in a slice or in DNS,
+// both observed by the gateway
+type endpointPropagation struct {
+	mu sync.Mutex
+	// resolved endpoints are only known by their IP, which then identifies the pods instead of their names
+	byIP bool
+	// when each pod was first observed ready, by namespace/name or namespace/IP
+	readyAt map[string]time.Time
+	// endpoints already seen per target
+	known map[string]map[string]bool
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+func newEndpointPropagation(byIP bool) *endpointPropagation {
+	return &endpointPropagation{
+		byIP:    byIP,
+		readyAt: make(map[string]time.Time),
+		known:   make(map[string]map[string]bool),
+	}
+}
+
+func (p *endpointPropagation) id(pod *corev1.Pod) string {
+	if p.byIP {
+		return pod.Namespace + "/" + pod.Status.PodIP
+	}
+	return client.ObjectKeyFromObject(pod).String()
+}
+
+func (p *endpointPropagation) podReady(pod *corev1.Pod, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := p.id(pod)
+	if _, ok := p.readyAt[name]; !ok {
+		p.readyAt[name] = now
+	}
+}
+
+// observe records the propagation of the endpoints new to the target, and forgets those gone
+func (p *endpointPropagation) observe(key string, pods []*corev1.Pod, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	known := p.known[key]
+	current := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		name := p.id(pod)
+		current[name] = true
+		if known[name] {
+			continue
+		}
+		if readyAt, ok := p.readyAt[name]; ok {
+			delay := now.Sub(readyAt)
+			p.count++
+			p.total += delay
+			p.max = max(p.max, delay)
+		}
+	}
+	for name := range known {
+		if !current[name] {
+			delete(p.readyAt, name)
+		}
+	}
+	p.known[key] = current
+}
+
+func (p *endpointPropagation) stats() (count int64, mean, maxDelay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.count == 0 {
+		return 0, 0, 0
+	}
+	return p.count, p.total / time.Duration(p.count), p.max
+}
+
+// watchPodReadiness records when pods become ready, without triggering reconciles
+func (g *k8sGateway) watchPodReadiness(ctx context.Context, mgr manager.Manager) error {
+	informer, err := mgr.GetCache().GetInformer(ctx, &corev1.Pod{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod informer: %v", err)
+	}
+	record := func(obj interface{}) {
+		pod, ok := obj.(*corev1.Pod)
+		if ok && workload.IsTraceWorkload(pod) && backend.IsPodReady(pod) {
+			g.propagation.podReady(pod, time.Now())
+		}
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    record,
+		UpdateFunc: func(_, newObj interface{}) { record(newObj) },
+	})
+	return err
+}
+
+// readyEndpoints lists the ready endpoints of the target's Service as pods, carrying what the dispatcher needs:
+// name, IP, node, and the labels and annotations of the cached pod if any
+func (g *k8sGateway) readyEndpoints(ctx context.Context, target metav1.Object) ([]*corev1.Pod, error) {
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := g.client.List(ctx, slices,
+		client.InNamespace(target.GetNamespace()),
+		client.MatchingLabels{discoveryv1.LabelServiceName: target.GetName()},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list endpoint slices: %v", err)
+	}
+	var pods []*corev1.Pod
+	seen := make(map[string]bool)
+	for i := range slices.Items {
+		slice := &slices.Items[i]
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" || len(ep.Addresses) == 0 {
+				continue
+			}
+			// the same endpoint may briefly appear in two slices
+			if seen[ep.TargetRef.Name] {
+				continue
+			}
+			seen[ep.TargetRef.Name] = true
+			pod := &corev1.Pod{}
+			if err := g.client.Get(ctx, client.ObjectKey{Namespace: target.GetNamespace(), Name: ep.TargetRef.Name}, pod); err != nil {
+				pod.Namespace = target.GetNamespace()
+				pod.Name = ep.TargetRef.Name
+			}
+			pod.Status.PodIP = ep.Addresses[0]
+			if ep.NodeName != nil {
+				pod.Spec.NodeName = *ep.NodeName
+			}
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func (g *k8sGateway) logPropagationStats() {
+	count, mean, maxDelay := g.propagation.stats()
+	g.logger.Info("Endpoint propagation", "endpoints", count, "mean", mean, "max", maxDelay)
+}
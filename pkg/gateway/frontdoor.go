@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// The front door is a gRPC service taking invocations from load generators on other machines.
+// It carries workload.Request and workload.Response as JSON with a hand-written service descriptor,
+// so both ends share the schema of the replay client without generated stubs.
+const (
+	frontDoorService = "kubedirect.bench.Gateway"
+	frontDoorInvoke  = "/" + frontDoorService + "/Invoke"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+type frontDoorServer interface {
+	invoke(ctx context.Context, req *Request) (*Response, error)
+}
+
+var frontDoorDesc = grpc.ServiceDesc{
+	ServiceName: frontDoorService,
+	HandlerType: (*frontDoorServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Invoke",
+		Handler:    invokeHandler,
+	}},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "frontdoor.go",
+}
+
+func invokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &Request{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(frontDoorServer).invoke(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: frontDoorInvoke}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(frontDoorServer).invoke(ctx, req.(*Request))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+// frontDoor relays the invocations of external clients like those of the replay client,
+// and hands their responses back to the callers waiting on them by request ID
+type frontDoor struct {
+	g        *gatewayImpl
+	mu       sync.Mutex
+	waiting  map[string]chan *Response
+	nInvoked int64
+}
+
+var _ frontDoorServer = &frontDoor{}
+
+// request IDs must be unique across the clients of a run, e.g., prefixed by the load generator:
+// the relay drops duplicates, which would leave their callers waiting until their deadline
+func (f *frontDoor) invoke(ctx context.Context, req *Request) (*Response, error) {
+	input, ok := f.g.externalInputs[req.Target]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown target %v", req.Target)
+	}
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing request ID")
+	}
+	done := make(chan *Response, 1)
+	f.mu.Lock()
+	if _, ok := f.waiting[req.ID]; ok {
+		f.mu.Unlock()
+		return nil, status.Errorf(codes.AlreadyExists, "request %v is in flight", req.ID)
+	}
+	f.waiting[req.ID] = done
+	f.mu.Unlock()
+
+	// gateway-side state does not cross the wire
+	req.Hops = nil
+	if req.ClientSendTS.IsZero() {
+		req.ClientSendTS = time.Now()
+	}
+	// the target may be finished concurrently, its requests must not be sent to any more
+	if !input.send(req) {
+		f.mu.Lock()
+		delete(f.waiting, req.ID)
+		f.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "target %v is finished", req.Target)
+	}
+	atomic.AddInt64(&f.nInvoked, 1)
+	select {
+	case res := <-done:
+		return res, nil
+	case <-ctx.Done():
+		f.mu.Lock()
+		delete(f.waiting, req.ID)
+		f.mu.Unlock()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// deliver hands a copy of res to its caller if the request came through the front door,
+// the relay calls it before the replay client can stamp the response
+func (f *frontDoor) deliver(res *Response) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	done, ok := f.waiting[res.Source.ID]
+	delete(f.waiting, res.Source.ID)
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	copied, source := *res, *res.Source
+	source.Hops = nil
+	copied.Source = &source
+	done <- &copied
+}
+
+// ServeFrontDoor accepts invocations over gRPC until ctx is done, see frontDoorDesc.
+// Their responses are also delivered to Responses, so the trace log records them
+func (g *gatewayImpl) ServeFrontDoor(ctx context.Context, addr string) error {
+	logger := klog.FromContext(ctx)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %v: %v", addr, err)
+	}
+	f := &frontDoor{g: g, waiting: make(map[string]chan *Response)}
+	g.frontDoor.Store(f)
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	server.RegisterService(&frontDoorDesc, f)
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+		logger.Info("Stopped gateway front door", "invoked", atomic.LoadInt64(&f.nInvoked))
+	}()
+	logger.Info("Serving gateway front door", "addr", addr)
+	if err := server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		return fmt.Errorf("failed to serve gateway front door: %v", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package gateway
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
@@ -24,8 +25,31 @@ func StartTracing(period int) {
 
 type Gateway interface {
 	RequestChan(target string) chan<- *Request
+	// responses of the target only, must be subscribed before Start, nil for an unknown target;
+	// closed once the target is finished and drained
 	ResponseChan(target string) <-chan *Response
+	// responses of all targets, closed by Close
+	Responses() <-chan *Response
+	// no more requests of the target will be sent, neither by the client nor through the front door
+	FinishTarget(target string)
+	// a completion per finished target once its requests in flight are answered, closed by Close
+	Completions() <-chan *Completion
 	Autoscaler() autoscaler.Autoscaler
+	// number of requests dropped because their ID was already seen
+	Duplicates() int64
+	// number of requests shed by admission control
+	Shed() int64
+	// write the per-hop timing of every Nth request to path
+	SampleHops(every int, path string) error
+	// export the hops of the sampled requests as spans to an OTLP/HTTP collector
+	ExportSpans(endpoint string) error
+	// the current shadow state
+	Snapshot() *Snapshot
+	// periodically record the shadow state, dumpable and watchable via the admin endpoint
+	StartSnapshots(ctx context.Context, interval time.Duration, capacity int)
+	ServeAdmin(ctx context.Context, addr string) error
+	// take invocations of external clients over gRPC, see NewRemoteGateway
+	ServeFrontDoor(ctx context.Context, addr string) error
 	SetUpWithManager(ctx context.Context, mgr manager.Manager) error
 	Start(ctx context.Context) error
 	Close()
@@ -34,18 +58,48 @@ type Gateway interface {
 type gatewayImpl struct {
 	internalInputBuffers  map[string]RequestBuffer
 	internalOutputBuffers map[string]ResponseBuffer
-	externalInputs        map[string]RequestBuffer
+	externalInputs        map[string]*onceBuffer[*Request]
 	externalOutput        ResponseBuffer // fan-in for all keys
-	onReqIn               func(req *Request)
-	onReqOut              func(res *Response)
+	// copies of the responses of the keys subscribed via ResponseChan
+	externalOutputs map[string]*onceBuffer[*Response]
+	completions     *chann.Chann[*Completion]
+	// recent request IDs seen by each relay, only accessed by the relay of the key
+	seenRequests map[string]*seenRequests
+	duplicates   int64
+	sampler      *hopSampler
+	spans        *spanExporter
+	// relayed requests without a response, per key
+	inFlight  map[string]*int64
+	traffic   map[string]*keyTraffic
+	snapshots *snapshotRing
+	// nil entries if admission control is disabled
+	admissionConfig *AdmissionConfig
+	admissions      map[string]*admission
+	// 0 for unbounded buffers between the relays and the dispatchers
+	relayBufferSize int
+	pressure        map[string]*relayPressure
+	// optional views into the dispatchers and the autoscaler
+	endpointsOf func(key string) int
+	desiredOf   func(key string) (int, bool)
+	onReqIn     func(req *Request)
+	onReqOut    func(res *Response)
+	// nil until the front door is served
+	frontDoor atomic.Pointer[frontDoor]
 }
 
 func newGatewayImpl(onReqIn func(req *Request), onReqOut func(res *Response)) *gatewayImpl {
 	return &gatewayImpl{
-		externalInputs:        make(map[string]RequestBuffer),
+		externalInputs:        make(map[string]*onceBuffer[*Request]),
 		externalOutput:        chann.New[*Response](),
+		externalOutputs:       make(map[string]*onceBuffer[*Response]),
+		completions:           chann.New[*Completion](),
 		internalInputBuffers:  make(map[string]RequestBuffer),
 		internalOutputBuffers: make(map[string]ResponseBuffer),
+		seenRequests:          make(map[string]*seenRequests),
+		inFlight:              make(map[string]*int64),
+		traffic:               make(map[string]*keyTraffic),
+		admissions:            make(map[string]*admission),
+		pressure:              make(map[string]*relayPressure),
 		onReqIn:               onReqIn,
 		onReqOut:              onReqOut,
 	}
@@ -55,12 +109,36 @@ func (g *gatewayImpl) RequestChan(target string) chan<- *Request {
 	return g.externalInputs[target].In()
 }
 
+// ResponseChan subscribes to the responses of target, the relay only copies responses of subscribed targets
+// so that no unread buffer grows; the maps are not guarded, so it must be called before Start
 func (g *gatewayImpl) ResponseChan(target string) <-chan *Response {
+	if _, ok := g.externalInputs[target]; !ok {
+		return nil
+	}
+	output, ok := g.externalOutputs[target]
+	if !ok {
+		output = newOnceBuffer(chann.New[*Response]())
+		g.externalOutputs[target] = output
+	}
+	return output.Out()
+}
+
+func (g *gatewayImpl) Responses() <-chan *Response {
 	return g.externalOutput.Out()
 }
 
+func (g *gatewayImpl) Duplicates() int64 {
+	return atomic.LoadInt64(&g.duplicates)
+}
+
 func (g *gatewayImpl) Close() {
+	g.sampler.close()
+	g.spans.close()
 	g.externalOutput.Close()
+	g.completions.Close()
+	for _, resBuffer := range g.externalOutputs {
+		resBuffer.Close()
+	}
 	for _, reqBuffer := range g.externalInputs {
 		reqBuffer.Close()
 	}
@@ -71,9 +149,24 @@ func (g *gatewayImpl) internalBuffers(key string) (reqChan <-chan *Request, resC
 }
 
 func (g *gatewayImpl) register(key string) {
-	g.externalInputs[key] = chann.New[*Request]()
-	g.internalInputBuffers[key] = chann.New[*Request]()
-	g.internalOutputBuffers[key] = chann.New[*Response]()
+	g.externalInputs[key] = newOnceBuffer(chann.New[*Request]())
+	g.internalInputBuffers[key] = newRelayBuffer[*Request](g.relayBufferSize)
+	g.internalOutputBuffers[key] = newRelayBuffer[*Response](0)
+	g.seenRequests[key] = newSeenRequests()
+	g.inFlight[key] = new(int64)
+	g.traffic[key] = &keyTraffic{}
+	g.admissions[key] = newAdmission(g.admissionConfig.For(key))
+	g.pressure[key] = &relayPressure{}
+}
+
+// isDuplicate guards against double-sends from a resumed or retried client within the dedupe window,
+// so that a request is counted only once by the autoscaler and in the output
+func (g *gatewayImpl) isDuplicate(key string, req *Request, now time.Time) bool {
+	if g.seenRequests[key].see(req.ID, now) {
+		atomic.AddInt64(&g.duplicates, 1)
+		return true
+	}
+	return false
 }
 
 func (g *gatewayImpl) relay(ctx context.Context, key string) {
@@ -82,40 +175,106 @@ func (g *gatewayImpl) relay(ctx context.Context, key string) {
 	externalInput := g.externalInputs[key].Out()
 	internalInput := g.internalInputBuffers[key].In()
 	externalOutput := g.externalOutput.In()
+	var targetOutput chan<- *Response
+	if output, ok := g.externalOutputs[key]; ok {
+		targetOutput = output.In()
+	}
+	drain := &targetDrain{}
+	deliver := func(res *Response) {
+		drain.delivered++
+		g.frontDoor.Load().deliver(res)
+		if targetOutput == nil {
+			externalOutput <- res
+			return
+		}
+		// a shallow copy taken before the client can stamp the response it receives
+		copied := *res
+		externalOutput <- res
+		targetOutput <- &copied
+	}
 	internalOutput := g.internalOutputBuffers[key].Out()
+	inFlight := g.inFlight[key]
+	traffic := g.traffic[key]
+	admission := g.admissions[key]
+	pressure := g.pressure[key]
+	reqBuffer, resBuffer := g.internalInputBuffers[key], g.internalOutputBuffers[key]
 	nSend := 0
 	nRecv := 0
 	lastTraceSendTime := time.Now()
 	lastTraceRecvTime := time.Now()
 	for {
 		select {
-		case req := <-externalInput:
+		case req, ok := <-externalInput:
+			if !ok {
+				// the target is finished, stop reading and drain the requests in flight
+				externalInput = nil
+				drain.finished = true
+				if g.complete(key, drain, inFlight) {
+					logger.V(1).Info("Target drained", "responses", drain.delivered)
+				}
+				continue
+			}
+			// stamp on arrival, before any bookkeeping that may block
+			recvTS := time.Now()
 			if req.Target != key {
 				logger.Error(fmt.Errorf("invalid target"), "Fail to relay req", "id", req.ID, "target", req.Target)
 				res := &Response{
 					Source: req,
 					Status: INVALID_TARGET,
 				}
-				externalOutput <- res
+				deliver(res)
 				continue
 			}
-			g.onReqIn(req)
-			req.GatewayRecvTS = time.Now()
+			if g.isDuplicate(key, req, recvTS) {
+				logger.V(2).Info("Dropped duplicate req", "id", req.ID, "duplicates", g.Duplicates())
+				continue
+			}
+			req.GatewayRecvTS = recvTS
+			traffic.arrive()
+			if !admission.admit(atomic.LoadInt64(inFlight)) {
+				logger.V(2).Info("Shed req", "id", req.ID, "shed", admission.shed())
+				res := &Response{
+					Source:        req,
+					Status:        FAIL_OVERFLOW,
+					GatewayRecvTS: recvTS,
+				}
+				deliver(res)
+				traffic.respond(res)
+				continue
+			}
+			g.sampler.attach(req)
 			nSend++
-			if req.GatewayRecvTS.Sub(lastTraceSendTime) > tracingOutputPeriod {
-				lastTraceSendTime = req.GatewayRecvTS
+			atomic.AddInt64(inFlight, 1)
+			// hand off to the dispatcher first, this only blocks if the buffer is bounded and full;
+			// the hooks below only read req, and a response cannot overtake them
+			// because it is relayed by this same loop
+			pressure.send(internalInput, req)
+			pressure.observe(reqBuffer.Len(), resBuffer.Len())
+			g.onReqIn(req)
+			if recvTS.Sub(lastTraceSendTime) > tracingOutputPeriod {
+				lastTraceSendTime = recvTS
 				logger.V(1).Info("[DEBUG][Send]", "id", req.ID, "outstanding", nSend-nRecv, "send/recv", fmt.Sprintf("%v/%v", nSend, nRecv))
 			}
-			internalInput <- req
 		case res := <-internalOutput:
-			g.onReqOut(res)
 			nRecv++
+			pressure.observe(reqBuffer.Len(), resBuffer.Len()+1)
+			left := atomic.AddInt64(inFlight, -1)
+			// likewise, deliver to the client before the hooks
+			deliver(res)
+			traffic.respond(res)
+			admission.observe(res, left)
+			g.onReqOut(res)
+			g.sampler.write(res)
+			g.spans.export(res)
+			if left == 0 && g.complete(key, drain, inFlight) {
+				logger.V(1).Info("Target drained", "responses", drain.delivered)
+			}
 			if res.GatewayRecvTS.Sub(lastTraceRecvTime) > tracingOutputPeriod {
 				lastTraceRecvTime = res.GatewayRecvTS
 				logger.V(1).Info("[DEBUG][Recv]", "id", res.Source.ID, "outstanding", nSend-nRecv, "send/recv", fmt.Sprintf("%v/%v", nSend, nRecv))
 			}
-			externalOutput <- res
 		case <-ctx.Done():
+			logger.V(1).Info("Stopping request/response relay", "send/recv", fmt.Sprintf("%v/%v", nSend, nRecv), "duplicates", g.Duplicates(), "shed", admission.shed())
 			return
 		}
 	}
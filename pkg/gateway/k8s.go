@@ -7,6 +7,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -29,41 +30,47 @@ import (
 type k8sGateway struct {
 	*gatewayImpl
 	dispatchTimeout time.Duration
+	config          *GatewayConfig
 	logger          logr.Logger
 	client          client.Client
 	dispatchers     map[string]*dispatcher.PodDispatcher
-	autoscaler      autoscaler.Autoscaler
+	// by target key, and the canary dispatchers by canary key
+	canaries          map[string]*canarySplit
+	canaryDispatchers map[string]*dispatcher.PodDispatcher
+	autoscaler        autoscaler.Autoscaler
+	// only with DiscoveryEndpointSlices
+	propagation     *endpointPropagation
+	endpointPoke    *endpointPoke
+	epObserver      autoscaler.EndpointObserver
 	newAutoscalerFn func(ctx context.Context, mgr manager.Manager, keys ...string) (autoscaler.Autoscaler, error)
 }
 
-func NewK8sGateway(dispatchTimeout time.Duration, asFramework string, asConfigPath string) (*k8sGateway, error) {
+func NewK8sGateway(dispatchTimeout time.Duration, gwConfig *GatewayConfig, asFramework string, asConfigPath string) (*k8sGateway, error) {
+	if gwConfig == nil {
+		gwConfig, _ = NewGatewayConfigFrom("")
+	}
 	g := &k8sGateway{
-		dispatchTimeout: dispatchTimeout,
-		dispatchers:     make(map[string]*dispatcher.PodDispatcher),
+		dispatchTimeout:   dispatchTimeout,
+		config:            gwConfig,
+		dispatchers:       make(map[string]*dispatcher.PodDispatcher),
+		canaries:          make(map[string]*canarySplit),
+		canaryDispatchers: make(map[string]*dispatcher.PodDispatcher),
 	}
 	g.gatewayImpl = newGatewayImpl(g.onReqIn, g.onReqOut)
+	g.UseAdmission(gwConfig.Admission)
+	g.UseRelayBuffers(gwConfig.RelayBufferSize)
 
 	asConfig, err := autoscaler.NewAutoscalerConfigFrom(asConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse autoscaler config: %v", err)
 	}
 
-	switch asFramework {
-	case "kpa":
-		g.newAutoscalerFn = func(ctx context.Context, mgr manager.Manager, keys ...string) (autoscaler.Autoscaler, error) {
-			if kpaConfig, err := asConfig.Knative.Complete(ctx, mgr); err != nil {
-				return nil, err
-			} else {
-				return autoscaler.NewKnativeAutoscaler(ctx, kpaConfig, keys...)
-			}
+	if asFramework != "" {
+		if !autoscaler.IsRegistered(asFramework) {
+			return nil, fmt.Errorf("unknown autoscaler %v, registered: %v", asFramework, autoscaler.Registered())
 		}
-	case "one-time":
 		g.newAutoscalerFn = func(ctx context.Context, mgr manager.Manager, keys ...string) (autoscaler.Autoscaler, error) {
-			if oneTimeConfig, err := asConfig.OneTime.Complete(ctx, mgr); err != nil {
-				return nil, err
-			} else {
-				return autoscaler.NewOneTimeAutoscaler(ctx, mgr, oneTimeConfig, keys...)
-			}
+			return autoscaler.New(ctx, asFramework, mgr, asConfig, keys...)
 		}
 	}
 	return g, nil
@@ -88,12 +95,379 @@ func (g *k8sGateway) Start(ctx context.Context) error {
 		go g.relay(ctx, key)
 		go dispatcher.Run(ctx)
 	}
+	for key, split := range g.canaries {
+		reqChan, resChan := g.internalBuffers(key)
+		go split.run(ctx, reqChan, resChan)
+		go split.canary.Run(ctx)
+	}
+	if g.config.Discovery == DiscoveryDNS {
+		for key, pd := range g.dispatchers {
+			go g.pollDNS(ctx, key, pd)
+		}
+		for key, pd := range g.canaryDispatchers {
+			go g.pollDNS(ctx, key, pd)
+		}
+	}
+	if len(g.canaries) > 0 {
+		go func() {
+			<-ctx.Done()
+			g.logCanaryStats()
+		}()
+	}
 	if g.autoscaler != nil {
 		go g.autoscaler.Run(ctx)
 	}
+	if g.config.Dispatcher.Zone != "" {
+		go func() {
+			<-ctx.Done()
+			g.logCrossZoneStats()
+		}()
+	}
+	if len(g.config.Dispatcher.Flavors) > 0 {
+		go func() {
+			<-ctx.Done()
+			g.logFlavorStats()
+		}()
+	}
+	if g.config.Dispatcher.Policy == dispatcher.PolicyLeastOutstanding {
+		go func() {
+			<-ctx.Done()
+			g.logRebalanceStats()
+		}()
+	}
+	if g.config.Dispatcher.Policy == dispatcher.PolicyColdAware {
+		go func() {
+			<-ctx.Done()
+			g.logColdStartStats()
+		}()
+	}
+	if g.config.Dispatcher.Affinity {
+		go func() {
+			<-ctx.Done()
+			g.logAffinityStats()
+		}()
+	}
+	if g.config.Dispatcher.ActivatorHoldMilliSec > 0 {
+		go func() {
+			<-ctx.Done()
+			g.logActivatorStats()
+		}()
+	}
+	if g.config.Dispatcher.Retry != nil {
+		go func() {
+			<-ctx.Done()
+			g.logRetryStats()
+		}()
+	}
+	if g.config.Dispatcher.Eviction != nil {
+		go func() {
+			<-ctx.Done()
+			g.logEvictionStats()
+		}()
+	}
+	if g.config.Dispatcher.Priority || g.config.Dispatcher.BatchLast {
+		go func() {
+			<-ctx.Done()
+			g.logPriorityStats()
+		}()
+	}
+	if g.config.Dispatcher.SlowStartMilliSec > 0 {
+		go func() {
+			<-ctx.Done()
+			g.logSlowStartStats()
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		g.logSmoothingStats()
+		g.logSchedulingStats()
+		g.logServedStats()
+		g.logDrainStats()
+		g.logCapacityStats()
+		g.logTimeoutStats()
+		g.logBackpressureStats()
+	}()
+	if g.propagation != nil {
+		go func() {
+			<-ctx.Done()
+			g.logPropagationStats()
+		}()
+	}
+	if g.endpointPoke != nil {
+		go func() {
+			<-ctx.Done()
+			g.logEndpointPokes()
+		}()
+	}
 	return nil
 }
 
+func (g *k8sGateway) logBackpressureStats() {
+	stats := g.BackpressureStats()
+	g.logger.Info("Relay backpressure", "bufferSize", g.config.RelayBufferSize, "blocked", stats.Blocked, "blockedTime", stats.BlockedTime, "maxReqDepth", stats.MaxReqDepth, "maxResDepth", stats.MaxResDepth, "worst", stats.Worst)
+}
+
+func (g *k8sGateway) logCanaryStats() {
+	var total CanaryStats
+	for _, split := range g.canaries {
+		stats := split.stats()
+		total.Stable += stats.Stable
+		total.StableFail += stats.StableFail
+		total.Canary += stats.Canary
+		total.CanaryFail += stats.CanaryFail
+	}
+	g.logger.Info("Canary split", "targets", len(g.canaries), "stable", total.Stable, "stableFail", total.StableFail, "canary", total.Canary, "canaryFail", total.CanaryFail)
+}
+
+func (g *k8sGateway) logFlavorStats() {
+	total := make(map[string]int64)
+	for _, pd := range g.dispatchers {
+		for name, n := range pd.FlavorStats() {
+			total[name] += n
+		}
+	}
+	g.logger.Info("Flavored dispatching", "dispatched", total)
+}
+
+func (g *k8sGateway) logCrossZoneStats() {
+	var dispatched, crossZone int64
+	for _, pd := range g.dispatchers {
+		d, c := pd.CrossZoneStats()
+		dispatched += d
+		crossZone += c
+	}
+	fraction := 0.
+	if dispatched > 0 {
+		fraction = float64(crossZone) / float64(dispatched)
+	}
+	g.logger.Info("Zone-aware dispatching", "zone", g.config.Dispatcher.Zone, "dispatched", dispatched, "crossZone", crossZone, "fraction", fmt.Sprintf("%.2f%%", fraction*100))
+}
+
+func (g *k8sGateway) logRebalanceStats() {
+	var rebalanced int64
+	for _, pd := range g.dispatchers {
+		rebalanced += pd.RebalanceStats()
+	}
+	g.logger.Info("Least-outstanding dispatching", "rebalanced", rebalanced)
+}
+
+func (g *k8sGateway) logColdStartStats() {
+	var total dispatcher.ColdStartStats
+	var warmUp time.Duration
+	for _, pd := range g.dispatchers {
+		stats := pd.ColdStartStats()
+		total.ToCold += stats.ToCold
+		total.Diverted += stats.Diverted
+		total.Warmed += stats.Warmed
+		warmUp += stats.MeanWarmUp * time.Duration(stats.Warmed)
+	}
+	if total.Warmed > 0 {
+		total.MeanWarmUp = warmUp / time.Duration(total.Warmed)
+	}
+	g.logger.Info("Cold-aware dispatching", "warmUpRequests", g.config.Dispatcher.WarmUpRequests, "toCold", total.ToCold, "diverted", total.Diverted, "warmed", total.Warmed, "meanWarmUp", total.MeanWarmUp)
+}
+
+func (g *k8sGateway) logSlowStartStats() {
+	var toWarming, swapped int64
+	for _, pd := range g.dispatchers {
+		w, s := pd.SlowStartStats()
+		toWarming += w
+		swapped += s
+	}
+	g.logger.Info("Slow-start dispatching", "window", time.Duration(g.config.Dispatcher.SlowStartMilliSec)*time.Millisecond, "toWarming", toWarming, "swapped", swapped)
+}
+
+func (g *k8sGateway) logAffinityStats() {
+	var hit, miss int64
+	for _, pd := range g.dispatchers {
+		h, m := pd.AffinityStats()
+		hit += h
+		miss += m
+	}
+	g.logger.Info("Affinity dispatching", "hit", hit, "miss", miss)
+}
+
+func (g *k8sGateway) logActivatorStats() {
+	var total dispatcher.ActivatorStats
+	var burst dispatcher.BurstStats
+	var hold time.Duration
+	for _, pd := range g.dispatchers {
+		b := pd.BurstStats()
+		burst.Proxied += b.Proxied
+		burst.Served += b.Served
+		burst.ToProxy += b.ToProxy
+		stats := pd.ActivatorStats()
+		total.Parked += stats.Parked
+		total.Released += stats.Released
+		hold += stats.MeanHold * time.Duration(stats.Released)
+		total.MaxHold = max(total.MaxHold, stats.MaxHold)
+	}
+	if total.Released > 0 {
+		total.MeanHold = hold / time.Duration(total.Released)
+	}
+	g.logger.Info("Activator", "parked", total.Parked, "released", total.Released, "expired", total.Parked-total.Released, "meanHold", total.MeanHold, "maxHold", total.MaxHold)
+	if burst.Proxied > 0 || burst.Served > 0 {
+		g.logger.Info("Target burst capacity", "proxied", burst.Proxied, "served", burst.Served, "toProxy", burst.ToProxy)
+	}
+}
+
+func (g *k8sGateway) logRetryStats() {
+	var retried, recovered int64
+	for _, pd := range g.dispatchers {
+		r, rc := pd.RetryStats()
+		retried += r
+		recovered += rc
+	}
+	g.logger.Info("Dispatch retries", "retried", retried, "recovered", recovered)
+}
+
+// only targets with an in-flight cap contribute
+func (g *k8sGateway) logCapacityStats() {
+	var queued, shed int64
+	for _, pd := range g.dispatchers {
+		q, s := pd.CapacityStats()
+		queued += q
+		shed += s
+	}
+	if queued == 0 && shed == 0 {
+		return
+	}
+	g.logger.Info("In-flight cap", "policy", g.config.Dispatcher.OverflowPolicy, "queued", queued, "shed", shed)
+}
+
+func (g *k8sGateway) logEvictionStats() {
+	var evicted, readmitted int64
+	for _, pd := range g.dispatchers {
+		e, r := pd.EvictionStats()
+		evicted += e
+		readmitted += r
+	}
+	g.logger.Info("Endpoint eviction", "evicted", evicted, "readmitted", readmitted)
+}
+
+func (g *k8sGateway) logPriorityStats() {
+	var held, yielded int64
+	for _, pd := range g.dispatchers {
+		h, y := pd.PriorityStats()
+		held += h
+		yielded += y
+	}
+	g.logger.Info("Priority dispatch", "held", held, "yielded", yielded)
+}
+
+// dispatch failures point at missing capacity, execution timeouts at slow backends
+func (g *k8sGateway) logTimeoutStats() {
+	var dispatch, exec int64
+	for _, pd := range g.dispatchers {
+		d, e := pd.TimeoutStats()
+		dispatch += d
+		exec += e
+	}
+	g.logger.Info("Timeouts", "dispatch", dispatch, "exec", exec)
+}
+
+// the requests served per endpoint of each target, a skew per-request latencies cannot reveal
+func (g *k8sGateway) logServedStats() {
+	for key, pd := range g.dispatchers {
+		stats := pd.ServedStats()
+		if stats.Endpoints == 0 {
+			continue
+		}
+		cv := 0.
+		if stats.Mean > 0 {
+			cv = stats.StdDev / stats.Mean
+		}
+		g.logger.Info("Served per endpoint", "target", key, "endpoints", stats.Endpoints, "min", stats.Min, "max", stats.Max,
+			"mean", fmt.Sprintf("%.1f", stats.Mean), "stddev", fmt.Sprintf("%.1f", stats.StdDev), "cv", fmt.Sprintf("%.2f", cv))
+	}
+}
+
+// lost requests are failures on endpoints removed while the requests were in flight;
+// draining endpoints before deletion should bring them to zero
+func (g *k8sGateway) logDrainStats() {
+	var drained, lost int64
+	for _, pd := range g.dispatchers {
+		d, l := pd.DrainStats()
+		drained += d
+		lost += l
+	}
+	g.logger.Info("Endpoint removal", "drained", drained, "lost", lost)
+}
+
+// only targets with rate smoothing are included
+func (g *k8sGateway) logSmoothingStats() {
+	var admitted int64
+	var totalWait, maxWait time.Duration
+	for _, pd := range g.dispatchers {
+		stats := pd.SmoothingStats()
+		admitted += stats.Admitted
+		totalWait += stats.MeanWait * time.Duration(stats.Admitted)
+		if stats.MaxWait > maxWait {
+			maxWait = stats.MaxWait
+		}
+	}
+	if admitted == 0 {
+		return
+	}
+	g.logger.Info("Rate smoothing", "admitted", admitted, "meanWait", totalWait/time.Duration(admitted), "maxWait", maxWait)
+}
+
+// the pick-up delay of every target, whether pooled or not
+func (g *k8sGateway) logSchedulingStats() {
+	var scheduled int64
+	var totalWait, maxWait time.Duration
+	var pooled, maxQueue, maxBusy int
+	for _, pd := range g.dispatchers {
+		stats := pd.SchedulingStats()
+		scheduled += stats.Scheduled
+		totalWait += stats.MeanWait * time.Duration(stats.Scheduled)
+		maxWait = max(maxWait, stats.MaxWait)
+		maxQueue = max(maxQueue, stats.MaxQueue)
+		// goroutines may peak at different times across targets, so the sum is an upper bound
+		maxBusy += stats.MaxBusy
+		if stats.Workers > 0 {
+			pooled++
+		}
+	}
+	if scheduled == 0 {
+		return
+	}
+	g.logger.Info("Dispatch scheduling", "scheduled", scheduled, "pooledTargets", pooled, "meanPickUp", totalWait/time.Duration(scheduled), "maxPickUp", maxWait,
+		"maxQueue", maxQueue, "maxBusyBound", maxBusy)
+}
+
+// zone of a node from its well-known topology label
+func (g *k8sGateway) nodeZone(ctx context.Context, nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+	node := &corev1.Node{}
+	if err := g.client.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		g.logger.V(1).Info("[WARN] Failed to get node zone", "node", nodeName, "error", err)
+		return ""
+	}
+	return node.Labels[corev1.LabelTopologyZone]
+}
+
+// newPodDispatcher creates the registered pod dispatcher of key
+func (g *k8sGateway) newPodDispatcher(ctx context.Context, key string, reqChan <-chan *workload.Request, resChan chan<- *workload.Response) (*dispatcher.PodDispatcher, error) {
+	d, err := dispatcher.New(ctx, dispatcher.Pod, &dispatcher.Spec{
+		Target:  key,
+		Timeout: g.dispatchTimeout,
+		ReqChan: reqChan,
+		ResChan: resChan,
+		Config:  g.config.Dispatcher.For(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pd, ok := d.(*dispatcher.PodDispatcher)
+	if !ok {
+		return nil, fmt.Errorf("%q dispatcher is a %T, not a pod dispatcher", dispatcher.Pod, d)
+	}
+	return pd, nil
+}
+
 func (g *k8sGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager) error {
 	logger := klog.FromContext(ctx)
 	g.logger = logger
@@ -107,23 +481,63 @@ func (g *k8sGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager)
 	if err := uncachedClient.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
 		return fmt.Errorf("error listing deployments in k8s gateway: %v", err)
 	}
+	canaries := &appsv1.DeploymentList{}
+	if err := uncachedClient.List(ctx, canaries, workload.CtrlListOptionsForCanary...); err != nil {
+		return fmt.Errorf("error listing canary deployments in k8s gateway: %v", err)
+	}
+	canaryOf := make(map[string]*appsv1.Deployment)
+	for i := range canaries.Items {
+		canary := &canaries.Items[i]
+		canaryOf[canary.Namespace+"/"+canary.Labels[workload.CanaryOfLabel]] = canary
+	}
+
 	keys := []string{}
 	for i := range targets.Items {
 		target := &targets.Items[i]
 		key := workload.KeyFromObject(target)
+		if !workload.OwnsKey(key) {
+			// served by another gateway shard, along with its canary
+			continue
+		}
 		keys = append(keys, key)
 		logger.V(1).Info(fmt.Sprintf("Registering deployment %v", klog.KObj(target)), "key", key)
 		// register channel
 		g.register(key)
 		reqBuffer, resBuffer := g.internalBuffers(key)
+		var split *canarySplit
+		if canary, ok := canaryOf[key]; ok {
+			canaryKey := workload.KeyFromObject(canary)
+			weight := 0.
+			if cfg := g.config.Canary.For(key); cfg != nil {
+				weight = cfg.Weight
+			}
+			split = newCanarySplit(key, canaryKey, weight)
+			reqBuffer, resBuffer = split.stableReqs.Out(), split.stableRes.In()
+			pd, err := g.newPodDispatcher(ctx, canaryKey, split.canaryReqs.Out(), split.canaryRes.In())
+			if err != nil {
+				return fmt.Errorf("failed to create canary dispatcher for %v: %v", canaryKey, err)
+			}
+			split.canary = pd.WithZoneResolver(g.nodeZone)
+			g.canaries[key] = split
+			g.canaryDispatchers[canaryKey] = split.canary
+			logger.V(1).Info(fmt.Sprintf("Registering canary %v", klog.KObj(canary)), "key", key, "canary", canaryKey, "weight", weight)
+		}
 		// default to concurrency 1
-		pd, err := dispatcher.NewPodDispatcher(ctx, key, g.dispatchTimeout, reqBuffer, resBuffer)
+		pd, err := g.newPodDispatcher(ctx, key, reqBuffer, resBuffer)
 		if err != nil {
 			return fmt.Errorf("failed to create pod dispatcher for %v: %v", key, err)
 		}
-		g.dispatchers[key] = pd
+		g.dispatchers[key] = pd.WithZoneResolver(g.nodeZone)
+	}
+	shard, nShards := workload.Shard()
+	logger.Info("All deployments registered", "total", len(g.dispatchers), "canaries", len(g.canaries), "shard", fmt.Sprintf("%d/%d", shard, nShards), "listed", len(targets.Items))
+	g.endpointsOf = func(key string) int {
+		n := g.dispatchers[key].Endpoints()
+		if split, ok := g.canaries[key]; ok {
+			n += split.canary.Endpoints()
+		}
+		return n
 	}
-	logger.Info("All deployments registered", "total", len(g.dispatchers))
 
 	if g.newAutoscalerFn != nil {
 		autoscaler, err := g.newAutoscalerFn(ctx, mgr, keys...)
@@ -133,6 +547,36 @@ func (g *k8sGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager)
 		g.autoscaler = autoscaler
 		logger.Info("Autoscaler created", "framework", autoscaler.Framework())
 	}
+	if reporter, ok := g.autoscaler.(autoscaler.DesiredReporter); ok {
+		g.desiredOf = reporter.Desired
+	}
+	if user, ok := g.autoscaler.(autoscaler.GatewayQueueUser); ok {
+		user.UseGatewayQueue(g)
+	}
+	if user, ok := g.autoscaler.(autoscaler.BurstCapacityUser); ok && g.burstCapacity() {
+		user.UseBurstCapacity(g)
+	}
+	if poker, ok := g.autoscaler.(autoscaler.Poker); ok {
+		for key, pd := range g.dispatchers {
+			pd.WithActivatorPoke(func() { poker.Poke(key) })
+		}
+		// the canary is scaled along with its target
+		for key, split := range g.canaries {
+			split.canary.WithActivatorPoke(func() { poker.Poke(key) })
+		}
+		if g.config.PokeOnEndpointChange {
+			g.endpointPoke = newEndpointPoke(poker.Poke, g.canaries)
+			logger.Info("Poking the autoscaler on endpoint changes")
+		}
+	} else if g.config.PokeOnEndpointChange {
+		logger.Info("[WARN] Autoscaler cannot be poked, ignoring pokeOnEndpointChange")
+	}
+	if observer, ok := g.autoscaler.(autoscaler.EndpointObserver); ok {
+		g.epObserver = observer
+	}
+	if zs, ok := g.autoscaler.(autoscaler.ZeroScaler); ok && zs.ScalesToZero() && g.config.Dispatcher.ActivatorHoldMilliSec <= 0 {
+		logger.Info("[WARN] Autoscaler scales to zero without the activator, requests at zero only wait for the dispatch timeout")
+	}
 
 	// set up event handler
 	enqueueWorkload := handler.TypedEnqueueRequestsFromMapFunc(
@@ -141,19 +585,91 @@ func (g *k8sGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager)
 			return []reconcile.Request{{NamespacedName: workload.NamespacedNameFromKey(workloadKey)}}
 		},
 	)
+	// NOTE: the EndpointSlice controller copies the Service labels to its slices,
+	// so slices of a Service labeled like its deployment map to the same key
+	var endpoints client.Object = &corev1.Pod{}
+	if g.config.Discovery == DiscoveryDNS {
+		// the pods are only watched to measure the propagation, endpoints are resolved in Start
+		g.propagation = newEndpointPropagation(true)
+		if err := g.watchPodReadiness(ctx, mgr); err != nil {
+			return fmt.Errorf("failed to watch pod readiness: %v", err)
+		}
+		logger.Info("Discovering endpoints from headless Service DNS", "interval", g.config.DNSIntervalMilliSec)
+		return nil
+	}
+	if g.config.Discovery == DiscoveryEndpointSlices {
+		g.propagation = newEndpointPropagation(false)
+		if err := g.watchPodReadiness(ctx, mgr); err != nil {
+			return fmt.Errorf("failed to watch pod readiness: %v", err)
+		}
+		endpoints = &discoveryv1.EndpointSlice{}
+		logger.Info("Discovering endpoints from EndpointSlices")
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: 256,
 		}).
 		Named("gateway_k8s").
-		Watches(&corev1.Pod{}, enqueueWorkload).
+		Watches(endpoints, enqueueWorkload).
 		Watches(&appsv1.Deployment{}, enqueueWorkload).
 		WithEventFilter(predicate.NewPredicateFuncs(g.FilterEvent)).
 		Complete(g)
 }
 
+// QueueDepth counts the requests of key waiting for an endpoint, of its canary as well
+func (g *k8sGateway) QueueDepth(key string) int {
+	depth, _ := g.queued(key, time.Now())
+	return depth
+}
+
+func (g *k8sGateway) QueueDelay(key string, now time.Time) time.Duration {
+	_, delay := g.queued(key, now)
+	return delay
+}
+
+// ExcessBurstCapacity returns the excess burst capacity of key, see dispatcher.PodDispatcher.ExcessBurstCapacity
+func (g *k8sGateway) ExcessBurstCapacity(key string) (float64, bool) {
+	pd, ok := g.dispatchers[key]
+	if !ok {
+		return 0, false
+	}
+	return pd.ExcessBurstCapacity()
+}
+
+// burstCapacity returns true if any target has a positive target-burst-capacity
+func (g *k8sGateway) burstCapacity() bool {
+	for _, pd := range g.dispatchers {
+		if _, ok := pd.ExcessBurstCapacity(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *k8sGateway) queued(key string, now time.Time) (int, time.Duration) {
+	pd, ok := g.dispatchers[key]
+	if !ok {
+		return 0, 0
+	}
+	depth, delay := pd.Queued(now)
+	if split, ok := g.canaries[key]; ok {
+		canaryDepth, canaryDelay := split.canary.Queued(now)
+		depth, delay = depth+canaryDepth, max(delay, canaryDelay)
+	}
+	return depth, delay
+}
+
 func (g *k8sGateway) FilterEvent(object client.Object) bool {
-	return workload.IsTraceWorkload(object)
+	if !workload.IsTraceWorkload(object) {
+		return false
+	}
+	// drop the events of targets served by other gateway shards, the maps are read-only once set up
+	key := workload.KeyFromObject(object)
+	_, ok := g.dispatchers[key]
+	if !ok {
+		_, ok = g.canaryDispatchers[key]
+	}
+	return ok
 }
 
 func (g *k8sGateway) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -169,6 +685,29 @@ func (g *k8sGateway) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		return ctrl.Result{}, err
 	}
 
+	pd, ok := g.dispatchers[key]
+	if !ok {
+		pd, ok = g.canaryDispatchers[key]
+	}
+	if !ok {
+		logger.Info("[WARN] No dispatcher found for target, will ignore")
+		return ctrl.Result{}, nil
+	}
+
+	if g.config.Discovery == DiscoveryEndpointSlices {
+		readyPods, err := g.readyEndpoints(ctx, target)
+		if err != nil {
+			logger.Error(err, "Failed to list endpoints for target deployment")
+			return ctrl.Result{}, err
+		}
+		g.propagation.observe(key, readyPods, time.Now())
+		if err := g.reconcileDispatcher(ctx, key, pd, readyPods); err != nil {
+			logger.Error(err, "Failed to reconcile pod dispatcher")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// get matching pods
 	pods := &corev1.PodList{}
 	if err := g.client.List(ctx, pods,
@@ -186,15 +725,24 @@ func (g *k8sGateway) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		}
 	}
 
-	pd, ok := g.dispatchers[key]
-	if !ok {
-		logger.Info("[WARN] No dispatcher found for target, will ignore")
-		return ctrl.Result{}, nil
-	}
-	if err := pd.Reconcile(ctx, readyPods); err != nil {
+	if err := g.reconcileDispatcher(ctx, key, pd, readyPods); err != nil {
 		logger.Error(err, "Failed to reconcile pod dispatcher")
 		return ctrl.Result{}, err
 	}
 
 	return ctrl.Result{}, nil
 }
+
+// reconcileDispatcher updates the endpoints of pd and tells the autoscaler if they changed
+func (g *k8sGateway) reconcileDispatcher(ctx context.Context, key string, pd *dispatcher.PodDispatcher, readyPods []*corev1.Pod) error {
+	before := pd.Endpoints()
+	if err := pd.Reconcile(ctx, readyPods); err != nil {
+		return err
+	}
+	after := pd.Endpoints()
+	g.endpointPoke.changed(key, before, after)
+	if g.epObserver != nil && before != after {
+		g.epObserver.EndpointsChanged(key, before, after)
+	}
+	return nil
+}
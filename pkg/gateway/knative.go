@@ -6,6 +6,7 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	knclient "knative.dev/serving/pkg/client/clientset/versioned"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -16,17 +17,45 @@ import (
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
 )
 
+const (
+	// KnativeDispatchIngress sends requests through the Kourier ingress, i.e., the full Knative data plane
+	KnativeDispatchIngress = "ingress"
+	// KnativeDispatchRevision sends requests to the private service of the latest ready revision,
+	// so that the Knative data-plane overhead can be told apart from its autoscaling
+	KnativeDispatchRevision = "revision"
+	// any other mode names a registered dispatcher, which gets the URL of the service, see dispatcher.Register
+)
+
 type knativeGateway struct {
 	*gatewayImpl
 	*knclient.Clientset
 	dispatchTimeout time.Duration
-	dispatchers map[string]*dispatcher.KnServiceDispatcher
+	dispatchMode    string
+	config          *KnativeConfig
+	dispatchers     map[string]dispatcher.Dispatcher
 }
 
-func NewKnativeGateway(dispatchTimeout time.Duration) (*knativeGateway, error) {
+func NewKnativeGateway(dispatchTimeout time.Duration, dispatchMode string, gwConfig *GatewayConfig) (*knativeGateway, error) {
+	if gwConfig == nil {
+		gwConfig, _ = NewGatewayConfigFrom("")
+	}
+	switch dispatchMode {
+	case "":
+		dispatchMode = KnativeDispatchIngress
+	case KnativeDispatchIngress, KnativeDispatchRevision:
+	case dispatcher.Pod:
+		return nil, fmt.Errorf("knative dispatch mode %q needs the endpoints of the k8s gateway", dispatchMode)
+	default:
+		if !dispatcher.IsRegistered(dispatchMode) {
+			return nil, fmt.Errorf("unknown knative dispatch mode %q, neither %v, %v nor a registered dispatcher (%v)",
+				dispatchMode, KnativeDispatchIngress, KnativeDispatchRevision, dispatcher.Registered())
+		}
+	}
 	g := &knativeGateway{
 		dispatchTimeout: dispatchTimeout,
-		dispatchers: make(map[string]*dispatcher.KnServiceDispatcher),
+		dispatchMode:    dispatchMode,
+		config:          gwConfig.Knative,
+		dispatchers:     make(map[string]dispatcher.Dispatcher),
 	}
 	g.gatewayImpl = newGatewayImpl(g.onReqIn, g.onReqOut)
 	return g, nil
@@ -54,27 +83,73 @@ func (g *knativeGateway) SetUpWithManager(ctx context.Context, mgr manager.Manag
 	logger := klog.FromContext(ctx).WithValues("gateway", "knative")
 
 	g.Clientset = knclient.NewForConfigOrDie(mgr.GetConfig())
+	kubeClient := clientset.NewForConfigOrDie(mgr.GetConfig())
 
 	// assume deployment and ksvc has the same "app" label
 	knServices, err := g.ServingV1().Services(metav1.NamespaceAll).List(ctx, workload.MetaV1ListOptionsForTrace)
 	if err != nil {
 		return fmt.Errorf("error listing kn services in knative gateway: %v", err)
 	}
+	// the revisions and URLs are read after the new annotations rolled out
+	owned := knServices.Items[:0]
 	for i := range knServices.Items {
-		service := &knServices.Items[i]
+		if workload.OwnsKey(workload.KeyFromObject(&knServices.Items[i])) {
+			owned = append(owned, knServices.Items[i])
+		}
+	}
+	if err := g.applyAnnotations(ctx, owned); err != nil {
+		return err
+	}
+	for i := range owned {
+		service := &owned[i]
 		key := workload.KeyFromObject(service)
 		logger.V(1).Info(fmt.Sprintf("Registering ksv %v", klog.KObj(service)), "key", key)
 		// register channel
 		g.register(key)
 		reqBuffer, resBuffer := g.internalBuffers(key)
 		// create dispatcher
-		url := service.Status.URL.String()
-		kd, err := dispatcher.NewKnServiceDispatcher(ctx, key, g.dispatchTimeout, reqBuffer, resBuffer, url)
+		spec := &dispatcher.Spec{
+			Target:  key,
+			Timeout: g.dispatchTimeout,
+			ReqChan: reqBuffer,
+			ResChan: resBuffer,
+			Address: service.Status.URL.String(),
+		}
+		name := g.dispatchMode
+		switch g.dispatchMode {
+		case KnativeDispatchIngress:
+			name = dispatcher.KnService
+		case KnativeDispatchRevision:
+			name = dispatcher.KnRevision
+			ip, err := g.revisionIP(ctx, kubeClient, service.Namespace, service.Status.LatestReadyRevisionName)
+			if err != nil {
+				return fmt.Errorf("failed to resolve the revision of %v: %v", klog.KObj(service), err)
+			}
+			logger.V(1).Info("Dispatching to revision", "key", key, "revision", service.Status.LatestReadyRevisionName, "ip", ip)
+			spec.Address = ip
+		}
+		kd, err := dispatcher.New(ctx, name, spec)
 		if err != nil {
-			return fmt.Errorf("failed to create knative service dispatcher for %v (%v): %v", klog.KObj(service), url, err)
+			return fmt.Errorf("failed to create %v dispatcher for %v (%v): %v", name, klog.KObj(service), spec.Address, err)
 		}
 		g.dispatchers[key] = kd
 	}
-	logger.Info("All knative services registered", "total", len(g.dispatchers))
+	logger.Info("All knative services registered", "total", len(g.dispatchers), "dispatch", g.dispatchMode)
 	return nil
 }
+
+// revisionIP returns the cluster IP of the private service of the revision, resolved once at setup,
+// so revisions rolled out during the run are not followed
+func (g *knativeGateway) revisionIP(ctx context.Context, kubeClient clientset.Interface, namespace string, revision string) (string, error) {
+	if revision == "" {
+		return "", fmt.Errorf("no ready revision")
+	}
+	svc, err := kubeClient.CoreV1().Services(namespace).Get(ctx, revision+"-private", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the private service of revision %v: %v", revision, err)
+	}
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" {
+		return "", fmt.Errorf("private service of revision %v has no cluster IP", revision)
+	}
+	return svc.Spec.ClusterIP, nil
+}
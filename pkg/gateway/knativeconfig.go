@@ -0,0 +1,216 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+const defaultKnativeReadyTimeoutSeconds = 300
+
+// KnativeConfig sets the autoscaling annotations of the knative services at setup, named like the kpa autoscaler config;
+// nil fields keep the annotations of the ksvc template. Changed annotations roll out a new revision,
+// which the gateway waits for before dispatching.
+type KnativeConfig struct {
+	TargetConcurrency        *float64 `yaml:"targetConcurrency"`
+	StableWindowSeconds      *int     `yaml:"stableWindowSeconds"`
+	PanicWindowPercentage    *float64 `yaml:"panicWindowPercentage"`
+	PanicThresholdPercentage *float64 `yaml:"panicThresholdPercentage"`
+	ScaleDownDelaySeconds    *int     `yaml:"scaleDownDelaySeconds"`
+	InitialScale             *int     `yaml:"initialScale"`
+	MinScale                 *int     `yaml:"minScale"`
+	MaxScale                 *int     `yaml:"maxScale"`
+	// how long to wait for the patched services to be ready, defaults to 300
+	ReadyTimeoutSeconds int `yaml:"readyTimeoutSeconds"`
+	// per-target overrides, indexed by workload key (namespace/name); their own targets and timeout are ignored
+	Targets map[string]*KnativeConfig `yaml:"targets"`
+}
+
+// For returns the config of the given target with its overrides applied
+func (cfg *KnativeConfig) For(key string) *KnativeConfig {
+	if cfg == nil {
+		return nil
+	}
+	target := cfg.Targets[key]
+	if target == nil {
+		return cfg
+	}
+	merged := *cfg
+	if target.TargetConcurrency != nil {
+		merged.TargetConcurrency = target.TargetConcurrency
+	}
+	if target.StableWindowSeconds != nil {
+		merged.StableWindowSeconds = target.StableWindowSeconds
+	}
+	if target.PanicWindowPercentage != nil {
+		merged.PanicWindowPercentage = target.PanicWindowPercentage
+	}
+	if target.PanicThresholdPercentage != nil {
+		merged.PanicThresholdPercentage = target.PanicThresholdPercentage
+	}
+	if target.ScaleDownDelaySeconds != nil {
+		merged.ScaleDownDelaySeconds = target.ScaleDownDelaySeconds
+	}
+	if target.InitialScale != nil {
+		merged.InitialScale = target.InitialScale
+	}
+	if target.MinScale != nil {
+		merged.MinScale = target.MinScale
+	}
+	if target.MaxScale != nil {
+		merged.MaxScale = target.MaxScale
+	}
+	return &merged
+}
+
+func (cfg *KnativeConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	if err := cfg.validateFields(); err != nil {
+		return err
+	}
+	if cfg.ReadyTimeoutSeconds < 0 {
+		return fmt.Errorf("readyTimeoutSeconds cannot be negative, got %v", cfg.ReadyTimeoutSeconds)
+	}
+	for key := range cfg.Targets {
+		if err := cfg.For(key).validateFields(); err != nil {
+			return fmt.Errorf("targets[%v]: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// the bounds are those enforced by the Knative webhook
+func (cfg *KnativeConfig) validateFields() error {
+	if cfg.TargetConcurrency != nil && *cfg.TargetConcurrency < 0.01 {
+		return fmt.Errorf("targetConcurrency must be at least 0.01, got %v", *cfg.TargetConcurrency)
+	}
+	if cfg.StableWindowSeconds != nil && (*cfg.StableWindowSeconds < 6 || *cfg.StableWindowSeconds > 3600) {
+		return fmt.Errorf("stableWindowSeconds must be in [6, 3600], got %v", *cfg.StableWindowSeconds)
+	}
+	if cfg.PanicWindowPercentage != nil && (*cfg.PanicWindowPercentage < 1 || *cfg.PanicWindowPercentage > 100) {
+		return fmt.Errorf("panicWindowPercentage must be in [1, 100], got %v", *cfg.PanicWindowPercentage)
+	}
+	if cfg.PanicThresholdPercentage != nil && (*cfg.PanicThresholdPercentage < 110 || *cfg.PanicThresholdPercentage > 1000) {
+		return fmt.Errorf("panicThresholdPercentage must be in [110, 1000], got %v", *cfg.PanicThresholdPercentage)
+	}
+	if cfg.ScaleDownDelaySeconds != nil && (*cfg.ScaleDownDelaySeconds < 0 || *cfg.ScaleDownDelaySeconds > 3600) {
+		return fmt.Errorf("scaleDownDelaySeconds must be in [0, 3600], got %v", *cfg.ScaleDownDelaySeconds)
+	}
+	if (cfg.InitialScale != nil && *cfg.InitialScale < 0) || (cfg.MinScale != nil && *cfg.MinScale < 0) || (cfg.MaxScale != nil && *cfg.MaxScale < 0) {
+		return fmt.Errorf("initialScale, minScale and maxScale cannot be negative")
+	}
+	if cfg.MinScale != nil && cfg.MaxScale != nil && *cfg.MaxScale > 0 && *cfg.MinScale > *cfg.MaxScale {
+		return fmt.Errorf("minScale %v exceeds maxScale %v", *cfg.MinScale, *cfg.MaxScale)
+	}
+	return nil
+}
+
+// Annotations returns the autoscaling annotations of the set fields
+func (cfg *KnativeConfig) Annotations() map[string]string {
+	annotations := make(map[string]string)
+	if cfg == nil {
+		return annotations
+	}
+	formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	if cfg.TargetConcurrency != nil {
+		annotations["autoscaling.knative.dev/target"] = formatFloat(*cfg.TargetConcurrency)
+	}
+	if cfg.StableWindowSeconds != nil {
+		annotations["autoscaling.knative.dev/window"] = fmt.Sprintf("%ds", *cfg.StableWindowSeconds)
+	}
+	if cfg.PanicWindowPercentage != nil {
+		annotations["autoscaling.knative.dev/panic-window-percentage"] = formatFloat(*cfg.PanicWindowPercentage)
+	}
+	if cfg.PanicThresholdPercentage != nil {
+		annotations["autoscaling.knative.dev/panic-threshold-percentage"] = formatFloat(*cfg.PanicThresholdPercentage)
+	}
+	if cfg.ScaleDownDelaySeconds != nil {
+		annotations["autoscaling.knative.dev/scale-down-delay"] = fmt.Sprintf("%ds", *cfg.ScaleDownDelaySeconds)
+	}
+	if cfg.InitialScale != nil {
+		annotations["autoscaling.knative.dev/initial-scale"] = strconv.Itoa(*cfg.InitialScale)
+	}
+	if cfg.MinScale != nil {
+		annotations["autoscaling.knative.dev/min-scale"] = strconv.Itoa(*cfg.MinScale)
+	}
+	if cfg.MaxScale != nil {
+		annotations["autoscaling.knative.dev/max-scale"] = strconv.Itoa(*cfg.MaxScale)
+	}
+	return annotations
+}
+
+// applyAnnotations patches the revision template of every service whose annotations differ from the config,
+// then waits for them to be ready and replaces them with their latest state
+func (g *knativeGateway) applyAnnotations(ctx context.Context, services []servingv1.Service) error {
+	if g.config == nil {
+		return nil
+	}
+	logger := klog.FromContext(ctx).WithValues("gateway", "knative")
+	var patched []int
+	for i := range services {
+		service := &services[i]
+		want := g.config.For(service.Namespace + "/" + service.Name).Annotations()
+		changed := false
+		for k, v := range want {
+			if service.Spec.Template.Annotations[k] != v {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"annotations": want},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal annotations patch: %v", err)
+		}
+		if _, err := g.ServingV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to patch the annotations of %v: %v", klog.KObj(service), err)
+		}
+		logger.V(1).Info("Patched autoscaling annotations", "service", klog.KObj(service), "annotations", want)
+		patched = append(patched, i)
+	}
+	if len(patched) == 0 {
+		return nil
+	}
+
+	timeout := time.Duration(g.config.ReadyTimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultKnativeReadyTimeoutSeconds * time.Second
+	}
+	logger.Info("Waiting for patched knative services", "patched", len(patched), "timeout", timeout)
+	for _, i := range patched {
+		service := &services[i]
+		err := wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+			latest, err := g.ServingV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if !latest.IsReady() || latest.Status.LatestReadyRevisionName != latest.Status.LatestCreatedRevisionName {
+				return false, nil
+			}
+			*service = *latest
+			return true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("knative service %v not ready after patching: %v", klog.KObj(service), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"sync/atomic"
+)
+
+// endpointPoke reconciles the autoscaler of a target as soon as its ready endpoints change,
+// so that follow-up scale-ups see the new pods right away instead of on the next tick
+type endpointPoke struct {
+	poke func(key string)
+	// canary keys map to the key of their target, whose decider also counts the canary endpoints
+	targetOf map[string]string
+	nPoked   int64
+}
+
+func newEndpointPoke(poke func(key string), canaries map[string]*canarySplit) *endpointPoke {
+	p := &endpointPoke{poke: poke, targetOf: make(map[string]string)}
+	for key, split := range canaries {
+		p.targetOf[split.canaryKey] = key
+	}
+	return p
+}
+
+// changed pokes the target of key if its endpoints went from before to after
+func (p *endpointPoke) changed(key string, before, after int) {
+	if p == nil || before == after {
+		return
+	}
+	if target, ok := p.targetOf[key]; ok {
+		key = target
+	}
+	atomic.AddInt64(&p.nPoked, 1)
+	p.poke(key)
+}
+
+func (g *k8sGateway) logEndpointPokes() {
+	g.logger.Info("Endpoint change pokes", "poked", atomic.LoadInt64(&g.endpointPoke.nPoked))
+}
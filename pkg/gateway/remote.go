@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.design/x/chann"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// remoteGateway forwards the requests of the replay client to the front door of a gateway on another machine,
+// so that several load generators can drive the same gateway; the gateway state stays on that machine
+type remoteGateway struct {
+	addr     string
+	conn     *grpc.ClientConn
+	inputs   map[string]*onceBuffer[*Request]
+	output   ResponseBuffer
+	inFlight sync.WaitGroup
+	logger   klog.Logger
+	// completions of the targets finished by this client, the remote gateway serves other clients too
+	completions *chann.Chann[*Completion]
+}
+
+// NewRemoteGateway returns a gateway whose requests are served by the front door at addr, see ServeFrontDoor
+func NewRemoteGateway(addr string) (*remoteGateway, error) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create front door client for %v: %v", addr, err)
+	}
+	return &remoteGateway{
+		addr:        addr,
+		conn:        conn,
+		inputs:      make(map[string]*onceBuffer[*Request]),
+		output:      chann.New[*Response](),
+		logger:      klog.Background(),
+		completions: chann.New[*Completion](),
+	}, nil
+}
+
+var _ Gateway = &remoteGateway{}
+
+// RequestChan registers target on first use, which must happen before Start
+func (g *remoteGateway) RequestChan(target string) chan<- *Request {
+	input, ok := g.inputs[target]
+	if !ok {
+		input = newOnceBuffer(chann.New[*Request]())
+		g.inputs[target] = input
+	}
+	return input.In()
+}
+
+// per-target responses are not supported, the front door only serves the fan-in
+func (g *remoteGateway) ResponseChan(target string) <-chan *Response {
+	return nil
+}
+
+func (g *remoteGateway) Responses() <-chan *Response {
+	return g.output.Out()
+}
+
+// FinishTarget only finishes the requests of this client, the target stays open at the remote gateway
+func (g *remoteGateway) FinishTarget(target string) {
+	if input, ok := g.inputs[target]; ok {
+		input.Close()
+	}
+}
+
+func (g *remoteGateway) Completions() <-chan *Completion {
+	return g.completions.Out()
+}
+
+func (g *remoteGateway) Autoscaler() autoscaler.Autoscaler {
+	return nil
+}
+
+// duplicates and shed requests are counted by the remote gateway
+func (g *remoteGateway) Duplicates() int64 {
+	return 0
+}
+
+func (g *remoteGateway) Shed() int64 {
+	return 0
+}
+
+func (g *remoteGateway) SampleHops(every int, path string) error {
+	if every > 0 {
+		return fmt.Errorf("per-hop sampling is not supported by the remote gateway, sample at %v instead", g.addr)
+	}
+	return nil
+}
+
+func (g *remoteGateway) ExportSpans(endpoint string) error {
+	if endpoint != "" {
+		return fmt.Errorf("spans are exported by the remote gateway at %v", g.addr)
+	}
+	return nil
+}
+
+func (g *remoteGateway) Snapshot() *Snapshot {
+	return &Snapshot{Time: time.Now(), Keys: make(map[string]*KeySnapshot)}
+}
+
+func (g *remoteGateway) StartSnapshots(ctx context.Context, interval time.Duration, capacity int) {}
+
+func (g *remoteGateway) ServeAdmin(ctx context.Context, addr string) error {
+	return fmt.Errorf("the admin endpoint is served by the remote gateway at %v", g.addr)
+}
+
+func (g *remoteGateway) ServeFrontDoor(ctx context.Context, addr string) error {
+	return fmt.Errorf("a remote gateway cannot serve a front door")
+}
+
+func (g *remoteGateway) SetUpWithManager(ctx context.Context, mgr manager.Manager) error {
+	g.logger = klog.FromContext(ctx).WithValues("gateway", "remote", "addr", g.addr)
+	return nil
+}
+
+func (g *remoteGateway) Start(ctx context.Context) error {
+	g.logger.Info("Forwarding requests to remote gateway", "targets", len(g.inputs))
+	for key := range g.inputs {
+		go g.forward(ctx, key, g.inputs[key].Out())
+	}
+	return nil
+}
+
+func (g *remoteGateway) forward(ctx context.Context, key string, requests <-chan *Request) {
+	var targetInFlight sync.WaitGroup
+	var delivered int64
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				// finished, complete once the invocations in flight return
+				g.inFlight.Add(1)
+				go func() {
+					defer g.inFlight.Done()
+					targetInFlight.Wait()
+					g.completions.In() <- &Completion{Target: key, Responses: atomic.LoadInt64(&delivered)}
+				}()
+				return
+			}
+			g.inFlight.Add(1)
+			targetInFlight.Add(1)
+			go func() {
+				defer g.inFlight.Done()
+				defer targetInFlight.Done()
+				g.output.In() <- g.invoke(ctx, req)
+				atomic.AddInt64(&delivered, 1)
+			}()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (g *remoteGateway) invoke(ctx context.Context, req *Request) *Response {
+	res := &Response{}
+	if err := g.conn.Invoke(ctx, frontDoorInvoke, req, res); err != nil {
+		g.logger.V(1).Info("[WARN] Remote invocation failed", "id", req.ID, "error", err)
+		res = &Response{Source: req}
+		switch status.Code(err) {
+		case codes.NotFound:
+			res.Status = INVALID_TARGET
+		case codes.DeadlineExceeded, codes.Canceled:
+			res.Status = FAIL_TIMEOUT
+		case codes.Unavailable:
+			res.Status = FAIL_CONNECT
+		default:
+			res.Status = FAIL_SEND
+		}
+		return res
+	}
+	if res.Source == nil {
+		res.Source = req
+	}
+	// keep the local send stamp, its monotonic reading does not survive the wire
+	res.Source.ClientSendTS = req.ClientSendTS
+	return res
+}
+
+// Close waits for the invocations in flight, which the canceled run context cuts short
+func (g *remoteGateway) Close() {
+	g.inFlight.Wait()
+	g.output.Close()
+	g.completions.Close()
+	for _, input := range g.inputs {
+		input.Close()
+	}
+	g.conn.Close()
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// hopSampler traces every Nth request through the gateway and writes its per-hop timing to a dedicated file
+type hopSampler struct {
+	every int64
+	mu    sync.Mutex
+	n     int64
+	file  *os.File
+	w     *bufio.Writer
+}
+
+func newHopSampler(every int, path string) (*hopSampler, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace sample output: %v", err)
+	}
+	return &hopSampler{
+		every: int64(every),
+		file:  file,
+		w:     bufio.NewWriter(file),
+	}, nil
+}
+
+// attach marks req for tracing if it is the Nth one
+func (s *hopSampler) attach(req *Request) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.n++
+	sampled := s.n%s.every == 0
+	s.mu.Unlock()
+	if sampled {
+		req.Hops = &Hops{}
+	}
+}
+
+func (s *hopSampler) write(res *Response) {
+	if s == nil || res.Source.Hops == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.WriteString(res.HopsSummary())
+}
+
+func (s *hopSampler) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Flush()
+	s.file.Close()
+}
+
+// SampleHops writes the per-hop timing of every Nth request to path, must be called before Start
+func (g *gatewayImpl) SampleHops(every int, path string) error {
+	if every <= 0 {
+		return nil
+	}
+	sampler, err := newHopSampler(every, path)
+	if err != nil {
+		return err
+	}
+	g.sampler = sampler
+	return nil
+}
@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const defaultSnapshotCapacity = 120
+
+// KeySnapshot is the shadow state of a single target
+type KeySnapshot struct {
+	// requests waiting to be relayed, and relayed requests waiting for the dispatcher
+	ExternalQueue int `json:"externalQueue"`
+	InternalQueue int `json:"internalQueue"`
+	// relayed requests without a response yet
+	InFlight int64 `json:"inFlight"`
+	// nil if the gateway does not track endpoints or the autoscaler does not expose its decisions
+	Endpoints *int `json:"endpoints,omitempty"`
+	Desired   *int `json:"desired,omitempty"`
+	// arrivals and responses per second, and the mean gateway latency of the successful responses,
+	// since the previous recorded snapshot; nil in fresh snapshots and the first recorded one
+	RPS         *float64 `json:"rps,omitempty"`
+	CompletedPS *float64 `json:"completedPerSecond,omitempty"`
+	LatencyMs   *float64 `json:"latencyMs,omitempty"`
+}
+
+type Snapshot struct {
+	// increases by one per recorded snapshot starting from 1, 0 in fresh snapshots
+	Seq  int64                   `json:"seq"`
+	Time time.Time               `json:"time"`
+	Keys map[string]*KeySnapshot `json:"keys"`
+}
+
+// snapshotRing keeps the latest snapshots, oldest first when dumped
+type snapshotRing struct {
+	mu   sync.Mutex
+	buf  []*Snapshot
+	next int
+	full bool
+	seq  int64
+	// closed and replaced on every add, wakes up the watchers
+	added chan struct{}
+}
+
+func newSnapshotRing(capacity int) *snapshotRing {
+	if capacity <= 0 {
+		capacity = defaultSnapshotCapacity
+	}
+	return &snapshotRing{buf: make([]*Snapshot, capacity), added: make(chan struct{})}
+}
+
+func (r *snapshotRing) add(s *Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	s.Seq = r.seq
+	close(r.added)
+	r.added = make(chan struct{})
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// latest n snapshots, all if n <= 0
+func (r *snapshotRing) dump(n int) []*Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest(n)
+}
+
+// must hold mu
+func (r *snapshotRing) latest(n int) []*Snapshot {
+	var out []*Snapshot
+	if r.full {
+		out = append(out, r.buf[r.next:]...)
+	}
+	out = append(out, r.buf[:r.next]...)
+	if n > 0 && n < len(out) {
+		out = out[len(out)-n:]
+	}
+	return out
+}
+
+// watch returns the snapshots recorded after seq, waiting for the next one until ctx is done if there are none
+func (r *snapshotRing) watch(ctx context.Context, seq int64) []*Snapshot {
+	for {
+		r.mu.Lock()
+		if r.seq > seq {
+			n := int(min(r.seq-seq, int64(len(r.buf))))
+			out := r.latest(n)
+			r.mu.Unlock()
+			return out
+		}
+		added := r.added
+		r.mu.Unlock()
+		select {
+		case <-added:
+		case <-ctx.Done():
+			return []*Snapshot{}
+		}
+	}
+}
+
+func (g *gatewayImpl) snapshot(now time.Time) *Snapshot {
+	s := &Snapshot{Time: now, Keys: make(map[string]*KeySnapshot, len(g.externalInputs))}
+	for key := range g.externalInputs {
+		ks := &KeySnapshot{
+			ExternalQueue: g.externalInputs[key].Len(),
+			InternalQueue: g.internalInputBuffers[key].Len(),
+			InFlight:      atomic.LoadInt64(g.inFlight[key]),
+		}
+		if g.endpointsOf != nil {
+			n := g.endpointsOf(key)
+			ks.Endpoints = &n
+		}
+		if g.desiredOf != nil {
+			if n, ok := g.desiredOf(key); ok {
+				ks.Desired = &n
+			}
+		}
+		s.Keys[key] = ks
+	}
+	return s
+}
+
+// Snapshot returns the current shadow state of the gateway
+func (g *gatewayImpl) Snapshot() *Snapshot {
+	return g.snapshot(time.Now())
+}
+
+// StartSnapshots records the shadow state of the gateway every interval into a ring buffer of the given capacity
+func (g *gatewayImpl) StartSnapshots(ctx context.Context, interval time.Duration, capacity int) {
+	if interval <= 0 {
+		return
+	}
+	g.snapshots = newSnapshotRing(capacity)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		prev := make(map[string]keyTraffic)
+		var last time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s := g.snapshot(now)
+				var elapsed time.Duration
+				if !last.IsZero() {
+					elapsed = now.Sub(last)
+				}
+				g.trafficRates(s, elapsed, prev)
+				last = now
+				g.snapshots.add(s)
+			}
+		}
+	}()
+}
+
+// GET /debug/snapshots[?n=N] dumps the latest N snapshots, and /debug/state takes a fresh one
+func (g *gatewayImpl) snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	if g.snapshots == nil {
+		http.Error(w, "snapshots are not enabled", http.StatusNotFound)
+		return
+	}
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	writeJSON(w, g.snapshots.dump(n))
+}
+
+func (g *gatewayImpl) stateHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, g.snapshot(time.Now()))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ServeAdmin exposes the gateway state until ctx is done
+func (g *gatewayImpl) ServeAdmin(ctx context.Context, addr string) error {
+	logger := klog.FromContext(ctx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/snapshots", g.snapshotsHandler)
+	mux.HandleFunc("/debug/state", g.stateHandler)
+	mux.HandleFunc("/watch", g.watchHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger.Info("Serving gateway admin endpoint", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to serve gateway admin endpoint: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	spanFlushPeriod = time.Second
+	// spans buffered while the collector is slow or down, dropped beyond
+	maxPendingSpans = 100000
+	// span kinds and status codes of the OTLP protocol
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	spanStatusOk     = 1
+	spanStatusError  = 2
+)
+
+// the OTLP/HTTP JSON encoding of the spans, see opentelemetry-proto; ids are hex, timestamps decimal strings
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            map[string]int  `json:"status,omitempty"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]string{"stringValue": value}}
+}
+
+// spanIDs derives the trace of a request from its ID, so that its spans can be looked up by request ID
+func spanIDs(requestID string) (traceID string, spanID func(name string) string) {
+	h := fnv.New128a()
+	h.Write([]byte(requestID))
+	traceID = hex.EncodeToString(h.Sum(nil))
+	spanID = func(name string) string {
+		h := fnv.New64a()
+		h.Write([]byte(requestID + "/" + name))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	return traceID, spanID
+}
+
+// requestSpans breaks a sampled response down into a root span over its time in the gateway
+// and a child span per hop: relay queueing, dispatch, connection, send and execution; missing hops are skipped
+func requestSpans(res *Response) []otlpSpan {
+	req := res.Source
+	hops := req.Hops
+	if hops == nil || req.GatewayRecvTS.IsZero() || res.GatewayRecvTS.IsZero() {
+		return nil
+	}
+	traceID, spanID := spanIDs(req.ID)
+	root := spanID("gateway")
+	newSpan := func(name string, kind int, from, to time.Time) otlpSpan {
+		return otlpSpan{
+			TraceID:           traceID,
+			SpanID:            spanID(name),
+			Name:              name,
+			Kind:              kind,
+			StartTimeUnixNano: strconv.FormatInt(from.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(to.UnixNano(), 10),
+		}
+	}
+	status := spanStatusOk
+	if res.Status != SUCCESS {
+		status = spanStatusError
+	}
+	gateway := newSpan("gateway", spanKindServer, req.GatewayRecvTS, res.GatewayRecvTS)
+	gateway.Attributes = []otlpAttribute{
+		stringAttribute("request.id", req.ID),
+		stringAttribute("request.target", req.Target),
+		stringAttribute("response.status", res.Status.String()),
+		stringAttribute("endpoint", hops.Endpoint),
+	}
+	gateway.Status = map[string]int{"code": status}
+	spans := []otlpSpan{gateway}
+	child := func(name string, kind int, from, to time.Time, attributes ...otlpAttribute) {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return
+		}
+		span := newSpan(name, kind, from, to)
+		span.ParentSpanID = root
+		span.Attributes = attributes
+		spans = append(spans, span)
+	}
+	// a request that never got an endpoint ends its dispatch with its response
+	acquired := hops.TokenAcquired
+	if acquired.IsZero() {
+		acquired = res.GatewayRecvTS
+	}
+	child("relay", spanKindInternal, req.GatewayRecvTS, hops.DispatchStart)
+	child("dispatch", spanKindInternal, hops.DispatchStart, acquired)
+	child("connect", spanKindInternal, hops.TokenAcquired, hops.ConnAcquired, stringAttribute("connection.new", strconv.FormatBool(hops.NewConn)))
+	child("send", spanKindInternal, hops.ConnAcquired, req.GatewaySendTS)
+	child("execute", spanKindClient, req.GatewaySendTS, res.GatewayRecvTS, stringAttribute("endpoint", hops.Endpoint))
+	return spans
+}
+
+// spanExporter posts the spans of the sampled requests to an OTLP/HTTP collector in the background,
+// JSON-encoded so that no OpenTelemetry module is needed
+type spanExporter struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	pending   []otlpSpan
+	nExported int64
+	nDropped  int64
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+func newSpanExporter(endpoint string) *spanExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	e := &spanExporter{
+		url:     url + "/v1/traces",
+		client:  &http.Client{Timeout: 10 * time.Second},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *spanExporter) export(res *Response) {
+	if e == nil || res.Source.Hops == nil {
+		return
+	}
+	spans := requestSpans(res)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.pending)+len(spans) > maxPendingSpans {
+		e.nDropped += int64(len(spans))
+		return
+	}
+	e.pending = append(e.pending, spans...)
+}
+
+func (e *spanExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(spanFlushPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.stop:
+			e.flush()
+			return
+		}
+	}
+}
+
+func (e *spanExporter) flush() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.post(spans); err != nil {
+		klog.V(1).InfoS("[WARN] Failed to export spans", "url", e.url, "spans", len(spans), "error", err)
+		e.mu.Lock()
+		e.nDropped += int64(len(spans))
+		e.mu.Unlock()
+		return
+	}
+	e.mu.Lock()
+	e.nExported += int64(len(spans))
+	e.mu.Unlock()
+}
+
+func (e *spanExporter) post(spans []otlpSpan) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{stringAttribute("service.name", "kubedirect-bench-gateway")},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/tomquartz/kubedirect-bench/pkg/gateway"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %v", err)
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %v", resp.Status)
+	}
+	return nil
+}
+
+// close exports the remaining spans
+func (e *spanExporter) close() {
+	if e == nil {
+		return
+	}
+	close(e.stop)
+	<-e.stopped
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	klog.InfoS("Exported request spans", "url", e.url, "exported", e.nExported, "dropped", e.nDropped)
+}
+
+// ExportSpans sends the hops of the requests sampled by SampleHops as OpenTelemetry spans to the OTLP/HTTP collector
+// at endpoint, e.g., localhost:4318, one trace per request keyed by its ID; must be called before Start
+func (g *gatewayImpl) ExportSpans(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	if g.sampler == nil {
+		return fmt.Errorf("spans are only exported for sampled requests, enable hop sampling first")
+	}
+	g.spans = newSpanExporter(endpoint)
+	return nil
+}
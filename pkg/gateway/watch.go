@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	//lint:ignore ST1001 Allow dot imports
+	. "github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// keyTraffic counts the requests and responses relayed for a key, written by its relay only
+type keyTraffic struct {
+	arrivals     int64
+	responses    int64
+	succeeded    int64
+	latencyNanos int64
+}
+
+func (t *keyTraffic) arrive() {
+	atomic.AddInt64(&t.arrivals, 1)
+}
+
+// respond counts res, and its latency through the gateway if it succeeded
+func (t *keyTraffic) respond(res *Response) {
+	atomic.AddInt64(&t.responses, 1)
+	if res.Status != SUCCESS || res.Source.GatewayRecvTS.IsZero() {
+		return
+	}
+	atomic.AddInt64(&t.succeeded, 1)
+	atomic.AddInt64(&t.latencyNanos, int64(res.GatewayRecvTS.Sub(res.Source.GatewayRecvTS)))
+}
+
+func (t *keyTraffic) load() keyTraffic {
+	return keyTraffic{
+		arrivals:     atomic.LoadInt64(&t.arrivals),
+		responses:    atomic.LoadInt64(&t.responses),
+		succeeded:    atomic.LoadInt64(&t.succeeded),
+		latencyNanos: atomic.LoadInt64(&t.latencyNanos),
+	}
+}
+
+// trafficRates fills the rates of each key of s over the interval since the previous snapshot,
+// prev holds the counters of the previous snapshot and is updated in place
+func (g *gatewayImpl) trafficRates(s *Snapshot, interval time.Duration, prev map[string]keyTraffic) {
+	for key, ks := range s.Keys {
+		cur := g.traffic[key].load()
+		last, ok := prev[key]
+		prev[key] = cur
+		if !ok || interval <= 0 {
+			continue
+		}
+		rps := float64(cur.arrivals-last.arrivals) / interval.Seconds()
+		completed := float64(cur.responses-last.responses) / interval.Seconds()
+		ks.RPS, ks.CompletedPS = &rps, &completed
+		if n := cur.succeeded - last.succeeded; n > 0 {
+			latency := float64(cur.latencyNanos-last.latencyNanos) / float64(n) / float64(time.Millisecond)
+			ks.LatencyMs = &latency
+		}
+	}
+}
+
+// GET /watch?after=SEQ[&timeout=SECONDS] long-polls the snapshots: it returns those recorded after SEQ,
+// waiting up to the timeout for the next one if there are none yet, in which case the list is empty.
+// Observers pass the seq of the last snapshot they got, starting from 0, to follow the run without gaps
+// as long as they poll again within the capacity of the ring
+func (g *gatewayImpl) watchHandler(w http.ResponseWriter, r *http.Request) {
+	if g.snapshots == nil {
+		http.Error(w, "snapshots are not enabled", http.StatusNotFound)
+		return
+	}
+	after, err := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	if err != nil && r.URL.Query().Has("after") {
+		http.Error(w, "after must be an integer", http.StatusBadRequest)
+		return
+	}
+	timeout := defaultWatchTimeout
+	if s := r.URL.Query().Get("timeout"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds < 0 {
+			http.Error(w, "timeout must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, maxWatchTimeout)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	writeJSON(w, g.snapshots.watch(ctx, after))
+}
@@ -3,6 +3,7 @@ package replay
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	// Kubedirect
+	"github.com/tomquartz/kubedirect-bench/pkg/autoscaler"
 	"github.com/tomquartz/kubedirect-bench/pkg/gateway"
 	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
 	"github.com/tomquartz/kubedirect-bench/pkg/workload"
@@ -27,14 +29,53 @@ func SampleOutput(factor int) {
 	sampleOutputFactor = factor
 }
 
+// fraction of the invocations of unlabeled targets tagged with the batch class
+var batchFraction = 0.
+
+func TagBatch(fraction float64) {
+	batchFraction = fraction
+}
+
+// fraction of the invocations of each target raised one above its priority label
+var highPriorityFraction = 0.
+
+func RaisePriority(fraction float64) {
+	highPriorityFraction = fraction
+}
+
+// if positive, the invocations of each target are spread over this many affinity keys
+var affinitySessions = 0
+
+func UseSessions(n int) {
+	affinitySessions = n
+}
+
+// if positive, each worker replays its trace over and over until this long after the start
+var soakDuration time.Duration
+
+func Soak(d time.Duration) {
+	soakDuration = d
+}
+
+// requested runtimes are multiplied by the factor, or replaced if the fixed runtime is positive
+var runtimeFactor = 1.
+var fixedRuntimeMilliSec = 0
+
+func ScaleRuntime(factor float64, fixedMilliSec int) {
+	runtimeFactor = factor
+	fixedRuntimeMilliSec = fixedMilliSec
+}
+
 type Client struct {
 	gateway    gateway.Gateway
 	traces     []*workload.TraceSpec
 	workers    map[string]*worker
-	outputFile *os.File
+	outputFile io.WriteCloser
 	client     client.Client
 	finishSend chan struct{}
 	finishRecv chan struct{}
+	// closed once the summaries of all targets are written
+	drained chan struct{}
 }
 
 func NewClient(ctx context.Context, gateway gateway.Gateway, loaderConfig string, outputPath string) (*Client, error) {
@@ -43,8 +84,13 @@ func NewClient(ctx context.Context, gateway gateway.Gateway, loaderConfig string
 	logger.Info("Loading trace specs...", "config", loaderConfig)
 	traces := workload.LoadTraceFromConfig(loaderConfig)
 	logger.Info("Finished loading", "total", len(traces))
+	if fixedRuntimeMilliSec > 0 || runtimeFactor != 1 {
+		workload.ScaleRuntimes(traces, runtimeFactor, fixedRuntimeMilliSec)
+		logger.Info("Scaled runtimes", "factor", runtimeFactor, "fixed", fixedRuntimeMilliSec)
+	}
 
-	outputFile, err := os.Create(outputPath)
+	// compressed on the fly if the path ends with .gz or .zst
+	outputFile, err := benchutil.CreateOutput(outputPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create output file %v: %v", outputPath, err)
 	}
@@ -56,32 +102,63 @@ func NewClient(ctx context.Context, gateway gateway.Gateway, loaderConfig string
 		outputFile: outputFile,
 		finishSend: make(chan struct{}),
 		finishRecv: make(chan struct{}),
+		drained:    make(chan struct{}),
 	}, nil
 }
 
+// FunctionStats returns the statistics of the loaded traces, in trace order
+// FunctionStats returns the statistics of the trace each target replays, by target key
+func (c *Client) FunctionStats(ctx context.Context, mgr manager.Manager) (map[string]*workload.FunctionStats, error) {
+	targets, err := c.listTargets(ctx, benchutil.NewUncachedClientOrDie(mgr))
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]*workload.FunctionStats, len(targets))
+	for i := range targets {
+		stats[workload.KeyFromObject(&targets[i])] = workload.NewFunctionStats(c.traces[i])
+	}
+	return stats, nil
+}
+
+// listTargets lists the trace deployments, the i-th of which replays the i-th trace.
+// NOTE: the trace of a target is picked by its list index regardless of sharding,
+// so that every target replays the same trace whichever shard owns it
+func (c *Client) listTargets(ctx context.Context, reader client.Reader) ([]appsv1.Deployment, error) {
+	// NOTE: deployments are the common basis for both knative and k8s workloads
+	targets := &appsv1.DeploymentList{}
+	if err := reader.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
+		return nil, fmt.Errorf("error listing deployments in client: %v", err)
+	}
+	if len(targets.Items) > len(c.traces) {
+		return nil, fmt.Errorf("mismatched deployments and traces: expected %d, got %d", len(c.traces), len(targets.Items))
+	}
+	return targets.Items, nil
+}
+
 func (c *Client) SetupWithManager(ctx context.Context, mgr manager.Manager) error {
 	logger := klog.FromContext(ctx)
 
 	c.client = mgr.GetClient()
 
 	// setup a temporary client to list services because manager hasn't started yet
-	uncachedClient := benchutil.NewUncachedClientOrDie(mgr)
-
-	// NOTE: deployments are the common basis for both knative and k8s workloads
-	targets := &appsv1.DeploymentList{}
-	if err := uncachedClient.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
-		return fmt.Errorf("error listing deployments in client: %v", err)
+	targets, err := c.listTargets(ctx, benchutil.NewUncachedClientOrDie(mgr))
+	if err != nil {
+		return err
 	}
-	if len(targets.Items) > len(c.traces) {
-		return fmt.Errorf("mismatched deployments and traces: expected %d, got %d", len(c.traces), len(targets.Items))
-	} else if len(targets.Items) < len(c.traces) {
-		logger.Info(fmt.Sprintf("Using the first %d traces out of %d", len(targets.Items), len(c.traces)))
+	if len(targets) < len(c.traces) {
+		logger.Info(fmt.Sprintf("Using the first %d traces out of %d", len(targets), len(c.traces)))
 	}
 
-	for i := range targets.Items {
-		target := &targets.Items[i]
+	for i := range targets {
+		target := &targets[i]
 		key := workload.KeyFromObject(target)
-		wrk := newWorker(key, c.traces[i], c.gateway.RequestChan(key))
+		if !workload.OwnsKey(key) {
+			continue
+		}
+		wrk := newWorker(key, c.traces[i], c.gateway.RequestChan(key)).
+			withClass(workload.ClassOfObject(target), batchFraction).
+			withSessions(affinitySessions).
+			withPriority(workload.PriorityOfObject(target), highPriorityFraction)
 		c.workers[key] = wrk
 		logger.V(1).Info(fmt.Sprintf("Registered worker %v", key), "senders", wrk.nSenders, "trace", wrk.trace.String())
 	}
@@ -97,34 +174,103 @@ func (c *Client) recv(_ context.Context) {
 	go c.write(writerChan.Out())
 	// fan-in responses from all workers
 	// gateway must close the response chan when shutting down
-	for res := range c.gateway.ResponseChan("") {
+	for res := range c.gateway.Responses() {
 		// logger.V(1).Info("Received response", "id", res.Source.ID, "target", res.Source.Target, "content", res.String())
 		res.ClientRecvTS = time.Now()
 		writerChan.In() <- res
 	}
 }
 
+// targetTally counts the responses of a target until its summary is written
+type targetTally struct {
+	total, failed int64
+	// the completion of the gateway, nil until received
+	completion *gateway.Completion
+}
+
+// summarize writes the summary of the target once the gateway completed it and all its responses are counted,
+// a completion may overtake the last responses of its target
+func (c *Client) summarize(tally *targetTally) bool {
+	if tally.completion == nil || tally.total < tally.completion.Responses {
+		return false
+	}
+	summary := fmt.Sprintf("Target: %v total %v success %v fail %v\n",
+		tally.completion.Target, tally.total, tally.total-tally.failed, tally.failed)
+	if _, err := io.WriteString(c.outputFile, summary); err != nil {
+		panic(fmt.Sprintf("Failed to write target summary: %v", err))
+	}
+	tally.completion = nil
+	return true
+}
+
 func (c *Client) write(responses <-chan *workload.Response) {
 	var nTotal, nFailed int64
-	for res := range responses {
-		if res == nil {
-			break
+	tallies := make(map[string]*targetTally, len(c.workers))
+	tallyOf := func(target string) *targetTally {
+		tally, ok := tallies[target]
+		if !ok {
+			tally = &targetTally{}
+			tallies[target] = tally
 		}
-		nTotal++
-		if res.Status != workload.SUCCESS {
-			nFailed++
+		return tally
+	}
+	// the targets whose summaries are pending, closing drained when none are left
+	pending := len(c.workers)
+	summarized := func() {
+		if pending--; pending == 0 {
+			close(c.drained)
 		}
-		if nTotal%int64(sampleOutputFactor) == 0 {
-			if _, err := c.outputFile.WriteString(res.Summary()); err != nil {
-				panic(fmt.Sprintf("Failed to write response: %v", err))
+	}
+	completions := c.gateway.Completions()
+	for responses != nil {
+		select {
+		case res, ok := <-responses:
+			if !ok || res == nil {
+				responses = nil
+				continue
+			}
+			nTotal++
+			tally := tallyOf(res.Source.Target)
+			tally.total++
+			if res.Status != workload.SUCCESS {
+				nFailed++
+				tally.failed++
+			}
+			if nTotal%int64(sampleOutputFactor) == 0 {
+				if _, err := io.WriteString(c.outputFile, res.Summary()); err != nil {
+					panic(fmt.Sprintf("Failed to write response: %v", err))
+				}
+			}
+			if c.summarize(tally) {
+				summarized()
+			}
+		case completion, ok := <-completions:
+			if !ok {
+				completions = nil
+				continue
+			}
+			tally := tallyOf(completion.Target)
+			tally.completion = completion
+			if c.summarize(tally) {
+				summarized()
 			}
 		}
 	}
-	if _, err := c.outputFile.WriteString(fmt.Sprintf("Summary: total %v success %v fail %v\n", nTotal, nTotal-nFailed, nFailed)); err != nil {
+	if _, err := io.WriteString(c.outputFile, fmt.Sprintf("Summary: total %v success %v fail %v duplicate %v shed %v\n", nTotal, nTotal-nFailed, nFailed, c.gateway.Duplicates(), c.gateway.Shed())); err != nil {
 		panic(fmt.Sprintf("Failed to write request summary: %v", err))
 	}
-	c.outputFile.Sync()
-	c.outputFile.Close()
+	if reporter, ok := c.gateway.Autoscaler().(autoscaler.CostReporter); ok {
+		cost := reporter.Cost()
+		if _, err := io.WriteString(c.outputFile, fmt.Sprintf("Cost: pod-seconds %.1f cost %.1f\n", cost.PodSeconds, cost.Cost)); err != nil {
+			panic(fmt.Sprintf("Failed to write cost summary: %v", err))
+		}
+	}
+	if file, ok := c.outputFile.(*os.File); ok {
+		file.Sync()
+	}
+	if err := c.outputFile.Close(); err != nil {
+		panic(fmt.Sprintf("Failed to close output: %v", err))
+	}
 	close(c.finishRecv)
 }
 
@@ -136,6 +282,17 @@ func (c *Client) FinishRecv() <-chan struct{} {
 	return c.finishRecv
 }
 
+// Drained fires once every target is finished and the responses of its requests are all written
+func (c *Client) Drained() <-chan struct{} {
+	return c.drained
+}
+
+// Record only writes the responses of the gateway, e.g., to the invocations through its front door,
+// until the gateway closes the response channel; FinishSend never fires
+func (c *Client) Record(ctx context.Context) {
+	go c.recv(ctx)
+}
+
 // NOTE: ctx is not used to stop the client
 func (c *Client) Start(ctx context.Context) error {
 	logger := klog.FromContext(ctx)
@@ -149,6 +306,8 @@ func (c *Client) Start(ctx context.Context) error {
 		go func() {
 			defer wg.Done()
 			worker.replay(ctx, start)
+			// the summary of the target is written as soon as its requests in flight are answered
+			c.gateway.FinishTarget(key)
 		}()
 	}
 
@@ -0,0 +1,106 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	// Kubedirect
+	benchutil "github.com/tomquartz/kubedirect-bench/pkg/util"
+	"github.com/tomquartz/kubedirect-bench/pkg/workload"
+)
+
+// waiting reasons of a container that will not go away by themselves within a run
+var brokenContainerReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+}
+
+// CheckHealth returns the reason of every trace target that is broken before the run starts, by key:
+// a deployment whose rollout failed, without a ReplicaSet to take the pod template from,
+// or with pods that cannot pull their image or keep crashing.
+// Must be called before the manager starts.
+func CheckHealth(ctx context.Context, mgr manager.Manager) (map[string]string, error) {
+	logger := klog.FromContext(ctx)
+	uncachedClient := benchutil.NewUncachedClientOrDie(mgr)
+
+	targets := &appsv1.DeploymentList{}
+	if err := uncachedClient.List(ctx, targets, workload.CtrlListOptionsForTrace...); err != nil {
+		return nil, fmt.Errorf("error listing deployments in health check: %v", err)
+	}
+	unhealthy := make(map[string]string)
+	for i := range targets.Items {
+		target := &targets.Items[i]
+		key := workload.KeyFromObject(target)
+		if !workload.OwnsKey(key) {
+			continue
+		}
+		reason, err := checkTarget(ctx, uncachedClient, target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the health of %v: %v", key, err)
+		}
+		if reason != "" {
+			unhealthy[key] = reason
+			logger.Info("[WARN] Unhealthy target", "target", key, "reason", reason)
+		}
+	}
+	logger.Info("Checked target health", "total", len(targets.Items), "unhealthy", len(unhealthy))
+	return unhealthy, nil
+}
+
+// checkTarget returns why the target is broken, empty if it is not
+func checkTarget(ctx context.Context, c client.Client, target *appsv1.Deployment) (string, error) {
+	for _, cond := range target.Status.Conditions {
+		if cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("replica failure: %v", cond.Message), nil
+		}
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("rollout stuck: %v", cond.Message), nil
+		}
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := c.List(ctx, replicaSets,
+		client.InNamespace(target.Namespace),
+		client.MatchingLabels(target.Spec.Selector.MatchLabels),
+	); err != nil {
+		return "", fmt.Errorf("failed to list replicasets: %v", err)
+	}
+	owned := false
+	for i := range replicaSets.Items {
+		for _, ref := range replicaSets.Items[i].OwnerReferences {
+			if ref.UID == target.UID {
+				owned = true
+			}
+		}
+	}
+	if !owned {
+		return "no replicaset, thus no pod template", nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods,
+		client.InNamespace(target.Namespace),
+		client.MatchingLabels(target.Spec.Template.Labels),
+	); err != nil {
+		return "", fmt.Errorf("failed to list pods: %v", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		for _, status := range pod.Status.ContainerStatuses {
+			if waiting := status.State.Waiting; waiting != nil && brokenContainerReasons[waiting.Reason] {
+				return fmt.Sprintf("pod %v: %v", pod.Name, waiting.Reason), nil
+			}
+		}
+	}
+	return "", nil
+}
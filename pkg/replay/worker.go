@@ -22,6 +22,14 @@ type worker struct {
 	clientStartTime   time.Time
 	nSenders          int
 	senderInvocations [][]*workload.InvocationSpec
+	// class of all invocations if set, otherwise batchFraction of them are sampled as batch
+	class         string
+	batchFraction float64
+	// number of affinity keys, none if zero
+	sessions int
+	// base priority of the invocations, highFraction of them are sampled one above
+	priority     int
+	highFraction float64
 }
 
 func newWorker(target string, trace *workload.TraceSpec, send chan<- *workload.Request) *worker {
@@ -41,22 +49,59 @@ func newWorker(target string, trace *workload.TraceSpec, send chan<- *workload.R
 	}
 }
 
+func (w *worker) withClass(class string, batchFraction float64) *worker {
+	w.class = class
+	w.batchFraction = batchFraction
+	return w
+}
+
+func (w *worker) withSessions(sessions int) *worker {
+	w.sessions = sessions
+	return w
+}
+
+func (w *worker) withPriority(priority int, highFraction float64) *worker {
+	w.priority = priority
+	w.highFraction = highFraction
+	return w
+}
+
 func (w *worker) next(nextRequestTime float64) <-chan time.Time {
 	nextSendTS := w.clientStartTime.Add(time.Duration(nextRequestTime * float64(time.Second)))
 	return time.After(time.Until(nextSendTS))
 }
 
-func (w *worker) send(senderID int) {
+// the length of one replay of the trace, at least its last arrival
+func (w *worker) period() time.Duration {
+	period := time.Duration(w.trace.DurationMinutes) * time.Minute
+	for _, invocation := range w.trace.Invocations {
+		period = max(period, time.Duration(invocation.ArrivalTimeSec*float64(time.Second)))
+	}
+	return max(period, time.Second)
+}
+
+func (w *worker) send(senderID int, round int) {
 	for reqID, spec := range w.senderInvocations[senderID] {
 		now := <-w.next(spec.ArrivalTimeSec)
+		id := fmt.Sprintf("%s-%d/%d", w.target, senderID, reqID)
+		if round > 0 {
+			// IDs must stay unique across the rounds of a soak
+			id = fmt.Sprintf("%s@%d", id, round)
+		}
 		req := &workload.Request{
-			ID:               fmt.Sprintf("%s-%d/%d", w.target, senderID, reqID),
+			ID:               id,
 			Target:           w.target,
 			DurationMilliSec: spec.RuntimeMilliSec,
 			ClientSendTS:     now,
 			ClientRelTime:    now.Sub(w.clientStartTime),
 			TraceRelTime:     time.Duration(spec.ArrivalTimeSec * float64(time.Second)),
 		}
+		req.Class = w.class
+		if req.Class == "" {
+			req.Class = workload.SampleClass(req.ID, w.batchFraction)
+		}
+		req.AffinityKey = workload.SampleAffinity(req.ID, w.sessions)
+		req.Priority = workload.SamplePriority(req.ID, w.priority, w.highFraction)
 		// logger.V(1).Info("sending request", "time", t, "id", req.ID)
 		w.toGateway <- req
 	}
@@ -66,15 +111,22 @@ func (w *worker) send(senderID int) {
 func (w *worker) replay(ctx context.Context, start time.Time) {
 	logger := klog.FromContext(ctx).WithValues("target", w.target)
 	logger.Info("Starting trace replay", "senders", w.nSenders, "trace", w.trace.String())
-	w.clientStartTime = start
-	var wg sync.WaitGroup
-	wg.Add(w.nSenders)
-	for i := 0; i < w.nSenders; i++ {
-		go func(i int) {
-			defer wg.Done()
-			w.send(i)
-		}(i)
+	period := w.period()
+	for round := 0; ; round++ {
+		w.clientStartTime = start.Add(time.Duration(round) * period)
+		var wg sync.WaitGroup
+		wg.Add(w.nSenders)
+		for i := 0; i < w.nSenders; i++ {
+			go func(i int) {
+				defer wg.Done()
+				w.send(i, round)
+			}(i)
+		}
+		wg.Wait()
+		if soakDuration <= 0 || time.Since(start)+period > soakDuration {
+			break
+		}
+		logger.V(1).Info("Replaying trace again", "round", round+1, "period", period)
 	}
-	wg.Wait()
 	logger.Info("Trace replay finished")
 }
@@ -0,0 +1,149 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// TopologyConfig describes simulated network delays between nodes.
+// RTTs are symmetric, so either direction may be specified.
+// Lookup order: node pair, zone pair, default.
+type TopologyConfig struct {
+	// node the gateway runs on
+	Gateway string `yaml:"gateway"`
+	// node the control plane runs on
+	ControlPlane string `yaml:"controlPlane"`
+	// node name -> zone
+	Zones              map[string]string             `yaml:"zones"`
+	RTTMilliSec        map[string]map[string]float64 `yaml:"rttMilliSec"`
+	ZoneRTTMilliSec    map[string]map[string]float64 `yaml:"zoneRttMilliSec"`
+	DefaultRTTMilliSec float64                       `yaml:"defaultRttMilliSec"`
+}
+
+// Topology is nil-safe: a nil topology has zero delay everywhere
+type Topology struct {
+	config *TopologyConfig
+}
+
+func NewTopologyFrom(configPath string) (*Topology, error) {
+	if configPath == "" {
+		return nil, nil
+	}
+	configYaml, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology YAML config: %v", err)
+	}
+	config := &TopologyConfig{}
+	if err := yaml.Unmarshal(configYaml, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML config: %v", err)
+	}
+	return NewTopology(config), nil
+}
+
+// Validate rejects negative delays and references to nodes or zones that are not declared
+func (cfg *TopologyConfig) Validate() error {
+	var errs []error
+	zones := make(map[string]bool)
+	for _, zone := range cfg.Zones {
+		zones[zone] = true
+	}
+	for _, node := range []string{cfg.Gateway, cfg.ControlPlane} {
+		if _, ok := cfg.Zones[node]; node != "" && len(cfg.Zones) > 0 && !ok {
+			errs = append(errs, fmt.Errorf("node %q has no zone", node))
+		}
+	}
+	for from, row := range cfg.RTTMilliSec {
+		for to, ms := range row {
+			if ms < 0 {
+				errs = append(errs, fmt.Errorf("negative RTT between nodes %v and %v", from, to))
+			}
+		}
+	}
+	for from, row := range cfg.ZoneRTTMilliSec {
+		for to, ms := range row {
+			if !zones[from] || !zones[to] {
+				errs = append(errs, fmt.Errorf("RTT between undeclared zones %v and %v", from, to))
+			}
+			if ms < 0 {
+				errs = append(errs, fmt.Errorf("negative RTT between zones %v and %v", from, to))
+			}
+		}
+	}
+	if cfg.DefaultRTTMilliSec < 0 {
+		errs = append(errs, fmt.Errorf("defaultRttMilliSec cannot be negative, got %v", cfg.DefaultRTTMilliSec))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func NewTopology(config *TopologyConfig) *Topology {
+	return &Topology{config: config}
+}
+
+func (t *Topology) String() string {
+	if t == nil {
+		return "none"
+	}
+	return fmt.Sprintf("gateway=%v controlPlane=%v nodes=%v zones=%v default=%vms",
+		t.config.Gateway, t.config.ControlPlane, len(t.config.RTTMilliSec), len(t.config.ZoneRTTMilliSec), t.config.DefaultRTTMilliSec)
+}
+
+func (t *Topology) Zone(node string) string {
+	if t == nil {
+		return ""
+	}
+	return t.config.Zones[node]
+}
+
+func (t *Topology) RTT(from, to string) time.Duration {
+	if t == nil || from == "" || to == "" || from == to {
+		return 0
+	}
+	if ms, ok := lookup(t.config.RTTMilliSec, from, to); ok {
+		return milliseconds(ms)
+	}
+	if fromZone, toZone := t.Zone(from), t.Zone(to); fromZone != "" && toZone != "" {
+		if fromZone == toZone {
+			// co-located in the same zone unless specified otherwise
+			if ms, ok := lookup(t.config.ZoneRTTMilliSec, fromZone, toZone); ok {
+				return milliseconds(ms)
+			}
+			return 0
+		}
+		if ms, ok := lookup(t.config.ZoneRTTMilliSec, fromZone, toZone); ok {
+			return milliseconds(ms)
+		}
+	}
+	return milliseconds(t.config.DefaultRTTMilliSec)
+}
+
+// RTT between the gateway and a node
+func (t *Topology) GatewayRTT(node string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.RTT(t.config.Gateway, node)
+}
+
+// RTT between the control plane and a node
+func (t *Topology) ControlPlaneRTT(node string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.RTT(t.config.ControlPlane, node)
+}
+
+func lookup(matrix map[string]map[string]float64, from, to string) (float64, bool) {
+	if ms, ok := matrix[from][to]; ok {
+		return ms, true
+	}
+	ms, ok := matrix[to][from]
+	return ms, ok
+}
+
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
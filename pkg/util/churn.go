@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Churn counts the API object events of a kind
+type Churn struct {
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+	Deleted int64 `json:"deleted"`
+}
+
+// ChurnCounter counts the objects created, updated, and deleted per kind, as observed by informers,
+// to compare the etcd pressure of baselines. Objects existing when the informer syncs are not counted,
+// and updates coalesced by the watch are counted once, so the updates are a lower bound.
+type ChurnCounter struct {
+	selector labels.Selector
+	mu       sync.Mutex
+	counts   map[string]*Churn
+}
+
+func NewChurnCounter(selector labels.Selector) *ChurnCounter {
+	return &ChurnCounter{
+		selector: selector,
+		counts:   make(map[string]*Churn),
+	}
+}
+
+// Watch counts the events of the given kinds, must be called before the cache starts
+func (c *ChurnCounter) Watch(ctx context.Context, informers cache.Informers, objs ...client.Object) error {
+	for _, obj := range objs {
+		kind := reflect.TypeOf(obj).Elem().Name()
+		counts := &Churn{}
+		c.mu.Lock()
+		c.counts[kind] = counts
+		c.mu.Unlock()
+
+		informer, err := informers.GetInformer(ctx, obj)
+		if err != nil {
+			return fmt.Errorf("failed to get %v informer: %v", kind, err)
+		}
+		_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj interface{}, isInInitialList bool) {
+				if !isInInitialList && c.selected(obj) {
+					atomic.AddInt64(&counts.Created, 1)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldMeta, ok1 := oldObj.(metav1.Object)
+				newMeta, ok2 := newObj.(metav1.Object)
+				// skip resyncs
+				if ok1 && ok2 && oldMeta.GetResourceVersion() != newMeta.GetResourceVersion() && c.selected(newObj) {
+					atomic.AddInt64(&counts.Updated, 1)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if c.selected(obj) {
+					atomic.AddInt64(&counts.Deleted, 1)
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch %v: %v", kind, err)
+		}
+	}
+	return nil
+}
+
+func (c *ChurnCounter) selected(obj interface{}) bool {
+	meta, ok := obj.(metav1.Object)
+	return ok && c.selector.Matches(labels.Set(meta.GetLabels()))
+}
+
+// Totals returns the counts per kind
+func (c *ChurnCounter) Totals() map[string]Churn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	totals := make(map[string]Churn, len(c.counts))
+	for kind, counts := range c.counts {
+		totals[kind] = Churn{
+			Created: atomic.LoadInt64(&counts.Created),
+			Updated: atomic.LoadInt64(&counts.Updated),
+			Deleted: atomic.LoadInt64(&counts.Deleted),
+		}
+	}
+	return totals
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// outputs are compressed by the suffix of their path: gzip in process, zstd through the zstd binary,
+// which must be on the PATH; a zstd module is not among the dependencies
+const (
+	GzipSuffix = ".gz"
+	ZstdSuffix = ".zst"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CreateOutput creates the file at path, compressing what is written to it by the suffix of path;
+// Close flushes the compressor and then closes the file
+func CreateOutput(path string) (io.WriteCloser, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(path, GzipSuffix):
+		return &chainedWriter{Writer: gzip.NewWriter(file), closers: []io.Closer{file}}, nil
+	case strings.HasSuffix(path, ZstdSuffix):
+		cmd := exec.Command("zstd", "-q", "-c", "-")
+		cmd.Stdout = file
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to pipe to zstd: %v", err)
+		}
+		if err := cmd.Start(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to start zstd, is it installed? %v", err)
+		}
+		return &chainedWriter{Writer: stdin, closers: []io.Closer{commandCloser{cmd}, file}}, nil
+	default:
+		return file, nil
+	}
+}
+
+// chainedWriter closes the writer if it is a Closer, then the closers in order
+type chainedWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *chainedWriter) Close() error {
+	var errs []error
+	if closer, ok := w.Writer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, closer := range w.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close compressed output: %v", errs)
+	}
+	return nil
+}
+
+// commandCloser waits for the command to exit once its input is closed
+type commandCloser struct {
+	cmd *exec.Cmd
+}
+
+func (c commandCloser) Close() error {
+	return c.cmd.Wait()
+}
+
+// OpenInput opens the file at path, decompressing it if it starts with the gzip or zstd magic,
+// so that readers take plain and compressed logs alike
+func OpenInput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read gzip header of %v: %v", path, err)
+		}
+		return &chainedReader{Reader: gz, closers: []io.Closer{gz, file}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		cmd := exec.Command("zstd", "-q", "-d", "-c", "-")
+		cmd.Stdin = reader
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to pipe from zstd: %v", err)
+		}
+		if err := cmd.Start(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to start zstd, is it installed? %v", err)
+		}
+		// closing the pipe first stops zstd if the input was not read to its end
+		return &chainedReader{Reader: stdout, closers: []io.Closer{stdout, commandCloser{cmd}, file}}, nil
+	default:
+		return &chainedReader{Reader: reader, closers: []io.Closer{file}}, nil
+	}
+}
+
+type chainedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close ignores the errors of the decompressor, which fails if the input was not read to its end
+func (r *chainedReader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if _, ok := closer.(commandCloser); ok {
+			closer.Close()
+			continue
+		}
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const podLabelIndexPrefix = "label:"
+
+func podLabelIndexName(key string) string {
+	return podLabelIndexPrefix + key
+}
+
+// PodLabelIndexers index pods by namespace/value of each given label key
+func PodLabelIndexers(labelKeys ...string) cache.Indexers {
+	indexers := cache.Indexers{}
+	for _, key := range labelKeys {
+		key := key
+		indexers[podLabelIndexName(key)] = func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok {
+				return nil, fmt.Errorf("unexpected object %T", obj)
+			}
+			value, ok := pod.Labels[key]
+			if !ok {
+				return nil, nil
+			}
+			return []string{pod.Namespace + "/" + value}, nil
+		}
+	}
+	return indexers
+}
+
+// IndexedPodLister serves List calls whose selector requires an exact match on an indexed label
+// from the label index, instead of scanning the whole namespace
+type IndexedPodLister struct {
+	corelisters.PodLister
+	indexer   cache.Indexer
+	labelKeys []string
+	indexed   int64
+	scanned   int64
+}
+
+var _ corelisters.PodLister = &IndexedPodLister{}
+
+// NOTE: the indexer must have been set up with PodLabelIndexers for the same label keys
+func NewIndexedPodLister(indexer cache.Indexer, labelKeys ...string) *IndexedPodLister {
+	return &IndexedPodLister{
+		PodLister: corelisters.NewPodLister(indexer),
+		indexer:   indexer,
+		labelKeys: labelKeys,
+	}
+}
+
+// Stats returns the number of namespaced List calls served by the index and by a full scan
+func (l *IndexedPodLister) Stats() (indexed, scanned int64) {
+	return atomic.LoadInt64(&l.indexed), atomic.LoadInt64(&l.scanned)
+}
+
+func (l *IndexedPodLister) Pods(namespace string) corelisters.PodNamespaceLister {
+	return &indexedPodNamespaceLister{
+		PodNamespaceLister: l.PodLister.Pods(namespace),
+		lister:             l,
+		namespace:          namespace,
+	}
+}
+
+type indexedPodNamespaceLister struct {
+	corelisters.PodNamespaceLister
+	lister    *IndexedPodLister
+	namespace string
+}
+
+func (l *indexedPodNamespaceLister) List(selector labels.Selector) ([]*corev1.Pod, error) {
+	for _, key := range l.lister.labelKeys {
+		value, ok := selector.RequiresExactMatch(key)
+		if !ok {
+			continue
+		}
+		objs, err := l.lister.indexer.ByIndex(podLabelIndexName(key), l.namespace+"/"+value)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&l.lister.indexed, 1)
+		pods := make([]*corev1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			pod := obj.(*corev1.Pod)
+			if selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod)
+			}
+		}
+		return pods, nil
+	}
+	atomic.AddInt64(&l.lister.scanned, 1)
+	return l.PodNamespaceLister.List(selector)
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExposeStartAnnotation is stamped by the custom kubelet on a pod when its api server create starts,
+// so benchmarks can split the kubelet queue wait from the create itself
+const ExposeStartAnnotation = "kubedirect/expose-start"
+
+// ExposeStartOf returns the time the create of the pod started, false if not stamped
+func ExposeStartOf(pod *corev1.Pod) (time.Time, bool) {
+	v, ok := pod.Annotations[ExposeStartAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
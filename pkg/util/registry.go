@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry maps names to the factories of one kind of pluggable component, e.g., deciders or dispatchers
+type Registry[F any] struct {
+	kind      string
+	mu        sync.RWMutex
+	factories map[string]F
+}
+
+func NewRegistry[F any](kind string) *Registry[F] {
+	return &Registry[F]{
+		kind:      kind,
+		factories: make(map[string]F),
+	}
+}
+
+// Register makes factory available by name, e.g., from the init of its package;
+// it panics if the name is taken, like the other registries of the standard library
+func (r *Registry[F]) Register(name string, factory F) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		panic(fmt.Sprintf("%s %q registered twice", r.kind, name))
+	}
+	r.factories[name] = factory
+}
+
+// Get returns the factory of name, or an error listing the registered names
+func (r *Registry[F]) Get(name string) (F, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+	if !ok {
+		return factory, fmt.Errorf("unknown %s %q, registered: %v", r.kind, name, strings.Join(r.Names(), ", "))
+	}
+	return factory, nil
+}
+
+func (r *Registry[F]) IsRegistered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Names returns the registered names, sorted
+func (r *Registry[F]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
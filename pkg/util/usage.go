@@ -0,0 +1,135 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// UsageSample is the resource usage of this process at a point in time
+type UsageSample struct {
+	Time time.Time `json:"time"`
+	// cumulative user and system CPU time
+	CPUSeconds float64 `json:"cpuSeconds"`
+	RSSMiB     float64 `json:"rssMiB"`
+	Goroutines int     `json:"goroutines"`
+}
+
+// UsageReport summarizes the samples of a process, so the overhead of the harness can be bounded
+type UsageReport struct {
+	Component string    `json:"component"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// CPU time over the sampled wall time, in cores
+	MeanCores     float64       `json:"meanCores"`
+	PeakCores     float64       `json:"peakCores"`
+	MeanRSSMiB    float64       `json:"meanRssMiB"`
+	PeakRSSMiB    float64       `json:"peakRssMiB"`
+	PeakGoroutine int           `json:"peakGoroutines"`
+	Samples       []UsageSample `json:"samples"`
+}
+
+// UsageSampler periodically samples the CPU, RSS and goroutines of this process
+type UsageSampler struct {
+	component string
+	interval  time.Duration
+	mu        sync.Mutex
+	samples   []UsageSample
+}
+
+func NewUsageSampler(component string, interval time.Duration) *UsageSampler {
+	return &UsageSampler{component: component, interval: interval}
+}
+
+func sampleUsage() (UsageSample, error) {
+	sample := UsageSample{Time: time.Now(), Goroutines: runtime.NumGoroutine()}
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return sample, fmt.Errorf("failed to get rusage: %v", err)
+	}
+	sample.CPUSeconds = time.Duration(usage.Utime.Nano() + usage.Stime.Nano()).Seconds()
+	// the second field of statm is the resident set in pages
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return sample, fmt.Errorf("failed to read statm: %v", err)
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return sample, fmt.Errorf("malformed statm %q", statm)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return sample, fmt.Errorf("malformed statm %q: %v", statm, err)
+	}
+	sample.RSSMiB = float64(pages*int64(os.Getpagesize())) / (1 << 20)
+	return sample, nil
+}
+
+// Run samples until ctx is done
+func (s *UsageSampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if sample, err := sampleUsage(); err == nil {
+			s.mu.Lock()
+			s.samples = append(s.samples, sample)
+			s.mu.Unlock()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *UsageSampler) Report() *UsageReport {
+	s.mu.Lock()
+	samples := append([]UsageSample(nil), s.samples...)
+	s.mu.Unlock()
+	report := &UsageReport{Component: s.component, Samples: samples}
+	if len(samples) == 0 {
+		return report
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	report.Start, report.End = first.Time, last.Time
+	if wall := last.Time.Sub(first.Time).Seconds(); wall > 0 {
+		report.MeanCores = (last.CPUSeconds - first.CPUSeconds) / wall
+	}
+	var totalRSS float64
+	for i, sample := range samples {
+		totalRSS += sample.RSSMiB
+		report.PeakRSSMiB = max(report.PeakRSSMiB, sample.RSSMiB)
+		report.PeakGoroutine = max(report.PeakGoroutine, sample.Goroutines)
+		if i > 0 {
+			if wall := sample.Time.Sub(samples[i-1].Time).Seconds(); wall > 0 {
+				report.PeakCores = max(report.PeakCores, (sample.CPUSeconds-samples[i-1].CPUSeconds)/wall)
+			}
+		}
+	}
+	report.MeanRSSMiB = totalRSS / float64(len(samples))
+	return report
+}
+
+// WriteReport writes the report as JSON, replacing the file atomically so a killed process leaves the last complete one
+func (s *UsageSampler) WriteReport(path string) error {
+	data, err := json.MarshalIndent(s.Report(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage report: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write usage report %v: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write usage report %v: %v", path, err)
+	}
+	return nil
+}
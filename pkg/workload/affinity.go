@@ -0,0 +1,17 @@
+package workload
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// SampleAffinity deterministically assigns a request to one of the sessions of its target by hashing its ID,
+// so repeated runs give the same invocations the same affinity key; empty if sessions is not positive
+func SampleAffinity(id string, sessions int) string {
+	if sessions <= 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return fmt.Sprintf("session-%d", h.Sum32()%uint32(sessions))
+}
@@ -0,0 +1,93 @@
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// BurstSpec describes synchronized bursts: every function is idle until the same instant,
+// then receives its burst within the spread, which stresses the scaling path across keys at once
+type BurstSpec struct {
+	Functions       int
+	DurationMinutes int
+	// when the bursts start, in seconds
+	AtSec float64
+	// invocations per function and their spread, in seconds
+	Size      int
+	SpreadSec float64
+	// per-function random offset of the burst, in seconds, 0 for perfectly synchronized bursts
+	JitterSec       float64
+	RuntimeMilliSec int
+	Seed            int64
+}
+
+func (b *BurstSpec) validate() error {
+	if b.Functions <= 0 || b.Size <= 0 || b.DurationMinutes <= 0 {
+		return fmt.Errorf("functions, size and duration must be positive")
+	}
+	if b.AtSec < 0 || b.SpreadSec < 0 || b.JitterSec < 0 || b.RuntimeMilliSec < 0 {
+		return fmt.Errorf("at, spread, jitter and runtime cannot be negative")
+	}
+	if b.AtSec+b.JitterSec+b.SpreadSec >= float64(b.DurationMinutes*60) {
+		return fmt.Errorf("bursts exceed the trace duration")
+	}
+	return nil
+}
+
+// WriteBurstFixture writes a fixture trace of synchronized bursts to dir, along with the loader config pointing to it,
+// and returns the path of the loader config
+func WriteBurstFixture(b *BurstSpec, dir string) (string, error) {
+	if err := b.validate(); err != nil {
+		return "", fmt.Errorf("invalid burst: %v", err)
+	}
+	rng := rand.New(rand.NewSource(b.Seed))
+	trace := &fixtureTrace{DurationMinutes: b.DurationMinutes}
+	for i := 0; i < b.Functions; i++ {
+		start := b.AtSec + rng.Float64()*b.JitterSec
+		function := &fixtureFunction{Name: fmt.Sprintf("burst-%d", i)}
+		for j := 0; j < b.Size; j++ {
+			offset := 0.
+			if b.Size > 1 {
+				offset = b.SpreadSec * float64(j) / float64(b.Size-1)
+			}
+			function.Invocations = append(function.Invocations, [2]float64{start + offset, float64(b.RuntimeMilliSec)})
+		}
+		trace.Functions = append(trace.Functions, function)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %v: %v", dir, err)
+	}
+	tracePath := filepath.Join(dir, "burst.json")
+	if err := writeJson(tracePath, trace); err != nil {
+		return "", err
+	}
+	loaderPath := filepath.Join(dir, "loader.burst.json")
+	loader := map[string]any{
+		"Seed":               b.Seed,
+		"Platform":           FixturePlatform,
+		"TracePath":          tracePath,
+		"Granularity":        "minute",
+		"ExperimentDuration": b.DurationMinutes,
+		"WarmupDuration":     0,
+	}
+	if err := writeJson(loaderPath, loader); err != nil {
+		return "", err
+	}
+	return loaderPath, nil
+}
+
+func writeJson(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %v: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %v: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package workload
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// request classes
+const (
+	// latency-sensitive, the default
+	ClassInteractive = "interactive"
+	// served opportunistically on spare capacity
+	ClassBatch = "batch"
+)
+
+// all invocations of a trace deployment labeled with a class carry it
+const ClassLabel = "kubedirect/class"
+
+// ClassOf returns the class of a request, the default if untagged
+func ClassOf(req *Request) string {
+	if req == nil || req.Class == "" {
+		return ClassInteractive
+	}
+	return req.Class
+}
+
+// ClassOfObject returns the class label of a trace workload, empty if unlabeled
+func ClassOfObject(obj client.Object) string {
+	return obj.GetLabels()[ClassLabel]
+}
+
+// the invocations of a trace deployment labeled with an integer priority carry it, higher goes first
+const PriorityLabel = "kubedirect/priority"
+
+// PriorityOfObject returns the priority label of a trace workload, 0 if unlabeled or not an integer
+func PriorityOfObject(obj client.Object) int {
+	priority, err := strconv.Atoi(obj.GetLabels()[PriorityLabel])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
+
+// SampleClass deterministically tags a fraction of the requests with the batch class by hashing their IDs,
+// so repeated runs tag the same invocations
+func SampleClass(id string, batchFraction float64) string {
+	if batchFraction <= 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	if float64(h.Sum32())/float64(^uint32(0)) < batchFraction {
+		return ClassBatch
+	}
+	return ""
+}
+
+// SamplePriority deterministically raises a fraction of the requests one above the base priority,
+// hashing their IDs apart from SampleClass so that the two samples are independent
+func SamplePriority(id string, base int, highFraction float64) int {
+	if highFraction <= 0 {
+		return base
+	}
+	h := fnv.New32a()
+	h.Write([]byte("priority/" + id))
+	if float64(h.Sum32())/float64(^uint32(0)) < highFraction {
+		return base + 1
+	}
+	return base
+}
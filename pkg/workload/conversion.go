@@ -37,6 +37,13 @@ import (
 )
 
 func LoadTraceFromConfig(path string) []*TraceSpec {
+	// fast path for the in-repo fixture
+	if specs, ok, err := loadFixtureTraceFromConfig(path); err != nil {
+		klog.Fatalf("Failed to load fixture trace: %v", err)
+	} else if ok {
+		klog.Infof("Found %d functions in fixture trace", len(specs))
+		return specs
+	}
 	functions := LoadDirigentTraceFromConfig(path)
 	specs := make([]*TraceSpec, 0, len(functions))
 	for _, function := range functions {
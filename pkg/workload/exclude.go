@@ -0,0 +1,29 @@
+package workload
+
+import (
+	"sort"
+)
+
+// keys dropped from the run, e.g., targets failing their health check at start
+var excludedKeys map[string]bool
+
+// ExcludeKeys drops the keys from the targets of this process, the same way as keys of other shards.
+// Must be called before the gateway and the client register their targets.
+func ExcludeKeys(keys ...string) {
+	if excludedKeys == nil {
+		excludedKeys = make(map[string]bool)
+	}
+	for _, key := range keys {
+		excludedKeys[key] = true
+	}
+}
+
+// ExcludedKeys returns the excluded keys, sorted
+func ExcludedKeys() []string {
+	keys := make([]string, 0, len(excludedKeys))
+	for key := range excludedKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,127 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResponseRecord is a response parsed back from its Summary line
+type ResponseRecord struct {
+	ID     string
+	Target string
+	// index of the sender within the worker of the target, and of the request within the sender
+	Sender    int
+	Index     int
+	Status    string
+	TraceTime time.Duration
+	// relative to the start of the client
+	ClientSendTime time.Duration
+	// from client send to client receive, negative if not received
+	ResponseTime      time.Duration
+	ActualRuntime     time.Duration
+	RequestedDuration time.Duration
+	// empty for untagged requests
+	Class string
+	// 0 unless prioritized, see Request.Priority
+	Priority int
+	// empty if not dispatched to a pod
+	Endpoint string
+}
+
+var summaryPattern = regexp.MustCompile(`^ID: (\S+)-(\d+)/(\d+), Func: (\S+), Status: (\w+), TS: ([\d.]+)s, CSendReq: ([\d.]+)s, .*CRecvRes: (\S+), Delay: \S+, Runtime: ([\d.]+)/(\d+)ms(?:, Class: (\S+))?(?:, Priority: (-?\d+))?(?:, Endpoint: (\S+))?$`)
+
+// ParseResponseSummary returns false if the line is not a response summary
+func ParseResponseSummary(line string) (*ResponseRecord, bool) {
+	m := summaryPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return nil, false
+	}
+	atoi := func(s string) int {
+		v, _ := strconv.Atoi(s)
+		return v
+	}
+	seconds := func(s string) time.Duration {
+		v, _ := strconv.ParseFloat(s, 64)
+		return time.Duration(v * float64(time.Second))
+	}
+	milliseconds := func(s string) time.Duration {
+		v, _ := strconv.ParseFloat(s, 64)
+		return time.Duration(v * float64(time.Millisecond))
+	}
+	record := &ResponseRecord{
+		ID:                fmt.Sprintf("%s-%s/%s", m[1], m[2], m[3]),
+		Target:            m[4],
+		Sender:            atoi(m[2]),
+		Index:             atoi(m[3]),
+		Status:            m[5],
+		TraceTime:         seconds(m[6]),
+		ClientSendTime:    seconds(m[7]),
+		ResponseTime:      -1,
+		ActualRuntime:     milliseconds(m[9]),
+		RequestedDuration: time.Duration(atoi(m[10])) * time.Millisecond,
+		Class:             m[11],
+		Priority:          atoi(m[12]),
+		Endpoint:          m[13],
+	}
+	if recv := strings.TrimSuffix(strings.TrimPrefix(m[8], "+"), "ms"); recv != "N/A" {
+		record.ResponseTime = milliseconds(recv)
+	}
+	return record, true
+}
+
+// the replay client produces no warm-up records, so every record is in the execution phase
+const invitroExecutionPhase = 2
+
+// InvitroCSVHeader is the execution record schema of the invitro loader used by Dirigent,
+// durations and times are in microseconds
+var InvitroCSVHeader = []string{
+	"phase",
+	"instance",
+	"invocationID",
+	"startTime",
+	"requestedDuration",
+	"responseTime",
+	"actualDuration",
+	"connectionTimeout",
+	"functionTimeout",
+}
+
+// InvitroRow converts the record to a row of InvitroCSVHeader.
+// The instance is named <function>-<sender> with dashes removed from the function name,
+// so that both splitting on "-" and stripping the numeric suffix give back the function, as the Dirigent notebooks do.
+// Invocation IDs are min<minute>.<index>, startTime is relative to the start of the client.
+func (r *ResponseRecord) InvitroRow() []string {
+	name := r.Target
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ReplaceAll(name, "-", "")
+	minute := int(math.Floor(r.TraceTime.Minutes()))
+	responseTime := r.ResponseTime.Microseconds()
+	var connectionTimeout, functionTimeout bool
+	switch r.Status {
+	case SUCCESS.String():
+	case FAIL_DISPATCH.String(), FAIL_CONNECT.String(), INVALID_TARGET.String(), FAIL_OVERFLOW.String():
+		connectionTimeout = true
+	default:
+		functionTimeout = true
+	}
+	if responseTime < 0 {
+		responseTime = 0
+	}
+	return []string{
+		strconv.Itoa(invitroExecutionPhase),
+		fmt.Sprintf("%s-%d", name, r.Sender),
+		fmt.Sprintf("min%d.%d", minute, r.Index),
+		strconv.FormatInt(r.ClientSendTime.Microseconds(), 10),
+		strconv.FormatInt(r.RequestedDuration.Microseconds(), 10),
+		strconv.FormatInt(responseTime, 10),
+		strconv.FormatInt(r.ActualRuntime.Microseconds(), 10),
+		strconv.FormatBool(connectionTimeout),
+		strconv.FormatBool(functionTimeout),
+	}
+}
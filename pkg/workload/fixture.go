@@ -0,0 +1,82 @@
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// FixturePlatform marks a loader config that points to a pre-generated in-repo trace,
+// so that the replay path can run without the Azure dataset or the invitro generator
+const FixturePlatform = "Fixture"
+
+// the subset of the loader config we need to detect a fixture
+type fixtureLoaderConfig struct {
+	Platform  string `json:"Platform"`
+	TracePath string `json:"TracePath"`
+}
+
+type fixtureFunction struct {
+	Name string `json:"name"`
+	// pairs of [arrival time in seconds, runtime in milliseconds]
+	Invocations [][2]float64 `json:"invocations"`
+}
+
+type fixtureTrace struct {
+	DurationMinutes int                `json:"durationMinutes"`
+	Functions       []*fixtureFunction `json:"functions"`
+}
+
+func IsFixtureConfig(path string) bool {
+	configJson, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	cfg := &fixtureLoaderConfig{}
+	return json.Unmarshal(configJson, cfg) == nil && cfg.Platform == FixturePlatform
+}
+
+// returns false if the loader config does not point to a fixture
+func loadFixtureTraceFromConfig(path string) ([]*TraceSpec, bool, error) {
+	configJson, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read loader config %v: %v", path, err)
+	}
+	cfg := &fixtureLoaderConfig{}
+	if err := json.Unmarshal(configJson, cfg); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal loader config %v: %v", path, err)
+	}
+	if cfg.Platform != FixturePlatform {
+		return nil, false, nil
+	}
+	traceJson, err := os.ReadFile(cfg.TracePath)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read fixture trace %v: %v", cfg.TracePath, err)
+	}
+	trace := &fixtureTrace{}
+	if err := json.Unmarshal(traceJson, trace); err != nil {
+		return nil, true, fmt.Errorf("failed to unmarshal fixture trace %v: %v", cfg.TracePath, err)
+	}
+	specs := make([]*TraceSpec, 0, len(trace.Functions))
+	for _, function := range trace.Functions {
+		spec := &TraceSpec{
+			DurationMinutes: trace.DurationMinutes,
+			Invocations:     make([]*InvocationSpec, 0, len(function.Invocations)),
+		}
+		for _, invocation := range function.Invocations {
+			if invocation[0] >= float64(trace.DurationMinutes*60) {
+				return nil, true, fmt.Errorf("invocation of %v at %.3fs exceeds trace duration", function.Name, invocation[0])
+			}
+			spec.Invocations = append(spec.Invocations, &InvocationSpec{
+				ArrivalTimeSec:  invocation[0],
+				RuntimeMilliSec: int(invocation[1]),
+			})
+		}
+		sort.Slice(spec.Invocations, func(i, j int) bool {
+			return spec.Invocations[i].ArrivalTimeSec < spec.Invocations[j].ArrivalTimeSec
+		})
+		specs = append(specs, spec)
+	}
+	return specs, true, nil
+}
@@ -40,18 +40,22 @@ import (
 const WorkloadServicePort = ":80"
 
 type funcServer struct {
-	mode FunctionType
+	mode  FunctionType
+	stats *statsRecorder
 	proto.UnimplementedExecutorServer
 }
 
 func newFuncServer(mode FunctionType) *funcServer {
 	return &funcServer{
-		mode: mode,
+		mode:  mode,
+		stats: newStatsRecorder(),
 	}
 }
 
 func (s *funcServer) Execute(_ context.Context, req *proto.FaasRequest) (*proto.FaasReply, error) {
 	start := time.Now()
+	s.stats.in()
+	defer s.stats.out()
 
 	var msg string
 	if s.mode == TraceFunction {
@@ -85,7 +89,9 @@ func StartGRPCServer() {
 		grpcServer.GracefulStop()
 	}()
 
-	proto.RegisterExecutorServer(grpcServer, newFuncServer(funcType))
+	server := newFuncServer(funcType)
+	go serveStats(server.stats)
+	proto.RegisterExecutorServer(grpcServer, server)
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
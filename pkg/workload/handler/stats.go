@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatsServicePort = ":9091"
+	StatsPath        = "/stats"
+)
+
+// PodStats is the load of a pod since it started, like the metrics Knative's queue-proxy reports.
+// The counters are cumulative, so any number of scrapers can difference two reports on their own
+type PodStats struct {
+	// requests executing now, and all requests received
+	InFlight int64 `json:"inFlight"`
+	Requests int64 `json:"requests"`
+	// the integral of the in-flight requests over time, its change over an interval divided by the interval is
+	// the average concurrency within
+	ConcurrencySeconds float64 `json:"concurrencySeconds"`
+	// when the report was taken, in unix nanoseconds
+	UnixNano int64 `json:"unixNano"`
+}
+
+type statsRecorder struct {
+	mu         sync.Mutex
+	stats      PodStats
+	lastChange time.Time
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{lastChange: time.Now()}
+}
+
+// caller must hold the lock
+func (r *statsRecorder) move(now time.Time) {
+	r.stats.ConcurrencySeconds += float64(r.stats.InFlight) * now.Sub(r.lastChange).Seconds()
+	r.lastChange = now
+}
+
+func (r *statsRecorder) in() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.move(time.Now())
+	r.stats.InFlight++
+	r.stats.Requests++
+}
+
+func (r *statsRecorder) out() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.move(time.Now())
+	r.stats.InFlight--
+}
+
+func (r *statsRecorder) report() PodStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.move(now)
+	stats := r.stats
+	stats.UnixNano = now.UnixNano()
+	return stats
+}
+
+func (r *statsRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.report()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveStats exposes the pod stats on StatsPath until the process exits
+func serveStats(r *statsRecorder) {
+	mux := http.NewServeMux()
+	mux.Handle(StatsPath, r)
+	if err := http.ListenAndServe(StatsServicePort, mux); err != nil {
+		log.Warnf("Failed to serve pod stats: %v", err)
+	}
+}
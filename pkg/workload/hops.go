@@ -0,0 +1,65 @@
+package workload
+
+import (
+	"fmt"
+	"time"
+)
+
+// Hops records where a sampled request spends its time inside the gateway.
+// Requests that are not sampled carry a nil *Hops, and all methods are no-ops on nil.
+type Hops struct {
+	// the dispatcher picked up the request
+	DispatchStart time.Time
+	// an endpoint slot (dispatcher token) was granted
+	TokenAcquired time.Time
+	Endpoint      string
+	// the executor got a connection from its pool
+	ConnAcquired time.Time
+	// a new connection had to be created because the pool was empty
+	NewConn bool
+}
+
+func (h *Hops) Dispatching() {
+	if h != nil {
+		h.DispatchStart = time.Now()
+	}
+}
+
+func (h *Hops) Acquired(endpoint string) {
+	if h != nil {
+		h.TokenAcquired = time.Now()
+		h.Endpoint = endpoint
+	}
+}
+
+func (h *Hops) Connected(newConn bool) {
+	if h != nil {
+		h.ConnAcquired = time.Now()
+		h.NewConn = newConn
+	}
+}
+
+// HopsSummary breaks down the gateway-side latency of a sampled response, relative to GatewayRecvTS of the request
+func (r *Response) HopsSummary() string {
+	req := r.Source
+	hops := req.Hops
+	if hops == nil {
+		return ""
+	}
+	hop := func(from, to time.Time) string {
+		d, ok := elapsed(from, to)
+		if !ok {
+			return "N/A"
+		}
+		return fmt.Sprintf("%.3fms", float64(d.Nanoseconds())/1e6)
+	}
+	return fmt.Sprintf("ID: %v, Func: %v, Status: %v, Endpoint: %v, Relay: %v, TokenWait: %v, PoolWait: %v, NewConn: %v, Send: %v, Exec: %v, Total: %v\n",
+		req.ID, req.Target, r.Status, hops.Endpoint,
+		hop(req.GatewayRecvTS, hops.DispatchStart),
+		hop(hops.DispatchStart, hops.TokenAcquired),
+		hop(hops.TokenAcquired, hops.ConnAcquired),
+		hops.NewConn,
+		hop(hops.ConnAcquired, req.GatewaySendTS),
+		hop(req.GatewaySendTS, r.GatewayRecvTS),
+		hop(req.GatewayRecvTS, r.GatewayRecvTS))
+}
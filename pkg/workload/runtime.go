@@ -0,0 +1,23 @@
+package workload
+
+import (
+	"math"
+)
+
+// ScaleRuntimes rewrites the requested runtime of every invocation in place, for what-if studies on execution duration.
+// A positive fixedMilliSec replaces all runtimes, otherwise they are multiplied by factor.
+// Arrival times are untouched, so the offered load changes with the runtime.
+func ScaleRuntimes(specs []*TraceSpec, factor float64, fixedMilliSec int) {
+	if fixedMilliSec <= 0 && factor == 1 {
+		return
+	}
+	for _, spec := range specs {
+		for _, invocation := range spec.Invocations {
+			if fixedMilliSec > 0 {
+				invocation.RuntimeMilliSec = fixedMilliSec
+			} else {
+				invocation.RuntimeMilliSec = int(math.Round(float64(invocation.RuntimeMilliSec) * factor))
+			}
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -34,18 +35,53 @@ var CtrlListOptions = []client.ListOption{
 
 var MetaV1ListOptions metav1.ListOptions
 
-func IsTraceWorkload(obj metav1.Object) bool {
-	return IsWorkload(obj) && obj.GetLabels()["workload"] == "trace"
+// RunIDLabel scopes the objects of an experiment, so that concurrent experiments on the same cluster
+// only see (and clean up) their own deployments and pods; the config templates put it on both
+// the deployments and their pod templates, so the pods they create (or expose) carry it too
+const RunIDLabel = "kubedirect/run-id"
+
+var runID string
+
+// UseRunID restricts trace workloads to objects labeled with the given run ID.
+// Must be called before any of the trace list options are consumed.
+func UseRunID(id string) error {
+	if errs := validation.IsValidLabelValue(id); len(errs) > 0 {
+		return fmt.Errorf("invalid run ID %q: %v", id, strings.Join(errs, "; "))
+	}
+	runID = id
+	buildListOptions()
+	return nil
 }
 
-var CtrlListOptionsForTrace = []client.ListOption{
-	client.HasLabels{"workload", "app"},
-	client.MatchingLabels{"workload": "trace"},
+func RunID() string {
+	return runID
 }
 
+func IsTraceWorkload(obj metav1.Object) bool {
+	if !IsWorkload(obj) || obj.GetLabels()["workload"] != "trace" {
+		return false
+	}
+	return runID == "" || obj.GetLabels()[RunIDLabel] == runID
+}
+
+var CtrlListOptionsForTrace []client.ListOption
+
+// a canary deployment takes a share of the requests of the trace deployment named by its canary-of label;
+// its workload label differs so it is not replayed as a target of its own, while its pods are trace workloads
+const (
+	CanaryOfLabel  = "kubedirect/canary-of"
+	CanaryWorkload = "trace-canary"
+)
+
+var CtrlListOptionsForCanary []client.ListOption
+
 var MetaV1ListOptionsForTrace metav1.ListOptions
 
 func init() {
+	buildListOptions()
+}
+
+func buildListOptions() {
 	check := func(err error) {
 		if err != nil {
 			panic(err)
@@ -57,14 +93,35 @@ func init() {
 	requireApp, err := labels.NewRequirement("app", selection.Exists, nil)
 	check(err)
 
-	MetaV1ListOptionsForTrace = metav1.ListOptions{
+	MetaV1ListOptions = metav1.ListOptions{
 		LabelSelector: labels.NewSelector().Add(*requireWorkload, *requireApp).String(),
 	}
 
 	requireTraceWorkload, err := labels.NewRequirement("workload", selection.Equals, []string{"trace"})
 	check(err)
+	traceSelector := labels.NewSelector().Add(*requireTraceWorkload, *requireApp)
+	traceLabels := client.MatchingLabels{"workload": "trace"}
+	if runID != "" {
+		requireRunID, err := labels.NewRequirement(RunIDLabel, selection.Equals, []string{runID})
+		check(err)
+		traceSelector = traceSelector.Add(*requireRunID)
+		traceLabels[RunIDLabel] = runID
+	}
 
 	MetaV1ListOptionsForTrace = metav1.ListOptions{
-		LabelSelector: labels.NewSelector().Add(*requireTraceWorkload, *requireApp).String(),
+		LabelSelector: traceSelector.String(),
+	}
+	CtrlListOptionsForTrace = []client.ListOption{
+		client.HasLabels{"workload", "app"},
+		traceLabels,
+	}
+
+	canaryLabels := client.MatchingLabels{"workload": CanaryWorkload}
+	if runID != "" {
+		canaryLabels[RunIDLabel] = runID
+	}
+	CtrlListOptionsForCanary = []client.ListOption{
+		client.HasLabels{"app", CanaryOfLabel},
+		canaryLabels,
 	}
 }
@@ -0,0 +1,97 @@
+package workload
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// default number of points of each shard on the ring, enough for a balanced split of a few thousand keys
+const defaultShardVirtualNodes = 128
+
+// ShardRing partitions keys across shards via consistent hashing,
+// so that changing the number of shards moves only a fraction of the keys
+type ShardRing struct {
+	points []uint64
+	owners map[uint64]int
+	count  int
+}
+
+func NewShardRing(count int, virtualNodes int) *ShardRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultShardVirtualNodes
+	}
+	r := &ShardRing{
+		owners: make(map[uint64]int, count*virtualNodes),
+		count:  count,
+	}
+	for shard := 0; shard < count; shard++ {
+		for v := 0; v < virtualNodes; v++ {
+			point := hashKey(fmt.Sprintf("shard-%d#%d", shard, v))
+			if _, ok := r.owners[point]; ok {
+				// a collision keeps the first owner, the other shard just has one point less
+				continue
+			}
+			r.owners[point] = shard
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// Owner returns the shard of the key, i.e., the first point clockwise from its hash
+func (r *ShardRing) Owner(key string) int {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+var (
+	shardRing  *ShardRing
+	shardIndex int
+)
+
+// UseShard restricts the targets of this process to the keys owned by the shard index out of count shards.
+// All processes must agree on count and virtualNodes (zero for the default) to partition the same targets.
+// Must be called before the gateway and the client register their targets.
+func UseShard(index int, count int, virtualNodes int) error {
+	if count <= 0 {
+		return fmt.Errorf("shard count must be positive, got %d", count)
+	}
+	if index < 0 || index >= count {
+		return fmt.Errorf("shard index must be in [0, %d), got %d", count, index)
+	}
+	if virtualNodes < 0 {
+		return fmt.Errorf("shard virtual nodes must be non-negative, got %d", virtualNodes)
+	}
+	shardRing = NewShardRing(count, virtualNodes)
+	shardIndex = index
+	return nil
+}
+
+// OwnsKey returns true if the key belongs to the shard of this process, always true if unsharded,
+// and is not excluded, see ExcludeKeys
+func OwnsKey(key string) bool {
+	if excludedKeys[key] {
+		return false
+	}
+	return shardRing == nil || shardRing.Owner(key) == shardIndex
+}
+
+// Shard returns the shard index and count of this process, 0 and 1 if unsharded
+func Shard() (index int, count int) {
+	if shardRing == nil {
+		return 0, 1
+	}
+	return shardIndex, shardRing.count
+}
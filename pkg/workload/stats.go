@@ -0,0 +1,125 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type FunctionStats struct {
+	Invocations int
+	// over the whole trace duration
+	AverageRPS float64
+	// max #invocations that arrive within the same second
+	PeakRPS int
+	// runtime distribution in milliseconds
+	RuntimeP50  int
+	RuntimeP90  int
+	RuntimeP99  int
+	RuntimeMax  int
+	RuntimeMean float64
+	// max #invocations in flight, assuming each runs exactly its requested runtime
+	PeakConcurrency int
+	// average #invocations in flight by Little's law
+	AverageConcurrency float64
+}
+
+func (s *FunctionStats) String() string {
+	return fmt.Sprintf("Invocations: %v, RPS: avg=%.2f peak=%v, Runtime(ms): p50=%v p90=%v p99=%v max=%v, Concurrency: avg=%.2f peak=%v",
+		s.Invocations, s.AverageRPS, s.PeakRPS, s.RuntimeP50, s.RuntimeP90, s.RuntimeP99, s.RuntimeMax, s.AverageConcurrency, s.PeakConcurrency)
+}
+
+type TraceStats struct {
+	Functions        []*FunctionStats
+	TotalInvocations int
+	// aggregated across functions
+	PeakRPS         int
+	PeakConcurrency int
+}
+
+func NewTraceStats(specs []*TraceSpec) *TraceStats {
+	stats := &TraceStats{
+		Functions: make([]*FunctionStats, 0, len(specs)),
+	}
+	var all []*InvocationSpec
+	for _, spec := range specs {
+		stats.Functions = append(stats.Functions, NewFunctionStats(spec))
+		stats.TotalInvocations += len(spec.Invocations)
+		all = append(all, spec.Invocations...)
+	}
+	stats.PeakRPS = peakRPS(all)
+	stats.PeakConcurrency = peakConcurrency(all)
+	return stats
+}
+
+func NewFunctionStats(spec *TraceSpec) *FunctionStats {
+	stats := &FunctionStats{
+		Invocations: len(spec.Invocations),
+	}
+	if len(spec.Invocations) == 0 {
+		return stats
+	}
+	runtimes := make([]int, 0, len(spec.Invocations))
+	totalRuntime := 0.
+	for _, invocation := range spec.Invocations {
+		runtimes = append(runtimes, invocation.RuntimeMilliSec)
+		totalRuntime += float64(invocation.RuntimeMilliSec)
+	}
+	sort.Ints(runtimes)
+	percentile := func(p float64) int {
+		return runtimes[int(math.Min(float64(len(runtimes)-1), p*float64(len(runtimes))))]
+	}
+	stats.RuntimeP50 = percentile(0.5)
+	stats.RuntimeP90 = percentile(0.9)
+	stats.RuntimeP99 = percentile(0.99)
+	stats.RuntimeMax = runtimes[len(runtimes)-1]
+	stats.RuntimeMean = totalRuntime / float64(len(runtimes))
+
+	if spec.DurationMinutes > 0 {
+		stats.AverageRPS = float64(len(spec.Invocations)) / float64(spec.DurationMinutes*60)
+	}
+	stats.PeakRPS = peakRPS(spec.Invocations)
+	stats.PeakConcurrency = peakConcurrency(spec.Invocations)
+	stats.AverageConcurrency = stats.AverageRPS * stats.RuntimeMean / 1e3
+	return stats
+}
+
+func peakRPS(invocations []*InvocationSpec) int {
+	bins := make(map[int]int)
+	peak := 0
+	for _, invocation := range invocations {
+		bin := int(invocation.ArrivalTimeSec)
+		bins[bin]++
+		if bins[bin] > peak {
+			peak = bins[bin]
+		}
+	}
+	return peak
+}
+
+func peakConcurrency(invocations []*InvocationSpec) int {
+	type event struct {
+		t     float64
+		delta int
+	}
+	events := make([]event, 0, 2*len(invocations))
+	for _, invocation := range invocations {
+		events = append(events, event{invocation.ArrivalTimeSec, 1})
+		events = append(events, event{invocation.ArrivalTimeSec + float64(invocation.RuntimeMilliSec)/1e3, -1})
+	}
+	// process departures first on ties
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].t == events[j].t {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].t < events[j].t
+	})
+	current, peak := 0, 0
+	for _, ev := range events {
+		current += ev.delta
+		if current > peak {
+			peak = current
+		}
+	}
+	return peak
+}
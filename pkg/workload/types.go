@@ -17,12 +17,24 @@ const (
 	FAIL_SEND
 	FAIL_RECV
 	INVALID_TARGET
+	// shed by the gateway admission control
+	FAIL_OVERFLOW
 )
 
 func (rs ResponseStatus) String() string {
 	return responseStatusReadable[rs]
 }
 
+// ParseResponseStatus is the inverse of String
+func ParseResponseStatus(s string) (ResponseStatus, bool) {
+	for i, name := range responseStatusReadable {
+		if name == s {
+			return ResponseStatus(i), true
+		}
+	}
+	return 0, false
+}
+
 var responseStatusReadable = []string{
 	"SUCCESS",
 	"FAIL_DISPATCH",
@@ -31,6 +43,7 @@ var responseStatusReadable = []string{
 	"FAIL_SEND",
 	"FAIL_RECV",
 	"INVALID_TARGET",
+	"FAIL_OVERFLOW",
 }
 
 type Request struct {
@@ -44,6 +57,14 @@ type Request struct {
 	ClientRelTime time.Duration
 	// Relative to the start of the selected time window
 	TraceRelTime time.Duration
+	// nil unless the request is sampled for per-hop tracing
+	Hops *Hops
+	// empty for the default, latency-sensitive class
+	Class string
+	// requests with the same affinity key prefer the same endpoint, empty if none
+	AffinityKey string
+	// higher goes first when waiting for an endpoint, if the dispatcher honors priorities; 0 by default
+	Priority int
 }
 
 type Response struct {
@@ -52,16 +73,27 @@ type Response struct {
 	GatewayRecvTS   time.Time
 	ClientRecvTS    time.Time
 	RuntimeMicroSec int
+	// the serving endpoint (pod name@ip:port), empty if not dispatched to a pod
+	Endpoint string
+}
+
+// elapsed returns to - from, or false if either stamp is unset.
+// Stamps taken with time.Now() carry a monotonic reading that Sub prefers,
+// so durations are immune to wall clock steps during a run as long as it is not stripped (e.g. by Round(0))
+func elapsed(from, to time.Time) (time.Duration, bool) {
+	if from.IsZero() || to.IsZero() {
+		return 0, false
+	}
+	return to.Sub(from), true
 }
 
 func (r *Response) Summary() string {
 	latency := func(t time.Time) string {
-		base := r.Source.ClientSendTS
-		elapsedMilliseconds := float64(t.Sub(base).Nanoseconds()) / 1e6
-		if elapsedMilliseconds < 0 {
+		d, ok := elapsed(r.Source.ClientSendTS, t)
+		if !ok || d < 0 {
 			return "N/A"
 		}
-		return fmt.Sprintf("+%.3fms", elapsedMilliseconds)
+		return fmt.Sprintf("+%.3fms", float64(d.Nanoseconds())/1e6)
 	}
 	traceTS := fmt.Sprintf("%.3fs", r.Source.TraceRelTime.Seconds())
 	CSendReq := fmt.Sprintf("%.3fs", r.Source.ClientRelTime.Seconds())
@@ -69,9 +101,21 @@ func (r *Response) Summary() string {
 	GsendReq := latency(r.Source.GatewaySendTS)
 	GrecvRes := latency(r.GatewayRecvTS)
 	CRecvRes := latency(r.ClientRecvTS)
+	// Add keeps the monotonic reading
 	delay := latency(r.GatewayRecvTS.Add(-time.Duration(r.RuntimeMicroSec) * time.Microsecond))
-	return fmt.Sprintf("ID: %v, Func: %v, Status: %v, TS: %v, CSendReq: %v, GRecvReq: %v, GSendReq: %v, GRecvRes: %v, CRecvRes: %v, Delay: %v, Runtime: %.3f/%vms\n",
+	summary := fmt.Sprintf("ID: %v, Func: %v, Status: %v, TS: %v, CSendReq: %v, GRecvReq: %v, GSendReq: %v, GRecvRes: %v, CRecvRes: %v, Delay: %v, Runtime: %.3f/%vms",
 		r.Source.ID, r.Source.Target, r.Status, traceTS, CSendReq, GrecvReq, GsendReq, GrecvRes, CRecvRes, delay, float64(r.RuntimeMicroSec)/1000, r.Source.DurationMilliSec)
+	// only tagged requests carry the class, so untagged runs keep the original format
+	if r.Source.Class != "" {
+		summary += fmt.Sprintf(", Class: %v", r.Source.Class)
+	}
+	if r.Source.Priority != 0 {
+		summary += fmt.Sprintf(", Priority: %v", r.Source.Priority)
+	}
+	if r.Endpoint != "" {
+		summary += fmt.Sprintf(", Endpoint: %v", r.Endpoint)
+	}
+	return summary + "\n"
 }
 
 type RequestBuffer = *chann.Chann[*Request]
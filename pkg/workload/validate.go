@@ -0,0 +1,57 @@
+package workload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	// Dirigent
+	"github.com/vhive-serverless/loader/pkg/config"
+)
+
+// ValidateLoaderConfig strictly decodes a loader config and checks the options the replay path relies on.
+// NOTE: relative trace paths are resolved against the working directory
+func ValidateLoaderConfig(path string) error {
+	configJson, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read loader config %v: %v", path, err)
+	}
+	cfg := config.LoaderConfiguration{}
+	decoder := json.NewDecoder(bytes.NewReader(configJson))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return fmt.Errorf("failed to decode loader config %v: %v", path, err)
+	}
+
+	var errs []error
+	if cfg.TracePath == "" {
+		errs = append(errs, fmt.Errorf("TracePath is empty"))
+	} else if _, err := os.Stat(cfg.TracePath); err != nil {
+		errs = append(errs, fmt.Errorf("TracePath %v is not accessible: %v", cfg.TracePath, err))
+	}
+	if cfg.ExperimentDuration <= 0 {
+		errs = append(errs, fmt.Errorf("ExperimentDuration must be positive, got %v", cfg.ExperimentDuration))
+	}
+	if cfg.WarmupDuration < 0 {
+		errs = append(errs, fmt.Errorf("WarmupDuration cannot be negative, got %v", cfg.WarmupDuration))
+	}
+	if cfg.Platform == FixturePlatform {
+		return utilerrors.NewAggregate(errs)
+	}
+	if cfg.Platform != "Dirigent" {
+		errs = append(errs, fmt.Errorf("Platform must be Dirigent or %v, got %q", FixturePlatform, cfg.Platform))
+	}
+	// the Azure trace is only available at minute granularity
+	if cfg.Granularity != "minute" {
+		errs = append(errs, fmt.Errorf("Granularity must be minute for Azure traces, got %q", cfg.Granularity))
+	}
+	switch cfg.IATDistribution {
+	case "exponential", "exponential_shift", "uniform", "uniform_shift", "equidistant":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported IATDistribution %q", cfg.IATDistribution))
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -116,6 +116,16 @@ function clean_kubelet {
     rm -rf $WATCH_DIR
 }
 
+# usage: kubelet.sh usage $dir
+# copy the resource usage reports of the custom kubelets, see -usage-output
+function collect_usage {
+    dir=$1
+    mkdir -p $dir
+    for worker in $(workers); do
+        scp $worker:.kubedirect/kubelet-usage.json $dir/kubelet-$worker.json || true
+    done
+}
+
 case "$1" in
 run)
     # run [watch] [#workers] -- args...
@@ -130,6 +140,11 @@ delegate)
     shift
     delegate_kubelet_service $@
     ;;
+usage)
+    # usage $dir
+    shift
+    collect_usage $@
+    ;;
 test)
     shift
     ;;